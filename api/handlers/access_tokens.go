@@ -0,0 +1,102 @@
+package handlers
+
+import (
+	"database/sql"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"vibecoders/models"
+
+	"github.com/labstack/echo/v4"
+)
+
+type CreateAccessTokenRequest struct {
+	Name          string   `json:"name"`
+	Scopes        []string `json:"scopes"`
+	ExpiresInDays int      `json:"expires_in_days"` // 0 means the token never expires
+}
+
+// GetAccessTokens lists the current user's personal access tokens
+func GetAccessTokens(db *sql.DB) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		userID := CurrentUser(c).ID
+
+		tokens, err := models.GetUserAccessTokens(db, userID)
+		if err != nil {
+			return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Could not fetch tokens"})
+		}
+
+		return c.JSON(http.StatusOK, tokens)
+	}
+}
+
+// CreateAccessToken issues a new personal access token. The token value is
+// only ever shown in this response.
+func CreateAccessToken(db *sql.DB) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		userID := CurrentUser(c).ID
+
+		var req CreateAccessTokenRequest
+		if err := c.Bind(&req); err != nil {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid request"})
+		}
+
+		req.Name = strings.TrimSpace(req.Name)
+		if req.Name == "" {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": "Token name is required"})
+		}
+
+		if len(req.Scopes) == 0 {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": "At least one scope is required"})
+		}
+		for _, scope := range req.Scopes {
+			if !models.IsValidAccessTokenScope(scope) {
+				return c.JSON(http.StatusBadRequest, map[string]string{"error": "Unknown scope: " + scope})
+			}
+		}
+
+		if req.ExpiresInDays < 0 {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": "expires_in_days cannot be negative"})
+		}
+
+		var expiresAt *time.Time
+		if req.ExpiresInDays > 0 {
+			t := time.Now().UTC().AddDate(0, 0, req.ExpiresInDays)
+			expiresAt = &t
+		}
+
+		accessToken, token, err := models.CreateAccessToken(db, userID, req.Name, req.Scopes, expiresAt)
+		if err != nil {
+			return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Could not create token"})
+		}
+
+		return c.JSON(http.StatusCreated, map[string]interface{}{
+			"token":        token,
+			"access_token": accessToken,
+		})
+	}
+}
+
+// RevokeAccessToken revokes one of the current user's personal access tokens
+func RevokeAccessToken(db *sql.DB) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		tokenID, err := strconv.Atoi(c.Param("id"))
+		if err != nil {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid token ID"})
+		}
+
+		userID := CurrentUser(c).ID
+
+		err = models.RevokeAccessToken(db, tokenID, userID)
+		if err != nil {
+			if err == sql.ErrNoRows {
+				return c.JSON(http.StatusNotFound, map[string]string{"error": "Token not found"})
+			}
+			return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Could not revoke token"})
+		}
+
+		return c.JSON(http.StatusOK, map[string]string{"message": "Token revoked successfully"})
+	}
+}
@@ -0,0 +1,80 @@
+package handlers
+
+import (
+	"database/sql"
+	"net/http"
+	"vibecoders/models"
+
+	"github.com/labstack/echo/v4"
+)
+
+// DeleteAccountRequest confirms self-service account deletion with either the
+// password or a two-factor code
+type DeleteAccountRequest struct {
+	Password       string `json:"password"`
+	Code           string `json:"code"`
+	AnonymizeForum bool   `json:"anonymize_forum"` // Keep forum posts and comments under "[deleted]"
+}
+
+// DeleteAccount deletes the current user's own account. Like an admin
+// deletion it is a soft delete that is purged after the grace period; every
+// session and magic link is revoked straight away. Accounts provisioned by an
+// OAuth provider have a random password, so without 2FA their owner sets one
+// through the password reset flow first.
+func DeleteAccount(db *sql.DB) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		user := CurrentUser(c)
+
+		var req DeleteAccountRequest
+		if err := c.Bind(&req); err != nil {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid request"})
+		}
+
+		switch {
+		case req.Password != "":
+			if authErr := checkPassword(c, db, user, req.Password); authErr != nil {
+				return c.JSON(authErr.status, map[string]string{"error": authErr.message})
+			}
+		case req.Code != "":
+			enabled, err := models.IsTwoFactorEnabled(db, user.ID)
+			if err != nil {
+				return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Could not check two-factor status"})
+			}
+			if !enabled {
+				return c.JSON(http.StatusBadRequest, map[string]string{"error": "Two-factor authentication is not enabled, confirm with your password"})
+			}
+			if authErr := checkTwoFactorCode(c, db, user.ID, req.Code); authErr != nil {
+				return c.JSON(authErr.status, map[string]string{"error": authErr.message})
+			}
+		default:
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": "Confirm with your password or a two-factor code"})
+		}
+
+		lastAdmin, err := models.IsLastAdmin(db, user.ID)
+		if err != nil {
+			return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Could not check roles"})
+		}
+		if lastAdmin {
+			return c.JSON(http.StatusConflict, map[string]string{"error": "You are the last administrator, make someone else an administrator first"})
+		}
+
+		// Forum content is anonymized by the purge job, so restoring the
+		// account within the grace period loses nothing
+		purgeAt, err := models.SoftDeleteUser(db, user.ID, req.AnonymizeForum)
+		if err != nil {
+			return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Could not delete account"})
+		}
+
+		recordUserAudit(c, db, models.AuditUserSelfDelete, user, models.AuditChanges{
+			"anonymize_forum": {From: nil, To: req.AnonymizeForum},
+			"purge_at":        {From: nil, To: purgeAt},
+		})
+
+		clearSessionCookie(c)
+
+		return c.JSON(http.StatusOK, map[string]interface{}{
+			"message":  "Your account has been deleted",
+			"purge_at": purgeAt,
+		})
+	}
+}
@@ -16,33 +16,41 @@ type AdminUpdateUserRequest struct {
 	LinkedInURL string `json:"linked_in_url"`
 	GithubURL   string `json:"github_url"`
 	PhotoURL    string `json:"photo_url"`
-	IsAdmin     bool   `json:"is_admin"`
+	IsAdmin     *bool  `json:"is_admin"` // Optional, grants or revokes the admin role
+	Password    string `json:"password"` // Optional, only changed when non-empty
 }
 
-// Check if the current user is an admin
+// Check if the current user may use the admin area, i.e. holds the
+// admin.access permission. Must run after RequireAuth.
 func IsAdmin(db *sql.DB) echo.MiddlewareFunc {
 	return func(next echo.HandlerFunc) echo.HandlerFunc {
 		return func(c echo.Context) error {
-			cookie, err := c.Cookie("session_token")
-			if err != nil {
-				if err == http.ErrNoCookie {
-					return c.JSON(http.StatusUnauthorized, map[string]string{"error": "Not logged in"})
-				}
-				return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Server error"})
+			user := CurrentUser(c)
+			if user == nil {
+				return c.JSON(http.StatusUnauthorized, map[string]string{"error": "Not logged in"})
 			}
 
-			userID, err := models.GetUserIDByToken(db, cookie.Value)
+			allowed, err := models.UserHasPermission(db, user.ID, models.PermAdminAccess)
 			if err != nil {
-				return c.JSON(http.StatusUnauthorized, map[string]string{"error": "Invalid session"})
+				return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Server error"})
+			}
+			if !allowed {
+				return c.JSON(http.StatusForbidden, map[string]string{"error": "Administrator access required"})
 			}
 
-			user, err := models.GetUserByID(db, userID)
+			// Enforce the "2FA required for admins" policy
+			required, err := adminTwoFactorRequired(db, user)
 			if err != nil {
-				return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Could not fetch user"})
+				return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Server error"})
 			}
-
-			if !user.IsAdmin {
-				return c.JSON(http.StatusForbidden, map[string]string{"error": "Administrator access required"})
+			if required {
+				enabled, err := models.IsTwoFactorEnabled(db, user.ID)
+				if err != nil {
+					return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Server error"})
+				}
+				if !enabled {
+					return c.JSON(http.StatusForbidden, map[string]string{"error": "Enable two-factor authentication to use administrator features"})
+				}
 			}
 
 			return next(c)
@@ -50,7 +58,8 @@ func IsAdmin(db *sql.DB) echo.MiddlewareFunc {
 	}
 }
 
-// Get all users with pagination
+// Get all users with pagination. With ?deleted=true lists the deleted users
+// that can still be restored instead.
 func GetAllUsers(db *sql.DB) echo.HandlerFunc {
 	return func(c echo.Context) error {
 		// Parse pagination parameters
@@ -64,14 +73,19 @@ func GetAllUsers(db *sql.DB) echo.HandlerFunc {
 			pageSize = 10 // Default page size
 		}
 
+		getUsers, countUsers := models.GetAllUsers, models.GetTotalUserCount
+		if c.QueryParam("deleted") == "true" {
+			getUsers, countUsers = models.GetDeletedUsers, models.GetDeletedUserCount
+		}
+
 		// Get users for the requested page
-		users, err := models.GetAllUsers(db, page, pageSize)
+		users, err := getUsers(db, page, pageSize)
 		if err != nil {
 			return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Could not fetch users"})
 		}
 
 		// Get total user count for pagination
-		total, err := models.GetTotalUserCount(db)
+		total, err := countUsers(db)
 		if err != nil {
 			return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Could not get user count"})
 		}
@@ -120,7 +134,7 @@ func UpdateUserAsAdmin(db *sql.DB) echo.HandlerFunc {
 		}
 
 		// Check if user exists
-		_, err = models.GetUserByID(db, userID)
+		existing, err := models.GetUserByID(db, userID)
 		if err != nil {
 			if err == sql.ErrNoRows {
 				return c.JSON(http.StatusNotFound, map[string]string{"error": "User not found"})
@@ -133,35 +147,94 @@ func UpdateUserAsAdmin(db *sql.DB) echo.HandlerFunc {
 			return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid request"})
 		}
 
-		// If changing username, check that it's not already taken
-		if req.Username != "" {
-			currentUser, err := models.GetUserByID(db, userID)
+		if req.Password != "" {
+			if msg := validateNewPassword(req.Password, req.Password); msg != "" {
+				return c.JSON(http.StatusBadRequest, map[string]string{"error": msg})
+			}
+		}
+
+		// If changing username, check that it's valid and not already taken
+		if existing.Username != req.Username {
+			if !models.ValidUsername(req.Username) {
+				return c.JSON(http.StatusBadRequest, map[string]string{
+					"error": "Username must be 2 to 39 letters, digits, hyphens or underscores",
+				})
+			}
+
+			taken, err := models.UsernameInUse(db, req.Username, userID)
 			if err != nil {
-				return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Could not fetch user"})
+				return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Database error"})
+			}
+			if taken {
+				return c.JSON(http.StatusConflict, map[string]string{"error": "Username already exists"})
 			}
+		}
 
-			if currentUser.Username != req.Username {
-				// Check if new username is already taken
-				_, err = models.GetUserByUsername(db, req.Username)
-				if err == nil {
-					return c.JSON(http.StatusConflict, map[string]string{"error": "Username already exists"})
-				} else if err != sql.ErrNoRows {
-					return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Database error"})
-				}
+		// Admin status is the admin role, which needs roles.manage to change.
+		// Check it before writing anything so a refused request changes nothing.
+		changeAdmin := req.IsAdmin != nil && *req.IsAdmin != existing.IsAdmin
+		if changeAdmin {
+			allowed, err := models.UserHasPermission(db, CurrentUser(c).ID, models.PermRolesManage)
+			if err != nil {
+				return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Server error"})
+			}
+			if !allowed {
+				return c.JSON(http.StatusForbidden, map[string]string{"error": "Missing permission: " + models.PermRolesManage})
+			}
+			if !*req.IsAdmin && userID == CurrentUser(c).ID {
+				return c.JSON(http.StatusBadRequest, map[string]string{"error": "You cannot remove your own administrator role"})
 			}
 		}
 
 		// Update user with admin privileges
-		err = models.UpdateUserAdmin(db, userID, req.Username, req.Fullname, req.Bio, req.LinkedInURL, req.GithubURL, req.PhotoURL, req.IsAdmin)
+		err = models.UpdateUserAdmin(db, userID, req.Username, req.Fullname, req.Bio, req.LinkedInURL, req.GithubURL, req.PhotoURL)
 		if err != nil {
 			return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Could not update user"})
 		}
 
+		if req.Password != "" {
+			if err := models.SetUserPassword(db, userID, req.Password); err != nil {
+				return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Could not update password"})
+			}
+			if err := models.RevokeUserMagicLinks(db, userID); err != nil {
+				return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Could not revoke magic links"})
+			}
+			if err := models.DeleteUserSessions(db, userID); err != nil {
+				return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Could not revoke sessions"})
+			}
+			if err := models.RevokeUserAccessTokens(db, userID); err != nil {
+				return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Could not revoke access tokens"})
+			}
+		}
+
+		updated, err := models.GetUserByID(db, userID)
+		if err != nil {
+			return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Could not fetch user"})
+		}
+
+		changes := models.DiffFields(userAuditFields(existing), userAuditFields(updated))
+		if req.Password != "" {
+			// Never log the password itself
+			changes["password"] = models.AuditChange{From: nil, To: "(changed)"}
+		}
+		if len(changes) > 0 {
+			recordUserAudit(c, db, models.AuditUserUpdate, updated, changes)
+		}
+
+		// The role change goes last so a failed profile update never leaves
+		// a granted or revoked role behind
+		if changeAdmin {
+			if authErr := changeUserRole(c, db, updated, models.RoleAdmin, *req.IsAdmin); authErr != nil {
+				return c.JSON(authErr.status, map[string]string{"error": authErr.message})
+			}
+		}
+
 		return c.JSON(http.StatusOK, map[string]string{"message": "User updated successfully"})
 	}
 }
 
-// Delete a user
+// Delete a user. The account is soft deleted and can be restored until the
+// grace period ends and the purge job removes it with all of its content.
 func DeleteUser(db *sql.DB) echo.HandlerFunc {
 	return func(c echo.Context) error {
 		userID, err := strconv.Atoi(c.Param("id"))
@@ -169,8 +242,12 @@ func DeleteUser(db *sql.DB) echo.HandlerFunc {
 			return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid user ID"})
 		}
 
+		if userID == CurrentUser(c).ID {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": "You cannot delete your own account here"})
+		}
+
 		// Check if user exists
-		_, err = models.GetUserByID(db, userID)
+		user, err := models.GetUserByID(db, userID)
 		if err != nil {
 			if err == sql.ErrNoRows {
 				return c.JSON(http.StatusNotFound, map[string]string{"error": "User not found"})
@@ -178,12 +255,61 @@ func DeleteUser(db *sql.DB) echo.HandlerFunc {
 			return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Could not fetch user"})
 		}
 
+		if user.Username == models.DeletedUserPlaceholder {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": "The deleted user placeholder cannot be deleted"})
+		}
+
+		lastAdmin, err := models.IsLastAdmin(db, userID)
+		if err != nil {
+			return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Could not check roles"})
+		}
+		if lastAdmin {
+			return c.JSON(http.StatusConflict, map[string]string{"error": "Cannot delete the last administrator"})
+		}
+
 		// Delete user
-		err = models.DeleteUser(db, userID)
+		purgeAt, err := models.SoftDeleteUser(db, userID, false)
 		if err != nil {
 			return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Could not delete user"})
 		}
 
-		return c.JSON(http.StatusOK, map[string]string{"message": "User deleted successfully"})
+		changes := models.DiffFields(userAuditFields(user), nil)
+		changes["purge_at"] = models.AuditChange{From: nil, To: purgeAt}
+		recordUserAudit(c, db, models.AuditUserDelete, user, changes)
+
+		return c.JSON(http.StatusOK, map[string]interface{}{
+			"message":  "User deleted successfully",
+			"purge_at": purgeAt,
+		})
 	}
-}
\ No newline at end of file
+}
+
+// Restore a deleted user whose grace period has not ended
+func RestoreUser(db *sql.DB) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		userID, err := strconv.Atoi(c.Param("id"))
+		if err != nil {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid user ID"})
+		}
+
+		user, err := models.GetDeletedUserByID(db, userID)
+		if err != nil {
+			if err == sql.ErrNoRows {
+				return c.JSON(http.StatusNotFound, map[string]string{"error": "Deleted user not found"})
+			}
+			return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Could not fetch user"})
+		}
+
+		if err := models.RestoreUser(db, userID); err != nil {
+			if err == sql.ErrNoRows {
+				return c.JSON(http.StatusGone, map[string]string{"error": "The grace period has ended, this user can no longer be restored"})
+			}
+			return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Could not restore user"})
+		}
+
+		recordUserAudit(c, db, models.AuditUserRestore, user,
+			models.AuditChanges{"deleted_at": {From: user.DeletedAt, To: nil}})
+
+		return c.JSON(http.StatusOK, map[string]string{"message": "User restored successfully"})
+	}
+}
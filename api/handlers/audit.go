@@ -0,0 +1,222 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/csv"
+	"encoding/json"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+	"vibecoders/models"
+
+	"github.com/labstack/echo/v4"
+)
+
+// auditExportLimit caps how many entries one CSV export may contain
+const auditExportLimit = 50000
+
+// recordAudit appends an entry for an action the current user has just
+// performed. The action has already happened, so a failure to record it is
+// logged rather than reported to the client.
+func recordAudit(c echo.Context, db *sql.DB, action, targetType, targetID, targetLabel string, changes models.AuditChanges) {
+	entry := &models.AuditEntry{
+		Action:      action,
+		TargetType:  targetType,
+		TargetID:    targetID,
+		TargetLabel: targetLabel,
+		Changes:     changes,
+		IPAddress:   c.RealIP(),
+		UserAgent:   c.Request().UserAgent(),
+	}
+
+	if actor := CurrentUser(c); actor != nil {
+		entry.ActorID = &actor.ID
+		entry.ActorUsername = actor.Username
+	}
+
+	// Actions taken while impersonating belong to the administrator
+	if impersonator := Impersonator(c); impersonator != nil {
+		entry.ActorID = &impersonator.ID
+		entry.ActorUsername = impersonator.Username + " as " + CurrentUser(c).Username
+	}
+
+	if err := models.RecordAudit(db, entry); err != nil {
+		log.Printf("Audit: could not record %s on %s %s by %s: %v", action, targetType, targetID, entry.ActorUsername, err)
+	}
+}
+
+// recordUserAudit records an action whose target is a user account
+func recordUserAudit(c echo.Context, db *sql.DB, action string, user *models.User, changes models.AuditChanges) {
+	recordAudit(c, db, action, "user", strconv.Itoa(user.ID), user.Username, changes)
+}
+
+// userAuditFields is the snapshot of a user that update diffs are built from
+func userAuditFields(user *models.User) map[string]interface{} {
+	return map[string]interface{}{
+		"username":      user.Username,
+		"fullname":      user.Fullname,
+		"bio":           user.Bio,
+		"linked_in_url": user.LinkedInURL,
+		"github_url":    user.GithubURL,
+		"photo_url":     user.PhotoURL,
+		"is_admin":      user.IsAdmin,
+	}
+}
+
+// parseAuditTime accepts RFC 3339 timestamps or plain dates
+func parseAuditTime(value string) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+	return time.Parse("2006-01-02", value)
+}
+
+// auditFilterFromQuery reads the filter shared by the list and export endpoints
+func auditFilterFromQuery(c echo.Context, db *sql.DB) (models.AuditFilter, *authError) {
+	filter := models.AuditFilter{
+		Action:     c.QueryParam("action"),
+		TargetType: c.QueryParam("target_type"),
+		TargetID:   c.QueryParam("target_id"),
+	}
+
+	if actor := c.QueryParam("actor"); actor != "" {
+		if id, err := strconv.Atoi(actor); err == nil {
+			filter.ActorID = id
+		} else {
+			user, err := models.GetUserByUsername(db, actor)
+			if err == sql.ErrNoRows {
+				return filter, &authError{http.StatusBadRequest, "Unknown actor: " + actor}
+			}
+			if err != nil {
+				return filter, &authError{http.StatusInternalServerError, "Could not look up actor"}
+			}
+			filter.ActorID = user.ID
+		}
+	}
+
+	if since := c.QueryParam("since"); since != "" {
+		t, err := parseAuditTime(since)
+		if err != nil {
+			return filter, &authError{http.StatusBadRequest, "Invalid since, use YYYY-MM-DD or RFC 3339"}
+		}
+		filter.Since = t
+	}
+
+	if until := c.QueryParam("until"); until != "" {
+		t, err := parseAuditTime(until)
+		if err != nil {
+			return filter, &authError{http.StatusBadRequest, "Invalid until, use YYYY-MM-DD or RFC 3339"}
+		}
+		filter.Until = t
+	}
+
+	return filter, nil
+}
+
+// GetAuditLog lists audit entries, newest first, with pagination and filters
+func GetAuditLog(db *sql.DB) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		page, err := strconv.Atoi(c.QueryParam("page"))
+		if err != nil || page < 1 {
+			page = 1
+		}
+
+		pageSize, err := strconv.Atoi(c.QueryParam("pageSize"))
+		if err != nil || pageSize < 1 || pageSize > 100 {
+			pageSize = 25
+		}
+
+		filter, authErr := auditFilterFromQuery(c, db)
+		if authErr != nil {
+			return c.JSON(authErr.status, map[string]string{"error": authErr.message})
+		}
+
+		entries, err := models.GetAuditEntries(db, filter, page, pageSize)
+		if err != nil {
+			return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Could not fetch audit log"})
+		}
+
+		total, err := models.CountAuditEntries(db, filter)
+		if err != nil {
+			return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Could not count audit entries"})
+		}
+
+		return c.JSON(http.StatusOK, map[string]interface{}{
+			"entries": entries,
+			"pagination": map[string]interface{}{
+				"total":      total,
+				"page":       page,
+				"pageSize":   pageSize,
+				"totalPages": (total + pageSize - 1) / pageSize,
+			},
+		})
+	}
+}
+
+// ExportAuditLog downloads the matching audit entries as CSV
+func ExportAuditLog(db *sql.DB) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		filter, authErr := auditFilterFromQuery(c, db)
+		if authErr != nil {
+			return c.JSON(authErr.status, map[string]string{"error": authErr.message})
+		}
+
+		total, err := models.CountAuditEntries(db, filter)
+		if err != nil {
+			return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Could not count audit entries"})
+		}
+		if total > auditExportLimit {
+			return c.JSON(http.StatusBadRequest, map[string]string{
+				"error": "Too many entries to export, narrow the filter to at most " + strconv.Itoa(auditExportLimit),
+			})
+		}
+
+		entries, err := models.GetAuditEntries(db, filter, 1, 0)
+		if err != nil {
+			return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Could not fetch audit log"})
+		}
+
+		filename := "audit-" + time.Now().UTC().Format("20060102-150405") + ".csv"
+		c.Response().Header().Set(echo.HeaderContentType, "text/csv; charset=utf-8")
+		c.Response().Header().Set(echo.HeaderContentDisposition, `attachment; filename="`+filename+`"`)
+		c.Response().WriteHeader(http.StatusOK)
+
+		w := csv.NewWriter(c.Response())
+		w.Write([]string{"id", "created_at", "actor_id", "actor_username", "action", "target_type",
+			"target_id", "target_label", "changes", "ip_address", "user_agent"})
+
+		for _, entry := range entries {
+			actorID := ""
+			if entry.ActorID != nil {
+				actorID = strconv.Itoa(*entry.ActorID)
+			}
+
+			changes := ""
+			if len(entry.Changes) > 0 {
+				data, err := json.Marshal(entry.Changes)
+				if err != nil {
+					return err
+				}
+				changes = string(data)
+			}
+
+			w.Write([]string{
+				strconv.Itoa(entry.ID),
+				entry.CreatedAt.UTC().Format(time.RFC3339),
+				actorID,
+				models.CSVCell(entry.ActorUsername),
+				models.CSVCell(entry.Action),
+				models.CSVCell(entry.TargetType),
+				models.CSVCell(entry.TargetID),
+				models.CSVCell(entry.TargetLabel),
+				models.CSVCell(changes),
+				models.CSVCell(entry.IPAddress),
+				models.CSVCell(entry.UserAgent),
+			})
+		}
+
+		w.Flush()
+		return w.Error()
+	}
+}
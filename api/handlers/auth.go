@@ -4,7 +4,10 @@ import (
 	"database/sql"
 	"fmt"
 	"net/http"
+	"strconv"
+	"time"
 
+	"vibecoders/mail"
 	"vibecoders/models"
 
 	"github.com/labstack/echo/v4"
@@ -19,6 +22,7 @@ type RegisterRequest struct {
 	Username        string `json:"username"`
 	Password        string `json:"password"`
 	ConfirmPassword string `json:"confirm_password"`
+	Email           string `json:"email"` // Optional, verified by email after registering
 	Bio             string `json:"bio"`
 	LinkedInURL     string `json:"linked_in_url"`
 	GithubURL       string `json:"github_url"`
@@ -39,32 +43,64 @@ func Login(db *sql.DB) echo.HandlerFunc {
 			return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid request"})
 		}
 
+		// Unknown usernames are throttled too, so a 429 reveals nothing
+		userKey := models.UsernameThrottleKey(req.Username)
+		if authErr := loginThrottled(c, db, userKey, models.IPThrottleKey(c.RealIP())); authErr != nil {
+			return c.JSON(authErr.status, map[string]string{"error": authErr.message})
+		}
+
 		user, err := models.GetUserByUsername(db, req.Username)
 		if err != nil {
 			if err == sql.ErrNoRows {
+				recordLoginFailure(c, db, req.Username)
 				return c.JSON(http.StatusUnauthorized, map[string]string{"error": "Invalid credentials"})
 			}
 			return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Database error"})
 		}
 
-		// In a real app, we would use password hashing
-		if user.Password != req.Password {
+		match, needsRehash := models.VerifyPassword(user.Password, req.Password)
+		if !match {
+			recordLoginFailure(c, db, req.Username)
 			return c.JSON(http.StatusUnauthorized, map[string]string{"error": "Invalid credentials"})
 		}
 
-		// Create session
-		token, err := models.CreateSession(db, user.ID)
+		// Upgrade legacy plaintext or outdated hashes now that we know the password
+		if needsRehash {
+			if err := models.SetUserPassword(db, user.ID, req.Password); err != nil {
+				c.Logger().Errorf("could not rehash password for user %d: %v", user.ID, err)
+
+				// A plaintext password that cannot be hashed (bcrypt takes at
+				// most 72 bytes) must not stay in the database, so the account
+				// is locked until its owner resets the password
+				if models.IsLegacyPassword(user.Password) {
+					if err := models.LockUserPassword(db, user.ID); err != nil {
+						return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Could not secure password"})
+					}
+					return c.JSON(http.StatusForbidden, map[string]string{
+						"error": "Your password must be reset before you can log in, use Forgot your password",
+					})
+				}
+			}
+		}
+
+		// Accounts with 2FA get a challenge instead of a session
+		twoFactor, err := models.IsTwoFactorEnabled(db, user.ID)
 		if err != nil {
-			return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Could not create session"})
+			return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Database error"})
+		}
+		// The account's failures are only cleared once the second factor
+		// is also right
+		if twoFactor {
+			return twoFactorChallenge(c, db, user.ID, "")
 		}
 
-		// Set cookie
-		cookie := new(http.Cookie)
-		cookie.Name = "session_token"
-		cookie.Value = token
-		cookie.Path = "/"
-		cookie.HttpOnly = true
-		c.SetCookie(cookie)
+		if _, err := models.ClearLoginThrottle(db, userKey); err != nil {
+			c.Logger().Errorf("could not clear login failures for user %d: %v", user.ID, err)
+		}
+
+		if err := startSession(c, db, user.ID); err != nil {
+			return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Could not create session"})
+		}
 
 		return c.JSON(http.StatusOK, map[string]interface{}{
 			"message": "Login successful",
@@ -91,37 +127,70 @@ func Logout(db *sql.DB) echo.HandlerFunc {
 			return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Could not delete session"})
 		}
 
-		// Clear cookie
-		cookie = new(http.Cookie)
-		cookie.Name = "session_token"
-		cookie.Value = ""
-		cookie.Path = "/"
-		cookie.MaxAge = -1
-		c.SetCookie(cookie)
+		clearSessionCookie(c)
 
 		return c.JSON(http.StatusOK, map[string]string{"message": "Logout successful"})
 	}
 }
 
-func Register(db *sql.DB) echo.HandlerFunc {
+// CurrentUserResponse is the logged-in user's view of their own account
+type CurrentUserResponse struct {
+	*models.User
+	EmailVerified     bool     `json:"email_verified"`
+	TwoFactorEnabled  bool     `json:"two_factor_enabled"`
+	TwoFactorRequired bool     `json:"two_factor_required"` // Site policy requires this user to enable 2FA
+	Roles             []string `json:"roles"`
+	Permissions       []string `json:"permissions"`
+
+	UnreadMessages      int `json:"unread_messages"`
+	UnreadConversations int `json:"unread_conversations"`
+
+	// Set while an administrator is viewing the site as this user
+	Impersonation *ImpersonationStatus `json:"impersonation,omitempty"`
+}
+
+func Register(db *sql.DB, mailer *mail.Mailer) echo.HandlerFunc {
 	return func(c echo.Context) error {
 		var req RegisterRequest
 		if err := c.Bind(&req); err != nil {
 			return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid request"})
 		}
 
-		// Validate passwords match
-		if req.Password != req.ConfirmPassword {
-			return c.JSON(http.StatusBadRequest, map[string]string{"error": "Passwords do not match"})
+		if msg := validateNewPassword(req.Password, req.ConfirmPassword); msg != "" {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": msg})
 		}
 
-		// Check if username already exists
-		_, err := models.GetUserByUsername(db, req.Username)
-		if err == nil {
-			return c.JSON(http.StatusConflict, map[string]string{"error": "Username already exists"})
-		} else if err != sql.ErrNoRows {
+		if !models.ValidUsername(req.Username) {
+			return c.JSON(http.StatusBadRequest, map[string]string{
+				"error": "Username must be 2 to 39 letters, digits, hyphens or underscores",
+			})
+		}
+
+		// Check if username already exists, including deleted accounts that
+		// have not been purged yet
+		taken, err := models.UsernameInUse(db, req.Username, 0)
+		if err != nil {
 			return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Database error"})
 		}
+		if taken {
+			return c.JSON(http.StatusConflict, map[string]string{"error": "Username already exists"})
+		}
+
+		// Validate the optional email address before creating anything
+		email := models.NormalizeEmail(req.Email)
+		if email != "" {
+			if !validEmail(email) {
+				return c.JSON(http.StatusBadRequest, map[string]string{"error": "A valid email address is required"})
+			}
+
+			taken, err := models.EmailInUse(db, email, 0)
+			if err != nil {
+				return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Database error"})
+			}
+			if taken {
+				return c.JSON(http.StatusConflict, map[string]string{"error": "Email address is already in use"})
+			}
+		}
 
 		// Create user
 		err = models.CreateUser(db, req.Username, req.Password, "", req.Bio, req.LinkedInURL, req.GithubURL, req.PhotoURL)
@@ -129,25 +198,28 @@ func Register(db *sql.DB) echo.HandlerFunc {
 			return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Could not create user"})
 		}
 
+		if email != "" {
+			user, err := models.GetUserByUsername(db, req.Username)
+			if err != nil {
+				return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Could not fetch user"})
+			}
+
+			if err := models.SetUserEmail(db, user.ID, email); err != nil {
+				return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Could not save email"})
+			}
+
+			if err := sendEmailVerification(db, mailer, user.ID, user.Username, email); err != nil {
+				c.Logger().Errorf("could not send verification email to user %d: %v", user.ID, err)
+			}
+		}
+
 		return c.JSON(http.StatusCreated, map[string]string{"message": "User registered successfully"})
 	}
 }
 
 func UpdateUser(db *sql.DB) echo.HandlerFunc {
 	return func(c echo.Context) error {
-		// Get user ID from session
-		cookie, err := c.Cookie("session_token")
-		if err != nil {
-			if err == http.ErrNoCookie {
-				return c.JSON(http.StatusUnauthorized, map[string]string{"error": "Not logged in"})
-			}
-			return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Server error"})
-		}
-
-		userID, err := models.GetUserIDByToken(db, cookie.Value)
-		if err != nil {
-			return c.JSON(http.StatusUnauthorized, map[string]string{"error": "Invalid session"})
-		}
+		userID := CurrentUser(c).ID
 
 		var req UpdateUserRequest
 		if err := c.Bind(&req); err != nil {
@@ -155,7 +227,7 @@ func UpdateUser(db *sql.DB) echo.HandlerFunc {
 		}
 
 		// Update user
-		err = models.UpdateUser(db, userID, "", req.Bio, req.LinkedInURL, req.GithubURL, req.PhotoURL)
+		err := models.UpdateUser(db, userID, "", req.Bio, req.LinkedInURL, req.GithubURL, req.PhotoURL)
 		if err != nil {
 			return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Could not update user"})
 		}
@@ -166,7 +238,20 @@ func UpdateUser(db *sql.DB) echo.HandlerFunc {
 
 func GetHomepageUsers(db *sql.DB) echo.HandlerFunc {
 	return func(c echo.Context) error {
-		users, err := models.GetTopUsers(db, 3)
+		window := c.QueryParam("window")
+		if window == "" {
+			window = models.ReputationAll
+		}
+		if !models.ValidReputationWindow(window) {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": "window must be one of week, month, year or all"})
+		}
+
+		limit, err := strconv.Atoi(c.QueryParam("limit"))
+		if err != nil || limit < 1 || limit > 50 {
+			limit = 3 // Default limit
+		}
+
+		users, err := models.GetTopUsers(db, limit, window)
 		if err != nil {
 			return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Could not fetch users"})
 		}
@@ -177,28 +262,63 @@ func GetHomepageUsers(db *sql.DB) echo.HandlerFunc {
 
 func GetCurrentUser(db *sql.DB) echo.HandlerFunc {
 	return func(c echo.Context) error {
-		cookie, err := c.Cookie("session_token")
+		user := CurrentUser(c)
+
+		twoFactor, err := models.IsTwoFactorEnabled(db, user.ID)
 		if err != nil {
-			if err == http.ErrNoCookie {
-				return c.JSON(http.StatusUnauthorized, map[string]string{"error": "Not logged in"})
-			}
-			return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Server error"})
+			return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Could not fetch user"})
+		}
+
+		required, err := adminTwoFactorRequired(db, user)
+		if err != nil {
+			return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Could not fetch user"})
+		}
+
+		roles, err := models.GetUserRoles(db, user.ID)
+		if err != nil {
+			return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Could not fetch user"})
 		}
 
-		userID, err := models.GetUserIDByToken(db, cookie.Value)
+		permissions, err := models.GetUserPermissions(db, user.ID)
 		if err != nil {
-			return c.JSON(http.StatusUnauthorized, map[string]string{"error": "Invalid session"})
+			return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Could not fetch user"})
 		}
 
-		user, err := models.GetUserByID(db, userID)
+		unread, err := models.CountUnreadMessages(db, user.ID)
 		if err != nil {
 			return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Could not fetch user"})
 		}
 
-		return c.JSON(http.StatusOK, user)
+		response := CurrentUserResponse{
+			User:                user,
+			EmailVerified:       user.EmailVerified,
+			TwoFactorEnabled:    twoFactor,
+			TwoFactorRequired:   required,
+			Roles:               roles,
+			Permissions:         permissions,
+			UnreadMessages:      unread.Messages,
+			UnreadConversations: unread.Conversations,
+		}
+
+		if impersonator := Impersonator(c); impersonator != nil {
+			response.Impersonation = &ImpersonationStatus{
+				ImpersonatorID:       impersonator.ID,
+				ImpersonatorUsername: impersonator.Username,
+				ExpiresAt:            CurrentSession(c).ExpiresAt,
+			}
+		}
+
+		return c.JSON(http.StatusOK, response)
 	}
 }
 
+// PublicUserResponse is a user's public profile
+type PublicUserResponse struct {
+	*models.User
+	Skills       []models.UserSkill   `json:"skills"`
+	Availability *models.Availability `json:"availability"`
+}
+
 func GetPublicUserByUsername(db *sql.DB) echo.HandlerFunc {
 	return func(c echo.Context) error {
 		username := c.Param("username")
@@ -216,31 +336,36 @@ func GetPublicUserByUsername(db *sql.DB) echo.HandlerFunc {
 
 		// Remove sensitive information for public profile
 		user.Password = ""
-		
-		return c.JSON(http.StatusOK, user)
+		user.Email = ""
+		user.EmailVerified = false
+
+		skills, err := models.GetUserSkills(db, user.ID)
+		if err != nil {
+			return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Could not fetch user"})
+		}
+
+		availability, err := models.GetAvailability(db, user.ID)
+		if err != nil && err != sql.ErrNoRows {
+			return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Could not fetch user"})
+		}
+
+		return c.JSON(http.StatusOK, PublicUserResponse{User: user, Skills: skills, Availability: availability})
 	}
 }
 
 // Magic link handlers
 type CreateMagicLinkRequest struct {
-	RedirectURL string `json:"redirect_url"`
+	RedirectURL      string `json:"redirect_url"`
+	MaxUses          int    `json:"max_uses"`           // 0 means unlimited
+	ExpiresInMinutes int    `json:"expires_in_minutes"` // 0 means the default of 7 days
 }
 
+// Longest lifetime a magic link may be created with
+const maxMagicLinkTTL = 30 * 24 * time.Hour
+
 func CreateMagicLink(db *sql.DB) echo.HandlerFunc {
 	return func(c echo.Context) error {
-		// Get user ID from session
-		cookie, err := c.Cookie("session_token")
-		if err != nil {
-			if err == http.ErrNoCookie {
-				return c.JSON(http.StatusUnauthorized, map[string]string{"error": "Not logged in"})
-			}
-			return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Server error"})
-		}
-
-		userID, err := models.GetUserIDByToken(db, cookie.Value)
-		if err != nil {
-			return c.JSON(http.StatusUnauthorized, map[string]string{"error": "Invalid session"})
-		}
+		userID := CurrentUser(c).ID
 
 		// Parse request body to get redirect URL
 		var req CreateMagicLinkRequest
@@ -249,8 +374,22 @@ func CreateMagicLink(db *sql.DB) echo.HandlerFunc {
 			req.RedirectURL = "/"
 		}
 
-		// Create magic link with the specified redirect URL
-		magicLink, err := models.CreateMagicLink(db, userID, req.RedirectURL)
+		redirectURL, err := normalizeRedirectURL(req.RedirectURL)
+		if err != nil {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+		}
+
+		if req.MaxUses < 0 {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": "max_uses cannot be negative"})
+		}
+
+		ttl := time.Duration(req.ExpiresInMinutes) * time.Minute
+		if ttl < 0 || ttl > maxMagicLinkTTL {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": "expires_in_minutes must be 0 for the default, or 1 to 43200"})
+		}
+
+		// Create magic link with the specified redirect URL, lifetime and use limit
+		magicLink, err := models.CreateMagicLink(db, userID, redirectURL, ttl, req.MaxUses)
 		if err != nil {
 			return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Could not create magic link"})
 		}
@@ -261,19 +400,7 @@ func CreateMagicLink(db *sql.DB) echo.HandlerFunc {
 
 func GetUserMagicLinks(db *sql.DB) echo.HandlerFunc {
 	return func(c echo.Context) error {
-		// Get user ID from session
-		cookie, err := c.Cookie("session_token")
-		if err != nil {
-			if err == http.ErrNoCookie {
-				return c.JSON(http.StatusUnauthorized, map[string]string{"error": "Not logged in"})
-			}
-			return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Server error"})
-		}
-
-		userID, err := models.GetUserIDByToken(db, cookie.Value)
-		if err != nil {
-			return c.JSON(http.StatusUnauthorized, map[string]string{"error": "Invalid session"})
-		}
+		userID := CurrentUser(c).ID
 
 		// Get user's magic links
 		links, err := models.GetUserMagicLinks(db, userID)
@@ -306,19 +433,7 @@ func DeleteMagicLink(db *sql.DB) echo.HandlerFunc {
 			return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid magic link ID"})
 		}
 
-		// Get user ID from session
-		cookie, err := c.Cookie("session_token")
-		if err != nil {
-			if err == http.ErrNoCookie {
-				return c.JSON(http.StatusUnauthorized, map[string]string{"error": "Not logged in"})
-			}
-			return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Server error"})
-		}
-
-		userID, err := models.GetUserIDByToken(db, cookie.Value)
-		if err != nil {
-			return c.JSON(http.StatusUnauthorized, map[string]string{"error": "Invalid session"})
-		}
+		userID := CurrentUser(c).ID
 
 		// Delete magic link
 		err = models.DeleteMagicLink(db, linkID, userID)
@@ -338,28 +453,40 @@ func LoginWithMagicLink(db *sql.DB) echo.HandlerFunc {
 			return c.JSON(http.StatusBadRequest, map[string]string{"error": "Magic link token is required"})
 		}
 
-		// Validate token
-		magicLink, err := models.GetMagicLinkByToken(db, token)
+		// Guessing tokens is throttled per address
+		if authErr := loginThrottled(c, db, models.IPThrottleKey(c.RealIP())); authErr != nil {
+			return c.JSON(authErr.status, map[string]string{"error": authErr.message})
+		}
+
+		// Validate token and consume one use
+		magicLink, err := models.RedeemMagicLink(db, token, c.RealIP(), c.Request().UserAgent())
 		if err != nil {
 			if err == sql.ErrNoRows {
+				recordLoginFailure(c, db, "")
 				return c.JSON(http.StatusNotFound, map[string]string{"error": "Invalid or expired magic link"})
 			}
 			return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Server error"})
 		}
 
-		// Create session
-		sessionToken, err := models.CreateSession(db, magicLink.UserID)
+		// Re-check the stored target in case it predates validation or the
+		// allowlist has since changed
+		redirectURL, err := normalizeRedirectURL(magicLink.RedirectURL)
 		if err != nil {
-			return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Could not create session"})
+			redirectURL = "/"
+		}
+
+		// A magic link only replaces the password, not the second factor
+		twoFactor, err := models.IsTwoFactorEnabled(db, magicLink.UserID)
+		if err != nil {
+			return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Server error"})
+		}
+		if twoFactor {
+			return twoFactorChallenge(c, db, magicLink.UserID, redirectURL)
 		}
 
-		// Set cookie
-		cookie := new(http.Cookie)
-		cookie.Name = "session_token"
-		cookie.Value = sessionToken
-		cookie.Path = "/"
-		cookie.HttpOnly = true
-		c.SetCookie(cookie)
+		if err := startSession(c, db, magicLink.UserID); err != nil {
+			return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Could not create session"})
+		}
 
 		// Get user info
 		user, err := models.GetUserByID(db, magicLink.UserID)
@@ -373,36 +500,7 @@ func LoginWithMagicLink(db *sql.DB) echo.HandlerFunc {
 				"id":       user.ID,
 				"username": user.Username,
 			},
-			"redirect_url": magicLink.RedirectURL,
+			"redirect_url": redirectURL,
 		})
 	}
 }
-
-// sessionFromContext retrieves the session from the context cookie
-func sessionFromContext(c echo.Context) (*models.Session, error) {
-	cookie, err := c.Cookie("session_token")
-	if err != nil {
-		return nil, err
-	}
-	
-	token := cookie.Value
-	
-	// Since we can't reliably get the DB from the context in all cases,
-	// let's use the GetUserIDByToken function instead
-	var session models.Session
-	
-	// Get the database from the handler closure
-	if db, ok := c.Get("db").(*sql.DB); ok {
-		userID, err := models.GetUserIDByToken(db, token)
-		if err != nil {
-			return nil, err
-		}
-		
-		session.UserID = userID
-		session.Token = token
-		return &session, nil
-	}
-	
-	// If we can't get the DB from context, return an error
-	return nil, fmt.Errorf("database not found in context")
-}
@@ -0,0 +1,96 @@
+package handlers
+
+import (
+	"database/sql"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"vibecoders/models"
+
+	"github.com/labstack/echo/v4"
+)
+
+type AvailabilityRequest struct {
+	Status       string `json:"status"`
+	HourlyRate   *int   `json:"hourly_rate"`
+	RateCurrency string `json:"rate_currency"`
+	Timezone     string `json:"timezone"`
+}
+
+// GetMyAvailability returns the current user's availability, or null if
+// they haven't set one
+func GetMyAvailability(db *sql.DB) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		availability, err := models.GetAvailability(db, CurrentUser(c).ID)
+		if err != nil && err != sql.ErrNoRows {
+			return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Could not fetch availability"})
+		}
+
+		return c.JSON(http.StatusOK, availability)
+	}
+}
+
+// UpdateMyAvailability sets the current user's availability status, rate and
+// timezone
+func UpdateMyAvailability(db *sql.DB) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		var req AvailabilityRequest
+		if err := c.Bind(&req); err != nil {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid request"})
+		}
+
+		if !models.ValidAvailabilityStatus(req.Status) {
+			return c.JSON(http.StatusBadRequest, map[string]string{
+				"error": "status must be one of " + strings.Join(models.AvailabilityStatuses, ", "),
+			})
+		}
+		if req.HourlyRate != nil && (*req.HourlyRate < 0 || *req.HourlyRate > models.MaxHourlyRate) {
+			return c.JSON(http.StatusBadRequest, map[string]string{
+				"error": fmt.Sprintf("hourly_rate must be between 0 and %d", models.MaxHourlyRate),
+			})
+		}
+
+		req.RateCurrency = strings.ToUpper(strings.TrimSpace(req.RateCurrency))
+		if req.RateCurrency == "" {
+			req.RateCurrency = "USD"
+		}
+		if !models.ValidCurrency(req.RateCurrency) {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": "rate_currency must be a three letter currency code"})
+		}
+
+		req.Timezone = strings.TrimSpace(req.Timezone)
+		if req.Timezone != "" && !models.ValidTimezone(req.Timezone) {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": "timezone must be an IANA timezone such as Europe/Berlin"})
+		}
+
+		userID := CurrentUser(c).ID
+		err := models.SetAvailability(db, userID, &models.Availability{
+			Status:       req.Status,
+			HourlyRate:   req.HourlyRate,
+			RateCurrency: req.RateCurrency,
+			Timezone:     req.Timezone,
+		})
+		if err != nil {
+			return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Could not update availability"})
+		}
+
+		availability, err := models.GetAvailability(db, userID)
+		if err != nil {
+			return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Could not fetch availability"})
+		}
+
+		return c.JSON(http.StatusOK, availability)
+	}
+}
+
+// ClearMyAvailability removes the availability from the current user's profile
+func ClearMyAvailability(db *sql.DB) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		if err := models.ClearAvailability(db, CurrentUser(c).ID); err != nil {
+			return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Could not clear availability"})
+		}
+
+		return c.JSON(http.StatusOK, map[string]string{"message": "Availability cleared"})
+	}
+}
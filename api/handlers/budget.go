@@ -26,29 +26,10 @@ type BulkImportRequest struct {
 	Transactions []models.BulkTransaction `json:"transactions"`
 }
 
-// getUserIDFromSession helper function gets the user ID from the session token
-func getUserIDFromSession(c echo.Context, db *sql.DB) (int, error) {
-	cookie, err := c.Cookie("session_token")
-	if err != nil {
-		return 0, err
-	}
-
-	userID, err := models.GetUserIDByToken(db, cookie.Value)
-	if err != nil {
-		return 0, err
-	}
-
-	return userID, nil
-}
-
 // GetBudgetTransactions returns all budget transactions for the authenticated user
 func GetBudgetTransactions(db *sql.DB) echo.HandlerFunc {
 	return func(c echo.Context) error {
-		// Get user ID from session
-		userID, err := getUserIDFromSession(c, db)
-		if err != nil {
-			return c.JSON(http.StatusUnauthorized, map[string]string{"error": "Unauthorized"})
-		}
+		userID := CurrentUser(c).ID
 
 		// Get transactions
 		transactions, err := models.GetBudgetTransactions(db, userID)
@@ -63,11 +44,7 @@ func GetBudgetTransactions(db *sql.DB) echo.HandlerFunc {
 // GetBudgetCategories returns all budget categories for the authenticated user
 func GetBudgetCategories(db *sql.DB) echo.HandlerFunc {
 	return func(c echo.Context) error {
-		// Get user ID from session
-		userID, err := getUserIDFromSession(c, db)
-		if err != nil {
-			return c.JSON(http.StatusUnauthorized, map[string]string{"error": "Unauthorized"})
-		}
+		userID := CurrentUser(c).ID
 
 		// Get categories
 		categories, err := models.GetBudgetCategories(db, userID)
@@ -82,11 +59,7 @@ func GetBudgetCategories(db *sql.DB) echo.HandlerFunc {
 // UpdateTransactionCategory updates the category for a transaction
 func UpdateTransactionCategory(db *sql.DB) echo.HandlerFunc {
 	return func(c echo.Context) error {
-		// Get user ID from session
-		userID, err := getUserIDFromSession(c, db)
-		if err != nil {
-			return c.JSON(http.StatusUnauthorized, map[string]string{"error": "Unauthorized"})
-		}
+		userID := CurrentUser(c).ID
 
 		// Parse request
 		var req UpdateCategoryRequest
@@ -102,7 +75,7 @@ func UpdateTransactionCategory(db *sql.DB) echo.HandlerFunc {
 			categoryID = *req.CategoryID
 		}
 		
-		err = models.UpdateTransactionCategory(db, req.TransactionID, categoryID, userID)
+		err := models.UpdateTransactionCategory(db, req.TransactionID, categoryID, userID)
 		if err != nil {
 			return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to update category"})
 		}
@@ -114,11 +87,7 @@ func UpdateTransactionCategory(db *sql.DB) echo.HandlerFunc {
 // CreateBudgetCategory creates a new budget category
 func CreateBudgetCategory(db *sql.DB) echo.HandlerFunc {
 	return func(c echo.Context) error {
-		// Get user ID from session
-		userID, err := getUserIDFromSession(c, db)
-		if err != nil {
-			return c.JSON(http.StatusUnauthorized, map[string]string{"error": "Unauthorized"})
-		}
+		userID := CurrentUser(c).ID
 
 		// Parse request
 		var req NewCategoryRequest
@@ -155,11 +124,7 @@ func CreateBudgetCategory(db *sql.DB) echo.HandlerFunc {
 // EditBudgetCategory updates an existing budget category
 func EditBudgetCategory(db *sql.DB) echo.HandlerFunc {
 	return func(c echo.Context) error {
-		// Get user ID from session
-		userID, err := getUserIDFromSession(c, db)
-		if err != nil {
-			return c.JSON(http.StatusUnauthorized, map[string]string{"error": "Unauthorized"})
-		}
+		userID := CurrentUser(c).ID
 
 		// Parse request
 		var req EditCategoryRequest
@@ -173,7 +138,7 @@ func EditBudgetCategory(db *sql.DB) echo.HandlerFunc {
 		}
 
 		// Update category
-		err = models.UpdateBudgetCategory(db, req.CategoryID, userID, req.Name)
+		err := models.UpdateBudgetCategory(db, req.CategoryID, userID, req.Name)
 		if err != nil {
 			if err == sql.ErrNoRows {
 				return c.JSON(http.StatusNotFound, map[string]string{"error": "Category not found or doesn't belong to user"})
@@ -199,11 +164,7 @@ func EditBudgetCategory(db *sql.DB) echo.HandlerFunc {
 // BulkImportTransactions imports multiple transactions at once
 func BulkImportTransactions(db *sql.DB) echo.HandlerFunc {
 	return func(c echo.Context) error {
-		// Get user ID from session
-		userID, err := getUserIDFromSession(c, db)
-		if err != nil {
-			return c.JSON(http.StatusUnauthorized, map[string]string{"error": "Unauthorized"})
-		}
+		userID := CurrentUser(c).ID
 
 		// Parse request
 		var req BulkImportRequest
@@ -0,0 +1,30 @@
+package handlers
+
+import (
+	"net/url"
+	"strings"
+)
+
+// BaseURL is the public origin of the site, used to build links in emails.
+// Set from the BASE_URL environment variable in main.
+var BaseURL = "http://localhost:8080"
+
+// absoluteURL joins a site path onto BaseURL
+func absoluteURL(path string) string {
+	return strings.TrimRight(BaseURL, "/") + path
+}
+
+// secureCookies reports whether cookies should be marked Secure, which is the
+// case whenever the site is served over HTTPS
+func secureCookies() bool {
+	return strings.HasPrefix(BaseURL, "https://")
+}
+
+// siteOrigin returns the scheme and host of BaseURL, e.g. "https://vibecoders.com"
+func siteOrigin() string {
+	u, err := url.Parse(BaseURL)
+	if err != nil || u.Host == "" {
+		return strings.TrimRight(BaseURL, "/")
+	}
+	return u.Scheme + "://" + u.Host
+}
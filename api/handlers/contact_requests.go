@@ -0,0 +1,281 @@
+package handlers
+
+import (
+	"database/sql"
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"vibecoders/mail"
+	"vibecoders/models"
+
+	"github.com/labstack/echo/v4"
+)
+
+type ContactRequestRequest struct {
+	Message string `json:"message"`
+}
+
+type RespondContactRequest struct {
+	Note string `json:"note"`
+}
+
+// maxContactNoteLength bounds the note a recipient can add when accepting
+const maxContactNoteLength = 500
+
+// SendContactRequest sends a message to the owner of a profile. The sender
+// needs a verified email address, since it is shared if the request is
+// accepted, and the recipient must not have marked themselves not looking
+// or blocked the sender.
+func SendContactRequest(db *sql.DB, mailer *mail.Mailer) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		sender := CurrentUser(c)
+
+		recipient, err := models.GetUserByUsername(db, c.Param("username"))
+		if err == sql.ErrNoRows || (err == nil && recipient.Username == models.DeletedUserPlaceholder) {
+			return c.JSON(http.StatusNotFound, map[string]string{"error": "User not found"})
+		}
+		if err != nil {
+			return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Could not fetch user"})
+		}
+		if recipient.ID == sender.ID {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": "You cannot contact yourself"})
+		}
+
+		if !sender.EmailVerified {
+			return c.JSON(http.StatusForbidden, map[string]string{"error": "Verify your email address before contacting people"})
+		}
+
+		blocked, err := models.IsBlockedBetween(db, sender.ID, recipient.ID)
+		if err != nil {
+			return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Could not fetch user"})
+		}
+		if blocked {
+			return c.JSON(http.StatusForbidden, map[string]string{"error": "This user is not accepting contact requests"})
+		}
+
+		availability, err := models.GetAvailability(db, recipient.ID)
+		if err != nil && err != sql.ErrNoRows {
+			return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Could not fetch user"})
+		}
+		if availability != nil && availability.Status == models.AvailabilityNotLooking {
+			return c.JSON(http.StatusForbidden, map[string]string{"error": "This user is not accepting contact requests"})
+		}
+
+		var req ContactRequestRequest
+		if err := c.Bind(&req); err != nil {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid request"})
+		}
+		req.Message = strings.TrimSpace(req.Message)
+		if len(req.Message) < models.ContactRequestMinLength || len(req.Message) > models.ContactRequestMaxLength {
+			return c.JSON(http.StatusBadRequest, map[string]string{
+				"error": fmt.Sprintf("Message must be %d to %d characters", models.ContactRequestMinLength, models.ContactRequestMaxLength),
+			})
+		}
+
+		id, err := models.CreateContactRequest(db, sender.ID, recipient.ID, req.Message)
+		switch err {
+		case nil:
+		case models.ErrContactRequestPending:
+			return c.JSON(http.StatusConflict, map[string]string{"error": "You already have a pending request to this user"})
+		case models.ErrContactRequestCooldown:
+			return c.JSON(http.StatusConflict, map[string]string{"error": "This user declined your recent request"})
+		case models.ErrContactRequestOpen:
+			return c.JSON(http.StatusTooManyRequests, map[string]string{
+				"error": "Too many unanswered contact requests, wait for some replies first",
+			})
+		case models.ErrContactRequestDaily:
+			if wait, err := models.ContactRequestRetryAfter(db, sender.ID); err == nil {
+				c.Response().Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+			}
+			return c.JSON(http.StatusTooManyRequests, map[string]string{"error": "Too many contact requests today, try again later"})
+		default:
+			return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Could not send contact request"})
+		}
+
+		if recipient.EmailVerified {
+			err := mailer.Enqueue(recipient.Email, sender.Username+" wants to get in touch", "notification", map[string]interface{}{
+				"Heading":    sender.Username + " wants to get in touch",
+				"Body":       req.Message,
+				"ActionURL":  absoluteURL("/profile"),
+				"ActionText": "Accept or decline",
+			})
+			if err != nil {
+				c.Logger().Errorf("could not queue contact request email for user %d: %v", recipient.ID, err)
+			}
+		}
+
+		request, err := models.GetContactRequest(db, id, sender.ID)
+		if err != nil {
+			return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Could not fetch contact request"})
+		}
+
+		return c.JSON(http.StatusCreated, request)
+	}
+}
+
+// listContactRequests serves the inbox (received) or sent requests, with an
+// optional ?status= filter
+func listContactRequests(db *sql.DB, sent bool) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		userID := CurrentUser(c).ID
+
+		status := c.QueryParam("status")
+		switch status {
+		case "", models.ContactRequestPending, models.ContactRequestAccepted, models.ContactRequestDeclined:
+		default:
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": "status must be pending, accepted or declined"})
+		}
+
+		page, err := strconv.Atoi(c.QueryParam("page"))
+		if err != nil || page < 1 {
+			page = 1
+		}
+
+		pageSize, err := strconv.Atoi(c.QueryParam("pageSize"))
+		if err != nil || pageSize < 1 || pageSize > 100 {
+			pageSize = 20 // Default page size
+		}
+
+		requests, err := models.GetContactRequests(db, userID, sent, status, page, pageSize)
+		if err != nil {
+			return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Could not fetch contact requests"})
+		}
+
+		total, err := models.CountContactRequests(db, userID, sent, status)
+		if err != nil {
+			return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Could not fetch contact requests"})
+		}
+
+		pending, err := models.CountContactRequests(db, userID, sent, models.ContactRequestPending)
+		if err != nil {
+			return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Could not fetch contact requests"})
+		}
+
+		return c.JSON(http.StatusOK, map[string]interface{}{
+			"requests": requests,
+			"pending":  pending,
+			"pagination": map[string]interface{}{
+				"total":      total,
+				"page":       page,
+				"pageSize":   pageSize,
+				"totalPages": (total + pageSize - 1) / pageSize,
+			},
+		})
+	}
+}
+
+// GetContactInbox lists the contact requests the current user received
+func GetContactInbox(db *sql.DB) echo.HandlerFunc {
+	return listContactRequests(db, false)
+}
+
+// GetSentContactRequests lists the contact requests the current user sent
+func GetSentContactRequests(db *sql.DB) echo.HandlerFunc {
+	return listContactRequests(db, true)
+}
+
+// contactRequestFromParam loads the request in the :id path parameter if the
+// current user sent or received it
+func contactRequestFromParam(c echo.Context, db *sql.DB) (*models.ContactRequest, *authError) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		return nil, &authError{http.StatusBadRequest, "Invalid contact request ID"}
+	}
+
+	userID := CurrentUser(c).ID
+	request, err := models.GetContactRequest(db, id, userID)
+	if err == sql.ErrNoRows || (err == nil && !request.IsParticipant(userID)) {
+		return nil, &authError{http.StatusNotFound, "Contact request not found"}
+	}
+	if err != nil {
+		return nil, &authError{http.StatusInternalServerError, "Could not fetch contact request"}
+	}
+
+	return request, nil
+}
+
+// GetContactRequest returns a single request the current user sent or received
+func GetContactRequest(db *sql.DB) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		request, authErr := contactRequestFromParam(c, db)
+		if authErr != nil {
+			return c.JSON(authErr.status, map[string]string{"error": authErr.message})
+		}
+
+		return c.JSON(http.StatusOK, request)
+	}
+}
+
+// respondToContactRequest accepts or declines a request sent to the current
+// user. Accepting shares both sides' contact details and lets the sender know.
+func respondToContactRequest(db *sql.DB, mailer *mail.Mailer, status string) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		request, authErr := contactRequestFromParam(c, db)
+		if authErr != nil {
+			return c.JSON(authErr.status, map[string]string{"error": authErr.message})
+		}
+
+		user := CurrentUser(c)
+		if request.Recipient.ID != user.ID {
+			return c.JSON(http.StatusForbidden, map[string]string{"error": "Only the recipient can answer a contact request"})
+		}
+
+		var req RespondContactRequest
+		if err := c.Bind(&req); err != nil {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid request"})
+		}
+		req.Note = strings.TrimSpace(req.Note)
+		if status != models.ContactRequestAccepted {
+			req.Note = ""
+		}
+		if len(req.Note) > maxContactNoteLength {
+			return c.JSON(http.StatusBadRequest, map[string]string{
+				"error": fmt.Sprintf("Note must be at most %d characters", maxContactNoteLength),
+			})
+		}
+
+		err := models.RespondToContactRequest(db, request.ID, user.ID, status, req.Note)
+		if err == models.ErrContactRequestResponded {
+			return c.JSON(http.StatusConflict, map[string]string{"error": "This contact request was already answered"})
+		}
+		if err != nil {
+			return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Could not update contact request"})
+		}
+
+		request, err = models.GetContactRequest(db, request.ID, user.ID)
+		if err != nil {
+			return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Could not fetch contact request"})
+		}
+
+		if status == models.ContactRequestAccepted {
+			sender, err := models.GetUserByID(db, request.Sender.ID)
+			if err == nil && sender.EmailVerified {
+				err = mailer.Enqueue(sender.Email, user.Username+" accepted your contact request", "notification", map[string]interface{}{
+					"Heading":    user.Username + " accepted your contact request",
+					"Body":       "You can now see their contact details.",
+					"ActionURL":  absoluteURL("/profile"),
+					"ActionText": "View contact details",
+				})
+			}
+			if err != nil {
+				c.Logger().Errorf("could not queue contact accepted email for user %d: %v", request.Sender.ID, err)
+			}
+		}
+
+		return c.JSON(http.StatusOK, request)
+	}
+}
+
+// AcceptContactRequest accepts a request, optionally with a note for the sender
+func AcceptContactRequest(db *sql.DB, mailer *mail.Mailer) echo.HandlerFunc {
+	return respondToContactRequest(db, mailer, models.ContactRequestAccepted)
+}
+
+// DeclineContactRequest declines a request. The sender can't contact the
+// same person again for a while.
+func DeclineContactRequest(db *sql.DB, mailer *mail.Mailer) echo.HandlerFunc {
+	return respondToContactRequest(db, mailer, models.ContactRequestDeclined)
+}
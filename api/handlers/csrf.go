@@ -0,0 +1,113 @@
+package handlers
+
+import (
+	"crypto/subtle"
+	"database/sql"
+	"net/http"
+	"strings"
+	"time"
+
+	"vibecoders/models"
+
+	"github.com/labstack/echo/v4"
+)
+
+const (
+	// csrfCookieName holds the session's CSRF token where the frontend can
+	// read it; it is deliberately not HttpOnly
+	csrfCookieName = "csrf_token"
+
+	// CSRFHeader is the header state-changing requests echo the token in
+	CSRFHeader = "X-CSRF-Token"
+)
+
+// AllowedOrigins lists extra origins, besides BaseURL, that may call the API
+// from a browser with credentials. Set from CORS_ALLOWED_ORIGINS in main.
+var AllowedOrigins []string
+
+func setCSRFCookie(c echo.Context, token string) {
+	cookie := new(http.Cookie)
+	cookie.Name = csrfCookieName
+	cookie.Value = token
+	cookie.Path = "/"
+	cookie.Secure = secureCookies()
+	cookie.SameSite = http.SameSiteLaxMode
+	cookie.MaxAge = int(models.SessionMaxAge / time.Second)
+	c.SetCookie(cookie)
+}
+
+func clearCSRFCookie(c echo.Context) {
+	cookie := new(http.Cookie)
+	cookie.Name = csrfCookieName
+	cookie.Value = ""
+	cookie.Path = "/"
+	cookie.MaxAge = -1
+	c.SetCookie(cookie)
+}
+
+// CORSOrigins returns every origin allowed to make credentialed requests
+func CORSOrigins() []string {
+	return append([]string{siteOrigin()}, AllowedOrigins...)
+}
+
+// allowedOrigin reports whether the request's Origin header, if any, is this
+// site or one of the allowed origins
+func allowedOrigin(c echo.Context) bool {
+	origin := c.Request().Header.Get(echo.HeaderOrigin)
+	if origin == "" {
+		// Not sent by a browser, or a same-origin request from an old one
+		return true
+	}
+
+	if origin == c.Scheme()+"://"+c.Request().Host {
+		return true
+	}
+	for _, allowed := range CORSOrigins() {
+		if strings.EqualFold(origin, allowed) {
+			return true
+		}
+	}
+	return false
+}
+
+// CSRFProtect checks state-changing requests. Requests authenticated by the
+// session cookie must send the session's CSRF token in the X-CSRF-Token
+// header. Requests without a session, like logging in, must not come from a
+// foreign origin. Bearer token requests carry no ambient credentials and are
+// not checked. Must run after OptionalAuth.
+func CSRFProtect(db *sql.DB) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			session := CurrentSession(c)
+
+			// Keep the readable cookie in step with the session's token
+			if session != nil {
+				if err := models.EnsureSessionCSRFToken(db, session); err != nil {
+					return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Server error"})
+				}
+				if cookie, err := c.Cookie(csrfCookieName); err != nil || cookie.Value != session.CSRFToken {
+					setCSRFCookie(c, session.CSRFToken)
+				}
+			}
+
+			switch c.Request().Method {
+			case http.MethodGet, http.MethodHead, http.MethodOptions:
+				return next(c)
+			}
+
+			if session != nil {
+				token := c.Request().Header.Get(CSRFHeader)
+				if token == "" || subtle.ConstantTimeCompare([]byte(token), []byte(session.CSRFToken)) != 1 {
+					return c.JSON(http.StatusForbidden, map[string]string{"error": "Missing or invalid CSRF token"})
+				}
+				return next(c)
+			}
+
+			if CurrentAccessToken(c) == nil && !allowedOrigin(c) {
+				return c.JSON(http.StatusForbidden, map[string]string{"error": "Cross-origin request blocked"})
+			}
+
+			return next(c)
+		}
+	}
+}
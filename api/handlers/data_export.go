@@ -0,0 +1,122 @@
+package handlers
+
+import (
+	"database/sql"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+	"vibecoders/models"
+
+	"github.com/labstack/echo/v4"
+)
+
+// dataExportLimiter caps how many exports a user can request per hour
+var dataExportLimiter = newRateLimiter(5, time.Hour)
+
+// dataExportResponse describes an export job and where to fetch it
+func dataExportResponse(export *models.DataExport) map[string]interface{} {
+	response := map[string]interface{}{
+		"export":     export,
+		"status_url": "/api/user/export/" + strconv.Itoa(export.ID),
+	}
+	if export.Status == models.DataExportReady {
+		response["download_url"] = "/api/user/export/" + strconv.Itoa(export.ID) + "/download"
+	}
+	return response
+}
+
+// ExportUserData downloads a ZIP of everything tied to the current account.
+// Small accounts get the archive straight away; large ones (or ?async=true)
+// get 202 and a status URL to poll while it is generated in the background.
+func ExportUserData(db *sql.DB) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		user := CurrentUser(c)
+
+		if !dataExportLimiter.Allow(strconv.Itoa(user.ID)) {
+			c.Response().Header().Set("Retry-After", "3600")
+			return c.JSON(http.StatusTooManyRequests, map[string]string{"error": "Too many exports, try again later"})
+		}
+
+		async := c.QueryParam("async") == "true"
+		if !async {
+			rows, err := models.CountUserExportRows(db, user.ID)
+			if err != nil {
+				return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Could not prepare export"})
+			}
+			async = rows > models.DataExportSyncLimit
+		}
+
+		if async {
+			export, err := models.CreateDataExport(db, user.ID)
+			if err != nil {
+				return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Could not start export"})
+			}
+
+			// The context is recycled once the handler returns, so the
+			// goroutine must not touch it
+			go func(id int) {
+				if err := models.RunDataExport(db, id); err != nil {
+					log.Printf("Data export %d failed: %v", id, err)
+				}
+			}(export.ID)
+
+			return c.JSON(http.StatusAccepted, dataExportResponse(export))
+		}
+
+		archive, err := models.BuildUserExport(db, user.ID)
+		if err != nil {
+			c.Logger().Errorf("data export for user %d failed: %v", user.ID, err)
+			return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Could not generate export"})
+		}
+
+		return sendDataExport(c, user.Username, archive)
+	}
+}
+
+// GetDataExportStatus reports the progress of a background export
+func GetDataExportStatus(db *sql.DB) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		id, err := strconv.Atoi(c.Param("id"))
+		if err != nil {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid export ID"})
+		}
+
+		export, err := models.GetDataExport(db, id, CurrentUser(c).ID)
+		if err != nil {
+			if err == sql.ErrNoRows {
+				return c.JSON(http.StatusNotFound, map[string]string{"error": "Export not found"})
+			}
+			return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Could not fetch export"})
+		}
+
+		return c.JSON(http.StatusOK, dataExportResponse(export))
+	}
+}
+
+// DownloadDataExport serves the archive of a finished background export
+func DownloadDataExport(db *sql.DB) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		id, err := strconv.Atoi(c.Param("id"))
+		if err != nil {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid export ID"})
+		}
+
+		user := CurrentUser(c)
+		archive, err := models.GetDataExportArchive(db, id, user.ID)
+		if err != nil {
+			if err == sql.ErrNoRows {
+				return c.JSON(http.StatusNotFound, map[string]string{"error": "Export not found or not ready"})
+			}
+			return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Could not fetch export"})
+		}
+
+		return sendDataExport(c, user.Username, archive)
+	}
+}
+
+func sendDataExport(c echo.Context, username string, archive []byte) error {
+	filename := "vibecoders-" + username + "-" + time.Now().UTC().Format("20060102") + ".zip"
+	c.Response().Header().Set(echo.HeaderContentDisposition, `attachment; filename="`+filename+`"`)
+	return c.Blob(http.StatusOK, "application/zip", archive)
+}
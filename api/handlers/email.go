@@ -0,0 +1,129 @@
+package handlers
+
+import (
+	"database/sql"
+	"net/http"
+	netmail "net/mail"
+	"strconv"
+	"time"
+
+	"vibecoders/mail"
+	"vibecoders/models"
+
+	"github.com/labstack/echo/v4"
+)
+
+var emailVerificationLimiter = newRateLimiter(3, time.Hour)
+
+type UpdateEmailRequest struct {
+	Email string `json:"email"`
+}
+
+// validEmail reports whether s is a bare email address like "me@example.com"
+func validEmail(s string) bool {
+	addr, err := netmail.ParseAddress(s)
+	return err == nil && addr.Address == s
+}
+
+// sendEmailVerification issues a verification token for the user's address
+// and queues the confirmation email
+func sendEmailVerification(db *sql.DB, mailer *mail.Mailer, userID int, username, email string) error {
+	token, err := models.CreateEmailVerificationToken(db, userID, email)
+	if err != nil {
+		return err
+	}
+
+	return mailer.Enqueue(email, "Confirm your VibeCoders email address", "verify_email", map[string]interface{}{
+		"Username":       username,
+		"Email":          email,
+		"VerifyURL":      absoluteURL("/api/email/verify?token=" + token),
+		"ExpiresInHours": int(models.EmailVerificationTTL / time.Hour),
+	})
+}
+
+// UpdateEmail sets or changes the current user's email address. The new
+// address is unverified until the link sent to it is followed.
+func UpdateEmail(db *sql.DB, mailer *mail.Mailer) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		user := CurrentUser(c)
+
+		var req UpdateEmailRequest
+		if err := c.Bind(&req); err != nil {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid request"})
+		}
+
+		email := models.NormalizeEmail(req.Email)
+		if !validEmail(email) {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": "A valid email address is required"})
+		}
+
+		if email == user.Email && user.EmailVerified {
+			return c.JSON(http.StatusOK, map[string]string{"message": "Email address is already verified"})
+		}
+
+		if !emailVerificationLimiter.Allow(strconv.Itoa(user.ID)) {
+			c.Response().Header().Set("Retry-After", "3600")
+			return c.JSON(http.StatusTooManyRequests, map[string]string{"error": "Too many verification emails, try again later"})
+		}
+
+		err := models.SetUserEmail(db, user.ID, email)
+		if err != nil {
+			if err == models.ErrEmailTaken {
+				return c.JSON(http.StatusConflict, map[string]string{"error": "Email address is already in use"})
+			}
+			return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Could not update email"})
+		}
+
+		if err := sendEmailVerification(db, mailer, user.ID, user.Username, email); err != nil {
+			return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Could not send verification email"})
+		}
+
+		return c.JSON(http.StatusOK, map[string]string{"message": "Verification email sent"})
+	}
+}
+
+// ResendEmailVerification sends a fresh verification link for the current
+// user's unverified address
+func ResendEmailVerification(db *sql.DB, mailer *mail.Mailer) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		user := CurrentUser(c)
+
+		if user.Email == "" {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": "No email address on this account"})
+		}
+		if user.EmailVerified {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": "Email address is already verified"})
+		}
+
+		if !emailVerificationLimiter.Allow(strconv.Itoa(user.ID)) {
+			c.Response().Header().Set("Retry-After", "3600")
+			return c.JSON(http.StatusTooManyRequests, map[string]string{"error": "Too many verification emails, try again later"})
+		}
+
+		if err := sendEmailVerification(db, mailer, user.ID, user.Username, user.Email); err != nil {
+			return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Could not send verification email"})
+		}
+
+		return c.JSON(http.StatusOK, map[string]string{"message": "Verification email sent"})
+	}
+}
+
+// VerifyEmail confirms an address from the link in a verification email and
+// sends the browser on to the profile page
+func VerifyEmail(db *sql.DB) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		token := c.QueryParam("token")
+		if token == "" {
+			return c.Redirect(http.StatusSeeOther, "/profile?email_verified=0")
+		}
+
+		if _, err := models.VerifyEmailToken(db, token); err != nil {
+			if err != sql.ErrNoRows {
+				c.Logger().Errorf("email verification failed: %v", err)
+			}
+			return c.Redirect(http.StatusSeeOther, "/profile?email_verified=0")
+		}
+
+		return c.Redirect(http.StatusSeeOther, "/profile?email_verified=1")
+	}
+}
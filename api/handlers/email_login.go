@@ -0,0 +1,96 @@
+package handlers
+
+import (
+	"database/sql"
+	"net/http"
+	"strings"
+	"time"
+
+	"vibecoders/mail"
+	"vibecoders/models"
+
+	"github.com/labstack/echo/v4"
+)
+
+// Login links sent by email are single use and short lived
+const emailLoginLinkTTL = 15 * time.Minute
+
+var (
+	emailLoginAddressLimiter = newRateLimiter(3, 15*time.Minute)
+	emailLoginIPLimiter      = newRateLimiter(10, time.Hour)
+)
+
+type EmailLoginRequest struct {
+	Email       string `json:"email"`
+	RedirectURL string `json:"redirect_url"`
+}
+
+// RequestEmailLoginLink emails a one-time login link to a verified address.
+// The response is identical whether or not an account exists so the endpoint
+// cannot be used to discover registered addresses.
+func RequestEmailLoginLink(db *sql.DB, mailer *mail.Mailer) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		var req EmailLoginRequest
+		if err := c.Bind(&req); err != nil {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid request"})
+		}
+
+		email := models.NormalizeEmail(req.Email)
+		if email == "" || !strings.Contains(email, "@") {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": "A valid email address is required"})
+		}
+
+		redirectURL, err := normalizeRedirectURL(req.RedirectURL)
+		if err != nil {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+		}
+
+		if !emailLoginIPLimiter.Allow(c.RealIP()) {
+			c.Response().Header().Set("Retry-After", "3600")
+			return c.JSON(http.StatusTooManyRequests, map[string]string{"error": "Too many login link requests, try again later"})
+		}
+
+		accepted := func() error {
+			return c.JSON(http.StatusAccepted, map[string]string{
+				"message": "If an account with that email exists, a login link is on its way",
+			})
+		}
+
+		// Silently drop requests over the per-address limit so the response
+		// does not reveal anything about the address
+		if !emailLoginAddressLimiter.Allow(email) {
+			return accepted()
+		}
+
+		userID, err := models.GetUserIDByVerifiedEmail(db, email)
+		if err != nil {
+			if err != sql.ErrNoRows {
+				c.Logger().Errorf("email login lookup failed: %v", err)
+			}
+			return accepted()
+		}
+
+		user, err := models.GetUserByID(db, userID)
+		if err != nil {
+			c.Logger().Errorf("email login could not fetch user %d: %v", userID, err)
+			return accepted()
+		}
+
+		link, err := models.CreateMagicLink(db, user.ID, redirectURL, emailLoginLinkTTL, 1)
+		if err != nil {
+			c.Logger().Errorf("email login could not create link for user %d: %v", user.ID, err)
+			return accepted()
+		}
+
+		err = mailer.Enqueue(email, "Your VibeCoders login link", "login_link", map[string]interface{}{
+			"Username":         user.Username,
+			"LoginURL":         absoluteURL("/magic/" + link.Token),
+			"ExpiresInMinutes": int(emailLoginLinkTTL / time.Minute),
+		})
+		if err != nil {
+			c.Logger().Errorf("email login could not queue email for user %d: %v", user.ID, err)
+		}
+
+		return accepted()
+	}
+}
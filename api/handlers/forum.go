@@ -61,12 +61,10 @@ func GetForumPostHandler(db *sql.DB) echo.HandlerFunc {
 			})
 		}
 
-		// Get current user ID from session (or use 0 for anonymous users)
+		// Get current user ID (or use 0 for anonymous users)
 		var userID int = 0
-		session, err := sessionFromContext(c)
-		if err == nil {
-			// User is logged in
-			userID = session.UserID
+		if user := CurrentUser(c); user != nil {
+			userID = user.ID
 		}
 
 		post, err := models.GetForumPostByID(db, postID, userID)
@@ -89,13 +87,7 @@ func GetForumPostHandler(db *sql.DB) echo.HandlerFunc {
 // CreateForumPostHandler adds a new forum post
 func CreateForumPostHandler(db *sql.DB) echo.HandlerFunc {
 	return func(c echo.Context) error {
-		// Get current user ID from session
-		session, err := sessionFromContext(c)
-		if err != nil {
-			return c.JSON(http.StatusUnauthorized, map[string]string{
-				"error": "Unauthorized",
-			})
-		}
+		userID := CurrentUser(c).ID
 
 		var req ForumPostRequest
 		if err := c.Bind(&req); err != nil {
@@ -110,14 +102,14 @@ func CreateForumPostHandler(db *sql.DB) echo.HandlerFunc {
 			})
 		}
 
-		postID, err := models.CreateForumPost(db, session.UserID, req.Title, req.Content, req.URL)
+		postID, err := models.CreateForumPost(db, userID, req.Title, req.Content, req.URL)
 		if err != nil {
 			return c.JSON(http.StatusInternalServerError, map[string]string{
 				"error": "Error creating post: " + err.Error(),
 			})
 		}
 
-		post, err := models.GetForumPostByID(db, postID, session.UserID)
+		post, err := models.GetForumPostByID(db, postID, userID)
 		if err != nil {
 			return c.JSON(http.StatusInternalServerError, map[string]string{
 				"error": "Error retrieving created post: " + err.Error(),
@@ -138,13 +130,7 @@ func CreateForumCommentHandler(db *sql.DB) echo.HandlerFunc {
 			})
 		}
 
-		// Get current user ID from session
-		session, err := sessionFromContext(c)
-		if err != nil {
-			return c.JSON(http.StatusUnauthorized, map[string]string{
-				"error": "Unauthorized",
-			})
-		}
+		userID := CurrentUser(c).ID
 
 		var req ForumCommentRequest
 		if err := c.Bind(&req); err != nil {
@@ -159,14 +145,14 @@ func CreateForumCommentHandler(db *sql.DB) echo.HandlerFunc {
 			})
 		}
 
-		_, err = models.CreateForumComment(db, postID, session.UserID, req.Content)
+		_, err = models.CreateForumComment(db, postID, userID, req.Content)
 		if err != nil {
 			return c.JSON(http.StatusInternalServerError, map[string]string{
 				"error": "Error creating comment: " + err.Error(),
 			})
 		}
 
-		post, err := models.GetForumPostByID(db, postID, session.UserID)
+		post, err := models.GetForumPostByID(db, postID, userID)
 		if err != nil {
 			return c.JSON(http.StatusInternalServerError, map[string]string{
 				"error": "Error retrieving updated post: " + err.Error(),
@@ -187,22 +173,16 @@ func VoteForumPostHandler(db *sql.DB) echo.HandlerFunc {
 			})
 		}
 
-		// Get current user ID from session
-		session, err := sessionFromContext(c)
-		if err != nil {
-			return c.JSON(http.StatusUnauthorized, map[string]string{
-				"error": "Unauthorized",
-			})
-		}
+		userID := CurrentUser(c).ID
 
-		err = models.VoteForumPost(db, postID, session.UserID)
+		err = models.VoteForumPost(db, postID, userID)
 		if err != nil {
 			return c.JSON(http.StatusInternalServerError, map[string]string{
 				"error": "Error voting for post: " + err.Error(),
 			})
 		}
 
-		post, err := models.GetForumPostByID(db, postID, session.UserID)
+		post, err := models.GetForumPostByID(db, postID, userID)
 		if err != nil {
 			return c.JSON(http.StatusInternalServerError, map[string]string{
 				"error": "Error retrieving updated post: " + err.Error(),
@@ -212,3 +192,99 @@ func VoteForumPostHandler(db *sql.DB) echo.HandlerFunc {
 		return c.JSON(http.StatusOK, post)
 	}
 }
+
+// DeleteForumPostHandler removes a post and its comments. Requires the
+// forum.moderate permission.
+func DeleteForumPostHandler(db *sql.DB) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		postID, err := strconv.Atoi(c.Param("id"))
+		if err != nil {
+			return c.JSON(http.StatusBadRequest, map[string]string{
+				"error": "Invalid post ID",
+			})
+		}
+
+		post, err := models.GetForumPostByID(db, postID, 0)
+		if err != nil {
+			if err == sql.ErrNoRows {
+				return c.JSON(http.StatusNotFound, map[string]string{
+					"error": "Post not found",
+				})
+			}
+			return c.JSON(http.StatusInternalServerError, map[string]string{
+				"error": "Error retrieving post: " + err.Error(),
+			})
+		}
+
+		if err := models.DeleteForumPost(db, postID); err != nil {
+			if err == sql.ErrNoRows {
+				return c.JSON(http.StatusNotFound, map[string]string{
+					"error": "Post not found",
+				})
+			}
+			return c.JSON(http.StatusInternalServerError, map[string]string{
+				"error": "Error deleting post: " + err.Error(),
+			})
+		}
+
+		recordAudit(c, db, models.AuditForumPostDelete, "forum_post", strconv.Itoa(post.ID), post.Title,
+			models.DiffFields(map[string]interface{}{
+				"author":   post.User.Username,
+				"title":    post.Title,
+				"content":  post.Content,
+				"url":      post.URL,
+				"comments": len(post.Comments),
+			}, nil))
+
+		return c.JSON(http.StatusOK, map[string]string{
+			"message": "Post deleted successfully",
+		})
+	}
+}
+
+// DeleteForumCommentHandler removes a comment. Requires the forum.moderate
+// permission.
+func DeleteForumCommentHandler(db *sql.DB) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		commentID, err := strconv.Atoi(c.Param("id"))
+		if err != nil {
+			return c.JSON(http.StatusBadRequest, map[string]string{
+				"error": "Invalid comment ID",
+			})
+		}
+
+		comment, err := models.GetForumCommentByID(db, commentID)
+		if err != nil {
+			if err == sql.ErrNoRows {
+				return c.JSON(http.StatusNotFound, map[string]string{
+					"error": "Comment not found",
+				})
+			}
+			return c.JSON(http.StatusInternalServerError, map[string]string{
+				"error": "Error retrieving comment: " + err.Error(),
+			})
+		}
+
+		if err := models.DeleteForumComment(db, commentID); err != nil {
+			if err == sql.ErrNoRows {
+				return c.JSON(http.StatusNotFound, map[string]string{
+					"error": "Comment not found",
+				})
+			}
+			return c.JSON(http.StatusInternalServerError, map[string]string{
+				"error": "Error deleting comment: " + err.Error(),
+			})
+		}
+
+		recordAudit(c, db, models.AuditForumCommentDelete, "forum_comment", strconv.Itoa(comment.ID), "",
+			models.DiffFields(map[string]interface{}{
+				"post_id": comment.PostID,
+				"user_id": comment.UserID,
+				"content": comment.Content,
+			}, nil))
+
+		return c.JSON(http.StatusOK, map[string]string{
+			"message": "Comment deleted successfully",
+		})
+	}
+}
@@ -0,0 +1,194 @@
+package handlers
+
+import (
+	"database/sql"
+	"net/http"
+	"strconv"
+	"time"
+	"vibecoders/models"
+
+	"github.com/labstack/echo/v4"
+)
+
+// ImpersonationStatus tells the frontend that an administrator is viewing the
+// site as the current user, so it can show a banner
+type ImpersonationStatus struct {
+	ImpersonatorID       int       `json:"impersonator_id"`
+	ImpersonatorUsername string    `json:"impersonator_username"`
+	ExpiresAt            time.Time `json:"expires_at"`
+}
+
+// resolveImpersonator checks that the administrator behind an impersonation
+// session is still logged in and still allowed to impersonate. Revoking the
+// admin's own session or permission ends the impersonation with it.
+func resolveImpersonator(db *sql.DB, session *models.Session) (*models.User, *authError) {
+	if session.ImpersonatorSessionID == nil {
+		return nil, &authError{http.StatusUnauthorized, "Invalid session"}
+	}
+
+	adminSession, err := models.GetSessionByID(db, *session.ImpersonatorSessionID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, &authError{http.StatusUnauthorized, "Impersonation ended"}
+		}
+		return nil, &authError{http.StatusInternalServerError, "Server error"}
+	}
+
+	if adminSession.UserID != *session.ImpersonatorID {
+		return nil, &authError{http.StatusUnauthorized, "Invalid session"}
+	}
+
+	allowed, err := models.UserHasPermission(db, adminSession.UserID, models.PermImpersonate)
+	if err != nil {
+		return nil, &authError{http.StatusInternalServerError, "Server error"}
+	}
+	if !allowed {
+		return nil, &authError{http.StatusUnauthorized, "Impersonation ended"}
+	}
+
+	impersonator, err := models.GetUserByID(db, adminSession.UserID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, &authError{http.StatusUnauthorized, "Impersonation ended"}
+		}
+		return nil, &authError{http.StatusInternalServerError, "Server error"}
+	}
+
+	return impersonator, nil
+}
+
+// Impersonator returns the administrator viewing the site as the current
+// user, or nil if the request is not part of an impersonation
+func Impersonator(c echo.Context) *models.User {
+	user, _ := c.Get(currentImpersonatorKey).(*models.User)
+	return user
+}
+
+// BlockImpersonation rejects requests made while impersonating. It guards
+// account and security changes that an administrator must never make on a
+// user's behalf.
+func BlockImpersonation() echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			if Impersonator(c) != nil {
+				return c.JSON(http.StatusForbidden, map[string]string{"error": "Not available while impersonating a user"})
+			}
+
+			return next(c)
+		}
+	}
+}
+
+// AuditImpersonation records every write made while impersonating, whether
+// or not it succeeded
+func AuditImpersonation(db *sql.DB) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			err := next(c)
+
+			if Impersonator(c) == nil {
+				return err
+			}
+
+			switch c.Request().Method {
+			case http.MethodGet, http.MethodHead, http.MethodOptions:
+				return err
+			}
+
+			user := CurrentUser(c)
+			recordAudit(c, db, models.AuditImpersonatedWrite, "request",
+				c.Request().Method+" "+c.Request().URL.Path, user.Username,
+				models.AuditChanges{"status": {From: nil, To: c.Response().Status}})
+
+			return err
+		}
+	}
+}
+
+// StartImpersonation switches the administrator's browser to a time-boxed
+// session as another user. The admin's own session is kept and restored by
+// StopImpersonation.
+func StartImpersonation(db *sql.DB) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		adminSession := CurrentSession(c)
+		if adminSession == nil {
+			return c.JSON(http.StatusForbidden, map[string]string{"error": "Impersonation requires a browser session"})
+		}
+
+		userID, err := strconv.Atoi(c.Param("id"))
+		if err != nil {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid user ID"})
+		}
+
+		if userID == CurrentUser(c).ID {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": "You cannot impersonate yourself"})
+		}
+
+		user, err := models.GetUserByID(db, userID)
+		if err != nil {
+			if err == sql.ErrNoRows {
+				return c.JSON(http.StatusNotFound, map[string]string{"error": "User not found"})
+			}
+			return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Could not fetch user"})
+		}
+
+		// Impersonating another administrator would let one admin act with
+		// another's privileges
+		privileged, err := models.UserHasPermission(db, userID, models.PermAdminAccess)
+		if err != nil {
+			return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Server error"})
+		}
+		if privileged {
+			return c.JSON(http.StatusForbidden, map[string]string{"error": "Administrators cannot be impersonated"})
+		}
+
+		session, err := models.CreateImpersonationSession(db, userID, adminSession, c.RealIP(), c.Request().UserAgent())
+		if err != nil {
+			return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Could not start impersonation"})
+		}
+
+		setSessionCookie(c, session.Token)
+		setCSRFCookie(c, session.CSRFToken)
+
+		recordUserAudit(c, db, models.AuditImpersonationStart, user,
+			models.AuditChanges{"expires_at": {From: nil, To: session.ExpiresAt}})
+
+		return c.JSON(http.StatusOK, map[string]interface{}{
+			"message":    "Now viewing the site as " + user.Username,
+			"user_id":    user.ID,
+			"username":   user.Username,
+			"expires_at": session.ExpiresAt,
+		})
+	}
+}
+
+// StopImpersonation ends the impersonation session and returns the browser
+// to the administrator's own session
+func StopImpersonation(db *sql.DB) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		session := CurrentSession(c)
+		if session == nil || Impersonator(c) == nil {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": "Not impersonating a user"})
+		}
+
+		if err := models.DeleteSession(db, session.Token); err != nil {
+			return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Could not end impersonation"})
+		}
+
+		recordUserAudit(c, db, models.AuditImpersonationStop, CurrentUser(c), nil)
+
+		adminSession, err := models.GetSessionByID(db, *session.ImpersonatorSessionID)
+		if err != nil {
+			if err != sql.ErrNoRows {
+				return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Could not restore session"})
+			}
+			clearSessionCookie(c)
+			return c.JSON(http.StatusOK, map[string]string{"message": "Impersonation ended, please log in again"})
+		}
+
+		setSessionCookie(c, adminSession.Token)
+		setCSRFCookie(c, adminSession.CSRFToken)
+
+		return c.JSON(http.StatusOK, map[string]string{"message": "Impersonation ended"})
+	}
+}
@@ -0,0 +1,124 @@
+package handlers
+
+import (
+	"database/sql"
+	"math"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"vibecoders/models"
+
+	"github.com/labstack/echo/v4"
+)
+
+// loginThrottled returns a 429 error, with Retry-After set, if any of the keys
+// is backed off after failed logins
+func loginThrottled(c echo.Context, db *sql.DB, keys ...string) *authError {
+	var wait time.Duration
+	for _, key := range keys {
+		blocked, err := models.LoginBlockedFor(db, key)
+		if err != nil {
+			return &authError{http.StatusInternalServerError, "Database error"}
+		}
+		if blocked > wait {
+			wait = blocked
+		}
+	}
+
+	if wait == 0 {
+		return nil
+	}
+
+	seconds := int(math.Ceil(wait.Seconds()))
+	c.Response().Header().Set("Retry-After", strconv.Itoa(seconds))
+	return &authError{http.StatusTooManyRequests, "Too many failed login attempts, try again in " + formatWait(seconds)}
+}
+
+// recordLoginFailure counts a failed login against the client's address and,
+// when one was given, the username
+func recordLoginFailure(c echo.Context, db *sql.DB, username string) {
+	if err := models.RecordLoginFailure(db, models.IPThrottleKey(c.RealIP()), models.IPThrottle); err != nil {
+		c.Logger().Errorf("could not record login failure: %v", err)
+	}
+	if username == "" {
+		return
+	}
+	if err := models.RecordLoginFailure(db, models.UsernameThrottleKey(username), models.UsernameThrottle); err != nil {
+		c.Logger().Errorf("could not record login failure: %v", err)
+	}
+}
+
+// formatWait renders a Retry-After delay for people
+func formatWait(seconds int) string {
+	n, unit := seconds, "second"
+	if seconds >= 60 {
+		n, unit = (seconds+59)/60, "minute"
+	}
+	if n != 1 {
+		unit += "s"
+	}
+	return strconv.Itoa(n) + " " + unit
+}
+
+// GetLoginLockouts lists usernames and addresses currently blocked after
+// failed logins
+func GetLoginLockouts(db *sql.DB) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		throttles, err := models.GetBlockedLoginThrottles(db)
+		if err != nil {
+			return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Could not fetch lockouts"})
+		}
+
+		return c.JSON(http.StatusOK, throttles)
+	}
+}
+
+// ClearLoginLockout removes a lockout by key, e.g. "ip:203.0.113.7"
+func ClearLoginLockout(db *sql.DB) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		key, err := url.PathUnescape(c.Param("key"))
+		if err != nil || key == "" {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid lockout key"})
+		}
+
+		cleared, err := models.ClearLoginThrottle(db, key)
+		if err != nil {
+			return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Could not clear lockout"})
+		}
+		if !cleared {
+			return c.JSON(http.StatusNotFound, map[string]string{"error": "Lockout not found"})
+		}
+
+		recordAudit(c, db, models.AuditLockoutClear, "lockout", key, key, nil)
+
+		return c.JSON(http.StatusOK, map[string]string{"message": "Lockout cleared"})
+	}
+}
+
+// UnlockUser clears the failed login lockout on a user's account
+func UnlockUser(db *sql.DB) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		userID, err := strconv.Atoi(c.Param("id"))
+		if err != nil {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid user ID"})
+		}
+
+		user, err := models.GetUserByID(db, userID)
+		if err != nil {
+			if err == sql.ErrNoRows {
+				return c.JSON(http.StatusNotFound, map[string]string{"error": "User not found"})
+			}
+			return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Could not fetch user"})
+		}
+
+		if _, err := models.ClearLoginThrottle(db, models.UsernameThrottleKey(user.Username)); err != nil {
+			return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Could not unlock user"})
+		}
+
+		recordUserAudit(c, db, models.AuditUserUnlock, user, nil)
+
+		return c.JSON(http.StatusOK, map[string]string{"message": "User unlocked"})
+	}
+}
@@ -0,0 +1,184 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"vibecoders/models"
+
+	"github.com/labstack/echo/v4"
+)
+
+const (
+	// maxMessageStreams caps how many open streams (tabs) one user may have
+	maxMessageStreams = 5
+
+	// messageStreamPing keeps idle connections from being closed by proxies
+	messageStreamPing = 25 * time.Second
+
+	// messageStreamLifetime closes streams periodically so the client
+	// reconnects, which re-checks the session
+	messageStreamLifetime = 30 * time.Minute
+)
+
+// messageEvent is one Server-Sent Event for a user's message stream
+type messageEvent struct {
+	Type string
+	Data interface{}
+}
+
+// messageHub fans events out to the open message streams of each user. It
+// only lives in this process, so every stream must be served by the same
+// server that handles the write.
+type messageHub struct {
+	mu      sync.Mutex
+	streams map[int]map[chan messageEvent]struct{}
+}
+
+var messageStreams = &messageHub{streams: make(map[int]map[chan messageEvent]struct{})}
+
+// subscribe opens a stream for a user. Returns false if they already have
+// maxMessageStreams open.
+func (h *messageHub) subscribe(userID int) (chan messageEvent, bool) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if len(h.streams[userID]) >= maxMessageStreams {
+		return nil, false
+	}
+	if h.streams[userID] == nil {
+		h.streams[userID] = make(map[chan messageEvent]struct{})
+	}
+
+	ch := make(chan messageEvent, 16)
+	h.streams[userID][ch] = struct{}{}
+	return ch, true
+}
+
+func (h *messageHub) unsubscribe(userID int, ch chan messageEvent) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	delete(h.streams[userID], ch)
+	if len(h.streams[userID]) == 0 {
+		delete(h.streams, userID)
+	}
+}
+
+// publish sends an event to every stream the user has open. A stream that
+// has fallen behind misses the event rather than holding up the sender; the
+// client catches up from the REST endpoints when it reconnects.
+func (h *messageHub) publish(userID int, event messageEvent) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	for ch := range h.streams[userID] {
+		select {
+		case ch <- event:
+		default:
+		}
+	}
+}
+
+// listening reports whether the user has any stream open
+func (h *messageHub) listening(userID int) bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	return len(h.streams[userID]) > 0
+}
+
+// publishToParticipants sends an event to both sides of a conversation,
+// adding each user's own unread counts to the payload
+func publishToParticipants(db *sql.DB, userIDs []int, eventType string, data map[string]interface{}) {
+	for _, userID := range userIDs {
+		if !messageStreams.listening(userID) {
+			continue
+		}
+
+		payload := make(map[string]interface{}, len(data)+1)
+		for k, v := range data {
+			payload[k] = v
+		}
+		if unread, err := models.CountUnreadMessages(db, userID); err == nil {
+			payload["unread"] = unread
+		}
+
+		messageStreams.publish(userID, messageEvent{Type: eventType, Data: payload})
+	}
+}
+
+// writeEvent writes one event in the text/event-stream format and flushes it
+// to the client
+func writeEvent(res *echo.Response, event messageEvent) error {
+	data, err := json.Marshal(event.Data)
+	if err != nil {
+		return err
+	}
+
+	if _, err := fmt.Fprintf(res, "event: %s\ndata: %s\n\n", event.Type, data); err != nil {
+		return err
+	}
+	res.Flush()
+	return nil
+}
+
+// StreamMessages delivers the current user's new messages and read receipts
+// as Server-Sent Events. The first event ("ready") carries the unread counts;
+// after that "message" and "read" events follow as they happen.
+func StreamMessages(db *sql.DB) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		userID := CurrentUser(c).ID
+
+		unread, err := models.CountUnreadMessages(db, userID)
+		if err != nil {
+			return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Could not fetch messages"})
+		}
+
+		events, ok := messageStreams.subscribe(userID)
+		if !ok {
+			return c.JSON(http.StatusTooManyRequests, map[string]string{"error": "Too many open message streams"})
+		}
+		defer messageStreams.unsubscribe(userID, events)
+
+		res := c.Response()
+		res.Header().Set(echo.HeaderContentType, "text/event-stream")
+		res.Header().Set(echo.HeaderCacheControl, "no-cache")
+		res.Header().Set(echo.HeaderConnection, "keep-alive")
+		// Stop nginx and similar proxies from buffering the stream
+		res.Header().Set("X-Accel-Buffering", "no")
+		res.WriteHeader(http.StatusOK)
+
+		if err := writeEvent(res, messageEvent{Type: "ready", Data: map[string]interface{}{"unread": unread}}); err != nil {
+			return nil
+		}
+
+		ping := time.NewTicker(messageStreamPing)
+		defer ping.Stop()
+		lifetime := time.NewTimer(messageStreamLifetime)
+		defer lifetime.Stop()
+
+		ctx := c.Request().Context()
+		for {
+			select {
+			case <-ctx.Done():
+				return nil
+			case <-lifetime.C:
+				return nil
+			case <-ping.C:
+				if _, err := fmt.Fprint(res, ": ping\n\n"); err != nil {
+					return nil
+				}
+				res.Flush()
+			case event := <-events:
+				if err := writeEvent(res, event); err != nil {
+					return nil
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,316 @@
+package handlers
+
+import (
+	"database/sql"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"vibecoders/models"
+
+	"github.com/labstack/echo/v4"
+)
+
+// messageLimiter caps how many direct messages a user can send per minute
+var messageLimiter = newRateLimiter(30, time.Minute)
+
+type StartConversationRequest struct {
+	Username string `json:"username"`
+	Body     string `json:"body"`
+}
+
+type SendMessageRequest struct {
+	Body string `json:"body"`
+}
+
+type MarkReadRequest struct {
+	MessageID int `json:"message_id"`
+}
+
+// validateMessageBody trims a message and checks its length
+func validateMessageBody(body string) (string, *authError) {
+	body = strings.TrimSpace(body)
+	if body == "" || len(body) > models.MaxMessageLength {
+		return "", &authError{http.StatusBadRequest, fmt.Sprintf("Message must be 1 to %d characters", models.MaxMessageLength)}
+	}
+	return body, nil
+}
+
+// checkCanMessage applies the rules for sender messaging recipientID: a
+// verified email address, no block in either direction and the rate limit
+func checkCanMessage(c echo.Context, db *sql.DB, sender *models.User, recipientID int) *authError {
+	if !sender.EmailVerified {
+		return &authError{http.StatusForbidden, "Verify your email address before sending messages"}
+	}
+
+	blocked, err := models.IsBlockedBetween(db, sender.ID, recipientID)
+	if err != nil {
+		return &authError{http.StatusInternalServerError, "Could not send message"}
+	}
+	if blocked {
+		return &authError{http.StatusForbidden, "You cannot message this user"}
+	}
+
+	if !messageLimiter.Allow(strconv.Itoa(sender.ID)) {
+		c.Response().Header().Set("Retry-After", "60")
+		return &authError{http.StatusTooManyRequests, "Too many messages, slow down"}
+	}
+
+	return nil
+}
+
+// deliverMessage stores a message and pushes it to both participants' streams
+func deliverMessage(db *sql.DB, conversationID, senderID, recipientID int, body string) (*models.Message, error) {
+	message, err := models.CreateMessage(db, conversationID, senderID, body)
+	if err != nil {
+		return nil, err
+	}
+
+	publishToParticipants(db, []int{recipientID, senderID}, "message", map[string]interface{}{
+		"conversation_id": conversationID,
+		"message":         message,
+	})
+
+	return message, nil
+}
+
+// StartConversation sends the first message to a user, or adds to the
+// existing conversation if the two have talked before
+func StartConversation(db *sql.DB) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		sender := CurrentUser(c)
+
+		var req StartConversationRequest
+		if err := c.Bind(&req); err != nil {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid request"})
+		}
+
+		body, authErr := validateMessageBody(req.Body)
+		if authErr != nil {
+			return c.JSON(authErr.status, map[string]string{"error": authErr.message})
+		}
+
+		recipient, err := models.GetUserByUsername(db, strings.TrimSpace(req.Username))
+		if err == sql.ErrNoRows || (err == nil && recipient.Username == models.DeletedUserPlaceholder) {
+			return c.JSON(http.StatusNotFound, map[string]string{"error": "User not found"})
+		}
+		if err != nil {
+			return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Could not fetch user"})
+		}
+		if recipient.ID == sender.ID {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": "You cannot message yourself"})
+		}
+
+		if authErr := checkCanMessage(c, db, sender, recipient.ID); authErr != nil {
+			return c.JSON(authErr.status, map[string]string{"error": authErr.message})
+		}
+
+		conversationID, err := models.GetOrCreateConversation(db, sender.ID, recipient.ID)
+		if err != nil {
+			return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Could not start conversation"})
+		}
+
+		message, err := deliverMessage(db, conversationID, sender.ID, recipient.ID, body)
+		if err != nil {
+			return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Could not send message"})
+		}
+
+		conversation, err := models.GetConversation(db, conversationID, sender.ID)
+		if err != nil {
+			return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Could not fetch conversation"})
+		}
+
+		return c.JSON(http.StatusCreated, map[string]interface{}{
+			"conversation": conversation,
+			"message":      message,
+		})
+	}
+}
+
+// GetConversations lists the current user's conversations, most recently
+// active first, with the unread totals
+func GetConversations(db *sql.DB) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		userID := CurrentUser(c).ID
+
+		page, err := strconv.Atoi(c.QueryParam("page"))
+		if err != nil || page < 1 {
+			page = 1
+		}
+
+		pageSize, err := strconv.Atoi(c.QueryParam("pageSize"))
+		if err != nil || pageSize < 1 || pageSize > 100 {
+			pageSize = 20 // Default page size
+		}
+
+		conversations, err := models.GetConversations(db, userID, page, pageSize)
+		if err != nil {
+			return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Could not fetch conversations"})
+		}
+
+		total, err := models.CountConversations(db, userID)
+		if err != nil {
+			return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Could not fetch conversations"})
+		}
+
+		unread, err := models.CountUnreadMessages(db, userID)
+		if err != nil {
+			return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Could not fetch conversations"})
+		}
+
+		return c.JSON(http.StatusOK, map[string]interface{}{
+			"conversations": conversations,
+			"unread":        unread,
+			"pagination": map[string]interface{}{
+				"total":      total,
+				"page":       page,
+				"pageSize":   pageSize,
+				"totalPages": (total + pageSize - 1) / pageSize,
+			},
+		})
+	}
+}
+
+// conversationFromParam loads the conversation in the :id path parameter if
+// the current user is part of it
+func conversationFromParam(c echo.Context, db *sql.DB) (*models.Conversation, *authError) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		return nil, &authError{http.StatusBadRequest, "Invalid conversation ID"}
+	}
+
+	conversation, err := models.GetConversation(db, id, CurrentUser(c).ID)
+	if err == sql.ErrNoRows {
+		return nil, &authError{http.StatusNotFound, "Conversation not found"}
+	}
+	if err != nil {
+		return nil, &authError{http.StatusInternalServerError, "Could not fetch conversation"}
+	}
+
+	return conversation, nil
+}
+
+// GetConversation returns a single conversation of the current user
+func GetConversation(db *sql.DB) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		conversation, authErr := conversationFromParam(c, db)
+		if authErr != nil {
+			return c.JSON(authErr.status, map[string]string{"error": authErr.message})
+		}
+
+		return c.JSON(http.StatusOK, conversation)
+	}
+}
+
+// GetConversationMessages returns the latest messages of a conversation,
+// oldest first. Pass ?before=<message id> to page back through history.
+func GetConversationMessages(db *sql.DB) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		conversation, authErr := conversationFromParam(c, db)
+		if authErr != nil {
+			return c.JSON(authErr.status, map[string]string{"error": authErr.message})
+		}
+
+		before := 0
+		if param := c.QueryParam("before"); param != "" {
+			var err error
+			before, err = strconv.Atoi(param)
+			if err != nil || before < 1 {
+				return c.JSON(http.StatusBadRequest, map[string]string{"error": "before must be a message ID"})
+			}
+		}
+
+		limit, err := strconv.Atoi(c.QueryParam("limit"))
+		if err != nil || limit < 1 || limit > 100 {
+			limit = 50
+		}
+
+		// Fetch one extra to tell whether there is more history
+		messages, err := models.GetMessages(db, conversation.ID, before, limit+1)
+		if err != nil {
+			return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Could not fetch messages"})
+		}
+
+		hasMore := len(messages) > limit
+		if hasMore {
+			messages = messages[1:]
+		}
+
+		return c.JSON(http.StatusOK, map[string]interface{}{
+			"messages": messages,
+			"has_more": hasMore,
+		})
+	}
+}
+
+// SendMessage adds a message to one of the current user's conversations
+func SendMessage(db *sql.DB) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		conversation, authErr := conversationFromParam(c, db)
+		if authErr != nil {
+			return c.JSON(authErr.status, map[string]string{"error": authErr.message})
+		}
+
+		var req SendMessageRequest
+		if err := c.Bind(&req); err != nil {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid request"})
+		}
+
+		body, authErr := validateMessageBody(req.Body)
+		if authErr != nil {
+			return c.JSON(authErr.status, map[string]string{"error": authErr.message})
+		}
+
+		sender := CurrentUser(c)
+		if authErr := checkCanMessage(c, db, sender, conversation.With.ID); authErr != nil {
+			return c.JSON(authErr.status, map[string]string{"error": authErr.message})
+		}
+
+		message, err := deliverMessage(db, conversation.ID, sender.ID, conversation.With.ID, body)
+		if err != nil {
+			return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Could not send message"})
+		}
+
+		return c.JSON(http.StatusCreated, message)
+	}
+}
+
+// MarkConversationRead marks a conversation read up to the given message, or
+// entirely if none is given. The other participant gets a read receipt.
+func MarkConversationRead(db *sql.DB) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		conversation, authErr := conversationFromParam(c, db)
+		if authErr != nil {
+			return c.JSON(authErr.status, map[string]string{"error": authErr.message})
+		}
+
+		var req MarkReadRequest
+		if err := c.Bind(&req); err != nil {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid request"})
+		}
+
+		userID := CurrentUser(c).ID
+		lastRead, err := models.MarkConversationRead(db, conversation.ID, userID, req.MessageID)
+		if err != nil {
+			return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Could not update conversation"})
+		}
+
+		publishToParticipants(db, []int{userID, conversation.With.ID}, "read", map[string]interface{}{
+			"conversation_id":      conversation.ID,
+			"user_id":              userID,
+			"last_read_message_id": lastRead,
+		})
+
+		unread, err := models.CountUnreadMessages(db, userID)
+		if err != nil {
+			return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Could not update conversation"})
+		}
+
+		return c.JSON(http.StatusOK, map[string]interface{}{
+			"last_read_message_id": lastRead,
+			"unread":               unread,
+		})
+	}
+}
@@ -0,0 +1,162 @@
+package handlers
+
+import (
+	"database/sql"
+	"net/http"
+	"strings"
+
+	"vibecoders/models"
+
+	"github.com/labstack/echo/v4"
+)
+
+// Context keys under which the authenticated user and credential are stored
+const (
+	currentUserKey         = "current_user"
+	currentSessionKey      = "current_session"
+	currentAccessTokenKey  = "current_access_token"
+	currentImpersonatorKey = "current_impersonator"
+)
+
+// authError is the status and message returned for an auth failure
+type authError struct {
+	status  int
+	message string
+}
+
+// resolveUser looks up the user behind an "Authorization: Bearer" personal
+// access token or, failing that, the session_token cookie. The credential is
+// stored on the context; sessions have their expiry slid forward.
+func resolveUser(c echo.Context, db *sql.DB) (*models.User, *authError) {
+	var userID int
+
+	if header := c.Request().Header.Get(echo.HeaderAuthorization); header != "" {
+		token, ok := strings.CutPrefix(header, "Bearer ")
+		if !ok {
+			return nil, &authError{http.StatusUnauthorized, "Invalid authorization header"}
+		}
+
+		accessToken, err := models.GetAccessTokenByToken(db, strings.TrimSpace(token))
+		if err != nil {
+			if err == sql.ErrNoRows {
+				return nil, &authError{http.StatusUnauthorized, "Invalid token"}
+			}
+			return nil, &authError{http.StatusInternalServerError, "Server error"}
+		}
+
+		c.Set(currentAccessTokenKey, accessToken)
+		userID = accessToken.UserID
+	} else {
+		cookie, err := c.Cookie("session_token")
+		if err != nil || cookie.Value == "" {
+			return nil, &authError{http.StatusUnauthorized, "Not logged in"}
+		}
+
+		session, err := models.GetSessionByToken(db, cookie.Value)
+		if err != nil {
+			if err == sql.ErrNoRows {
+				return nil, &authError{http.StatusUnauthorized, "Invalid session"}
+			}
+			return nil, &authError{http.StatusInternalServerError, "Server error"}
+		}
+
+		if session.ImpersonatorID != nil {
+			impersonator, authErr := resolveImpersonator(db, session)
+			if authErr != nil {
+				return nil, authErr
+			}
+			c.Set(currentImpersonatorKey, impersonator)
+		}
+
+		if err := models.TouchSession(db, session, c.RealIP(), c.Request().UserAgent()); err != nil {
+			c.Logger().Errorf("could not renew session %d: %v", session.ID, err)
+		}
+
+		c.Set(currentSessionKey, session)
+		userID = session.UserID
+	}
+
+	user, err := models.GetUserByID(db, userID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, &authError{http.StatusUnauthorized, "Invalid session"}
+		}
+		return nil, &authError{http.StatusInternalServerError, "Could not fetch user"}
+	}
+
+	return user, nil
+}
+
+// OptionalAuth resolves the session if one is present and stores the user on
+// the context, but lets anonymous requests through
+func OptionalAuth(db *sql.DB) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			if CurrentUser(c) == nil {
+				if user, authErr := resolveUser(c, db); authErr == nil {
+					c.Set(currentUserKey, user)
+				}
+			}
+
+			return next(c)
+		}
+	}
+}
+
+// RequireAuth rejects the request with 401 unless it carries a valid session
+// or personal access token. The credential is only resolved once if
+// OptionalAuth already ran.
+//
+// Personal access tokens are only accepted when the route names the resource
+// it belongs to: a token needs "<resource>:read" for GET requests and
+// "<resource>:write" for anything else. Routes without a resource are
+// browser-session only.
+func RequireAuth(db *sql.DB, resource ...string) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			if CurrentUser(c) == nil {
+				user, authErr := resolveUser(c, db)
+				if authErr != nil {
+					return c.JSON(authErr.status, map[string]string{"error": authErr.message})
+				}
+				c.Set(currentUserKey, user)
+			}
+
+			if token := CurrentAccessToken(c); token != nil {
+				if len(resource) == 0 {
+					return c.JSON(http.StatusForbidden, map[string]string{"error": "This endpoint does not accept access tokens"})
+				}
+
+				scope := resource[0] + ":write"
+				if method := c.Request().Method; method == http.MethodGet || method == http.MethodHead {
+					scope = resource[0] + ":read"
+				}
+				if !token.HasScope(scope) {
+					return c.JSON(http.StatusForbidden, map[string]string{"error": "Token is missing the " + scope + " scope"})
+				}
+			}
+
+			return next(c)
+		}
+	}
+}
+
+// CurrentSession returns the session the request was authenticated with, or
+// nil for anonymous requests
+func CurrentSession(c echo.Context) *models.Session {
+	session, _ := c.Get(currentSessionKey).(*models.Session)
+	return session
+}
+
+// CurrentAccessToken returns the personal access token the request was
+// authenticated with, or nil if it used a session or is anonymous
+func CurrentAccessToken(c echo.Context) *models.AccessToken {
+	token, _ := c.Get(currentAccessTokenKey).(*models.AccessToken)
+	return token
+}
+
+// CurrentUser returns the authenticated user, or nil for anonymous requests
+func CurrentUser(c echo.Context) *models.User {
+	user, _ := c.Get(currentUserKey).(*models.User)
+	return user
+}
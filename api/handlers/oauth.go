@@ -0,0 +1,317 @@
+package handlers
+
+import (
+	"crypto/subtle"
+	"database/sql"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"vibecoders/models"
+	"vibecoders/oauth"
+
+	"github.com/labstack/echo/v4"
+)
+
+// oauthStateCookie binds an authorization request to the browser that
+// started it, so a callback URL cannot be replayed in someone else's browser
+const oauthStateCookie = "oauth_state"
+
+// oauthCallbackURL is the redirect URI registered with each provider
+func oauthCallbackURL(provider string) string {
+	return absoluteURL("/api/oauth/" + provider + "/callback")
+}
+
+func setOAuthStateCookie(c echo.Context, state string, maxAge int) {
+	cookie := new(http.Cookie)
+	cookie.Name = oauthStateCookie
+	cookie.Value = state
+	cookie.Path = "/api/oauth"
+	cookie.HttpOnly = true
+	cookie.SameSite = http.SameSiteLaxMode // Sent on the provider's top-level redirect back
+	cookie.MaxAge = maxAge
+	c.SetCookie(cookie)
+}
+
+// oauthError sends the browser back to the app with a message to show
+func oauthError(c echo.Context, page, message string) error {
+	return c.Redirect(http.StatusFound, page+"?oauth_error="+url.QueryEscape(message))
+}
+
+// GetOAuthProviders lists the providers users can log in with
+func GetOAuthProviders(providers oauth.Providers) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		names := providers.Names()
+		sort.Strings(names)
+		return c.JSON(http.StatusOK, names)
+	}
+}
+
+// StartOAuthLogin sends the browser to the provider to log in
+func StartOAuthLogin(db *sql.DB, providers oauth.Providers) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		provider, ok := providers[c.Param("provider")]
+		if !ok {
+			return c.JSON(http.StatusNotFound, map[string]string{"error": "Unknown login provider"})
+		}
+
+		redirectURL, err := normalizeRedirectURL(c.QueryParam("redirect_url"))
+		if err != nil {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+		}
+
+		return beginOAuth(c, db, provider, redirectURL, 0)
+	}
+}
+
+// StartOAuthLink sends a logged-in user to the provider to link an account
+func StartOAuthLink(db *sql.DB, providers oauth.Providers) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		provider, ok := providers[c.Param("provider")]
+		if !ok {
+			return c.JSON(http.StatusNotFound, map[string]string{"error": "Unknown login provider"})
+		}
+
+		return beginOAuth(c, db, provider, "/profile", CurrentUser(c).ID)
+	}
+}
+
+// beginOAuth records the state, nonce and PKCE verifier for a new
+// authorization request and redirects to the provider
+func beginOAuth(c echo.Context, db *sql.DB, provider *oauth.Provider, redirectURL string, linkUserID int) error {
+	nonce, err := oauth.RandomString(32)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Could not start login"})
+	}
+	verifier, err := oauth.NewCodeVerifier()
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Could not start login"})
+	}
+
+	state, err := models.CreateOAuthState(db, &models.OAuthState{
+		Provider:     provider.Name,
+		Nonce:        nonce,
+		CodeVerifier: verifier,
+		RedirectURL:  redirectURL,
+		LinkUserID:   linkUserID,
+	})
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Could not start login"})
+	}
+
+	authURL, err := provider.AuthCodeURL(c.Request().Context(), oauthCallbackURL(provider.Name), state, nonce, oauth.CodeChallenge(verifier))
+	if err != nil {
+		c.Logger().Errorf("oauth: could not start %s login: %v", provider.Name, err)
+		return c.JSON(http.StatusBadGateway, map[string]string{"error": "Login provider is unavailable"})
+	}
+
+	setOAuthStateCookie(c, state, int(models.OAuthStateTTL/time.Second))
+	return c.Redirect(http.StatusFound, authURL)
+}
+
+// OAuthCallback completes a provider login. The provider account is matched
+// to a user by an existing link, then by verified email, and otherwise a new
+// user is provisioned. Users with 2FA still need to enter a code.
+func OAuthCallback(db *sql.DB, providers oauth.Providers) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		provider, ok := providers[c.Param("provider")]
+		if !ok {
+			return c.JSON(http.StatusNotFound, map[string]string{"error": "Unknown login provider"})
+		}
+
+		state := c.QueryParam("state")
+		cookie, err := c.Cookie(oauthStateCookie)
+		setOAuthStateCookie(c, "", -1)
+		if err != nil || state == "" || subtle.ConstantTimeCompare([]byte(cookie.Value), []byte(state)) != 1 {
+			return oauthError(c, "/login", "Login could not be verified, please try again")
+		}
+
+		pending, err := models.ConsumeOAuthState(db, state)
+		if err != nil || pending.Provider != provider.Name {
+			return oauthError(c, "/login", "Login has expired, please try again")
+		}
+
+		failPage := "/login"
+		if pending.LinkUserID != 0 {
+			failPage = "/profile"
+		}
+
+		if c.QueryParam("error") != "" {
+			return oauthError(c, failPage, "Login was cancelled")
+		}
+
+		ctx := c.Request().Context()
+		redirectURI := oauthCallbackURL(provider.Name)
+		token, err := provider.Exchange(ctx, redirectURI, c.QueryParam("code"), pending.CodeVerifier)
+		if err != nil {
+			c.Logger().Errorf("oauth: %v", err)
+			return oauthError(c, failPage, "Login with "+provider.Name+" failed")
+		}
+
+		identity, err := provider.Identity(ctx, token, pending.Nonce)
+		if err != nil {
+			c.Logger().Errorf("oauth: %v", err)
+			return oauthError(c, failPage, "Login with "+provider.Name+" failed")
+		}
+
+		if pending.LinkUserID != 0 {
+			err := models.LinkUserIdentity(db, pending.LinkUserID, provider.Name, identity.Subject, identity.Email, identity.Username)
+			if err == models.ErrIdentityLinked {
+				return oauthError(c, "/profile", "That "+provider.Name+" account is linked to another user")
+			}
+			if err != nil {
+				return oauthError(c, "/profile", "Could not link account")
+			}
+			return c.Redirect(http.StatusFound, "/profile?linked="+url.QueryEscape(provider.Name))
+		}
+
+		userID, err := oauthUser(db, provider, identity)
+		if err != nil {
+			c.Logger().Errorf("oauth: could not resolve %s user: %v", provider.Name, err)
+			return oauthError(c, "/login", "Could not log in with "+provider.Name)
+		}
+
+		redirectURL, err := normalizeRedirectURL(pending.RedirectURL)
+		if err != nil {
+			redirectURL = "/"
+		}
+
+		twoFactor, err := models.IsTwoFactorEnabled(db, userID)
+		if err != nil {
+			return oauthError(c, "/login", "Could not log in with "+provider.Name)
+		}
+		if twoFactor {
+			challenge, err := models.CreateLoginChallenge(db, userID, redirectURL)
+			if err == models.ErrTooManyLoginChallenges {
+				return oauthError(c, "/login", "Too many login attempts, try again in a few minutes")
+			}
+			if err != nil {
+				return oauthError(c, "/login", "Could not start two-factor login")
+			}
+			return c.Redirect(http.StatusFound, "/login?challenge="+url.QueryEscape(challenge))
+		}
+
+		if err := startSession(c, db, userID); err != nil {
+			return oauthError(c, "/login", "Could not create session")
+		}
+
+		return c.Redirect(http.StatusFound, redirectURL)
+	}
+}
+
+// oauthUser finds or provisions the local user for a provider identity
+func oauthUser(db *sql.DB, provider *oauth.Provider, identity *oauth.Identity) (int, error) {
+	existing, err := models.GetUserIdentity(db, provider.Name, identity.Subject)
+	if err == nil {
+		// Deleted accounts cannot log in, even through a linked provider
+		if _, err := models.GetUserByID(db, existing.UserID); err != nil {
+			return 0, err
+		}
+		if err := models.TouchUserIdentity(db, existing.ID); err != nil {
+			return 0, err
+		}
+		return existing.UserID, nil
+	}
+	if err != sql.ErrNoRows {
+		return 0, err
+	}
+
+	// Link to an existing account only when both sides have verified the address
+	if identity.EmailVerified && identity.Email != "" {
+		userID, err := models.GetUserIDByVerifiedEmail(db, identity.Email)
+		if err == nil {
+			err := models.LinkUserIdentity(db, userID, provider.Name, identity.Subject, identity.Email, identity.Username)
+			if err != nil {
+				return 0, err
+			}
+			existing, err := models.GetUserIdentity(db, provider.Name, identity.Subject)
+			if err != nil {
+				return 0, err
+			}
+			return userID, models.TouchUserIdentity(db, existing.ID)
+		}
+		if err != sql.ErrNoRows {
+			return 0, err
+		}
+	}
+
+	base := identity.Username
+	if base == "" {
+		base, _, _ = strings.Cut(identity.Email, "@")
+	}
+	username, err := models.AvailableUsername(db, base)
+	if err != nil {
+		return 0, err
+	}
+
+	newUser := &models.NewOAuthUser{
+		Username:         username,
+		Fullname:         identity.Name,
+		PhotoURL:         identity.AvatarURL,
+		Provider:         provider.Name,
+		Subject:          identity.Subject,
+		ProviderUsername: identity.Username,
+	}
+	if strings.HasPrefix(identity.ProfileURL, "https://github.com/") {
+		newUser.GithubURL = identity.ProfileURL
+	}
+
+	// Only adopt addresses the provider has verified and nobody else claims
+	if identity.EmailVerified && validEmail(models.NormalizeEmail(identity.Email)) {
+		taken, err := models.EmailInUse(db, identity.Email, 0)
+		if err != nil {
+			return 0, err
+		}
+		if !taken {
+			newUser.Email = identity.Email
+			newUser.EmailVerified = true
+		}
+	}
+
+	return models.CreateOAuthUser(db, newUser)
+}
+
+// GetUserIdentities lists the provider accounts linked to the current user
+func GetUserIdentities(db *sql.DB) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		identities, err := models.GetUserIdentities(db, CurrentUser(c).ID)
+		if err != nil {
+			return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Could not fetch linked accounts"})
+		}
+
+		return c.JSON(http.StatusOK, identities)
+	}
+}
+
+// UnlinkUserIdentity removes a linked provider account. The last one can only
+// be removed if the user could still get in with a password reset.
+func UnlinkUserIdentity(db *sql.DB) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		user := CurrentUser(c)
+
+		id, err := strconv.Atoi(c.Param("id"))
+		if err != nil {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid identity ID"})
+		}
+
+		identities, err := models.GetUserIdentities(db, user.ID)
+		if err != nil {
+			return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Could not fetch linked accounts"})
+		}
+		if len(identities) == 1 && identities[0].ID == id && !user.EmailVerified {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": "Verify an email address before unlinking your last login provider"})
+		}
+
+		if err := models.DeleteUserIdentity(db, id, user.ID); err != nil {
+			if err == sql.ErrNoRows {
+				return c.JSON(http.StatusNotFound, map[string]string{"error": "Linked account not found"})
+			}
+			return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Could not unlink account"})
+		}
+
+		return c.JSON(http.StatusOK, map[string]string{"message": "Account unlinked"})
+	}
+}
@@ -0,0 +1,434 @@
+package handlers
+
+import (
+	"crypto/hmac"
+	"crypto/sha1"
+	"database/sql"
+	"encoding/base32"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"vibecoders/internal/testdb"
+	"vibecoders/mail"
+	"vibecoders/models"
+	"vibecoders/oauth"
+	"vibecoders/oauth/mockidp"
+
+	"github.com/labstack/echo/v4"
+)
+
+// oauthTest runs the OAuth handlers against a local mock identity provider
+type oauthTest struct {
+	t   *testing.T
+	db  *sql.DB
+	e   *echo.Echo
+	idp *httptest.Server
+}
+
+func newOAuthTest(t *testing.T) *oauthTest {
+	t.Helper()
+
+	var idp *mockidp.Server
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		idp.ServeHTTP(w, r)
+	}))
+	t.Cleanup(server.Close)
+
+	idp, err := mockidp.New(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	providers := oauth.Providers{"mock": {
+		Name:     "mock",
+		ClientID: "vibecoders",
+		Issuer:   server.URL,
+		Scopes:   []string{"openid", "email", "profile"},
+	}}
+
+	db := testdb.New(t)
+	// Emails stay in the outbox, where tests can read them
+	mailer := mail.NewMailer(db, nil, mail.NewTemplates(os.DirFS("../.."), "templates/email"), "noreply@example.com")
+
+	e := echo.New()
+	api := e.Group("/api", OptionalAuth(db))
+	api.GET("/oauth/:provider/login", StartOAuthLogin(db, providers))
+	api.GET("/oauth/:provider/callback", OAuthCallback(db, providers))
+	api.POST("/login/2fa", CompleteLoginChallenge(db))
+	api.GET("/user", GetCurrentUser(db), RequireAuth(db))
+	api.DELETE("/user", DeleteAccount(db), RequireAuth(db))
+	api.POST("/password/forgot", ForgotPassword(db, mailer))
+	api.POST("/password/reset", ResetPassword(db))
+
+	return &oauthTest{t: t, db: db, e: e, idp: server}
+}
+
+func (o *oauthTest) serve(req *http.Request) *httptest.ResponseRecorder {
+	rec := httptest.NewRecorder()
+	o.e.ServeHTTP(rec, req)
+	return rec
+}
+
+// start begins a login and returns the state cookie and the provider's
+// authorization URL
+func (o *oauthTest) start() (*http.Cookie, string) {
+	o.t.Helper()
+
+	rec := o.serve(httptest.NewRequest(http.MethodGet, "/api/oauth/mock/login", nil))
+	if rec.Code != http.StatusFound {
+		o.t.Fatalf("start: status %d: %s", rec.Code, rec.Body)
+	}
+
+	cookie := responseCookie(rec, oauthStateCookie)
+	if cookie == nil || cookie.Value == "" {
+		o.t.Fatal("start: no state cookie")
+	}
+
+	return cookie, rec.Header().Get("Location")
+}
+
+// authorize logs in at the mock provider as login and returns the callback
+// request the provider redirects to
+func (o *oauthTest) authorize(authURL, login string) *http.Request {
+	o.t.Helper()
+
+	target, err := url.Parse(authURL)
+	if err != nil {
+		o.t.Fatal(err)
+	}
+	if !strings.HasPrefix(authURL, o.idp.URL) {
+		o.t.Fatalf("authorize: redirected to %s, not the provider", authURL)
+	}
+	query := target.Query()
+	query.Set("login", login)
+	target.RawQuery = query.Encode()
+
+	client := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse }}
+	res, err := client.Get(target.String())
+	if err != nil {
+		o.t.Fatal(err)
+	}
+	res.Body.Close()
+	if res.StatusCode != http.StatusFound {
+		o.t.Fatalf("authorize: status %d", res.StatusCode)
+	}
+
+	callback, err := url.Parse(res.Header.Get("Location"))
+	if err != nil {
+		o.t.Fatal(err)
+	}
+	return httptest.NewRequest(http.MethodGet, callback.RequestURI(), nil)
+}
+
+// login runs the whole flow as login and returns the callback response
+func (o *oauthTest) login(login string) *httptest.ResponseRecorder {
+	o.t.Helper()
+
+	cookie, authURL := o.start()
+	req := o.authorize(authURL, login)
+	req.AddCookie(cookie)
+	return o.serve(req)
+}
+
+// currentUser fetches GET /api/user with the session from a login response
+func (o *oauthTest) currentUser(rec *httptest.ResponseRecorder) CurrentUserResponse {
+	o.t.Helper()
+
+	session := responseCookie(rec, "session_token")
+	if session == nil || session.Value == "" {
+		o.t.Fatalf("no session cookie, redirected to %s", rec.Header().Get("Location"))
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/api/user", nil)
+	req.AddCookie(session)
+	res := o.serve(req)
+	if res.Code != http.StatusOK {
+		o.t.Fatalf("GET /api/user: status %d: %s", res.Code, res.Body)
+	}
+
+	var user CurrentUserResponse
+	if err := json.Unmarshal(res.Body.Bytes(), &user); err != nil {
+		o.t.Fatal(err)
+	}
+	return user
+}
+
+func responseCookie(rec *httptest.ResponseRecorder, name string) *http.Cookie {
+	for _, cookie := range rec.Result().Cookies() {
+		if cookie.Name == name {
+			return cookie
+		}
+	}
+	return nil
+}
+
+// expectOAuthError checks the callback sent the browser back with an error
+// and without a session
+func expectOAuthError(t *testing.T, rec *httptest.ResponseRecorder) {
+	t.Helper()
+
+	if rec.Code != http.StatusFound || !strings.Contains(rec.Header().Get("Location"), "oauth_error=") {
+		t.Fatalf("expected an oauth_error redirect, got %d to %q", rec.Code, rec.Header().Get("Location"))
+	}
+	if session := responseCookie(rec, "session_token"); session != nil && session.Value != "" {
+		t.Fatal("a session was issued")
+	}
+}
+
+func TestOAuthLoginProvisionsUser(t *testing.T) {
+	o := newOAuthTest(t)
+
+	rec := o.login("alice")
+	if rec.Code != http.StatusFound || rec.Header().Get("Location") != "/" {
+		t.Fatalf("callback: expected redirect to /, got %d to %q", rec.Code, rec.Header().Get("Location"))
+	}
+
+	user := o.currentUser(rec)
+	if user.Username != "alice" {
+		t.Errorf("username = %q, want alice", user.Username)
+	}
+	if user.Email != "alice@example.com" || !user.EmailVerified {
+		t.Errorf("email = %q (verified %v), want the provider's verified address", user.Email, user.EmailVerified)
+	}
+
+	// Logging in again uses the linked identity instead of provisioning
+	again := o.currentUser(o.login("alice"))
+	if again.ID != user.ID {
+		t.Errorf("second login got user %d, want %d", again.ID, user.ID)
+	}
+}
+
+func TestOAuthCallbackRejectsStateMismatch(t *testing.T) {
+	o := newOAuthTest(t)
+
+	_, authURL := o.start()
+	req := o.authorize(authURL, "alice")
+	req.AddCookie(&http.Cookie{Name: oauthStateCookie, Value: "someone-elses-state"})
+	expectOAuthError(t, o.serve(req))
+
+	// Without the cookie at all
+	_, authURL = o.start()
+	expectOAuthError(t, o.serve(o.authorize(authURL, "alice")))
+}
+
+func TestOAuthCallbackRejectsReplayedState(t *testing.T) {
+	o := newOAuthTest(t)
+
+	cookie, authURL := o.start()
+	req := o.authorize(authURL, "alice")
+	req.AddCookie(cookie)
+	o.currentUser(o.serve(req))
+
+	replay := httptest.NewRequest(http.MethodGet, req.URL.RequestURI(), nil)
+	replay.AddCookie(cookie)
+	expectOAuthError(t, o.serve(replay))
+}
+
+func TestOAuthCallbackRejectsWrongNonce(t *testing.T) {
+	o := newOAuthTest(t)
+
+	cookie, authURL := o.start()
+	if _, err := o.db.Exec(`UPDATE oauth_states SET nonce = 'not-the-nonce-sent'`); err != nil {
+		t.Fatal(err)
+	}
+
+	req := o.authorize(authURL, "alice")
+	req.AddCookie(cookie)
+	expectOAuthError(t, o.serve(req))
+}
+
+func TestOAuthCallbackRejectsWrongCodeVerifier(t *testing.T) {
+	o := newOAuthTest(t)
+
+	cookie, authURL := o.start()
+	verifier, err := oauth.NewCodeVerifier()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := o.db.Exec(`UPDATE oauth_states SET code_verifier = ?`, verifier); err != nil {
+		t.Fatal(err)
+	}
+
+	req := o.authorize(authURL, "alice")
+	req.AddCookie(cookie)
+	expectOAuthError(t, o.serve(req))
+}
+
+// createUserWithEmail registers a password user and sets their address
+func createUserWithEmail(t *testing.T, db *sql.DB, username, email string, verified bool) int {
+	t.Helper()
+
+	if err := models.CreateUser(db, username, "password123", "", "", "", "", ""); err != nil {
+		t.Fatal(err)
+	}
+	user, err := models.GetUserByUsername(db, username)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := models.SetUserEmail(db, user.ID, email); err != nil {
+		t.Fatal(err)
+	}
+	if verified {
+		if _, err := db.Exec(`UPDATE users SET email_verified_at = CURRENT_TIMESTAMP WHERE id = ?`, user.ID); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return user.ID
+}
+
+func TestOAuthLinksByVerifiedEmail(t *testing.T) {
+	o := newOAuthTest(t)
+	userID := createUserWithEmail(t, o.db, "existing", "alice@example.com", true)
+
+	user := o.currentUser(o.login("alice"))
+	if user.ID != userID {
+		t.Fatalf("logged in as user %d, want the existing user %d", user.ID, userID)
+	}
+
+	identities, err := models.GetUserIdentities(o.db, userID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(identities) != 1 || identities[0].Subject != "mock|alice" {
+		t.Errorf("identities = %+v, want the mock account linked", identities)
+	}
+}
+
+func TestOAuthDoesNotLinkUnverifiedEmail(t *testing.T) {
+	o := newOAuthTest(t)
+	userID := createUserWithEmail(t, o.db, "claimer", "alice@example.com", false)
+
+	user := o.currentUser(o.login("alice"))
+	if user.ID == userID {
+		t.Fatal("logged into the account that only claimed the address")
+	}
+	if user.Email != "alice@example.com" || !user.EmailVerified {
+		t.Errorf("new user email = %q (verified %v), want the provider's verified address", user.Email, user.EmailVerified)
+	}
+}
+
+// totp computes the current code for a base32 secret
+func totp(t *testing.T, secret string) string {
+	t.Helper()
+
+	key, err := base32.StdEncoding.WithPadding(base32.NoPadding).DecodeString(strings.TrimRight(secret, "="))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var counter [8]byte
+	binary.BigEndian.PutUint64(counter[:], uint64(time.Now().Unix()/30))
+	mac := hmac.New(sha1.New, key)
+	mac.Write(counter[:])
+	sum := mac.Sum(nil)
+
+	offset := sum[len(sum)-1] & 0x0f
+	value := binary.BigEndian.Uint32(sum[offset:]) & 0x7fffffff
+	return fmt.Sprintf("%06d", value%1000000)
+}
+
+func TestOAuthLoginHandsOffToTwoFactor(t *testing.T) {
+	o := newOAuthTest(t)
+	userID := createUserWithEmail(t, o.db, "secure", "alice@example.com", true)
+
+	secret, err := models.BeginTOTPEnrollment(o.db, userID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	recoveryCodes, err := models.ConfirmTOTPEnrollment(o.db, userID, totp(t, secret))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rec := o.login("alice")
+	location, err := url.Parse(rec.Header().Get("Location"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	challenge := location.Query().Get("challenge")
+	if rec.Code != http.StatusFound || location.Path != "/login" || challenge == "" {
+		t.Fatalf("expected a redirect to /login with a challenge, got %d to %q", rec.Code, location)
+	}
+	if session := responseCookie(rec, "session_token"); session != nil && session.Value != "" {
+		t.Fatal("a session was issued before the second factor")
+	}
+
+	complete := func(code string) *httptest.ResponseRecorder {
+		body := fmt.Sprintf(`{"challenge": %q, "code": %q}`, challenge, code)
+		req := httptest.NewRequest(http.MethodPost, "/api/login/2fa", strings.NewReader(body))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		return o.serve(req)
+	}
+
+	if res := complete("000000"); res.Code != http.StatusUnauthorized {
+		t.Fatalf("wrong code: status %d, want 401", res.Code)
+	}
+
+	user := o.currentUser(complete(recoveryCodes[0]))
+	if user.ID != userID {
+		t.Errorf("logged in as user %d, want %d", user.ID, userID)
+	}
+}
+
+var resetToken = regexp.MustCompile(`reset-password\?token=(\S+)`)
+
+// An account provisioned by a provider has a random password, so without 2FA
+// its owner confirms deletion with a password set through a reset
+func TestOAuthUserDeletesAccountAfterPasswordReset(t *testing.T) {
+	o := newOAuthTest(t)
+
+	send := func(method, path, body string, session *http.Cookie) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		if session != nil {
+			req.AddCookie(session)
+		}
+		return o.serve(req)
+	}
+
+	rec := o.login("alice")
+	user := o.currentUser(rec)
+	session := responseCookie(rec, "session_token")
+
+	if res := send(http.MethodDelete, "/api/user", `{"password": "password123"}`, session); res.Code != http.StatusForbidden {
+		t.Fatalf("delete before reset: status %d, want 403", res.Code)
+	}
+
+	if res := send(http.MethodPost, "/api/password/forgot", `{"email": "alice@example.com"}`, nil); res.Code != http.StatusAccepted {
+		t.Fatalf("forgot: status %d: %s", res.Code, res.Body)
+	}
+
+	var body string
+	err := o.db.QueryRow(`SELECT text_body FROM email_outbox WHERE to_address = ?`, "alice@example.com").Scan(&body)
+	if err != nil {
+		t.Fatalf("no reset email: %v", err)
+	}
+	match := resetToken.FindStringSubmatch(body)
+	if match == nil {
+		t.Fatalf("no reset link in %q", body)
+	}
+
+	reset := fmt.Sprintf(`{"token": %q, "new_password": "password123", "confirm_password": "password123"}`, match[1])
+	if res := send(http.MethodPost, "/api/password/reset", reset, nil); res.Code != http.StatusOK {
+		t.Fatalf("reset: status %d: %s", res.Code, res.Body)
+	}
+
+	// The reset revoked every session, so log in through the provider again
+	session = responseCookie(o.login("alice"), "session_token")
+	if res := send(http.MethodDelete, "/api/user", `{"password": "password123"}`, session); res.Code != http.StatusOK {
+		t.Fatalf("delete after reset: status %d: %s", res.Code, res.Body)
+	}
+
+	if _, err := models.GetDeletedUserByID(o.db, user.ID); err != nil {
+		t.Errorf("user %d is not deleted: %v", user.ID, err)
+	}
+}
@@ -0,0 +1,221 @@
+package handlers
+
+import (
+	"database/sql"
+	"net/http"
+	"strings"
+	"time"
+
+	"vibecoders/mail"
+	"vibecoders/models"
+
+	"github.com/labstack/echo/v4"
+)
+
+// Password length limits apply wherever a password is set. bcrypt only
+// accepts passwords up to 72 bytes.
+const (
+	minPasswordLength = 8
+	maxPasswordBytes  = 72
+)
+
+var (
+	passwordResetAddressLimiter = newRateLimiter(3, time.Hour)
+	passwordResetIPLimiter      = newRateLimiter(10, time.Hour)
+)
+
+type ChangePasswordRequest struct {
+	CurrentPassword string `json:"current_password"`
+	NewPassword     string `json:"new_password"`
+	ConfirmPassword string `json:"confirm_password"`
+}
+
+type ForgotPasswordRequest struct {
+	Email string `json:"email"`
+}
+
+type ResetPasswordRequest struct {
+	Token           string `json:"token"`
+	NewPassword     string `json:"new_password"`
+	ConfirmPassword string `json:"confirm_password"`
+}
+
+// validateNewPassword returns a user-facing error message, or "" if the
+// password is acceptable
+func validateNewPassword(password, confirm string) string {
+	if len(password) < minPasswordLength {
+		return "Password must be at least 8 characters"
+	}
+	if len(password) > maxPasswordBytes {
+		return "Password must be at most 72 bytes"
+	}
+	if password != confirm {
+		return "Passwords do not match"
+	}
+	return ""
+}
+
+// checkPassword verifies a password for an already authenticated user. The
+// user on the context is loaded without the password hash, so it is fetched.
+// Wrong passwords count as failed logins for the account, so a stolen session
+// cannot be used to guess it.
+func checkPassword(c echo.Context, db *sql.DB, user *models.User, password string) *authError {
+	if authErr := loginThrottled(c, db, models.UsernameThrottleKey(user.Username)); authErr != nil {
+		return authErr
+	}
+
+	stored, err := models.GetUserByUsername(db, user.Username)
+	if err != nil {
+		return &authError{http.StatusInternalServerError, "Could not verify password"}
+	}
+
+	if match, _ := models.VerifyPassword(stored.Password, password); !match {
+		recordLoginFailure(c, db, user.Username)
+		return &authError{http.StatusForbidden, "Password is incorrect"}
+	}
+
+	return nil
+}
+
+// ChangePassword sets a new password for the current user after checking the
+// current one. Every other session is signed out and access tokens are
+// revoked; this session stays logged in.
+func ChangePassword(db *sql.DB) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		user := CurrentUser(c)
+
+		var req ChangePasswordRequest
+		if err := c.Bind(&req); err != nil {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid request"})
+		}
+
+		if authErr := checkPassword(c, db, user, req.CurrentPassword); authErr != nil {
+			return c.JSON(authErr.status, map[string]string{"error": authErr.message})
+		}
+
+		if msg := validateNewPassword(req.NewPassword, req.ConfirmPassword); msg != "" {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": msg})
+		}
+
+		if err := models.SetUserPassword(db, user.ID, req.NewPassword); err != nil {
+			return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Could not update password"})
+		}
+
+		if session := CurrentSession(c); session != nil {
+			err := models.DeleteOtherUserSessions(db, user.ID, session.ID)
+			if err != nil {
+				c.Logger().Errorf("could not revoke other sessions for user %d: %v", user.ID, err)
+			}
+		}
+		if err := models.RevokeUserMagicLinks(db, user.ID); err != nil {
+			c.Logger().Errorf("could not revoke magic links for user %d: %v", user.ID, err)
+		}
+		if err := models.RevokeUserAccessTokens(db, user.ID); err != nil {
+			c.Logger().Errorf("could not revoke access tokens for user %d: %v", user.ID, err)
+		}
+
+		return c.JSON(http.StatusOK, map[string]string{"message": "Password updated"})
+	}
+}
+
+// ForgotPassword emails a password reset link to a verified address. Like the
+// email login endpoint, the response never reveals whether an account exists.
+func ForgotPassword(db *sql.DB, mailer *mail.Mailer) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		var req ForgotPasswordRequest
+		if err := c.Bind(&req); err != nil {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid request"})
+		}
+
+		email := models.NormalizeEmail(req.Email)
+		if email == "" || !strings.Contains(email, "@") {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": "A valid email address is required"})
+		}
+
+		if !passwordResetIPLimiter.Allow(c.RealIP()) {
+			c.Response().Header().Set("Retry-After", "3600")
+			return c.JSON(http.StatusTooManyRequests, map[string]string{"error": "Too many password reset requests, try again later"})
+		}
+
+		accepted := func() error {
+			return c.JSON(http.StatusAccepted, map[string]string{
+				"message": "If an account with that email exists, a password reset link is on its way",
+			})
+		}
+
+		if !passwordResetAddressLimiter.Allow(email) {
+			return accepted()
+		}
+
+		userID, err := models.GetUserIDByVerifiedEmail(db, email)
+		if err != nil {
+			if err != sql.ErrNoRows {
+				c.Logger().Errorf("password reset lookup failed: %v", err)
+			}
+			return accepted()
+		}
+
+		user, err := models.GetUserByID(db, userID)
+		if err != nil {
+			c.Logger().Errorf("password reset could not fetch user %d: %v", userID, err)
+			return accepted()
+		}
+
+		token, err := models.CreatePasswordResetToken(db, user.ID)
+		if err != nil {
+			c.Logger().Errorf("password reset could not create token for user %d: %v", user.ID, err)
+			return accepted()
+		}
+
+		err = mailer.Enqueue(email, "Reset your VibeCoders password", "password_reset", map[string]interface{}{
+			"Username":         user.Username,
+			"ResetURL":         absoluteURL("/reset-password?token=" + token),
+			"ExpiresInMinutes": int(models.PasswordResetTTL / time.Minute),
+		})
+		if err != nil {
+			c.Logger().Errorf("password reset could not queue email for user %d: %v", user.ID, err)
+		}
+
+		return accepted()
+	}
+}
+
+// ResetPassword sets a new password using a token from a reset email. All of
+// the user's sessions, magic links and access tokens are revoked so they must
+// log in again.
+func ResetPassword(db *sql.DB) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		var req ResetPasswordRequest
+		if err := c.Bind(&req); err != nil {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid request"})
+		}
+
+		if msg := validateNewPassword(req.NewPassword, req.ConfirmPassword); msg != "" {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": msg})
+		}
+
+		userID, err := models.ConsumePasswordResetToken(db, req.Token)
+		if err != nil {
+			if err == sql.ErrNoRows {
+				return c.JSON(http.StatusBadRequest, map[string]string{"error": "Reset link is invalid or has expired"})
+			}
+			return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Could not reset password"})
+		}
+
+		if err := models.SetUserPassword(db, userID, req.NewPassword); err != nil {
+			return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Could not update password"})
+		}
+
+		if err := models.DeleteUserSessions(db, userID); err != nil {
+			c.Logger().Errorf("could not revoke sessions for user %d: %v", userID, err)
+		}
+		if err := models.RevokeUserMagicLinks(db, userID); err != nil {
+			c.Logger().Errorf("could not revoke magic links for user %d: %v", userID, err)
+		}
+		if err := models.RevokeUserAccessTokens(db, userID); err != nil {
+			c.Logger().Errorf("could not revoke access tokens for user %d: %v", userID, err)
+		}
+
+		return c.JSON(http.StatusOK, map[string]string{"message": "Password has been reset, please log in"})
+	}
+}
@@ -22,19 +22,7 @@ type ProjectRequest struct {
 // GetUserProjects retrieves all projects for the current user
 func GetUserProjects(db *sql.DB) echo.HandlerFunc {
 	return func(c echo.Context) error {
-		// Get user ID from session
-		cookie, err := c.Cookie("session_token")
-		if err != nil {
-			if err == http.ErrNoCookie {
-				return c.JSON(http.StatusUnauthorized, map[string]string{"error": "Not logged in"})
-			}
-			return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Server error"})
-		}
-
-		userID, err := models.GetUserIDByToken(db, cookie.Value)
-		if err != nil {
-			return c.JSON(http.StatusUnauthorized, map[string]string{"error": "Invalid session"})
-		}
+		userID := CurrentUser(c).ID
 
 		projects, err := models.GetProjectsByUserID(db, userID)
 		if err != nil {
@@ -48,19 +36,7 @@ func GetUserProjects(db *sql.DB) echo.HandlerFunc {
 // CreateProject adds a new project for the current user
 func CreateProject(db *sql.DB) echo.HandlerFunc {
 	return func(c echo.Context) error {
-		// Get user ID from session
-		cookie, err := c.Cookie("session_token")
-		if err != nil {
-			if err == http.ErrNoCookie {
-				return c.JSON(http.StatusUnauthorized, map[string]string{"error": "Not logged in"})
-			}
-			return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Server error"})
-		}
-
-		userID, err := models.GetUserIDByToken(db, cookie.Value)
-		if err != nil {
-			return c.JSON(http.StatusUnauthorized, map[string]string{"error": "Invalid session"})
-		}
+		userID := CurrentUser(c).ID
 
 		var req ProjectRequest
 		if err := c.Bind(&req); err != nil {
@@ -98,19 +74,7 @@ func UpdateProject(db *sql.DB) echo.HandlerFunc {
 			return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid project ID"})
 		}
 
-		// Get user ID from session
-		cookie, err := c.Cookie("session_token")
-		if err != nil {
-			if err == http.ErrNoCookie {
-				return c.JSON(http.StatusUnauthorized, map[string]string{"error": "Not logged in"})
-			}
-			return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Server error"})
-		}
-
-		userID, err := models.GetUserIDByToken(db, cookie.Value)
-		if err != nil {
-			return c.JSON(http.StatusUnauthorized, map[string]string{"error": "Invalid session"})
-		}
+		userID := CurrentUser(c).ID
 
 		// Check if project exists and belongs to the user
 		project, err := models.GetProjectByID(db, projectID)
@@ -161,19 +125,7 @@ func DeleteProject(db *sql.DB) echo.HandlerFunc {
 			return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid project ID"})
 		}
 
-		// Get user ID from session
-		cookie, err := c.Cookie("session_token")
-		if err != nil {
-			if err == http.ErrNoCookie {
-				return c.JSON(http.StatusUnauthorized, map[string]string{"error": "Not logged in"})
-			}
-			return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Server error"})
-		}
-
-		userID, err := models.GetUserIDByToken(db, cookie.Value)
-		if err != nil {
-			return c.JSON(http.StatusUnauthorized, map[string]string{"error": "Invalid session"})
-		}
+		userID := CurrentUser(c).ID
 
 		// Check if project exists and belongs to the user
 		project, err := models.GetProjectByID(db, projectID)
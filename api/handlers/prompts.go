@@ -18,19 +18,7 @@ type PromptRequest struct {
 // GetUserPrompts retrieves all prompts for the current user
 func GetUserPrompts(db *sql.DB) echo.HandlerFunc {
 	return func(c echo.Context) error {
-		// Get user ID from session
-		cookie, err := c.Cookie("session_token")
-		if err != nil {
-			if err == http.ErrNoCookie {
-				return c.JSON(http.StatusUnauthorized, map[string]string{"error": "Not logged in"})
-			}
-			return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Server error"})
-		}
-
-		userID, err := models.GetUserIDByToken(db, cookie.Value)
-		if err != nil {
-			return c.JSON(http.StatusUnauthorized, map[string]string{"error": "Invalid session"})
-		}
+		userID := CurrentUser(c).ID
 
 		prompts, err := models.GetPromptsByUserID(db, userID)
 		if err != nil {
@@ -44,19 +32,7 @@ func GetUserPrompts(db *sql.DB) echo.HandlerFunc {
 // CreatePrompt adds a new prompt for the current user
 func CreatePrompt(db *sql.DB) echo.HandlerFunc {
 	return func(c echo.Context) error {
-		// Get user ID from session
-		cookie, err := c.Cookie("session_token")
-		if err != nil {
-			if err == http.ErrNoCookie {
-				return c.JSON(http.StatusUnauthorized, map[string]string{"error": "Not logged in"})
-			}
-			return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Server error"})
-		}
-
-		userID, err := models.GetUserIDByToken(db, cookie.Value)
-		if err != nil {
-			return c.JSON(http.StatusUnauthorized, map[string]string{"error": "Invalid session"})
-		}
+		userID := CurrentUser(c).ID
 
 		var req PromptRequest
 		if err := c.Bind(&req); err != nil {
@@ -93,19 +69,7 @@ func UpdatePrompt(db *sql.DB) echo.HandlerFunc {
 			return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid prompt ID"})
 		}
 
-		// Get user ID from session
-		cookie, err := c.Cookie("session_token")
-		if err != nil {
-			if err == http.ErrNoCookie {
-				return c.JSON(http.StatusUnauthorized, map[string]string{"error": "Not logged in"})
-			}
-			return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Server error"})
-		}
-
-		userID, err := models.GetUserIDByToken(db, cookie.Value)
-		if err != nil {
-			return c.JSON(http.StatusUnauthorized, map[string]string{"error": "Invalid session"})
-		}
+		userID := CurrentUser(c).ID
 
 		// Check if prompt exists and belongs to the user
 		prompt, err := models.GetPromptByID(db, promptID)
@@ -155,19 +119,7 @@ func DeletePrompt(db *sql.DB) echo.HandlerFunc {
 			return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid prompt ID"})
 		}
 
-		// Get user ID from session
-		cookie, err := c.Cookie("session_token")
-		if err != nil {
-			if err == http.ErrNoCookie {
-				return c.JSON(http.StatusUnauthorized, map[string]string{"error": "Not logged in"})
-			}
-			return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Server error"})
-		}
-
-		userID, err := models.GetUserIDByToken(db, cookie.Value)
-		if err != nil {
-			return c.JSON(http.StatusUnauthorized, map[string]string{"error": "Invalid session"})
-		}
+		userID := CurrentUser(c).ID
 
 		// Check if prompt exists and belongs to the user
 		prompt, err := models.GetPromptByID(db, promptID)
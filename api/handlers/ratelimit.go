@@ -0,0 +1,75 @@
+package handlers
+
+import (
+	"sync"
+	"time"
+)
+
+// rateLimiter is an in-memory sliding window limiter allowing at most limit
+// events per key within window
+type rateLimiter struct {
+	mu     sync.Mutex
+	limit  int
+	window time.Duration
+	events map[string][]time.Time
+	swept  time.Time
+}
+
+func newRateLimiter(limit int, window time.Duration) *rateLimiter {
+	return &rateLimiter{
+		limit:  limit,
+		window: window,
+		events: make(map[string][]time.Time),
+	}
+}
+
+// Allow records an event for key and reports whether it is within the limit
+func (r *rateLimiter) Allow(key string) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	now := time.Now()
+	cutoff := now.Add(-r.window)
+
+	recent := r.events[key][:0]
+	for _, t := range r.events[key] {
+		if t.After(cutoff) {
+			recent = append(recent, t)
+		}
+	}
+
+	// Drop stale keys once per window so the map does not grow without bound
+	if now.Sub(r.swept) > r.window {
+		for k, times := range r.events {
+			if k != key && (len(times) == 0 || !times[len(times)-1].After(cutoff)) {
+				delete(r.events, k)
+			}
+		}
+		r.swept = now
+	}
+
+	if len(recent) >= r.limit {
+		r.events[key] = recent
+		return false
+	}
+
+	r.events[key] = append(recent, now)
+	return true
+}
+
+// Blocked reports whether key has reached the limit, without recording an
+// event. Used where only failures count towards the limit.
+func (r *rateLimiter) Blocked(key string) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	cutoff := time.Now().Add(-r.window)
+	count := 0
+	for _, t := range r.events[key] {
+		if t.After(cutoff) {
+			count++
+		}
+	}
+
+	return count >= r.limit
+}
@@ -0,0 +1,59 @@
+package handlers
+
+import (
+	"errors"
+	"net/url"
+	"strings"
+)
+
+// AllowedRedirectHosts lists external hosts that magic links may redirect to
+// after login. Anything else must be a same-origin path. Set from the
+// REDIRECT_ALLOWED_HOSTS environment variable in main.
+var AllowedRedirectHosts []string
+
+var errInvalidRedirect = errors.New("redirect_url must be a path on this site or an allowed host")
+
+// normalizeRedirectURL validates a post-login redirect target and returns it in
+// canonical form. Empty input becomes "/".
+func normalizeRedirectURL(raw string) (string, error) {
+	raw = strings.TrimSpace(raw)
+	if raw == "" {
+		return "/", nil
+	}
+
+	// Browsers treat backslashes like slashes ("/\evil.com") and strip control
+	// characters, so neither can be allowed through
+	if strings.ContainsAny(raw, "\\") || strings.IndexFunc(raw, func(r rune) bool { return r < 0x20 || r == 0x7f }) >= 0 {
+		return "", errInvalidRedirect
+	}
+
+	u, err := url.Parse(raw)
+	if err != nil {
+		return "", errInvalidRedirect
+	}
+
+	// Same-origin path: must be absolute and must not be protocol-relative
+	if u.Scheme == "" && u.Host == "" && u.User == nil {
+		if !strings.HasPrefix(raw, "/") || strings.HasPrefix(raw, "//") {
+			return "", errInvalidRedirect
+		}
+		return u.String(), nil
+	}
+
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return "", errInvalidRedirect
+	}
+	if u.User != nil {
+		return "", errInvalidRedirect
+	}
+
+	host := strings.ToLower(u.Hostname())
+	for _, allowed := range AllowedRedirectHosts {
+		if host == strings.ToLower(allowed) {
+			u.Host = strings.ToLower(u.Host)
+			return u.String(), nil
+		}
+	}
+
+	return "", errInvalidRedirect
+}
@@ -0,0 +1,187 @@
+package handlers
+
+import (
+	"database/sql"
+	"net/http"
+	"strconv"
+	"vibecoders/models"
+
+	"github.com/labstack/echo/v4"
+)
+
+// RoleRequest names a role to grant
+type RoleRequest struct {
+	Role string `json:"role"`
+}
+
+// RequirePermission only lets through logged-in users whose roles grant every
+// listed permission. Must run after RequireAuth.
+func RequirePermission(db *sql.DB, permissions ...string) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			user := CurrentUser(c)
+			if user == nil {
+				return c.JSON(http.StatusUnauthorized, map[string]string{"error": "Not logged in"})
+			}
+
+			for _, permission := range permissions {
+				has, err := models.UserHasPermission(db, user.ID, permission)
+				if err != nil {
+					return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Server error"})
+				}
+				if !has {
+					return c.JSON(http.StatusForbidden, map[string]string{"error": "Missing permission: " + permission})
+				}
+			}
+
+			return next(c)
+		}
+	}
+}
+
+// changeUserRole grants or revokes a role on behalf of the current user and
+// records it in the audit log. Administrators cannot revoke their own admin
+// role, so a site always keeps someone able to undo mistakes.
+func changeUserRole(c echo.Context, db *sql.DB, user *models.User, role string, grant bool) *authError {
+	actor := CurrentUser(c)
+
+	before, err := models.GetUserRoles(db, user.ID)
+	if err != nil {
+		return &authError{http.StatusInternalServerError, "Could not fetch roles"}
+	}
+
+	action := models.AuditRoleGrant
+	if grant {
+		err := models.GrantRole(db, user.ID, role, actor.ID)
+		if err == models.ErrUnknownRole {
+			return &authError{http.StatusBadRequest, "Unknown role: " + role}
+		}
+		if err != nil {
+			return &authError{http.StatusInternalServerError, "Could not grant role"}
+		}
+	} else {
+		action = models.AuditRoleRevoke
+		if role == models.RoleAdmin && user.ID == actor.ID {
+			return &authError{http.StatusBadRequest, "You cannot remove your own administrator role"}
+		}
+
+		switch err := models.RevokeRole(db, user.ID, role); err {
+		case nil, sql.ErrNoRows:
+			// Revoking a role the user does not hold leaves them as requested
+		case models.ErrLastAdmin:
+			return &authError{http.StatusConflict, "Cannot remove the last administrator"}
+		default:
+			return &authError{http.StatusInternalServerError, "Could not revoke role"}
+		}
+	}
+
+	after, err := models.GetUserRoles(db, user.ID)
+	if err != nil {
+		return &authError{http.StatusInternalServerError, "Could not fetch roles"}
+	}
+
+	changes := models.DiffFields(map[string]interface{}{"roles": before}, map[string]interface{}{"roles": after})
+	if len(changes) > 0 {
+		recordUserAudit(c, db, action, user, changes)
+	}
+
+	return nil
+}
+
+// GetRoles lists the available roles and their permissions
+func GetRoles(db *sql.DB) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		roles, err := models.GetRoles(db)
+		if err != nil {
+			return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Could not fetch roles"})
+		}
+
+		return c.JSON(http.StatusOK, roles)
+	}
+}
+
+// userRolesResponse returns a user's current roles and effective permissions
+func userRolesResponse(c echo.Context, db *sql.DB, userID int) error {
+	roles, err := models.GetUserRoles(db, userID)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Could not fetch roles"})
+	}
+
+	permissions, err := models.GetUserPermissions(db, userID)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Could not fetch permissions"})
+	}
+
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"user_id":     userID,
+		"roles":       roles,
+		"permissions": permissions,
+	})
+}
+
+// roleTargetUser parses and loads the :id of the user whose roles change
+func roleTargetUser(c echo.Context, db *sql.DB) (*models.User, *authError) {
+	userID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		return nil, &authError{http.StatusBadRequest, "Invalid user ID"}
+	}
+
+	user, err := models.GetUserByID(db, userID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, &authError{http.StatusNotFound, "User not found"}
+		}
+		return nil, &authError{http.StatusInternalServerError, "Could not fetch user"}
+	}
+
+	return user, nil
+}
+
+// GetUserRoles lists a user's roles and effective permissions
+func GetUserRoles(db *sql.DB) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		user, authErr := roleTargetUser(c, db)
+		if authErr != nil {
+			return c.JSON(authErr.status, map[string]string{"error": authErr.message})
+		}
+
+		return userRolesResponse(c, db, user.ID)
+	}
+}
+
+// GrantUserRole gives a user a role
+func GrantUserRole(db *sql.DB) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		user, authErr := roleTargetUser(c, db)
+		if authErr != nil {
+			return c.JSON(authErr.status, map[string]string{"error": authErr.message})
+		}
+
+		var req RoleRequest
+		if err := c.Bind(&req); err != nil || req.Role == "" {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": "Role is required"})
+		}
+
+		if authErr := changeUserRole(c, db, user, req.Role, true); authErr != nil {
+			return c.JSON(authErr.status, map[string]string{"error": authErr.message})
+		}
+
+		return userRolesResponse(c, db, user.ID)
+	}
+}
+
+// RevokeUserRole takes a role away from a user
+func RevokeUserRole(db *sql.DB) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		user, authErr := roleTargetUser(c, db)
+		if authErr != nil {
+			return c.JSON(authErr.status, map[string]string{"error": authErr.message})
+		}
+
+		if authErr := changeUserRole(c, db, user, c.Param("role"), false); authErr != nil {
+			return c.JSON(authErr.status, map[string]string{"error": authErr.message})
+		}
+
+		return userRolesResponse(c, db, user.ID)
+	}
+}
@@ -0,0 +1,105 @@
+package handlers
+
+import (
+	"database/sql"
+	"net/http"
+	"strconv"
+	"time"
+
+	"vibecoders/models"
+
+	"github.com/labstack/echo/v4"
+)
+
+// setSessionCookie hands the session token to the browser. The server enforces
+// the sliding expiry; the cookie itself lives as long as a session possibly can.
+func setSessionCookie(c echo.Context, token string) {
+	cookie := new(http.Cookie)
+	cookie.Name = "session_token"
+	cookie.Value = token
+	cookie.Path = "/"
+	cookie.HttpOnly = true
+	cookie.Secure = secureCookies()
+	cookie.SameSite = http.SameSiteLaxMode
+	cookie.MaxAge = int(models.SessionMaxAge / time.Second)
+	c.SetCookie(cookie)
+}
+
+// clearSessionCookie removes the session cookie from the browser
+func clearSessionCookie(c echo.Context) {
+	cookie := new(http.Cookie)
+	cookie.Name = "session_token"
+	cookie.Value = ""
+	cookie.Path = "/"
+	cookie.MaxAge = -1
+	c.SetCookie(cookie)
+
+	clearCSRFCookie(c)
+}
+
+// GetSessions lists the current user's active sessions (devices)
+func GetSessions(db *sql.DB) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		userID := CurrentUser(c).ID
+
+		sessions, err := models.GetUserSessions(db, userID)
+		if err != nil {
+			return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Could not fetch sessions"})
+		}
+
+		if current := CurrentSession(c); current != nil {
+			for i := range sessions {
+				sessions[i].Current = sessions[i].ID == current.ID
+			}
+		}
+
+		return c.JSON(http.StatusOK, sessions)
+	}
+}
+
+// RevokeSession logs out a single device belonging to the current user
+func RevokeSession(db *sql.DB) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		sessionID, err := strconv.Atoi(c.Param("id"))
+		if err != nil {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid session ID"})
+		}
+
+		userID := CurrentUser(c).ID
+
+		err = models.DeleteUserSession(db, sessionID, userID)
+		if err != nil {
+			if err == sql.ErrNoRows {
+				return c.JSON(http.StatusNotFound, map[string]string{"error": "Session not found"})
+			}
+			return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Could not revoke session"})
+		}
+
+		if current := CurrentSession(c); current != nil && current.ID == sessionID {
+			clearSessionCookie(c)
+		}
+
+		return c.JSON(http.StatusOK, map[string]string{"message": "Session revoked successfully"})
+	}
+}
+
+// RevokeAllSessions logs the current user out everywhere, including this
+// device, and invalidates their magic links
+func RevokeAllSessions(db *sql.DB) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		userID := CurrentUser(c).ID
+
+		if err := models.DeleteUserSessions(db, userID); err != nil {
+			return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Could not revoke sessions"})
+		}
+
+		// Outstanding magic links would let someone straight back in
+		if err := models.RevokeUserMagicLinks(db, userID); err != nil {
+			return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Could not revoke magic links"})
+		}
+
+		clearSessionCookie(c)
+
+		return c.JSON(http.StatusOK, map[string]string{"message": "Logged out everywhere"})
+	}
+}
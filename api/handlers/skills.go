@@ -0,0 +1,486 @@
+package handlers
+
+import (
+	"database/sql"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"vibecoders/models"
+
+	"github.com/labstack/echo/v4"
+)
+
+// skillPage reads the page and pageSize query parameters for skill lists
+func skillPage(c echo.Context) (int, int) {
+	page, err := strconv.Atoi(c.QueryParam("page"))
+	if err != nil || page < 1 {
+		page = 1
+	}
+
+	pageSize, err := strconv.Atoi(c.QueryParam("pageSize"))
+	if err != nil || pageSize < 1 || pageSize > 100 {
+		pageSize = 50 // Default page size
+	}
+
+	return page, pageSize
+}
+
+func skillPagination(total, page, pageSize int) map[string]interface{} {
+	return map[string]interface{}{
+		"total":      total,
+		"page":       page,
+		"pageSize":   pageSize,
+		"totalPages": (total + pageSize - 1) / pageSize,
+	}
+}
+
+// GetSkills lists a page of the approved skills taxonomy with how many people
+// list each skill. Optional ?category= narrows it to one category.
+func GetSkills(db *sql.DB) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		category := c.QueryParam("category")
+		if category != "" && !models.ValidSkillCategory(category) {
+			return c.JSON(http.StatusBadRequest, map[string]string{
+				"error": "category must be one of " + strings.Join(models.SkillCategories, ", "),
+			})
+		}
+
+		page, pageSize := skillPage(c)
+		skills, err := models.GetSkills(db, category, page, pageSize)
+		if err != nil {
+			return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Could not fetch skills"})
+		}
+
+		total, err := models.GetSkillCount(db, category)
+		if err != nil {
+			return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Could not count skills"})
+		}
+
+		return c.JSON(http.StatusOK, map[string]interface{}{
+			"skills":     skills,
+			"pagination": skillPagination(total, page, pageSize),
+		})
+	}
+}
+
+// AutocompleteSkills suggests skills whose name or alias starts with ?q=
+func AutocompleteSkills(db *sql.DB) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		prefix := models.NormalizeSkillName(c.QueryParam("q"))
+		if prefix == "" {
+			return c.JSON(http.StatusOK, []models.Skill{})
+		}
+
+		limit, err := strconv.Atoi(c.QueryParam("limit"))
+		if err != nil || limit < 1 || limit > 25 {
+			limit = 10 // Default limit
+		}
+
+		skills, err := models.SuggestSkills(db, prefix, limit)
+		if err != nil {
+			return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Could not fetch skills"})
+		}
+
+		return c.JSON(http.StatusOK, skills)
+	}
+}
+
+// GetMySkills returns the skills on the current user's profile
+func GetMySkills(db *sql.DB) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		skills, err := models.GetUserSkills(db, CurrentUser(c).ID)
+		if err != nil {
+			return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Could not fetch skills"})
+		}
+
+		return c.JSON(http.StatusOK, skills)
+	}
+}
+
+type UpdateSkillsRequest struct {
+	Skills []models.UserSkillInput `json:"skills"`
+}
+
+// UpdateMySkills replaces the skills on the current user's profile
+func UpdateMySkills(db *sql.DB) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		var req UpdateSkillsRequest
+		if err := c.Bind(&req); err != nil {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid request"})
+		}
+
+		if len(req.Skills) > models.MaxUserSkills {
+			return c.JSON(http.StatusBadRequest, map[string]string{
+				"error": fmt.Sprintf("You can list at most %d skills", models.MaxUserSkills),
+			})
+		}
+
+		for i := range req.Skills {
+			skill := &req.Skills[i]
+			skill.Name = models.NormalizeSkillName(skill.Name)
+			if skill.Name == "" {
+				return c.JSON(http.StatusBadRequest, map[string]string{
+					"error": fmt.Sprintf("Skill names must be 1 to %d characters", models.MaxSkillNameLength),
+				})
+			}
+			if skill.Proficiency == "" {
+				skill.Proficiency = "intermediate"
+			}
+			if !models.ValidSkillProficiency(skill.Proficiency) {
+				return c.JSON(http.StatusBadRequest, map[string]string{
+					"error": "proficiency must be one of " + strings.Join(models.SkillProficiencies, ", "),
+				})
+			}
+			if skill.Years < 0 || skill.Years > models.MaxSkillYears {
+				return c.JSON(http.StatusBadRequest, map[string]string{
+					"error": fmt.Sprintf("years must be between 0 and %d", models.MaxSkillYears),
+				})
+			}
+		}
+
+		userID := CurrentUser(c).ID
+		if err := models.SetUserSkills(db, userID, req.Skills); err != nil {
+			return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Could not update skills"})
+		}
+
+		skills, err := models.GetUserSkills(db, userID)
+		if err != nil {
+			return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Could not fetch skills"})
+		}
+
+		return c.JSON(http.StatusOK, skills)
+	}
+}
+
+// Admin curation
+
+type SkillRequest struct {
+	Name     string `json:"name"`
+	Category string `json:"category"`
+}
+
+// validate normalizes the request, returning a message if it is invalid
+func (req *SkillRequest) validate() string {
+	req.Name = models.NormalizeSkillName(req.Name)
+	if req.Name == "" {
+		return fmt.Sprintf("Skill names must be 1 to %d characters", models.MaxSkillNameLength)
+	}
+	if req.Category == "" {
+		req.Category = "other"
+	}
+	if !models.ValidSkillCategory(req.Category) {
+		return "category must be one of " + strings.Join(models.SkillCategories, ", ")
+	}
+	return ""
+}
+
+// skillFromParam loads the skill named by the :id path parameter
+func skillFromParam(c echo.Context, db *sql.DB) (*models.Skill, *authError) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		return nil, &authError{http.StatusBadRequest, "Invalid skill ID"}
+	}
+
+	skill, err := models.GetSkillByID(db, id)
+	if err == sql.ErrNoRows {
+		return nil, &authError{http.StatusNotFound, "Skill not found"}
+	}
+	if err != nil {
+		return nil, &authError{http.StatusInternalServerError, "Could not fetch skill"}
+	}
+
+	return skill, nil
+}
+
+func recordSkillAudit(c echo.Context, db *sql.DB, action string, skill *models.Skill, changes models.AuditChanges) {
+	recordAudit(c, db, action, "skill", strconv.Itoa(skill.ID), skill.Name, changes)
+}
+
+// CreateSkill adds a skill to the taxonomy
+func CreateSkill(db *sql.DB) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		var req SkillRequest
+		if err := c.Bind(&req); err != nil {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid request"})
+		}
+		if message := req.validate(); message != "" {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": message})
+		}
+
+		id, err := models.CreateSkill(db, req.Name, req.Category)
+		if err == models.ErrSkillExists {
+			return c.JSON(http.StatusConflict, map[string]string{"error": "A skill or alias with that name already exists"})
+		}
+		if err != nil {
+			return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Could not create skill"})
+		}
+
+		skill, err := models.GetSkillByID(db, id)
+		if err != nil {
+			return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Could not fetch skill"})
+		}
+
+		recordSkillAudit(c, db, models.AuditSkillCreate, skill, nil)
+
+		return c.JSON(http.StatusCreated, skill)
+	}
+}
+
+// GetSkillSuggestions lists the names users listed that are not in the
+// taxonomy yet, most listed first
+func GetSkillSuggestions(db *sql.DB) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		page, pageSize := skillPage(c)
+		skills, err := models.GetSkillSuggestions(db, page, pageSize)
+		if err != nil {
+			return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Could not fetch suggestions"})
+		}
+
+		total, err := models.GetSkillSuggestionCount(db)
+		if err != nil {
+			return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Could not count suggestions"})
+		}
+
+		return c.JSON(http.StatusOK, map[string]interface{}{
+			"skills":     skills,
+			"pagination": skillPagination(total, page, pageSize),
+		})
+	}
+}
+
+type ApproveSkillRequest struct {
+	Category string `json:"category"` // Optional, defaults to the suggestion's category
+}
+
+// ApproveSkill adds a user suggestion to the public taxonomy. Suggestions
+// that are synonyms of an existing skill should be merged instead.
+func ApproveSkill(db *sql.DB) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		skill, authErr := skillFromParam(c, db)
+		if authErr != nil {
+			return c.JSON(authErr.status, map[string]string{"error": authErr.message})
+		}
+
+		var req ApproveSkillRequest
+		if err := c.Bind(&req); err != nil {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid request"})
+		}
+		if req.Category == "" {
+			req.Category = skill.Category
+		}
+		if !models.ValidSkillCategory(req.Category) {
+			return c.JSON(http.StatusBadRequest, map[string]string{
+				"error": "category must be one of " + strings.Join(models.SkillCategories, ", "),
+			})
+		}
+
+		err := models.ApproveSkill(db, skill.ID, req.Category)
+		if err == sql.ErrNoRows {
+			return c.JSON(http.StatusConflict, map[string]string{"error": "Skill is already approved"})
+		}
+		if err != nil {
+			return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Could not approve skill"})
+		}
+
+		approved, err := models.GetSkillByID(db, skill.ID)
+		if err != nil {
+			return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Could not fetch skill"})
+		}
+
+		recordSkillAudit(c, db, models.AuditSkillApprove, approved, models.DiffFields(
+			map[string]interface{}{"approved": false, "category": skill.Category},
+			map[string]interface{}{"approved": true, "category": approved.Category},
+		))
+
+		return c.JSON(http.StatusOK, approved)
+	}
+}
+
+// UpdateSkill renames or recategorizes a skill
+func UpdateSkill(db *sql.DB) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		skill, authErr := skillFromParam(c, db)
+		if authErr != nil {
+			return c.JSON(authErr.status, map[string]string{"error": authErr.message})
+		}
+
+		var req SkillRequest
+		if err := c.Bind(&req); err != nil {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid request"})
+		}
+		if req.Name == "" {
+			req.Name = skill.Name
+		}
+		if req.Category == "" {
+			req.Category = skill.Category
+		}
+		if message := req.validate(); message != "" {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": message})
+		}
+
+		err := models.UpdateSkill(db, skill.ID, req.Name, req.Category)
+		if err == models.ErrSkillExists {
+			return c.JSON(http.StatusConflict, map[string]string{"error": "A skill or alias with that name already exists"})
+		}
+		if err != nil {
+			return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Could not update skill"})
+		}
+
+		changes := models.DiffFields(
+			map[string]interface{}{"name": skill.Name, "category": skill.Category},
+			map[string]interface{}{"name": req.Name, "category": req.Category},
+		)
+
+		updated, err := models.GetSkillByID(db, skill.ID)
+		if err != nil {
+			return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Could not fetch skill"})
+		}
+
+		if len(changes) > 0 {
+			recordSkillAudit(c, db, models.AuditSkillUpdate, updated, changes)
+		}
+
+		return c.JSON(http.StatusOK, updated)
+	}
+}
+
+// DeleteSkill removes a skill from the taxonomy and from every profile
+func DeleteSkill(db *sql.DB) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		skill, authErr := skillFromParam(c, db)
+		if authErr != nil {
+			return c.JSON(authErr.status, map[string]string{"error": authErr.message})
+		}
+
+		if err := models.DeleteSkill(db, skill.ID); err != nil {
+			return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Could not delete skill"})
+		}
+
+		recordSkillAudit(c, db, models.AuditSkillDelete, skill, models.AuditChanges{
+			"user_count": {From: skill.UserCount, To: 0},
+		})
+
+		return c.JSON(http.StatusOK, map[string]string{"message": "Skill deleted"})
+	}
+}
+
+type MergeSkillRequest struct {
+	Into int `json:"into"`
+}
+
+// MergeSkill folds the skill in the path into the skill given as "into",
+// keeping its name as an alias
+func MergeSkill(db *sql.DB) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		skill, authErr := skillFromParam(c, db)
+		if authErr != nil {
+			return c.JSON(authErr.status, map[string]string{"error": authErr.message})
+		}
+
+		var req MergeSkillRequest
+		if err := c.Bind(&req); err != nil {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid request"})
+		}
+		if req.Into == skill.ID {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": "Cannot merge a skill into itself"})
+		}
+
+		into, err := models.GetSkillByID(db, req.Into)
+		if err == sql.ErrNoRows {
+			return c.JSON(http.StatusNotFound, map[string]string{"error": "Skill to merge into not found"})
+		}
+		if err != nil {
+			return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Could not fetch skill"})
+		}
+
+		if err := models.MergeSkill(db, skill.ID, into.ID); err != nil {
+			return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Could not merge skills"})
+		}
+
+		merged, err := models.GetSkillByID(db, into.ID)
+		if err != nil {
+			return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Could not fetch skill"})
+		}
+
+		recordSkillAudit(c, db, models.AuditSkillMerge, merged, models.AuditChanges{
+			"merged":     {From: skill.Name, To: merged.Name},
+			"user_count": {From: into.UserCount, To: merged.UserCount},
+		})
+
+		return c.JSON(http.StatusOK, merged)
+	}
+}
+
+type SkillAliasRequest struct {
+	Alias string `json:"alias"`
+}
+
+// AddSkillAlias makes another name resolve to a skill
+func AddSkillAlias(db *sql.DB) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		skill, authErr := skillFromParam(c, db)
+		if authErr != nil {
+			return c.JSON(authErr.status, map[string]string{"error": authErr.message})
+		}
+
+		var req SkillAliasRequest
+		if err := c.Bind(&req); err != nil {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid request"})
+		}
+		alias := models.NormalizeSkillName(req.Alias)
+		if alias == "" {
+			return c.JSON(http.StatusBadRequest, map[string]string{
+				"error": fmt.Sprintf("Aliases must be 1 to %d characters", models.MaxSkillNameLength),
+			})
+		}
+
+		err := models.AddSkillAlias(db, skill.ID, alias)
+		if err == models.ErrSkillExists {
+			return c.JSON(http.StatusConflict, map[string]string{
+				"error": "A skill or alias with that name already exists; merge the skills instead",
+			})
+		}
+		if err != nil {
+			return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Could not add alias"})
+		}
+
+		recordSkillAudit(c, db, models.AuditSkillAliasAdd, skill, models.AuditChanges{"alias": {From: nil, To: alias}})
+
+		updated, err := models.GetSkillByID(db, skill.ID)
+		if err != nil {
+			return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Could not fetch skill"})
+		}
+
+		return c.JSON(http.StatusCreated, updated)
+	}
+}
+
+// RemoveSkillAlias deletes one alias of a skill
+func RemoveSkillAlias(db *sql.DB) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		skill, authErr := skillFromParam(c, db)
+		if authErr != nil {
+			return c.JSON(authErr.status, map[string]string{"error": authErr.message})
+		}
+
+		alias, err := url.PathUnescape(c.Param("alias"))
+		if err != nil {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid alias"})
+		}
+
+		err = models.RemoveSkillAlias(db, skill.ID, alias)
+		if err == sql.ErrNoRows {
+			return c.JSON(http.StatusNotFound, map[string]string{"error": "Alias not found"})
+		}
+		if err != nil {
+			return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Could not remove alias"})
+		}
+
+		recordSkillAudit(c, db, models.AuditSkillAliasRemove, skill, models.AuditChanges{"alias": {From: alias, To: nil}})
+
+		return c.JSON(http.StatusOK, map[string]string{"message": "Alias removed"})
+	}
+}
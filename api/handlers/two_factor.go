@@ -0,0 +1,391 @@
+package handlers
+
+import (
+	"database/sql"
+	"net/http"
+	"strconv"
+	"time"
+
+	"vibecoders/models"
+
+	"github.com/labstack/echo/v4"
+)
+
+// totpIssuer is the account label shown in authenticator apps
+const totpIssuer = "VibeCoders"
+
+// Limits wrong codes on the authenticated 2FA management endpoints; the login
+// step is limited per challenge instead
+var twoFactorCodeLimiter = newRateLimiter(10, 15*time.Minute)
+
+type TwoFactorCodeRequest struct {
+	Code string `json:"code"`
+}
+
+type DisableTwoFactorRequest struct {
+	Password string `json:"password"`
+	Code     string `json:"code"`
+}
+
+type LoginChallengeRequest struct {
+	Challenge string `json:"challenge"`
+	Code      string `json:"code"` // TOTP code or a recovery code
+}
+
+type AdminSettingsRequest struct {
+	RequireAdminTwoFactor bool `json:"require_admin_2fa"`
+}
+
+// startSession issues a session cookie for a user who has passed every factor
+func startSession(c echo.Context, db *sql.DB, userID int) error {
+	session, err := models.CreateSession(db, userID, c.RealIP(), c.Request().UserAgent())
+	if err != nil {
+		return err
+	}
+
+	setSessionCookie(c, session.Token)
+	setCSRFCookie(c, session.CSRFToken)
+	return nil
+}
+
+// twoFactorChallenge is sent instead of a session when the user has 2FA on.
+// The client completes the login by posting a code to /api/login/2fa.
+func twoFactorChallenge(c echo.Context, db *sql.DB, userID int, redirectURL string) error {
+	token, err := models.CreateLoginChallenge(db, userID, redirectURL)
+	if err == models.ErrTooManyLoginChallenges {
+		c.Response().Header().Set("Retry-After", strconv.Itoa(int(models.LoginChallengeTTL.Seconds())))
+		return c.JSON(http.StatusTooManyRequests, map[string]string{"error": "Too many login attempts, try again in a few minutes"})
+	}
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Could not start two-factor login"})
+	}
+
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"message":             "Two-factor authentication code required",
+		"two_factor_required": true,
+		"challenge":           token,
+	})
+}
+
+// adminTwoFactorRequired reports whether the site policy requires this user
+// to have 2FA enabled
+func adminTwoFactorRequired(db *sql.DB, user *models.User) (bool, error) {
+	if !user.IsAdmin {
+		return false, nil
+	}
+	return models.GetBoolSetting(db, models.SettingRequireAdminTwoFactor)
+}
+
+// twoFactorLimited rejects a user who has entered too many wrong codes
+func twoFactorLimited(c echo.Context, userID int) *authError {
+	if twoFactorCodeLimiter.Blocked(strconv.Itoa(userID)) {
+		c.Response().Header().Set("Retry-After", "900")
+		return &authError{http.StatusTooManyRequests, "Too many invalid codes, try again later"}
+	}
+	return nil
+}
+
+// checkTwoFactorCode verifies a code for the current user. Wrong codes count
+// towards the per-user limit.
+func checkTwoFactorCode(c echo.Context, db *sql.DB, userID int, code string) *authError {
+	if authErr := twoFactorLimited(c, userID); authErr != nil {
+		return authErr
+	}
+
+	err := models.VerifyTwoFactorCode(db, userID, code)
+	if err == models.ErrInvalidTwoFactorCode {
+		twoFactorCodeLimiter.Allow(strconv.Itoa(userID))
+		return &authError{http.StatusForbidden, "Invalid two-factor code"}
+	}
+	if err != nil {
+		return &authError{http.StatusInternalServerError, "Could not verify code"}
+	}
+	return nil
+}
+
+// GetTwoFactorStatus reports whether the current user has 2FA enabled
+func GetTwoFactorStatus(db *sql.DB) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		status, err := models.GetTwoFactorStatus(db, CurrentUser(c).ID)
+		if err != nil {
+			return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Could not fetch two-factor status"})
+		}
+
+		return c.JSON(http.StatusOK, status)
+	}
+}
+
+// SetupTwoFactor starts TOTP enrollment and returns the secret along with an
+// otpauth URI for QR codes. Nothing changes at login until it is confirmed.
+func SetupTwoFactor(db *sql.DB) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		user := CurrentUser(c)
+
+		secret, err := models.BeginTOTPEnrollment(db, user.ID)
+		if err != nil {
+			if err == models.ErrTwoFactorEnabled {
+				return c.JSON(http.StatusConflict, map[string]string{"error": "Two-factor authentication is already enabled"})
+			}
+			return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Could not start two-factor setup"})
+		}
+
+		return c.JSON(http.StatusOK, map[string]string{
+			"secret":      secret,
+			"otpauth_uri": models.TOTPURI(totpIssuer, user.Username, secret),
+		})
+	}
+}
+
+// EnableTwoFactor confirms enrollment with a code from the authenticator app
+// and returns the one-time recovery codes. They are only ever shown here.
+func EnableTwoFactor(db *sql.DB) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		user := CurrentUser(c)
+
+		var req TwoFactorCodeRequest
+		if err := c.Bind(&req); err != nil {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid request"})
+		}
+
+		if authErr := twoFactorLimited(c, user.ID); authErr != nil {
+			return c.JSON(authErr.status, map[string]string{"error": authErr.message})
+		}
+
+		codes, err := models.ConfirmTOTPEnrollment(db, user.ID, req.Code)
+		if err != nil {
+			switch err {
+			case models.ErrTwoFactorEnabled:
+				return c.JSON(http.StatusConflict, map[string]string{"error": "Two-factor authentication is already enabled"})
+			case models.ErrTwoFactorNotEnabled:
+				return c.JSON(http.StatusBadRequest, map[string]string{"error": "Start two-factor setup first"})
+			case models.ErrInvalidTwoFactorCode:
+				twoFactorCodeLimiter.Allow(strconv.Itoa(user.ID))
+				return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid two-factor code"})
+			}
+			return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Could not enable two-factor authentication"})
+		}
+
+		return c.JSON(http.StatusOK, map[string]interface{}{
+			"message":        "Two-factor authentication enabled",
+			"recovery_codes": codes,
+		})
+	}
+}
+
+// DisableTwoFactor turns 2FA off after checking the password and a current
+// code. Administrators cannot turn it off while the site requires it.
+func DisableTwoFactor(db *sql.DB) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		user := CurrentUser(c)
+
+		var req DisableTwoFactorRequest
+		if err := c.Bind(&req); err != nil {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid request"})
+		}
+
+		required, err := adminTwoFactorRequired(db, user)
+		if err != nil {
+			return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Could not check two-factor policy"})
+		}
+		if required {
+			return c.JSON(http.StatusForbidden, map[string]string{"error": "Two-factor authentication is required for administrators"})
+		}
+
+		if authErr := checkPassword(c, db, user, req.Password); authErr != nil {
+			return c.JSON(authErr.status, map[string]string{"error": authErr.message})
+		}
+
+		if authErr := checkTwoFactorCode(c, db, user.ID, req.Code); authErr != nil {
+			return c.JSON(authErr.status, map[string]string{"error": authErr.message})
+		}
+
+		if err := models.DisableTwoFactor(db, user.ID); err != nil {
+			return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Could not disable two-factor authentication"})
+		}
+
+		return c.JSON(http.StatusOK, map[string]string{"message": "Two-factor authentication disabled"})
+	}
+}
+
+// RegenerateRecoveryCodes replaces the current user's recovery codes after
+// checking a current code
+func RegenerateRecoveryCodes(db *sql.DB) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		user := CurrentUser(c)
+
+		var req TwoFactorCodeRequest
+		if err := c.Bind(&req); err != nil {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid request"})
+		}
+
+		if authErr := checkTwoFactorCode(c, db, user.ID, req.Code); authErr != nil {
+			return c.JSON(authErr.status, map[string]string{"error": authErr.message})
+		}
+
+		codes, err := models.RegenerateRecoveryCodes(db, user.ID)
+		if err != nil {
+			return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Could not create recovery codes"})
+		}
+
+		return c.JSON(http.StatusOK, map[string]interface{}{"recovery_codes": codes})
+	}
+}
+
+// CompleteLoginChallenge finishes a two-factor login and issues the session
+func CompleteLoginChallenge(db *sql.DB) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		var req LoginChallengeRequest
+		if err := c.Bind(&req); err != nil {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid request"})
+		}
+
+		if authErr := loginThrottled(c, db, models.IPThrottleKey(c.RealIP())); authErr != nil {
+			return c.JSON(authErr.status, map[string]string{"error": authErr.message})
+		}
+
+		challenge, err := models.GetLoginChallenge(db, req.Challenge)
+		if err != nil {
+			if err == sql.ErrNoRows {
+				recordLoginFailure(c, db, "")
+				return c.JSON(http.StatusUnauthorized, map[string]string{"error": "Login has expired, please start again"})
+			}
+			return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Database error"})
+		}
+
+		user, err := models.GetUserByID(db, challenge.UserID)
+		if err != nil {
+			return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Could not fetch user"})
+		}
+
+		// Wrong codes count against the account like wrong passwords do
+		userKey := models.UsernameThrottleKey(user.Username)
+		if authErr := loginThrottled(c, db, userKey); authErr != nil {
+			return c.JSON(authErr.status, map[string]string{"error": authErr.message})
+		}
+
+		if err := models.ClaimLoginChallengeAttempt(db, challenge.ID); err != nil {
+			if err == sql.ErrNoRows {
+				return c.JSON(http.StatusUnauthorized, map[string]string{"error": "Login has expired, please start again"})
+			}
+			return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Database error"})
+		}
+
+		err = models.VerifyTwoFactorCode(db, challenge.UserID, req.Code)
+		if err != nil {
+			if err == models.ErrInvalidTwoFactorCode {
+				recordLoginFailure(c, db, user.Username)
+				return c.JSON(http.StatusUnauthorized, map[string]string{"error": "Invalid two-factor code"})
+			}
+			return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Could not verify code"})
+		}
+
+		if err := models.DeleteLoginChallenge(db, challenge.ID); err != nil {
+			c.Logger().Errorf("could not delete login challenge %d: %v", challenge.ID, err)
+		}
+		if _, err := models.ClearLoginThrottle(db, userKey); err != nil {
+			c.Logger().Errorf("could not clear login failures for user %d: %v", user.ID, err)
+		}
+
+		if err := startSession(c, db, challenge.UserID); err != nil {
+			return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Could not create session"})
+		}
+
+		redirectURL, err := normalizeRedirectURL(challenge.RedirectURL)
+		if err != nil {
+			redirectURL = "/"
+		}
+
+		return c.JSON(http.StatusOK, map[string]interface{}{
+			"message": "Login successful",
+			"user": map[string]interface{}{
+				"id":       user.ID,
+				"username": user.Username,
+			},
+			"redirect_url": redirectURL,
+		})
+	}
+}
+
+// GetAdminSettings returns the site-wide settings administrators can change
+func GetAdminSettings(db *sql.DB) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		required, err := models.GetBoolSetting(db, models.SettingRequireAdminTwoFactor)
+		if err != nil {
+			return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Could not fetch settings"})
+		}
+
+		return c.JSON(http.StatusOK, AdminSettingsRequest{RequireAdminTwoFactor: required})
+	}
+}
+
+// UpdateAdminSettings changes site-wide settings. An administrator can only
+// require 2FA for admins once they have it enabled themselves, so they cannot
+// lock themselves out of the admin API.
+func UpdateAdminSettings(db *sql.DB) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		var req AdminSettingsRequest
+		if err := c.Bind(&req); err != nil {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid request"})
+		}
+
+		if req.RequireAdminTwoFactor {
+			enabled, err := models.IsTwoFactorEnabled(db, CurrentUser(c).ID)
+			if err != nil {
+				return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Could not check two-factor status"})
+			}
+			if !enabled {
+				return c.JSON(http.StatusBadRequest, map[string]string{"error": "Enable two-factor authentication on your own account first"})
+			}
+		}
+
+		previous, err := models.GetBoolSetting(db, models.SettingRequireAdminTwoFactor)
+		if err != nil {
+			return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Could not load settings"})
+		}
+
+		err = models.SetSetting(db, models.SettingRequireAdminTwoFactor, strconv.FormatBool(req.RequireAdminTwoFactor))
+		if err != nil {
+			return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Could not update settings"})
+		}
+
+		if previous != req.RequireAdminTwoFactor {
+			recordAudit(c, db, models.AuditSettingsUpdate, "setting", models.SettingRequireAdminTwoFactor, "",
+				models.AuditChanges{models.SettingRequireAdminTwoFactor: {From: previous, To: req.RequireAdminTwoFactor}})
+		}
+
+		return c.JSON(http.StatusOK, req)
+	}
+}
+
+// AdminResetTwoFactor turns off 2FA for a user who has lost their device and
+// recovery codes
+func AdminResetTwoFactor(db *sql.DB) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		userID, err := strconv.Atoi(c.Param("id"))
+		if err != nil {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid user ID"})
+		}
+
+		user, err := models.GetUserByID(db, userID)
+		if err != nil {
+			if err == sql.ErrNoRows {
+				return c.JSON(http.StatusNotFound, map[string]string{"error": "User not found"})
+			}
+			return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Could not fetch user"})
+		}
+
+		enabled, err := models.IsTwoFactorEnabled(db, userID)
+		if err != nil {
+			return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Could not check two-factor status"})
+		}
+
+		if err := models.DisableTwoFactor(db, userID); err != nil {
+			return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Could not reset two-factor authentication"})
+		}
+
+		recordUserAudit(c, db, models.AuditUserTwoFactorReset, user,
+			models.AuditChanges{"two_factor_enabled": {From: enabled, To: false}})
+
+		return c.JSON(http.StatusOK, map[string]string{"message": "Two-factor authentication reset"})
+	}
+}
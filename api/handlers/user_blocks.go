@@ -0,0 +1,77 @@
+package handlers
+
+import (
+	"database/sql"
+	"net/http"
+
+	"vibecoders/models"
+
+	"github.com/labstack/echo/v4"
+)
+
+// blockTargetFromParam loads the user named in the :username path parameter
+// for blocking or unblocking
+func blockTargetFromParam(c echo.Context, db *sql.DB) (*models.User, *authError) {
+	user, err := models.GetUserByUsername(db, c.Param("username"))
+	if err == sql.ErrNoRows || (err == nil && user.Username == models.DeletedUserPlaceholder) {
+		return nil, &authError{http.StatusNotFound, "User not found"}
+	}
+	if err != nil {
+		return nil, &authError{http.StatusInternalServerError, "Could not fetch user"}
+	}
+	if user.ID == CurrentUser(c).ID {
+		return nil, &authError{http.StatusBadRequest, "You cannot block yourself"}
+	}
+
+	return user, nil
+}
+
+// GetBlockedUsers lists the users the current user has blocked
+func GetBlockedUsers(db *sql.DB) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		users, err := models.GetBlockedUsers(db, CurrentUser(c).ID)
+		if err != nil {
+			return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Could not fetch blocked users"})
+		}
+
+		return c.JSON(http.StatusOK, users)
+	}
+}
+
+// BlockUser stops a user from messaging or sending contact requests to the
+// current user, and the current user from messaging them. Existing
+// conversations stay readable.
+func BlockUser(db *sql.DB) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		target, authErr := blockTargetFromParam(c, db)
+		if authErr != nil {
+			return c.JSON(authErr.status, map[string]string{"error": authErr.message})
+		}
+
+		if err := models.BlockUser(db, CurrentUser(c).ID, target.ID); err != nil {
+			return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Could not block user"})
+		}
+
+		return c.JSON(http.StatusOK, map[string]string{"message": "User blocked"})
+	}
+}
+
+// UnblockUser lifts a block the current user placed
+func UnblockUser(db *sql.DB) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		target, authErr := blockTargetFromParam(c, db)
+		if authErr != nil {
+			return c.JSON(authErr.status, map[string]string{"error": authErr.message})
+		}
+
+		err := models.UnblockUser(db, CurrentUser(c).ID, target.ID)
+		if err == sql.ErrNoRows {
+			return c.JSON(http.StatusNotFound, map[string]string{"error": "User is not blocked"})
+		}
+		if err != nil {
+			return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Could not unblock user"})
+		}
+
+		return c.JSON(http.StatusOK, map[string]string{"message": "User unblocked"})
+	}
+}
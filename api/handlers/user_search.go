@@ -0,0 +1,78 @@
+package handlers
+
+import (
+	"database/sql"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"vibecoders/models"
+
+	"github.com/labstack/echo/v4"
+)
+
+// maxSearchQueryLength bounds the free text accepted by the directory search
+const maxSearchQueryLength = 200
+
+// maxSearchSkills bounds how many skill filters one search may combine
+const maxSearchSkills = 10
+
+// SearchUsers is the public developer directory: full-text search over
+// profiles, prompts and projects with optional filters
+func SearchUsers(db *sql.DB) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		search := models.UserSearch{
+			Query:        c.QueryParam("q"),
+			HasGithub:    c.QueryParam("has_github") == "true",
+			HasProjects:  c.QueryParam("has_projects") == "true",
+			Availability: c.QueryParam("availability"),
+		}
+		if search.Availability != "" && !models.ValidAvailabilityStatus(search.Availability) {
+			return c.JSON(http.StatusBadRequest, map[string]string{
+				"error": "availability must be one of " + strings.Join(models.AvailabilityStatuses, ", "),
+			})
+		}
+		if len(search.Query) > maxSearchQueryLength {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": "Search query is too long"})
+		}
+
+		for _, skill := range c.QueryParams()["skill"] {
+			if skill = models.NormalizeSkillName(skill); skill != "" {
+				search.Skills = append(search.Skills, skill)
+			}
+		}
+		if len(search.Skills) > maxSearchSkills {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": "Too many skill filters"})
+		}
+
+		page, err := strconv.Atoi(c.QueryParam("page"))
+		if err != nil || page < 1 {
+			page = 1
+		}
+
+		pageSize, err := strconv.Atoi(c.QueryParam("pageSize"))
+		if err != nil || pageSize < 1 || pageSize > 50 {
+			pageSize = 20 // Default page size
+		}
+
+		users, err := models.SearchUsers(db, search, page, pageSize)
+		if err != nil {
+			return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Could not search users"})
+		}
+
+		total, err := models.CountSearchUsers(db, search)
+		if err != nil {
+			return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Could not search users"})
+		}
+
+		return c.JSON(http.StatusOK, map[string]interface{}{
+			"users": users,
+			"pagination": map[string]interface{}{
+				"total":      total,
+				"page":       page,
+				"pageSize":   pageSize,
+				"totalPages": (total + pageSize - 1) / pageSize,
+			},
+		})
+	}
+}
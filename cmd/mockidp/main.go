@@ -0,0 +1,27 @@
+// Command mockidp runs the mock OpenID Connect provider for local testing of
+// OAuth login. Point the app at it with:
+//
+//	OAUTH_PROVIDERS=mock OAUTH_MOCK_CLIENT_ID=vibecoders OAUTH_MOCK_ISSUER=http://localhost:9999
+package main
+
+import (
+	"flag"
+	"log"
+	"net/http"
+
+	"vibecoders/oauth/mockidp"
+)
+
+func main() {
+	addr := flag.String("addr", ":9999", "listen address")
+	issuer := flag.String("issuer", "http://localhost:9999", "public URL of this server")
+	flag.Parse()
+
+	server, err := mockidp.New(*issuer)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	log.Printf("Mock identity provider listening on %s (issuer %s)", *addr, server.Issuer)
+	log.Fatal(http.ListenAndServe(*addr, server))
+}
@@ -0,0 +1,14 @@
+-- Track when and where each session was used so sessions can expire
+-- and users can review and revoke their devices
+ALTER TABLE sessions ADD COLUMN last_seen_at TIMESTAMP;
+ALTER TABLE sessions ADD COLUMN expires_at TIMESTAMP;
+ALTER TABLE sessions ADD COLUMN ip_address TEXT;
+ALTER TABLE sessions ADD COLUMN user_agent TEXT;
+
+-- Existing sessions get a fresh 30 day window from now
+UPDATE sessions
+SET last_seen_at = COALESCE(created_at, CURRENT_TIMESTAMP),
+    expires_at = datetime('now', '+30 days');
+
+CREATE INDEX idx_sessions_user_id ON sessions(user_id);
+CREATE INDEX idx_sessions_expires_at ON sessions(expires_at);
@@ -0,0 +1,16 @@
+-- Magic links can be limited to N uses (NULL means unlimited) and revoked
+ALTER TABLE magic_links ADD COLUMN max_uses INTEGER;
+ALTER TABLE magic_links ADD COLUMN use_count INTEGER DEFAULT 0;
+ALTER TABLE magic_links ADD COLUMN revoked_at TIMESTAMP;
+
+-- Every successful login through a magic link is recorded
+CREATE TABLE IF NOT EXISTS magic_link_redemptions (
+  id INTEGER PRIMARY KEY AUTOINCREMENT,
+  magic_link_id INTEGER NOT NULL,
+  redeemed_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+  ip_address TEXT,
+  user_agent TEXT,
+  FOREIGN KEY (magic_link_id) REFERENCES magic_links(id) ON DELETE CASCADE
+);
+
+CREATE INDEX idx_magic_link_redemptions_magic_link_id ON magic_link_redemptions(magic_link_id);
@@ -0,0 +1,17 @@
+-- Outgoing email is queued here and delivered by a background worker
+-- so that slow or failing mail servers never block a request
+CREATE TABLE IF NOT EXISTS email_outbox (
+  id INTEGER PRIMARY KEY AUTOINCREMENT,
+  to_address TEXT NOT NULL,
+  subject TEXT NOT NULL,
+  text_body TEXT NOT NULL,
+  html_body TEXT,
+  status TEXT NOT NULL DEFAULT 'pending', -- pending, sent, failed
+  attempts INTEGER NOT NULL DEFAULT 0,
+  last_error TEXT,
+  next_attempt_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+  created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+  sent_at TIMESTAMP
+);
+
+CREATE INDEX idx_email_outbox_status_next_attempt ON email_outbox(status, next_attempt_at);
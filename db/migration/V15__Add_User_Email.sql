@@ -0,0 +1,6 @@
+-- Email address used for passwordless login and notifications.
+-- Addresses are stored lowercased; only verified addresses can receive login links.
+ALTER TABLE users ADD COLUMN email TEXT;
+ALTER TABLE users ADD COLUMN email_verified_at TIMESTAMP;
+
+CREATE UNIQUE INDEX idx_users_email ON users(email);
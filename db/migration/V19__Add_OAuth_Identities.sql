@@ -0,0 +1,29 @@
+-- Accounts at external identity providers linked to a user
+CREATE TABLE IF NOT EXISTS user_identities (
+  id INTEGER PRIMARY KEY AUTOINCREMENT,
+  user_id INTEGER NOT NULL,
+  provider TEXT NOT NULL,
+  subject TEXT NOT NULL,
+  email TEXT,
+  username TEXT,
+  created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+  last_login_at TIMESTAMP,
+  UNIQUE (provider, subject),
+  FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+CREATE INDEX idx_user_identities_user_id ON user_identities(user_id);
+
+-- In-flight authorization requests. The state is stored hashed; the nonce and
+-- PKCE verifier never leave the server.
+CREATE TABLE IF NOT EXISTS oauth_states (
+  id INTEGER PRIMARY KEY AUTOINCREMENT,
+  state_hash TEXT UNIQUE NOT NULL,
+  provider TEXT NOT NULL,
+  nonce TEXT NOT NULL,
+  code_verifier TEXT NOT NULL,
+  redirect_url TEXT,
+  link_user_id INTEGER,
+  created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+  expires_at TIMESTAMP NOT NULL
+);
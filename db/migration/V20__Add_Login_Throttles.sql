@@ -0,0 +1,10 @@
+-- Failed login counters keyed by "user:<username>" or "ip:<address>".
+-- blocked_until enforces the backoff; locked marks a full lockout that
+-- lasts until it expires or an administrator unlocks it.
+CREATE TABLE IF NOT EXISTS login_throttles (
+  key TEXT PRIMARY KEY,
+  failures INTEGER NOT NULL DEFAULT 0,
+  last_failure_at TIMESTAMP NOT NULL,
+  blocked_until TIMESTAMP,
+  locked INTEGER NOT NULL DEFAULT 0
+);
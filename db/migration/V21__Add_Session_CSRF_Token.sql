@@ -0,0 +1,3 @@
+-- Per-session CSRF token. Cookie-authenticated requests that change state must
+-- echo it in the X-CSRF-Token header. Older sessions get one on next use.
+ALTER TABLE sessions ADD COLUMN csrf_token TEXT;
@@ -0,0 +1,60 @@
+-- Role based access control. Users hold roles; roles grant permissions.
+CREATE TABLE IF NOT EXISTS roles (
+  id INTEGER PRIMARY KEY AUTOINCREMENT,
+  name TEXT UNIQUE NOT NULL,
+  description TEXT
+);
+
+CREATE TABLE IF NOT EXISTS permissions (
+  id INTEGER PRIMARY KEY AUTOINCREMENT,
+  name TEXT UNIQUE NOT NULL,
+  description TEXT
+);
+
+CREATE TABLE IF NOT EXISTS role_permissions (
+  role_id INTEGER NOT NULL,
+  permission_id INTEGER NOT NULL,
+  PRIMARY KEY (role_id, permission_id),
+  FOREIGN KEY (role_id) REFERENCES roles(id) ON DELETE CASCADE,
+  FOREIGN KEY (permission_id) REFERENCES permissions(id) ON DELETE CASCADE
+);
+
+CREATE TABLE IF NOT EXISTS user_roles (
+  user_id INTEGER NOT NULL,
+  role_id INTEGER NOT NULL,
+  granted_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+  granted_by INTEGER,
+  PRIMARY KEY (user_id, role_id),
+  FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE,
+  FOREIGN KEY (role_id) REFERENCES roles(id) ON DELETE CASCADE
+);
+
+CREATE INDEX idx_user_roles_role_id ON user_roles(role_id);
+
+INSERT INTO roles (name, description) VALUES
+  ('admin', 'Full access to the admin area'),
+  ('moderator', 'Moderates the forum'),
+  ('member', 'Regular member');
+
+INSERT INTO permissions (name, description) VALUES
+  ('admin.access', 'Use the admin API'),
+  ('users.view', 'View all users'),
+  ('users.edit', 'Edit users, reset their 2FA and unlock them'),
+  ('users.delete', 'Delete users'),
+  ('roles.manage', 'Grant and revoke roles'),
+  ('settings.manage', 'Change site settings'),
+  ('forum.moderate', 'Delete forum posts and comments');
+
+INSERT INTO role_permissions (role_id, permission_id)
+  SELECT r.id, p.id FROM roles r, permissions p WHERE r.name = 'admin';
+
+INSERT INTO role_permissions (role_id, permission_id)
+  SELECT r.id, p.id FROM roles r, permissions p WHERE r.name = 'moderator' AND p.name = 'forum.moderate';
+
+-- Existing users become members, and existing admins get the admin role.
+-- users.is_admin is superseded by the admin role and no longer read.
+INSERT INTO user_roles (user_id, role_id)
+  SELECT u.id, r.id FROM users u, roles r WHERE r.name = 'member';
+
+INSERT INTO user_roles (user_id, role_id)
+  SELECT u.id, r.id FROM users u, roles r WHERE r.name = 'admin' AND u.is_admin = 1;
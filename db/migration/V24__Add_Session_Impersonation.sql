@@ -0,0 +1,9 @@
+-- A session whose impersonator_id is set was started by that administrator to
+-- view the site as the session's user. impersonator_session_id is the admin's
+-- own session, restored when impersonation ends.
+ALTER TABLE sessions ADD COLUMN impersonator_id INTEGER;
+ALTER TABLE sessions ADD COLUMN impersonator_session_id INTEGER;
+
+INSERT INTO permissions (name, description) VALUES ('users.impersonate', 'View the site as another user');
+INSERT INTO role_permissions (role_id, permission_id)
+  SELECT r.id, p.id FROM roles r, permissions p WHERE r.name = 'admin' AND p.name = 'users.impersonate';
@@ -0,0 +1,6 @@
+-- Deleted users keep their row (and their username and email stay reserved)
+-- until the purge job removes them and everything they own once the grace
+-- period has passed.
+ALTER TABLE users ADD COLUMN deleted_at TIMESTAMP;
+
+CREATE INDEX idx_users_deleted_at ON users(deleted_at);
@@ -0,0 +1,18 @@
+-- Account exports generated in the background for large accounts. The ZIP
+-- archive is kept in the row until the export expires.
+CREATE TABLE IF NOT EXISTS data_exports (
+  id INTEGER PRIMARY KEY AUTOINCREMENT,
+  user_id INTEGER NOT NULL,
+  status TEXT NOT NULL DEFAULT 'pending', -- pending, running, ready, failed
+  archive BLOB,
+  size INTEGER,
+  error TEXT,
+  created_at TIMESTAMP NOT NULL,
+  started_at TIMESTAMP,
+  completed_at TIMESTAMP,
+  expires_at TIMESTAMP NOT NULL,
+  FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+CREATE INDEX idx_data_exports_user_id ON data_exports(user_id);
+CREATE INDEX idx_data_exports_status ON data_exports(status);
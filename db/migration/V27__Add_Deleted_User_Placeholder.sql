@@ -0,0 +1,5 @@
+-- Placeholder account that forum posts and comments are handed to when their
+-- author deletes their account but chooses to keep them. The password is an
+-- invalid bcrypt hash, so nobody can log in as it.
+INSERT INTO users (username, password, fullname, bio, linked_in_url, github_url, photo_url)
+VALUES ('[deleted]', 'v1$!', 'Deleted user', '', '', '', '');
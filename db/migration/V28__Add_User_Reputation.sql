@@ -0,0 +1,18 @@
+-- Reputation scores, one row per user per ranking window. The table is
+-- rebuilt in the background from forum, prompt and project activity so the
+-- homepage ranking never has to aggregate on request.
+CREATE TABLE IF NOT EXISTS user_reputation (
+  user_id INTEGER NOT NULL,
+  period TEXT NOT NULL, -- week, month, year, all
+  score INTEGER NOT NULL DEFAULT 0,
+  post_votes INTEGER NOT NULL DEFAULT 0,
+  comments INTEGER NOT NULL DEFAULT 0,
+  prompts INTEGER NOT NULL DEFAULT 0,
+  projects INTEGER NOT NULL DEFAULT 0,
+  profile_fields INTEGER NOT NULL DEFAULT 0,
+  computed_at TIMESTAMP NOT NULL,
+  PRIMARY KEY (user_id, period),
+  FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+CREATE INDEX idx_user_reputation_period_score ON user_reputation(period, score DESC);
@@ -0,0 +1,83 @@
+-- Full-text index for the public developer directory. Each row's rowid is
+-- the user's ID. Rows are rebuilt from user_search_documents by the triggers
+-- below whenever a user, or one of their prompts or projects, changes.
+-- Deleted users and the [deleted] placeholder are not indexed.
+CREATE VIEW user_search_documents AS
+SELECT u.id,
+       u.username,
+       COALESCE(u.fullname, '') AS fullname,
+       COALESCE(u.bio, '') AS bio,
+       '' AS skills,
+       COALESCE((SELECT group_concat(title, ' ') FROM prompts WHERE user_id = u.id), '') AS prompts,
+       COALESCE((SELECT group_concat(description, ' ') FROM projects WHERE user_id = u.id), '') AS projects
+FROM users u
+WHERE u.deleted_at IS NULL AND u.username != '[deleted]';
+
+CREATE VIRTUAL TABLE users_fts USING fts5(
+  username, fullname, bio, skills, prompts, projects,
+  tokenize = 'unicode61 remove_diacritics 2',
+  prefix = '2 3'
+);
+
+INSERT INTO users_fts (rowid, username, fullname, bio, skills, prompts, projects)
+SELECT id, username, fullname, bio, skills, prompts, projects FROM user_search_documents;
+
+CREATE TRIGGER users_fts_user_insert AFTER INSERT ON users
+BEGIN
+  INSERT INTO users_fts (rowid, username, fullname, bio, skills, prompts, projects)
+  SELECT id, username, fullname, bio, skills, prompts, projects FROM user_search_documents WHERE id = NEW.id;
+END;
+
+CREATE TRIGGER users_fts_user_update AFTER UPDATE OF username, fullname, bio, deleted_at ON users
+BEGIN
+  DELETE FROM users_fts WHERE rowid = OLD.id;
+  INSERT INTO users_fts (rowid, username, fullname, bio, skills, prompts, projects)
+  SELECT id, username, fullname, bio, skills, prompts, projects FROM user_search_documents WHERE id = NEW.id;
+END;
+
+CREATE TRIGGER users_fts_user_delete AFTER DELETE ON users
+BEGIN
+  DELETE FROM users_fts WHERE rowid = OLD.id;
+END;
+
+CREATE TRIGGER users_fts_prompt_insert AFTER INSERT ON prompts
+BEGIN
+  DELETE FROM users_fts WHERE rowid = NEW.user_id;
+  INSERT INTO users_fts (rowid, username, fullname, bio, skills, prompts, projects)
+  SELECT id, username, fullname, bio, skills, prompts, projects FROM user_search_documents WHERE id = NEW.user_id;
+END;
+
+CREATE TRIGGER users_fts_prompt_update AFTER UPDATE OF title ON prompts
+BEGIN
+  DELETE FROM users_fts WHERE rowid = NEW.user_id;
+  INSERT INTO users_fts (rowid, username, fullname, bio, skills, prompts, projects)
+  SELECT id, username, fullname, bio, skills, prompts, projects FROM user_search_documents WHERE id = NEW.user_id;
+END;
+
+CREATE TRIGGER users_fts_prompt_delete AFTER DELETE ON prompts
+BEGIN
+  DELETE FROM users_fts WHERE rowid = OLD.user_id;
+  INSERT INTO users_fts (rowid, username, fullname, bio, skills, prompts, projects)
+  SELECT id, username, fullname, bio, skills, prompts, projects FROM user_search_documents WHERE id = OLD.user_id;
+END;
+
+CREATE TRIGGER users_fts_project_insert AFTER INSERT ON projects
+BEGIN
+  DELETE FROM users_fts WHERE rowid = NEW.user_id;
+  INSERT INTO users_fts (rowid, username, fullname, bio, skills, prompts, projects)
+  SELECT id, username, fullname, bio, skills, prompts, projects FROM user_search_documents WHERE id = NEW.user_id;
+END;
+
+CREATE TRIGGER users_fts_project_update AFTER UPDATE OF description ON projects
+BEGIN
+  DELETE FROM users_fts WHERE rowid = NEW.user_id;
+  INSERT INTO users_fts (rowid, username, fullname, bio, skills, prompts, projects)
+  SELECT id, username, fullname, bio, skills, prompts, projects FROM user_search_documents WHERE id = NEW.user_id;
+END;
+
+CREATE TRIGGER users_fts_project_delete AFTER DELETE ON projects
+BEGIN
+  DELETE FROM users_fts WHERE rowid = OLD.user_id;
+  INSERT INTO users_fts (rowid, username, fullname, bio, skills, prompts, projects)
+  SELECT id, username, fullname, bio, skills, prompts, projects FROM user_search_documents WHERE id = OLD.user_id;
+END;
@@ -0,0 +1,109 @@
+-- Curated skills and tools taxonomy. Aliases let "golang" resolve to "Go";
+-- merging a synonym into a skill turns its name into an alias.
+CREATE TABLE IF NOT EXISTS skills (
+  id INTEGER PRIMARY KEY AUTOINCREMENT,
+  name TEXT NOT NULL UNIQUE COLLATE NOCASE,
+  category TEXT NOT NULL DEFAULT 'other', -- language, framework, ai, tool, other
+  created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE IF NOT EXISTS skill_aliases (
+  alias TEXT PRIMARY KEY COLLATE NOCASE,
+  skill_id INTEGER NOT NULL,
+  FOREIGN KEY (skill_id) REFERENCES skills(id) ON DELETE CASCADE
+);
+
+CREATE TABLE IF NOT EXISTS user_skills (
+  user_id INTEGER NOT NULL,
+  skill_id INTEGER NOT NULL,
+  proficiency TEXT NOT NULL DEFAULT 'intermediate', -- beginner, intermediate, advanced, expert
+  years INTEGER NOT NULL DEFAULT 0,
+  created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+  PRIMARY KEY (user_id, skill_id),
+  FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE,
+  FOREIGN KEY (skill_id) REFERENCES skills(id) ON DELETE CASCADE
+);
+
+CREATE INDEX idx_skill_aliases_skill_id ON skill_aliases(skill_id);
+CREATE INDEX idx_user_skills_skill_id ON user_skills(skill_id);
+
+INSERT INTO skills (name, category) VALUES
+  ('Go', 'language'), ('Python', 'language'), ('JavaScript', 'language'), ('TypeScript', 'language'),
+  ('Swift', 'language'), ('Rust', 'language'), ('SQL', 'language'),
+  ('React', 'framework'), ('Node.js', 'framework'), ('SwiftUI', 'framework'), ('Tailwind CSS', 'framework'),
+  ('Claude', 'ai'), ('ChatGPT', 'ai'), ('GitHub Copilot', 'ai'), ('Cursor', 'ai'),
+  ('Git', 'tool'), ('Docker', 'tool'), ('SQLite', 'tool');
+
+INSERT INTO skill_aliases (alias, skill_id) SELECT 'golang', id FROM skills WHERE name = 'Go';
+INSERT INTO skill_aliases (alias, skill_id) SELECT 'js', id FROM skills WHERE name = 'JavaScript';
+INSERT INTO skill_aliases (alias, skill_id) SELECT 'ts', id FROM skills WHERE name = 'TypeScript';
+INSERT INTO skill_aliases (alias, skill_id) SELECT 'reactjs', id FROM skills WHERE name = 'React';
+INSERT INTO skill_aliases (alias, skill_id) SELECT 'nodejs', id FROM skills WHERE name = 'Node.js';
+INSERT INTO skill_aliases (alias, skill_id) SELECT 'tailwind', id FROM skills WHERE name = 'Tailwind CSS';
+INSERT INTO skill_aliases (alias, skill_id) SELECT 'copilot', id FROM skills WHERE name = 'GitHub Copilot';
+INSERT INTO skill_aliases (alias, skill_id) SELECT 'claude code', id FROM skills WHERE name = 'Claude';
+
+-- Curating the taxonomy is its own permission
+INSERT INTO permissions (name, description) VALUES ('skills.manage', 'Curate and merge skills');
+INSERT INTO role_permissions (role_id, permission_id)
+  SELECT r.id, p.id FROM roles r, permissions p WHERE r.name = 'admin' AND p.name = 'skills.manage';
+
+-- Index skill names and aliases for directory search
+DROP VIEW user_search_documents;
+CREATE VIEW user_search_documents AS
+SELECT u.id,
+       u.username,
+       COALESCE(u.fullname, '') AS fullname,
+       COALESCE(u.bio, '') AS bio,
+       COALESCE((SELECT group_concat(s.name || ' ' || COALESCE((SELECT group_concat(alias, ' ') FROM skill_aliases WHERE skill_id = s.id), ''), ' ')
+                 FROM user_skills us JOIN skills s ON s.id = us.skill_id WHERE us.user_id = u.id), '') AS skills,
+       COALESCE((SELECT group_concat(title, ' ') FROM prompts WHERE user_id = u.id), '') AS prompts,
+       COALESCE((SELECT group_concat(description, ' ') FROM projects WHERE user_id = u.id), '') AS projects
+FROM users u
+WHERE u.deleted_at IS NULL AND u.username != '[deleted]';
+
+CREATE TRIGGER users_fts_user_skill_insert AFTER INSERT ON user_skills
+BEGIN
+  DELETE FROM users_fts WHERE rowid = NEW.user_id;
+  INSERT INTO users_fts (rowid, username, fullname, bio, skills, prompts, projects)
+  SELECT id, username, fullname, bio, skills, prompts, projects FROM user_search_documents WHERE id = NEW.user_id;
+END;
+
+CREATE TRIGGER users_fts_user_skill_update AFTER UPDATE OF skill_id ON user_skills
+BEGIN
+  DELETE FROM users_fts WHERE rowid = NEW.user_id;
+  INSERT INTO users_fts (rowid, username, fullname, bio, skills, prompts, projects)
+  SELECT id, username, fullname, bio, skills, prompts, projects FROM user_search_documents WHERE id = NEW.user_id;
+END;
+
+CREATE TRIGGER users_fts_user_skill_delete AFTER DELETE ON user_skills
+BEGIN
+  DELETE FROM users_fts WHERE rowid = OLD.user_id;
+  INSERT INTO users_fts (rowid, username, fullname, bio, skills, prompts, projects)
+  SELECT id, username, fullname, bio, skills, prompts, projects FROM user_search_documents WHERE id = OLD.user_id;
+END;
+
+-- Renaming a skill or changing its aliases reindexes everyone who has it
+CREATE TRIGGER users_fts_skill_rename AFTER UPDATE OF name ON skills
+BEGIN
+  DELETE FROM users_fts WHERE rowid IN (SELECT user_id FROM user_skills WHERE skill_id = NEW.id);
+  INSERT INTO users_fts (rowid, username, fullname, bio, skills, prompts, projects)
+  SELECT id, username, fullname, bio, skills, prompts, projects FROM user_search_documents
+  WHERE id IN (SELECT user_id FROM user_skills WHERE skill_id = NEW.id);
+END;
+
+CREATE TRIGGER users_fts_skill_alias_insert AFTER INSERT ON skill_aliases
+BEGIN
+  DELETE FROM users_fts WHERE rowid IN (SELECT user_id FROM user_skills WHERE skill_id = NEW.skill_id);
+  INSERT INTO users_fts (rowid, username, fullname, bio, skills, prompts, projects)
+  SELECT id, username, fullname, bio, skills, prompts, projects FROM user_search_documents
+  WHERE id IN (SELECT user_id FROM user_skills WHERE skill_id = NEW.skill_id);
+END;
+
+CREATE TRIGGER users_fts_skill_alias_delete AFTER DELETE ON skill_aliases
+BEGIN
+  DELETE FROM users_fts WHERE rowid IN (SELECT user_id FROM user_skills WHERE skill_id = OLD.skill_id);
+  INSERT INTO users_fts (rowid, username, fullname, bio, skills, prompts, projects)
+  SELECT id, username, fullname, bio, skills, prompts, projects FROM user_search_documents
+  WHERE id IN (SELECT user_id FROM user_skills WHERE skill_id = OLD.skill_id);
+END;
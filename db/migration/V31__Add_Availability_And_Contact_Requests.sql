@@ -0,0 +1,30 @@
+-- Hiring availability shown on public profiles
+CREATE TABLE IF NOT EXISTS user_availability (
+  user_id INTEGER PRIMARY KEY,
+  status TEXT NOT NULL, -- open_to_work, freelance, not_looking
+  hourly_rate INTEGER, -- whole units of rate_currency
+  rate_currency TEXT NOT NULL DEFAULT 'USD',
+  timezone TEXT, -- IANA name, e.g. Europe/Berlin
+  updated_at TIMESTAMP NOT NULL,
+  FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+CREATE INDEX idx_user_availability_status ON user_availability(status);
+
+-- A message from one user to a profile owner. Contact details are only
+-- shared once the recipient accepts.
+CREATE TABLE IF NOT EXISTS contact_requests (
+  id INTEGER PRIMARY KEY AUTOINCREMENT,
+  sender_id INTEGER NOT NULL,
+  recipient_id INTEGER NOT NULL,
+  message TEXT NOT NULL,
+  status TEXT NOT NULL DEFAULT 'pending', -- pending, accepted, declined
+  response_note TEXT,
+  created_at TIMESTAMP NOT NULL,
+  responded_at TIMESTAMP,
+  FOREIGN KEY (sender_id) REFERENCES users(id) ON DELETE CASCADE,
+  FOREIGN KEY (recipient_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+CREATE INDEX idx_contact_requests_recipient ON contact_requests(recipient_id, status);
+CREATE INDEX idx_contact_requests_sender ON contact_requests(sender_id, created_at);
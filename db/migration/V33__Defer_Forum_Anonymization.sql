@@ -0,0 +1,4 @@
+-- Users who ask for their forum posts and comments to be kept under
+-- "[deleted]" are anonymized by the purge job rather than at deletion, so an
+-- account restored within the grace period gets its content back unchanged.
+ALTER TABLE users ADD COLUMN anonymize_forum_on_purge BOOLEAN NOT NULL DEFAULT 0;
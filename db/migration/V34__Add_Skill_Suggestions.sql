@@ -0,0 +1,6 @@
+-- Names users list that the taxonomy doesn't know become suggestions. They
+-- stay on the profiles that list them but are left out of the public skills
+-- list and autocomplete until an admin approves or merges them.
+ALTER TABLE skills ADD COLUMN approved BOOLEAN NOT NULL DEFAULT 1;
+
+CREATE INDEX idx_skills_approved ON skills(approved);
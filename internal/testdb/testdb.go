@@ -0,0 +1,70 @@
+// Package testdb builds throwaway SQLite databases from the Flyway migrations
+// for tests
+package testdb
+
+import (
+	"database/sql"
+	"os"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"sort"
+	"strconv"
+	"testing"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+var migrationVersion = regexp.MustCompile(`^V(\d+)__`)
+
+// New returns a database with every migration applied in version order. The
+// test is skipped when SQLite was built without FTS5.
+func New(t testing.TB) *sql.DB {
+	t.Helper()
+
+	_, file, _, _ := runtime.Caller(0)
+	dir := filepath.Join(filepath.Dir(file), "..", "..", "db", "migration")
+
+	var files []string
+	for _, pattern := range []string{"V*.sql", filepath.Join("V*", "V*.sql")} {
+		matches, err := filepath.Glob(filepath.Join(dir, pattern))
+		if err != nil {
+			t.Fatal(err)
+		}
+		files = append(files, matches...)
+	}
+	if len(files) == 0 {
+		t.Fatalf("no migrations found in %s", dir)
+	}
+
+	version := func(path string) int {
+		n, _ := strconv.Atoi(migrationVersion.FindStringSubmatch(filepath.Base(path))[1])
+		return n
+	}
+	sort.Slice(files, func(i, j int) bool { return version(files[i]) < version(files[j]) })
+
+	// A throwaway database doesn't need to survive a crash
+	db, err := sql.Open("sqlite3", "file:"+filepath.Join(t.TempDir(), "test.db")+"?_sync=OFF&_journal_mode=MEMORY")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	// The search migrations need FTS5, which go-sqlite3 only has when built
+	// with the sqlite_fts5 tag
+	if _, err := db.Exec(`CREATE VIRTUAL TABLE temp.fts5_probe USING fts5(x)`); err != nil {
+		t.Skipf("SQLite has no FTS5 (%v), run go test -tags sqlite_fts5", err)
+	}
+
+	for _, file := range files {
+		script, err := os.ReadFile(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := db.Exec(string(script)); err != nil {
+			t.Fatalf("%s: %v", filepath.Base(file), err)
+		}
+	}
+
+	return db
+}
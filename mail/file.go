@@ -0,0 +1,44 @@
+package mail
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// FileSender writes each message into a maildir (tmp/, new/, cur/) instead of
+// sending it. Used for local development and tests; any mail client that
+// understands maildir can open the directory.
+type FileSender struct {
+	Dir string
+}
+
+// NewFileSender creates the maildir layout under dir if needed
+func NewFileSender(dir string) (*FileSender, error) {
+	for _, sub := range []string{"tmp", "new", "cur"} {
+		if err := os.MkdirAll(filepath.Join(dir, sub), 0o755); err != nil {
+			return nil, err
+		}
+	}
+
+	return &FileSender{Dir: dir}, nil
+}
+
+// Send implements Sender. The message is written to tmp/ and then renamed
+// into new/ so readers never see a partial file.
+func (s *FileSender) Send(msg *Message) error {
+	data, err := msg.encode()
+	if err != nil {
+		return err
+	}
+
+	name := fmt.Sprintf("%d.%s.vibecoders.eml", time.Now().UnixNano(), randomID())
+	tmpPath := filepath.Join(s.Dir, "tmp", name)
+
+	if err := os.WriteFile(tmpPath, data, 0o644); err != nil {
+		return err
+	}
+
+	return os.Rename(tmpPath, filepath.Join(s.Dir, "new", name))
+}
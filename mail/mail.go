@@ -0,0 +1,169 @@
+// Package mail renders and delivers email. Messages are queued in the
+// email_outbox table and handed to a Sender by a background worker.
+package mail
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net/textproto"
+	"os"
+	"strings"
+	"time"
+)
+
+// ErrHeaderLineBreak is returned for a recipient or subject containing a
+// line break, which would let it inject headers or a body of its own
+var ErrHeaderLineBreak = errors.New("mail header contains a line break")
+
+// validHeader reports whether a header value is safe to write as is
+func validHeader(value string) bool {
+	return !strings.ContainsAny(value, "\r\n")
+}
+
+// Message is a single outgoing email with a plain text and optional HTML body
+type Message struct {
+	From    string
+	To      string
+	Subject string
+	Text    string
+	HTML    string
+}
+
+// Sender delivers a message through some transport
+type Sender interface {
+	Send(msg *Message) error
+}
+
+// SenderFromEnv builds the transport selected by MAIL_TRANSPORT:
+//
+//	smtp - SMTP_HOST, SMTP_PORT, SMTP_USERNAME, SMTP_PASSWORD
+//	file - writes messages into the maildir at MAIL_DIR (default ./maildir)
+//
+// The file transport is the default so development never sends real mail.
+func SenderFromEnv() (Sender, error) {
+	switch transport := os.Getenv("MAIL_TRANSPORT"); transport {
+	case "smtp":
+		host := os.Getenv("SMTP_HOST")
+		if host == "" {
+			return nil, fmt.Errorf("SMTP_HOST is required for the smtp mail transport")
+		}
+		port := os.Getenv("SMTP_PORT")
+		if port == "" {
+			port = "587"
+		}
+		return &SMTPSender{
+			Host:     host,
+			Port:     port,
+			Username: os.Getenv("SMTP_USERNAME"),
+			Password: os.Getenv("SMTP_PASSWORD"),
+		}, nil
+	case "", "file":
+		dir := os.Getenv("MAIL_DIR")
+		if dir == "" {
+			dir = "./maildir"
+		}
+		return NewFileSender(dir)
+	default:
+		return nil, fmt.Errorf("unknown MAIL_TRANSPORT %q", transport)
+	}
+}
+
+// encode renders the message as an RFC 5322 document. Messages with an HTML
+// body are sent as multipart/alternative.
+func (m *Message) encode() ([]byte, error) {
+	for _, value := range []string{m.From, m.To, m.Subject} {
+		if !validHeader(value) {
+			return nil, ErrHeaderLineBreak
+		}
+	}
+
+	var buf bytes.Buffer
+
+	header := func(key, value string) {
+		fmt.Fprintf(&buf, "%s: %s\r\n", key, value)
+	}
+	header("From", m.From)
+	header("To", m.To)
+	header("Subject", encodeHeader(m.Subject))
+	header("Date", time.Now().Format(time.RFC1123Z))
+	header("Message-ID", fmt.Sprintf("<%s@vibecoders>", randomID()))
+	header("MIME-Version", "1.0")
+
+	if m.HTML == "" {
+		header("Content-Type", "text/plain; charset=UTF-8")
+		header("Content-Transfer-Encoding", "quoted-printable")
+		buf.WriteString("\r\n")
+		if err := writeQuotedPrintable(&buf, m.Text); err != nil {
+			return nil, err
+		}
+		return buf.Bytes(), nil
+	}
+
+	var body bytes.Buffer
+	writer := multipart.NewWriter(&body)
+	for _, part := range []struct{ contentType, content string }{
+		{"text/plain; charset=UTF-8", m.Text},
+		{"text/html; charset=UTF-8", m.HTML},
+	} {
+		w, err := writer.CreatePart(textproto.MIMEHeader{
+			"Content-Type":              {part.contentType},
+			"Content-Transfer-Encoding": {"quoted-printable"},
+		})
+		if err != nil {
+			return nil, err
+		}
+		if err := writeQuotedPrintable(w, part.content); err != nil {
+			return nil, err
+		}
+	}
+	if err := writer.Close(); err != nil {
+		return nil, err
+	}
+
+	header("Content-Type", "multipart/alternative; boundary="+writer.Boundary())
+	buf.WriteString("\r\n")
+	buf.Write(body.Bytes())
+
+	return buf.Bytes(), nil
+}
+
+func writeQuotedPrintable(w interface{ Write([]byte) (int, error) }, s string) error {
+	qp := quotedprintable.NewWriter(w)
+	if _, err := qp.Write([]byte(s)); err != nil {
+		return err
+	}
+	return qp.Close()
+}
+
+// encodeHeader applies RFC 2047 encoding when a header contains non-ASCII text
+func encodeHeader(s string) string {
+	for _, r := range s {
+		if r > 127 {
+			return fmt.Sprintf("=?UTF-8?Q?%s?=", strings.ReplaceAll(qEncode(s), " ", "_"))
+		}
+	}
+	return s
+}
+
+func qEncode(s string) string {
+	var buf bytes.Buffer
+	for _, b := range []byte(s) {
+		if b == ' ' || (b >= '0' && b <= '9') || (b >= 'a' && b <= 'z') || (b >= 'A' && b <= 'Z') {
+			buf.WriteByte(b)
+		} else {
+			fmt.Fprintf(&buf, "=%02X", b)
+		}
+	}
+	return buf.String()
+}
+
+func randomID() string {
+	b := make([]byte, 12)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
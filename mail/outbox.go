@@ -0,0 +1,116 @@
+package mail
+
+import (
+	"database/sql"
+	"errors"
+	"log"
+	"time"
+
+	"vibecoders/models"
+)
+
+const (
+	// maxAttempts is how many times delivery is tried before giving up
+	maxAttempts = 8
+
+	// Retries back off exponentially from retryBaseDelay up to retryMaxDelay
+	retryBaseDelay = 30 * time.Second
+	retryMaxDelay  = 6 * time.Hour
+
+	// outboxBatchSize bounds how many emails one pass of the worker sends
+	outboxBatchSize = 20
+)
+
+// Mailer renders templated emails into the outbox and delivers them in the
+// background through a Sender
+type Mailer struct {
+	db        *sql.DB
+	sender    Sender
+	templates *Templates
+	from      string
+}
+
+// NewMailer creates a Mailer sending as from
+func NewMailer(db *sql.DB, sender Sender, templates *Templates, from string) *Mailer {
+	return &Mailer{db: db, sender: sender, templates: templates, from: from}
+}
+
+// Enqueue renders the named template and queues the result for delivery to to
+func (m *Mailer) Enqueue(to, subject, template string, data interface{}) error {
+	if m == nil {
+		return errors.New("mail is not configured")
+	}
+	if !validHeader(to) || !validHeader(subject) {
+		return ErrHeaderLineBreak
+	}
+
+	text, html, err := m.templates.Render(template, data)
+	if err != nil {
+		return err
+	}
+
+	_, err = models.QueueEmail(m.db, to, subject, text, html)
+	return err
+}
+
+// Start processes the outbox every interval until the process exits
+func (m *Mailer) Start(interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			m.processOutbox()
+			<-ticker.C
+		}
+	}()
+}
+
+// processOutbox sends every due email once, rescheduling failures
+func (m *Mailer) processOutbox() {
+	emails, err := models.GetDueOutboxEmails(m.db, outboxBatchSize)
+	if err != nil {
+		log.Printf("Mail outbox: could not load pending emails: %v", err)
+		return
+	}
+
+	for _, email := range emails {
+		msg := &Message{
+			From:    m.from,
+			To:      email.ToAddress,
+			Subject: email.Subject,
+			Text:    email.TextBody,
+			HTML:    email.HTMLBody,
+		}
+
+		sendErr := m.sender.Send(msg)
+		if sendErr == nil {
+			if err := models.MarkOutboxEmailSent(m.db, email.ID); err != nil {
+				log.Printf("Mail outbox: could not mark email %d sent: %v", email.ID, err)
+			}
+			continue
+		}
+
+		var nextAttemptAt *time.Time
+		if attempt := email.Attempts + 1; attempt < maxAttempts {
+			next := time.Now().UTC().Add(retryDelay(attempt))
+			nextAttemptAt = &next
+			log.Printf("Mail outbox: email %d attempt %d failed, retrying at %s: %v", email.ID, attempt, next.Format(time.RFC3339), sendErr)
+		} else {
+			log.Printf("Mail outbox: email %d failed permanently after %d attempts: %v", email.ID, attempt, sendErr)
+		}
+
+		if err := models.MarkOutboxEmailFailed(m.db, email.ID, sendErr, nextAttemptAt); err != nil {
+			log.Printf("Mail outbox: could not record failure for email %d: %v", email.ID, err)
+		}
+	}
+}
+
+// retryDelay returns the exponential backoff before the given retry attempt
+func retryDelay(attempt int) time.Duration {
+	delay := retryBaseDelay << (attempt - 1)
+	if delay <= 0 || delay > retryMaxDelay {
+		return retryMaxDelay
+	}
+	return delay
+}
@@ -0,0 +1,30 @@
+package mail
+
+import (
+	"net"
+	"net/smtp"
+)
+
+// SMTPSender delivers mail through an SMTP relay. STARTTLS is used whenever
+// the server offers it; credentials are only sent when Username is set.
+type SMTPSender struct {
+	Host     string
+	Port     string
+	Username string
+	Password string
+}
+
+// Send implements Sender
+func (s *SMTPSender) Send(msg *Message) error {
+	data, err := msg.encode()
+	if err != nil {
+		return err
+	}
+
+	var auth smtp.Auth
+	if s.Username != "" {
+		auth = smtp.PlainAuth("", s.Username, s.Password, s.Host)
+	}
+
+	return smtp.SendMail(net.JoinHostPort(s.Host, s.Port), auth, msg.From, []string{msg.To}, data)
+}
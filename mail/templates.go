@@ -0,0 +1,53 @@
+package mail
+
+import (
+	"bytes"
+	htmltemplate "html/template"
+	"io/fs"
+	"path"
+	texttemplate "text/template"
+)
+
+// Templates renders email bodies from a directory of templates. Each email
+// named X has a plain text body in X.txt and an optional HTML body in X.html;
+// HTML bodies define a "content" block that is wrapped by layout.html.
+type Templates struct {
+	fsys fs.FS
+	dir  string
+}
+
+// NewTemplates loads email templates from dir inside fsys
+func NewTemplates(fsys fs.FS, dir string) *Templates {
+	return &Templates{fsys: fsys, dir: dir}
+}
+
+// Render executes the text and HTML templates for name with data. The HTML
+// body is empty if there is no X.html template.
+func (t *Templates) Render(name string, data interface{}) (string, string, error) {
+	textTmpl, err := texttemplate.ParseFS(t.fsys, path.Join(t.dir, name+".txt"))
+	if err != nil {
+		return "", "", err
+	}
+
+	var text bytes.Buffer
+	if err := textTmpl.Execute(&text, data); err != nil {
+		return "", "", err
+	}
+
+	htmlPath := path.Join(t.dir, name+".html")
+	if _, err := fs.Stat(t.fsys, htmlPath); err != nil {
+		return text.String(), "", nil
+	}
+
+	htmlTmpl, err := htmltemplate.ParseFS(t.fsys, path.Join(t.dir, "layout.html"), htmlPath)
+	if err != nil {
+		return "", "", err
+	}
+
+	var html bytes.Buffer
+	if err := htmlTmpl.ExecuteTemplate(&html, "layout.html", data); err != nil {
+		return "", "", err
+	}
+
+	return text.String(), html.String(), nil
+}
@@ -3,16 +3,19 @@ package main
 import (
 	"database/sql"
 	"embed"
-	"fmt"
 	"html/template"
 	"io"
 	"io/fs"
 	"log"
 	"net/http"
 	"os"
+	"strings"
+	"time"
 
 	"vibecoders/api/handlers"
+	"vibecoders/mail"
 	"vibecoders/models"
+	"vibecoders/oauth"
 
 	"github.com/labstack/echo/v4"
 	"github.com/labstack/echo/v4/middleware"
@@ -58,9 +61,64 @@ func main() {
 
 	log.Println("Successfully connected to database")
 
+	// The search index triggers fire on every user, prompt and project write
+	if err := models.CheckUserSearch(db); err != nil {
+		log.Fatalf("Full-text search is unavailable (%v). Build the server with: go build -tags sqlite_fts5", err)
+	}
+
+	// Periodically purge expired sessions
+	models.StartSessionSweeper(db, time.Hour)
+	models.StartUserPurger(db, time.Hour)
+	models.StartDataExportWorker(db, time.Minute)
+	models.StartReputationUpdater(db, 15*time.Minute)
+
+	// Outgoing mail is queued in the outbox and delivered in the background
+	// through the transport chosen by MAIL_TRANSPORT
+	sender, err := mail.SenderFromEnv()
+	if err != nil {
+		log.Fatalf("Failed to configure mail: %v", err)
+	}
+	mailFrom := os.Getenv("MAIL_FROM")
+	if mailFrom == "" {
+		mailFrom = "VibeCoders <no-reply@vibecoders.com>"
+	}
+	mailer := mail.NewMailer(db, sender, mail.NewTemplates(templateContent, "templates/email"), mailFrom)
+	mailer.Start(30 * time.Second)
+
+	// Public origin used for links in emails
+	if baseURL := os.Getenv("BASE_URL"); baseURL != "" {
+		handlers.BaseURL = baseURL
+	}
+
+	// External hosts magic links may redirect to, e.g. "docs.vibecoders.com,blog.vibecoders.com"
+	for _, host := range strings.Split(os.Getenv("REDIRECT_ALLOWED_HOSTS"), ",") {
+		if host = strings.TrimSpace(host); host != "" {
+			handlers.AllowedRedirectHosts = append(handlers.AllowedRedirectHosts, host)
+		}
+	}
+
+	// External login providers from OAUTH_PROVIDERS
+	oauthProviders, err := oauth.ProvidersFromEnv()
+	if err != nil {
+		log.Fatalf("Failed to configure OAuth: %v", err)
+	}
+
+	// Additional origins allowed to call the API from a browser, e.g. "https://app.vibecoders.com"
+	for _, origin := range strings.Split(os.Getenv("CORS_ALLOWED_ORIGINS"), ",") {
+		if origin = strings.TrimRight(strings.TrimSpace(origin), "/"); origin != "" {
+			handlers.AllowedOrigins = append(handlers.AllowedOrigins, origin)
+		}
+	}
+
 	// Initialize Echo
 	e := echo.New()
 
+	// Client addresses key the login throttles and rate limits and are
+	// recorded on sessions and in the audit log. nginx sets X-Real-IP to the
+	// connecting address; it is only trusted from a loopback or private peer,
+	// and X-Forwarded-For (which the client controls) is ignored.
+	e.IPExtractor = echo.ExtractIPFromRealIPHeader()
+
 	// Initialize templates
 	renderer := &TemplateRenderer{
 		templates: template.Must(template.ParseFS(templateContent, "templates/*.html")),
@@ -70,15 +128,17 @@ func main() {
 	// Middleware
 	e.Use(middleware.Logger())
 	e.Use(middleware.Recover())
-	e.Use(middleware.CORS())
-
-	// Add DB to context
-	e.Use(func(next echo.HandlerFunc) echo.HandlerFunc {
-		return func(c echo.Context) error {
-			c.Set("db", db)
-			return next(c)
-		}
-	})
+	// Browsers may only call the API with credentials from our own origin and
+	// those listed in CORS_ALLOWED_ORIGINS
+	e.Use(middleware.CORSWithConfig(middleware.CORSConfig{
+		AllowOrigins:     handlers.CORSOrigins(),
+		AllowCredentials: true,
+		AllowHeaders: []string{
+			echo.HeaderOrigin, echo.HeaderContentType, echo.HeaderAccept,
+			echo.HeaderAuthorization, handlers.CSRFHeader,
+		},
+		ExposeHeaders: []string{echo.HeaderRetryAfter},
+	}))
 
 	// Serve static files from embedded filesystem
 	staticFS, err := fs.Sub(staticContent, "static/dist")
@@ -86,58 +146,189 @@ func main() {
 		log.Fatal(err)
 	}
 
-	// API routes
-	api := e.Group("/api")
+	// API routes. The session is resolved once for every API request;
+	// requireAuth rejects anonymous requests with 401. Routes that name a
+	// resource also accept personal access tokens scoped to it. Cookie
+	// authenticated writes must carry the session's CSRF token, and writes
+	// made while impersonating a user are audited.
+	api := e.Group("/api", handlers.OptionalAuth(db), handlers.CSRFProtect(db), handlers.AuditImpersonation(db))
+	requireAuth := handlers.RequireAuth(db)
+
+	// Account and security changes an administrator may not make while
+	// impersonating a user
+	notImpersonating := handlers.BlockImpersonation()
 	api.POST("/login", handlers.Login(db))
+	api.POST("/login/2fa", handlers.CompleteLoginChallenge(db))
 	api.DELETE("/logout", handlers.Logout(db))
-	api.POST("/register", handlers.Register(db))
-	api.PATCH("/user", handlers.UpdateUser(db))
+	api.POST("/register", handlers.Register(db, mailer))
+	api.PATCH("/user", handlers.UpdateUser(db), handlers.RequireAuth(db, "profile"))
+	api.DELETE("/user", handlers.DeleteAccount(db), requireAuth, notImpersonating)
 	api.GET("/homepage-users", handlers.GetHomepageUsers(db))
-	api.GET("/user", handlers.GetCurrentUser(db))
+	api.GET("/user", handlers.GetCurrentUser(db), handlers.RequireAuth(db, "profile"))
+	api.GET("/users/search", handlers.SearchUsers(db))
+	api.GET("/skills", handlers.GetSkills(db))
+	api.GET("/skills/autocomplete", handlers.AutocompleteSkills(db))
+	api.GET("/user/skills", handlers.GetMySkills(db), handlers.RequireAuth(db, "profile"))
+	api.PUT("/user/skills", handlers.UpdateMySkills(db), handlers.RequireAuth(db, "profile"))
+	api.GET("/user/availability", handlers.GetMyAvailability(db), handlers.RequireAuth(db, "profile"))
+	api.PUT("/user/availability", handlers.UpdateMyAvailability(db), handlers.RequireAuth(db, "profile"))
+	api.DELETE("/user/availability", handlers.ClearMyAvailability(db), handlers.RequireAuth(db, "profile"))
+
+	// Contact requests between users (browser session only)
+	api.POST("/users/:username/contact", handlers.SendContactRequest(db, mailer), requireAuth, notImpersonating)
+	contact := api.Group("/contact-requests", requireAuth)
+	contact.GET("/inbox", handlers.GetContactInbox(db))
+	contact.GET("/sent", handlers.GetSentContactRequests(db))
+	contact.GET("/:id", handlers.GetContactRequest(db))
+	contact.POST("/:id/accept", handlers.AcceptContactRequest(db, mailer), notImpersonating)
+	contact.POST("/:id/decline", handlers.DeclineContactRequest(db, mailer), notImpersonating)
+
+	// Direct messages (browser session only). Administrators can't read or
+	// send them while impersonating.
+	conversations := api.Group("/conversations", requireAuth, notImpersonating)
+	conversations.GET("", handlers.GetConversations(db))
+	conversations.POST("", handlers.StartConversation(db))
+	conversations.GET("/:id", handlers.GetConversation(db))
+	conversations.GET("/:id/messages", handlers.GetConversationMessages(db))
+	conversations.POST("/:id/messages", handlers.SendMessage(db))
+	conversations.POST("/:id/read", handlers.MarkConversationRead(db))
+	api.GET("/messages/stream", handlers.StreamMessages(db), requireAuth, notImpersonating)
+	api.GET("/user/blocks", handlers.GetBlockedUsers(db), requireAuth)
+	api.POST("/users/:username/block", handlers.BlockUser(db), requireAuth, notImpersonating)
+	api.DELETE("/users/:username/block", handlers.UnblockUser(db), requireAuth, notImpersonating)
 	api.GET("/users/:username", handlers.GetPublicUserByUsername(db))
+
+	// Email address routes
+	api.PUT("/user/email", handlers.UpdateEmail(db, mailer), requireAuth, notImpersonating)
+	api.POST("/user/email/resend", handlers.ResendEmailVerification(db, mailer), requireAuth, notImpersonating)
+	api.GET("/email/verify", handlers.VerifyEmail(db))
+
+	// Account data export (session only, not while impersonating)
+	export := api.Group("/user/export", requireAuth, notImpersonating)
+	export.GET("", handlers.ExportUserData(db))
+	export.GET("/:id", handlers.GetDataExportStatus(db))
+	export.GET("/:id/download", handlers.DownloadDataExport(db))
+
+	// Session (device) management routes
+	sessions := api.Group("/sessions", requireAuth)
+	sessions.GET("", handlers.GetSessions(db))
+	sessions.DELETE("", handlers.RevokeAllSessions(db), notImpersonating)
+	sessions.DELETE("/:id", handlers.RevokeSession(db), notImpersonating)
+
+	// Personal access token routes
+	tokens := api.Group("/tokens", requireAuth)
+	tokens.GET("", handlers.GetAccessTokens(db))
+	tokens.POST("", handlers.CreateAccessToken(db), notImpersonating)
+	tokens.DELETE("/:id", handlers.RevokeAccessToken(db), notImpersonating)
 	
 	// Magic link routes
-	api.POST("/magic-links", handlers.CreateMagicLink(db))
-	api.GET("/magic-links", handlers.GetUserMagicLinks(db))
-	api.DELETE("/magic-links/:id", handlers.DeleteMagicLink(db))
+	magicLinks := api.Group("/magic-links", requireAuth)
+	magicLinks.POST("", handlers.CreateMagicLink(db), notImpersonating)
+	magicLinks.GET("", handlers.GetUserMagicLinks(db))
+	magicLinks.DELETE("/:id", handlers.DeleteMagicLink(db), notImpersonating)
 	api.GET("/magic/:token", handlers.LoginWithMagicLink(db))
+	api.POST("/login/email", handlers.RequestEmailLoginLink(db, mailer))
+
+	// Two-factor authentication management (session only)
+	twoFactor := api.Group("/user/2fa", requireAuth)
+	twoFactor.GET("", handlers.GetTwoFactorStatus(db))
+	twoFactor.POST("/setup", handlers.SetupTwoFactor(db), notImpersonating)
+	twoFactor.POST("/enable", handlers.EnableTwoFactor(db), notImpersonating)
+	twoFactor.POST("/disable", handlers.DisableTwoFactor(db), notImpersonating)
+	twoFactor.POST("/recovery-codes", handlers.RegenerateRecoveryCodes(db), notImpersonating)
+
+	// Login with external OAuth / OpenID Connect providers
+	api.GET("/oauth/providers", handlers.GetOAuthProviders(oauthProviders))
+	api.GET("/oauth/:provider/login", handlers.StartOAuthLogin(db, oauthProviders))
+	api.GET("/oauth/:provider/link", handlers.StartOAuthLink(db, oauthProviders), requireAuth, notImpersonating)
+	api.GET("/oauth/:provider/callback", handlers.OAuthCallback(db, oauthProviders))
+	api.GET("/user/identities", handlers.GetUserIdentities(db), requireAuth)
+	api.DELETE("/user/identities/:id", handlers.UnlinkUserIdentity(db), requireAuth, notImpersonating)
+
+	// Password change (session only) and the emailed reset flow
+	api.POST("/password/change", handlers.ChangePassword(db), requireAuth, notImpersonating)
+	api.POST("/password/forgot", handlers.ForgotPassword(db, mailer))
+	api.POST("/password/reset", handlers.ResetPassword(db))
 
 	// Prompt routes
-	api.GET("/prompts", handlers.GetUserPrompts(db))
-	api.POST("/prompts", handlers.CreatePrompt(db))
-	api.PUT("/prompts/:id", handlers.UpdatePrompt(db))
-	api.DELETE("/prompts/:id", handlers.DeletePrompt(db))
+	prompts := api.Group("/prompts", handlers.RequireAuth(db, "prompts"))
+	prompts.GET("", handlers.GetUserPrompts(db))
+	prompts.POST("", handlers.CreatePrompt(db))
+	prompts.PUT("/:id", handlers.UpdatePrompt(db))
+	prompts.DELETE("/:id", handlers.DeletePrompt(db))
 	api.GET("/users/:username/prompts", handlers.GetUserPublicPrompts(db))
 
 	// Project routes
-	api.GET("/projects", handlers.GetUserProjects(db))
-	api.POST("/projects", handlers.CreateProject(db))
-	api.PUT("/projects/:id", handlers.UpdateProject(db))
-	api.DELETE("/projects/:id", handlers.DeleteProject(db))
+	projects := api.Group("/projects", handlers.RequireAuth(db, "projects"))
+	projects.GET("", handlers.GetUserProjects(db))
+	projects.POST("", handlers.CreateProject(db))
+	projects.PUT("/:id", handlers.UpdateProject(db))
+	projects.DELETE("/:id", handlers.DeleteProject(db))
 	api.GET("/users/:username/projects", handlers.GetUserPublicProjects(db))
 
 	// Forum routes
 	api.GET("/forum", handlers.GetForumPostsHandler(db))
-	api.POST("/forum", handlers.CreateForumPostHandler(db))
+	requireForumAuth := handlers.RequireAuth(db, "forum")
+	api.POST("/forum", handlers.CreateForumPostHandler(db), requireForumAuth)
 	api.GET("/forum/:id", handlers.GetForumPostHandler(db))
-	api.POST("/forum/:id/comments", handlers.CreateForumCommentHandler(db))
-	api.POST("/forum/:id/vote", handlers.VoteForumPostHandler(db))
+	api.POST("/forum/:id/comments", handlers.CreateForumCommentHandler(db), requireForumAuth)
+	api.POST("/forum/:id/vote", handlers.VoteForumPostHandler(db), requireForumAuth)
+
+	canModerate := handlers.RequirePermission(db, models.PermForumModerate)
+	api.DELETE("/forum/:id", handlers.DeleteForumPostHandler(db), requireForumAuth, canModerate)
+	api.DELETE("/forum/comments/:id", handlers.DeleteForumCommentHandler(db), requireForumAuth, canModerate)
 	
 	// Budget routes
-	api.GET("/budget/transactions", handlers.GetBudgetTransactions(db))
-	api.GET("/budget/categories", handlers.GetBudgetCategories(db))
-	api.POST("/budget/categories", handlers.CreateBudgetCategory(db))
-	api.PUT("/budget/categories/edit", handlers.EditBudgetCategory(db))
-	api.PUT("/budget/transactions/category", handlers.UpdateTransactionCategory(db))
-	api.POST("/budget/transactions/bulk", handlers.BulkImportTransactions(db))
+	budget := api.Group("/budget", handlers.RequireAuth(db, "budget"))
+	budget.GET("/transactions", handlers.GetBudgetTransactions(db))
+	budget.GET("/categories", handlers.GetBudgetCategories(db))
+	budget.POST("/categories", handlers.CreateBudgetCategory(db))
+	budget.PUT("/categories/edit", handlers.EditBudgetCategory(db))
+	budget.PUT("/transactions/category", handlers.UpdateTransactionCategory(db))
+	budget.POST("/transactions/bulk", handlers.BulkImportTransactions(db))
 
 	// Admin API routes with admin middleware
 	adminMiddleware := handlers.IsAdmin(db)
-	admin := api.Group("/admin", adminMiddleware)
-	admin.GET("/users", handlers.GetAllUsers(db))
-	admin.GET("/users/:id", handlers.GetUserByID(db))
-	admin.PUT("/users/:id", handlers.UpdateUserAsAdmin(db))
-	admin.DELETE("/users/:id", handlers.DeleteUser(db))
+	admin := api.Group("/admin", requireAuth, adminMiddleware)
+	canView := handlers.RequirePermission(db, models.PermUsersView)
+	canEdit := handlers.RequirePermission(db, models.PermUsersEdit)
+	canDelete := handlers.RequirePermission(db, models.PermUsersDelete)
+	admin.GET("/users", handlers.GetAllUsers(db), canView)
+	admin.GET("/users/:id", handlers.GetUserByID(db), canView)
+	admin.PUT("/users/:id", handlers.UpdateUserAsAdmin(db), canEdit)
+	admin.DELETE("/users/:id", handlers.DeleteUser(db), canDelete)
+	admin.POST("/users/:id/restore", handlers.RestoreUser(db), canDelete)
+	admin.DELETE("/users/:id/2fa", handlers.AdminResetTwoFactor(db), canEdit)
+	admin.POST("/users/:id/unlock", handlers.UnlockUser(db), canEdit)
+	admin.GET("/lockouts", handlers.GetLoginLockouts(db), canEdit)
+	admin.DELETE("/lockouts/:key", handlers.ClearLoginLockout(db), canEdit)
+
+	canManageRoles := handlers.RequirePermission(db, models.PermRolesManage)
+	admin.GET("/roles", handlers.GetRoles(db), canManageRoles)
+	admin.GET("/users/:id/roles", handlers.GetUserRoles(db), canManageRoles)
+	admin.POST("/users/:id/roles", handlers.GrantUserRole(db), canManageRoles)
+	admin.DELETE("/users/:id/roles/:role", handlers.RevokeUserRole(db), canManageRoles)
+
+	admin.POST("/users/:id/impersonate", handlers.StartImpersonation(db), handlers.RequirePermission(db, models.PermImpersonate))
+	api.POST("/impersonation/stop", handlers.StopImpersonation(db), requireAuth)
+
+	canViewAudit := handlers.RequirePermission(db, models.PermAuditView)
+	admin.GET("/audit", handlers.GetAuditLog(db), canViewAudit)
+	admin.GET("/audit/export", handlers.ExportAuditLog(db), canViewAudit)
+
+	canManageSkills := handlers.RequirePermission(db, models.PermSkillsManage)
+	admin.POST("/skills", handlers.CreateSkill(db), canManageSkills)
+	admin.GET("/skills/suggestions", handlers.GetSkillSuggestions(db), canManageSkills)
+	admin.POST("/skills/:id/approve", handlers.ApproveSkill(db), canManageSkills)
+	admin.PUT("/skills/:id", handlers.UpdateSkill(db), canManageSkills)
+	admin.DELETE("/skills/:id", handlers.DeleteSkill(db), canManageSkills)
+	admin.POST("/skills/:id/merge", handlers.MergeSkill(db), canManageSkills)
+	admin.POST("/skills/:id/aliases", handlers.AddSkillAlias(db), canManageSkills)
+	admin.DELETE("/skills/:id/aliases/:alias", handlers.RemoveSkillAlias(db), canManageSkills)
+
+	canManageSettings := handlers.RequirePermission(db, models.PermSettingsManage)
+	admin.GET("/settings", handlers.GetAdminSettings(db), canManageSettings)
+	admin.PUT("/settings", handlers.UpdateAdminSettings(db), canManageSettings)
 
 	assetHandler := http.FileServer(http.FS(staticFS))
 
@@ -169,34 +360,21 @@ func main() {
 			"User":        nil,
 		}
 
-		// Check if user is logged in by looking for session cookie
-		cookie, err := c.Cookie("session_token")
-		fmt.Println(cookie, err)
-		if err == nil {
-			// Get the database from context
-			db := c.Get("db").(*sql.DB)
-
-			// Get user ID from session token
-			userID, err := models.GetUserIDByToken(db, cookie.Value)
-			if err == nil {
-				// Get user details
-				user, err := models.GetUserByID(db, userID)
-				if err == nil {
-					// Add user to template data
-					data["User"] = user
-				}
-			}
+		if user := handlers.CurrentUser(c); user != nil {
+			data["User"] = user
 		}
 
 		return c.Render(http.StatusOK, "apps.html", data)
-	})
+	}, handlers.OptionalAuth(db))
 
 	// Serve SPA routes
 	e.GET("/", serveSPA)
 	e.GET("/login", serveSPA)
 	e.GET("/register", serveSPA)
+	e.GET("/reset-password", serveSPA)
 	e.GET("/profile", serveSPA)
 	e.GET("/users/:username", serveSPA)
+	e.GET("/messages", serveSPA)
 	e.GET("/forum", serveSPA)
 	e.GET("/forum/:id", serveSPA)
 	e.GET("/forum/new", serveSPA)
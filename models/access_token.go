@@ -0,0 +1,199 @@
+package models
+
+import (
+	"database/sql"
+	"strings"
+	"time"
+)
+
+// Personal access tokens look like "vcp_<64 hex chars>". The prefix makes them
+// easy to spot in scripts and secret scanners.
+const accessTokenPrefix = "vcp_"
+
+// AccessTokenScopes lists every scope a personal access token may be granted
+var AccessTokenScopes = []string{
+	"profile:read", "profile:write",
+	"prompts:read", "prompts:write",
+	"projects:read", "projects:write",
+	"forum:write",
+	"budget:read", "budget:write",
+}
+
+type AccessToken struct {
+	ID          int        `json:"id"`
+	UserID      int        `json:"user_id"`
+	Name        string     `json:"name"`
+	TokenPrefix string     `json:"token_prefix"`
+	Scopes      []string   `json:"scopes"`
+	CreatedAt   time.Time  `json:"created_at"`
+	LastUsedAt  *time.Time `json:"last_used_at"`
+	ExpiresAt   *time.Time `json:"expires_at"`
+}
+
+// IsValidAccessTokenScope reports whether scope is a known scope
+func IsValidAccessTokenScope(scope string) bool {
+	for _, s := range AccessTokenScopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+// HasScope reports whether the token was granted the given scope
+func (t *AccessToken) HasScope(scope string) bool {
+	for _, s := range t.Scopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+// CreateAccessToken issues a new token for a user. The plaintext token is only
+// returned here; afterwards only its hash is known.
+func CreateAccessToken(db *sql.DB, userID int, name string, scopes []string, expiresAt *time.Time) (*AccessToken, string, error) {
+	secret, err := newSecretToken()
+	if err != nil {
+		return nil, "", err
+	}
+	token := accessTokenPrefix + secret
+	prefix := token[:len(accessTokenPrefix)+8]
+
+	query := `INSERT INTO personal_access_tokens (user_id, name, token_hash, token_prefix, scopes, created_at, expires_at)
+              VALUES (?, ?, ?, ?, ?, ?, ?)`
+
+	now := time.Now().UTC()
+	result, err := db.Exec(query, userID, name, hashToken(token), prefix, strings.Join(scopes, ","), now, expiresAt)
+	if err != nil {
+		return nil, "", err
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return nil, "", err
+	}
+
+	return &AccessToken{
+		ID:          int(id),
+		UserID:      userID,
+		Name:        name,
+		TokenPrefix: prefix,
+		Scopes:      scopes,
+		CreatedAt:   now,
+		ExpiresAt:   expiresAt,
+	}, token, nil
+}
+
+// GetAccessTokenByToken looks up an active token by its plaintext value and
+// records the use. Unknown, revoked and expired tokens return sql.ErrNoRows.
+func GetAccessTokenByToken(db *sql.DB, token string) (*AccessToken, error) {
+	if !strings.HasPrefix(token, accessTokenPrefix) {
+		return nil, sql.ErrNoRows
+	}
+
+	query := `SELECT id, user_id, name, token_prefix, scopes, created_at, last_used_at, expires_at
+              FROM personal_access_tokens
+              WHERE token_hash = ? AND revoked_at IS NULL`
+
+	t, err := scanAccessToken(db.QueryRow(query, hashToken(token)))
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now().UTC()
+	if t.ExpiresAt != nil && now.After(*t.ExpiresAt) {
+		return nil, sql.ErrNoRows
+	}
+
+	_, err = db.Exec(`UPDATE personal_access_tokens SET last_used_at = ? WHERE id = ?`, now, t.ID)
+	if err != nil {
+		return nil, err
+	}
+	t.LastUsedAt = &now
+
+	return t, nil
+}
+
+// GetUserAccessTokens lists a user's tokens that have not been revoked
+func GetUserAccessTokens(db *sql.DB, userID int) ([]AccessToken, error) {
+	query := `SELECT id, user_id, name, token_prefix, scopes, created_at, last_used_at, expires_at
+              FROM personal_access_tokens
+              WHERE user_id = ? AND revoked_at IS NULL
+              ORDER BY created_at DESC`
+
+	rows, err := db.Query(query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	tokens := []AccessToken{}
+	for rows.Next() {
+		t, err := scanAccessToken(rows)
+		if err != nil {
+			return nil, err
+		}
+		tokens = append(tokens, *t)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return tokens, nil
+}
+
+// RevokeAccessToken revokes one of the user's tokens
+func RevokeAccessToken(db *sql.DB, id, userID int) error {
+	query := `UPDATE personal_access_tokens SET revoked_at = ?
+              WHERE id = ? AND user_id = ? AND revoked_at IS NULL`
+
+	result, err := db.Exec(query, time.Now().UTC(), id, userID)
+	if err != nil {
+		return err
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return sql.ErrNoRows
+	}
+
+	return nil
+}
+
+// RevokeUserAccessTokens revokes every active token of a user. Called when
+// the user's password changes, so a leaked token doesn't outlive it.
+func RevokeUserAccessTokens(db *sql.DB, userID int) error {
+	query := `UPDATE personal_access_tokens SET revoked_at = ? WHERE user_id = ? AND revoked_at IS NULL`
+	_, err := db.Exec(query, time.Now().UTC(), userID)
+	return err
+}
+
+func scanAccessToken(row rowScanner) (*AccessToken, error) {
+	var t AccessToken
+	var scopes string
+	var lastUsedAt, expiresAt sql.NullTime
+
+	err := row.Scan(&t.ID, &t.UserID, &t.Name, &t.TokenPrefix, &scopes, &t.CreatedAt, &lastUsedAt, &expiresAt)
+	if err != nil {
+		return nil, err
+	}
+
+	if scopes != "" {
+		t.Scopes = strings.Split(scopes, ",")
+	} else {
+		t.Scopes = []string{}
+	}
+	if lastUsedAt.Valid {
+		t.LastUsedAt = &lastUsedAt.Time
+	}
+	if expiresAt.Valid {
+		t.ExpiresAt = &expiresAt.Time
+	}
+
+	return &t, nil
+}
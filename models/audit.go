@@ -0,0 +1,234 @@
+package models
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+	"time"
+)
+
+// Audited actions
+const (
+	AuditUserUpdate         = "user.update"
+	AuditUserDelete         = "user.delete"
+	AuditUserRestore        = "user.restore"
+	AuditUserSelfDelete     = "user.self_delete"
+	AuditUserTwoFactorReset = "user.2fa_reset"
+	AuditUserUnlock         = "user.unlock"
+	AuditLockoutClear       = "lockout.clear"
+	AuditRoleGrant          = "role.grant"
+	AuditRoleRevoke         = "role.revoke"
+	AuditSettingsUpdate     = "settings.update"
+	AuditForumPostDelete    = "forum.post_delete"
+	AuditForumCommentDelete = "forum.comment_delete"
+	AuditImpersonationStart = "impersonation.start"
+	AuditImpersonationStop  = "impersonation.stop"
+	AuditImpersonatedWrite  = "impersonation.request"
+	AuditSkillCreate        = "skill.create"
+	AuditSkillUpdate        = "skill.update"
+	AuditSkillDelete        = "skill.delete"
+	AuditSkillMerge         = "skill.merge"
+	AuditSkillAliasAdd      = "skill.alias_add"
+	AuditSkillAliasRemove   = "skill.alias_remove"
+	AuditSkillApprove       = "skill.approve"
+)
+
+// AuditChange is the value of one field before and after an action
+type AuditChange struct {
+	From interface{} `json:"from"`
+	To   interface{} `json:"to"`
+}
+
+// AuditChanges maps field names to how they changed
+type AuditChanges map[string]AuditChange
+
+// AuditEntry is one row of the audit log
+type AuditEntry struct {
+	ID            int          `json:"id"`
+	ActorID       *int         `json:"actor_id"`
+	ActorUsername string       `json:"actor_username"`
+	Action        string       `json:"action"`
+	TargetType    string       `json:"target_type"`
+	TargetID      string       `json:"target_id"`
+	TargetLabel   string       `json:"target_label"`
+	Changes       AuditChanges `json:"changes"`
+	IPAddress     string       `json:"ip_address"`
+	UserAgent     string       `json:"user_agent"`
+	CreatedAt     time.Time    `json:"created_at"`
+}
+
+// AuditFilter narrows down audit log queries. Zero values match everything.
+type AuditFilter struct {
+	ActorID    int
+	Action     string // Exact action, or a prefix ending in "." such as "user."
+	TargetType string
+	TargetID   string
+	Since      time.Time
+	Until      time.Time
+}
+
+// DiffFields compares two snapshots of the same fields and returns only the
+// ones that differ. A field missing from either side is reported as nil.
+func DiffFields(before, after map[string]interface{}) AuditChanges {
+	changes := AuditChanges{}
+	for field, from := range before {
+		to, ok := after[field]
+		if !ok || !reflect.DeepEqual(from, to) {
+			changes[field] = AuditChange{From: from, To: to}
+		}
+	}
+	for field, to := range after {
+		if _, ok := before[field]; !ok {
+			changes[field] = AuditChange{From: nil, To: to}
+		}
+	}
+	return changes
+}
+
+// RecordAudit appends an entry to the audit log
+func RecordAudit(db *sql.DB, entry *AuditEntry) error {
+	var changes interface{}
+	if len(entry.Changes) > 0 {
+		data, err := json.Marshal(entry.Changes)
+		if err != nil {
+			return err
+		}
+		changes = string(data)
+	}
+
+	if entry.CreatedAt.IsZero() {
+		entry.CreatedAt = time.Now().UTC()
+	}
+
+	query := `INSERT INTO audit_log (actor_id, actor_username, action, target_type, target_id, target_label,
+                                     changes, ip_address, user_agent, created_at)
+              VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`
+
+	result, err := db.Exec(query, entry.ActorID, entry.ActorUsername, entry.Action, entry.TargetType,
+		entry.TargetID, entry.TargetLabel, changes, entry.IPAddress, entry.UserAgent, entry.CreatedAt)
+	if err != nil {
+		return err
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return err
+	}
+	entry.ID = int(id)
+
+	return nil
+}
+
+// where builds the WHERE clause for a filter
+func (f AuditFilter) where() (string, []interface{}) {
+	var conditions []string
+	var args []interface{}
+
+	if f.ActorID != 0 {
+		conditions = append(conditions, "actor_id = ?")
+		args = append(args, f.ActorID)
+	}
+	if f.Action != "" {
+		if strings.HasSuffix(f.Action, ".") {
+			conditions = append(conditions, "substr(action, 1, ?) = ?")
+			args = append(args, len(f.Action), f.Action)
+		} else {
+			conditions = append(conditions, "action = ?")
+			args = append(args, f.Action)
+		}
+	}
+	if f.TargetType != "" {
+		conditions = append(conditions, "target_type = ?")
+		args = append(args, f.TargetType)
+	}
+	if f.TargetID != "" {
+		conditions = append(conditions, "target_id = ?")
+		args = append(args, f.TargetID)
+	}
+	if !f.Since.IsZero() {
+		conditions = append(conditions, "created_at >= ?")
+		args = append(args, f.Since.UTC())
+	}
+	if !f.Until.IsZero() {
+		conditions = append(conditions, "created_at < ?")
+		args = append(args, f.Until.UTC())
+	}
+
+	if len(conditions) == 0 {
+		return "", nil
+	}
+	return " WHERE " + strings.Join(conditions, " AND "), args
+}
+
+// GetAuditEntries returns matching entries, newest first. A pageSize of 0
+// returns every match.
+func GetAuditEntries(db *sql.DB, filter AuditFilter, page, pageSize int) ([]AuditEntry, error) {
+	where, args := filter.where()
+	query := `SELECT id, actor_id, actor_username, action, target_type, COALESCE(target_id, ''),
+                     COALESCE(target_label, ''), changes, COALESCE(ip_address, ''),
+                     COALESCE(user_agent, ''), created_at
+              FROM audit_log` + where + ` ORDER BY created_at DESC, id DESC`
+
+	if pageSize > 0 {
+		query += ` LIMIT ? OFFSET ?`
+		args = append(args, pageSize, (page-1)*pageSize)
+	}
+
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	entries := []AuditEntry{}
+	for rows.Next() {
+		entry, err := scanAuditEntry(rows)
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, *entry)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return entries, nil
+}
+
+// CountAuditEntries returns how many entries match a filter
+func CountAuditEntries(db *sql.DB, filter AuditFilter) (int, error) {
+	where, args := filter.where()
+
+	var count int
+	err := db.QueryRow(`SELECT COUNT(*) FROM audit_log`+where, args...).Scan(&count)
+	return count, err
+}
+
+func scanAuditEntry(row rowScanner) (*AuditEntry, error) {
+	var entry AuditEntry
+	var actorID sql.NullInt64
+	var changes sql.NullString
+
+	err := row.Scan(&entry.ID, &actorID, &entry.ActorUsername, &entry.Action, &entry.TargetType,
+		&entry.TargetID, &entry.TargetLabel, &changes, &entry.IPAddress, &entry.UserAgent, &entry.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+
+	if actorID.Valid {
+		id := int(actorID.Int64)
+		entry.ActorID = &id
+	}
+
+	entry.Changes = AuditChanges{}
+	if changes.Valid && changes.String != "" {
+		if err := json.Unmarshal([]byte(changes.String), &entry.Changes); err != nil {
+			return nil, fmt.Errorf("audit entry %d: %w", entry.ID, err)
+		}
+	}
+
+	return &entry, nil
+}
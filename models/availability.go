@@ -0,0 +1,102 @@
+package models
+
+import (
+	"database/sql"
+	"regexp"
+	"time"
+
+	// Timezones are validated against the embedded database so the result
+	// doesn't depend on the host's zoneinfo
+	_ "time/tzdata"
+)
+
+// Availability statuses
+const (
+	AvailabilityOpenToWork = "open_to_work"
+	AvailabilityFreelance  = "freelance"
+	AvailabilityNotLooking = "not_looking"
+)
+
+// AvailabilityStatuses lists the valid availability statuses
+var AvailabilityStatuses = []string{AvailabilityOpenToWork, AvailabilityFreelance, AvailabilityNotLooking}
+
+// MaxHourlyRate is the highest hourly rate accepted on a profile
+const MaxHourlyRate = 100000
+
+var currencyPattern = regexp.MustCompile(`^[A-Z]{3}$`)
+
+// Availability is whether, and on what terms, a user is open to work
+type Availability struct {
+	Status       string    `json:"status"`
+	HourlyRate   *int      `json:"hourly_rate"`
+	RateCurrency string    `json:"rate_currency"`
+	Timezone     string    `json:"timezone"`
+	UpdatedAt    time.Time `json:"updated_at"`
+}
+
+// ValidAvailabilityStatus reports whether status is one of AvailabilityStatuses
+func ValidAvailabilityStatus(status string) bool {
+	return indexOf(AvailabilityStatuses, status) >= 0
+}
+
+// ValidCurrency reports whether currency looks like an ISO 4217 code
+func ValidCurrency(currency string) bool {
+	return currencyPattern.MatchString(currency)
+}
+
+// ValidTimezone reports whether tz is an IANA timezone name
+func ValidTimezone(tz string) bool {
+	if tz == "" || tz == "Local" {
+		return false
+	}
+	_, err := time.LoadLocation(tz)
+	return err == nil
+}
+
+// GetAvailability returns a user's availability, or sql.ErrNoRows if they
+// haven't set one
+func GetAvailability(db *sql.DB, userID int) (*Availability, error) {
+	var a Availability
+	var rate sql.NullInt64
+	var timezone sql.NullString
+
+	err := db.QueryRow(`SELECT status, hourly_rate, rate_currency, timezone, updated_at
+                        FROM user_availability WHERE user_id = ?`, userID).
+		Scan(&a.Status, &rate, &a.RateCurrency, &timezone, &a.UpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+
+	if rate.Valid {
+		value := int(rate.Int64)
+		a.HourlyRate = &value
+	}
+	a.Timezone = timezone.String
+
+	return &a, nil
+}
+
+// SetAvailability creates or replaces a user's availability
+func SetAvailability(db *sql.DB, userID int, a *Availability) error {
+	var timezone interface{}
+	if a.Timezone != "" {
+		timezone = a.Timezone
+	}
+
+	_, err := db.Exec(`INSERT INTO user_availability (user_id, status, hourly_rate, rate_currency, timezone, updated_at)
+                       VALUES (?, ?, ?, ?, ?, ?)
+                       ON CONFLICT (user_id) DO UPDATE SET
+                         status = excluded.status,
+                         hourly_rate = excluded.hourly_rate,
+                         rate_currency = excluded.rate_currency,
+                         timezone = excluded.timezone,
+                         updated_at = excluded.updated_at`,
+		userID, a.Status, a.HourlyRate, a.RateCurrency, timezone, time.Now().UTC())
+	return err
+}
+
+// ClearAvailability removes a user's availability from their profile
+func ClearAvailability(db *sql.DB, userID int) error {
+	_, err := db.Exec(`DELETE FROM user_availability WHERE user_id = ?`, userID)
+	return err
+}
@@ -0,0 +1,310 @@
+package models
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+)
+
+// Contact request states
+const (
+	ContactRequestPending  = "pending"
+	ContactRequestAccepted = "accepted"
+	ContactRequestDeclined = "declined"
+)
+
+const (
+	// ContactRequestDailyLimit is how many requests a user may send in 24 hours
+	ContactRequestDailyLimit = 10
+
+	// ContactRequestMaxPending is how many unanswered requests a user may
+	// have outstanding at once
+	ContactRequestMaxPending = 20
+
+	// ContactRequestCooldown is how long after a decline the sender must wait
+	// before contacting the same person again
+	ContactRequestCooldown = 30 * 24 * time.Hour
+
+	// Bounds on the message length
+	ContactRequestMinLength = 10
+	ContactRequestMaxLength = 2000
+)
+
+var (
+	ErrContactRequestPending   = errors.New("a contact request to this user is already pending")
+	ErrContactRequestCooldown  = errors.New("this user declined a recent contact request")
+	ErrContactRequestDaily     = errors.New("daily contact request limit reached")
+	ErrContactRequestOpen      = errors.New("too many unanswered contact requests")
+	ErrContactRequestResponded = errors.New("contact request already answered")
+)
+
+// ContactDetails are shared with the other party once a request is accepted
+type ContactDetails struct {
+	Email       string `json:"email,omitempty"`
+	GithubURL   string `json:"github_url,omitempty"`
+	LinkedInURL string `json:"linked_in_url,omitempty"`
+	Note        string `json:"note,omitempty"`
+}
+
+// ContactUser is the public side of a user in a contact request
+type ContactUser struct {
+	ID       int    `json:"id"`
+	Username string `json:"username"`
+	Fullname string `json:"fullname"`
+	PhotoURL string `json:"photo_url"`
+
+	contact ContactDetails
+}
+
+// ContactRequest is a message from one user to a profile owner
+type ContactRequest struct {
+	ID           int         `json:"id"`
+	Sender       ContactUser `json:"sender"`
+	Recipient    ContactUser `json:"recipient"`
+	Message      string      `json:"message"`
+	Status       string      `json:"status"`
+	ResponseNote string      `json:"response_note,omitempty"`
+	CreatedAt    time.Time   `json:"created_at"`
+	RespondedAt  *time.Time  `json:"responded_at,omitempty"`
+
+	// Contact is the other party's contact details, only once accepted
+	Contact *ContactDetails `json:"contact,omitempty"`
+}
+
+// IsParticipant reports whether the user sent or received the request
+func (r *ContactRequest) IsParticipant(userID int) bool {
+	return r.Sender.ID == userID || r.Recipient.ID == userID
+}
+
+// revealFor fills in Contact with the details of whoever viewerID is talking
+// to, if the request was accepted. The recipient's reply note goes to the
+// sender.
+func (r *ContactRequest) revealFor(viewerID int) {
+	if r.Status != ContactRequestAccepted {
+		return
+	}
+
+	if viewerID == r.Sender.ID {
+		contact := r.Recipient.contact
+		contact.Note = r.ResponseNote
+		r.Contact = &contact
+	} else {
+		contact := r.Sender.contact
+		r.Contact = &contact
+	}
+}
+
+const contactRequestSelect = `
+	SELECT cr.id, cr.message, cr.status, cr.response_note, cr.created_at, cr.responded_at,
+	       s.id, s.username, s.fullname, s.photo_url, s.email, s.email_verified_at, s.github_url, s.linked_in_url,
+	       r.id, r.username, r.fullname, r.photo_url, r.email, r.email_verified_at, r.github_url, r.linked_in_url
+	FROM contact_requests cr
+	JOIN users s ON s.id = cr.sender_id
+	JOIN users r ON r.id = cr.recipient_id
+	WHERE s.deleted_at IS NULL AND r.deleted_at IS NULL`
+
+// contactUserColumns receives one user's columns of contactRequestSelect
+type contactUserColumns struct {
+	fullname, photo, email, github, linkedIn sql.NullString
+	emailVerifiedAt                          sql.NullTime
+}
+
+func (c *contactUserColumns) dest(user *ContactUser) []interface{} {
+	return []interface{}{&user.ID, &user.Username, &c.fullname, &c.photo, &c.email, &c.emailVerifiedAt, &c.github, &c.linkedIn}
+}
+
+func (c *contactUserColumns) apply(user *ContactUser) {
+	user.Fullname = c.fullname.String
+	user.PhotoURL = c.photo.String
+	// Only a verified address is ever shared
+	if c.email.Valid && c.emailVerifiedAt.Valid {
+		user.contact.Email = c.email.String
+	}
+	user.contact.GithubURL = c.github.String
+	user.contact.LinkedInURL = c.linkedIn.String
+}
+
+func scanContactRequest(row rowScanner, viewerID int) (*ContactRequest, error) {
+	var r ContactRequest
+	var note sql.NullString
+	var respondedAt sql.NullTime
+	var sender, recipient contactUserColumns
+
+	dest := []interface{}{&r.ID, &r.Message, &r.Status, &note, &r.CreatedAt, &respondedAt}
+	dest = append(dest, sender.dest(&r.Sender)...)
+	dest = append(dest, recipient.dest(&r.Recipient)...)
+
+	if err := row.Scan(dest...); err != nil {
+		return nil, err
+	}
+
+	sender.apply(&r.Sender)
+	recipient.apply(&r.Recipient)
+	r.ResponseNote = note.String
+	if respondedAt.Valid {
+		r.RespondedAt = &respondedAt.Time
+	}
+	r.revealFor(viewerID)
+
+	return &r, nil
+}
+
+// CreateContactRequest sends a message from sender to recipient, enforcing
+// the spam limits. Returns the new request's ID.
+func CreateContactRequest(db *sql.DB, senderID, recipientID int, message string) (int, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return 0, err
+	}
+
+	now := time.Now().UTC()
+
+	var pendingToRecipient, declinedRecently, sentToday, openCount int
+	err = tx.QueryRow(`SELECT
+	                     COUNT(CASE WHEN recipient_id = ? AND status = ? THEN 1 END),
+	                     COUNT(CASE WHEN recipient_id = ? AND status = ? AND responded_at > ? THEN 1 END),
+	                     COUNT(CASE WHEN created_at > ? THEN 1 END),
+	                     COUNT(CASE WHEN status = ? THEN 1 END)
+	                   FROM contact_requests WHERE sender_id = ?`,
+		recipientID, ContactRequestPending,
+		recipientID, ContactRequestDeclined, now.Add(-ContactRequestCooldown),
+		now.Add(-24*time.Hour),
+		ContactRequestPending,
+		senderID).Scan(&pendingToRecipient, &declinedRecently, &sentToday, &openCount)
+	if err != nil {
+		tx.Rollback()
+		return 0, err
+	}
+
+	var limitErr error
+	switch {
+	case pendingToRecipient > 0:
+		limitErr = ErrContactRequestPending
+	case declinedRecently > 0:
+		limitErr = ErrContactRequestCooldown
+	case sentToday >= ContactRequestDailyLimit:
+		limitErr = ErrContactRequestDaily
+	case openCount >= ContactRequestMaxPending:
+		limitErr = ErrContactRequestOpen
+	}
+	if limitErr != nil {
+		tx.Rollback()
+		return 0, limitErr
+	}
+
+	result, err := tx.Exec(`INSERT INTO contact_requests (sender_id, recipient_id, message, status, created_at)
+                            VALUES (?, ?, ?, ?, ?)`, senderID, recipientID, message, ContactRequestPending, now)
+	if err != nil {
+		tx.Rollback()
+		return 0, err
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		tx.Rollback()
+		return 0, err
+	}
+
+	return int(id), tx.Commit()
+}
+
+// ContactRequestRetryAfter returns how long until the sender may send
+// another request under the daily limit
+func ContactRequestRetryAfter(db *sql.DB, senderID int) (time.Duration, error) {
+	since := time.Now().UTC().Add(-24 * time.Hour)
+
+	var oldest time.Time
+	err := db.QueryRow(`SELECT created_at FROM contact_requests
+                        WHERE sender_id = ? AND created_at > ?
+                        ORDER BY created_at DESC LIMIT 1 OFFSET ?`,
+		senderID, since, ContactRequestDailyLimit-1).Scan(&oldest)
+	if err != nil {
+		return 0, err
+	}
+
+	return time.Until(oldest.Add(24 * time.Hour)), nil
+}
+
+// GetContactRequest returns a request as seen by viewerID
+func GetContactRequest(db *sql.DB, id, viewerID int) (*ContactRequest, error) {
+	return scanContactRequest(db.QueryRow(contactRequestSelect+` AND cr.id = ?`, id), viewerID)
+}
+
+// GetContactRequests returns one page of the requests a user received
+// (sent false) or sent (sent true), newest first. An empty status matches
+// every status.
+func GetContactRequests(db *sql.DB, userID int, sent bool, status string, page, pageSize int) ([]ContactRequest, error) {
+	query, args := contactRequestFilter(contactRequestSelect, userID, sent, status)
+	query += ` ORDER BY cr.created_at DESC, cr.id DESC LIMIT ? OFFSET ?`
+	args = append(args, pageSize, (page-1)*pageSize)
+
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	requests := []ContactRequest{}
+	for rows.Next() {
+		r, err := scanContactRequest(rows, userID)
+		if err != nil {
+			return nil, err
+		}
+		requests = append(requests, *r)
+	}
+
+	return requests, rows.Err()
+}
+
+// CountContactRequests counts the requests GetContactRequests pages through
+func CountContactRequests(db *sql.DB, userID int, sent bool, status string) (int, error) {
+	query, args := contactRequestFilter(`SELECT COUNT(*) FROM contact_requests cr
+	                                     JOIN users s ON s.id = cr.sender_id
+	                                     JOIN users r ON r.id = cr.recipient_id
+	                                     WHERE s.deleted_at IS NULL AND r.deleted_at IS NULL`, userID, sent, status)
+
+	var count int
+	err := db.QueryRow(query, args...).Scan(&count)
+	return count, err
+}
+
+func contactRequestFilter(query string, userID int, sent bool, status string) (string, []interface{}) {
+	if sent {
+		query += ` AND cr.sender_id = ?`
+	} else {
+		query += ` AND cr.recipient_id = ?`
+	}
+	args := []interface{}{userID}
+
+	if status != "" {
+		query += ` AND cr.status = ?`
+		args = append(args, status)
+	}
+
+	return query, args
+}
+
+// RespondToContactRequest accepts or declines a pending request. Returns
+// ErrContactRequestResponded if it was already answered.
+func RespondToContactRequest(db *sql.DB, id, recipientID int, status, note string) error {
+	var responseNote interface{}
+	if note != "" {
+		responseNote = note
+	}
+
+	result, err := db.Exec(`UPDATE contact_requests SET status = ?, response_note = ?, responded_at = ?
+                            WHERE id = ? AND recipient_id = ? AND status = ?`,
+		status, responseNote, time.Now().UTC(), id, recipientID, ContactRequestPending)
+	if err != nil {
+		return err
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return ErrContactRequestResponded
+	}
+	return nil
+}
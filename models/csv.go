@@ -0,0 +1,19 @@
+package models
+
+import (
+	"strconv"
+	"strings"
+)
+
+// CSVCell stops spreadsheet programs from running user-controlled text as a
+// formula by prefixing cells that would start one with a quote. Plain numbers,
+// negative ones included, are left alone.
+func CSVCell(value string) string {
+	if value == "" || !strings.ContainsRune("=+-@\t\r", rune(value[0])) {
+		return value
+	}
+	if _, err := strconv.ParseFloat(value, 64); err == nil {
+		return value
+	}
+	return "'" + value
+}
@@ -0,0 +1,22 @@
+package models
+
+import "testing"
+
+func TestCSVCell(t *testing.T) {
+	for value, want := range map[string]string{
+		"":                  "",
+		"hello":             "hello",
+		"=HYPERLINK(\"x\")": "'=HYPERLINK(\"x\")",
+		"+1+1":              "'+1+1",
+		"-2+3":              "'-2+3",
+		"@SUM(A1)":          "'@SUM(A1)",
+		"\tcmd":             "'\tcmd",
+		"\rcmd":             "'\rcmd",
+		"-12.50":            "-12.50",
+		"a=b":               "a=b",
+	} {
+		if got := CSVCell(value); got != want {
+			t.Errorf("CSVCell(%q) = %q, want %q", value, got, want)
+		}
+	}
+}
@@ -0,0 +1,382 @@
+package models
+
+import (
+	"archive/zip"
+	"bytes"
+	"database/sql"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"time"
+)
+
+const (
+	// DataExportTTL is how long a finished export can be downloaded
+	DataExportTTL = 7 * 24 * time.Hour
+
+	// DataExportSyncLimit is the most rows an account may have for its
+	// export to be built during the request instead of in the background
+	DataExportSyncLimit = 2000
+
+	// dataExportStaleAfter is how long a running export may go without
+	// finishing before it is assumed lost (e.g. the server restarted)
+	dataExportStaleAfter = 15 * time.Minute
+)
+
+// Export job states
+const (
+	DataExportPending = "pending"
+	DataExportRunning = "running"
+	DataExportReady   = "ready"
+	DataExportFailed  = "failed"
+)
+
+// DataExport is a background account export job
+type DataExport struct {
+	ID          int        `json:"id"`
+	UserID      int        `json:"-"`
+	Status      string     `json:"status"`
+	Size        int64      `json:"size,omitempty"`
+	Error       string     `json:"error,omitempty"`
+	CreatedAt   time.Time  `json:"created_at"`
+	CompletedAt *time.Time `json:"completed_at,omitempty"`
+	ExpiresAt   time.Time  `json:"expires_at"`
+}
+
+// exportTable is one file in the export archive. Every query takes the user
+// ID as its only argument. Secrets (password and token hashes, TOTP secrets,
+// session tokens) are never selected.
+type exportTable struct {
+	name  string
+	query string
+}
+
+var exportTables = []exportTable{
+	{"account", `SELECT id, username, fullname, bio, linked_in_url, github_url, photo_url, email,
+                        email_verified_at, totp_enabled_at AS two_factor_enabled_at, created_at
+                 FROM users WHERE id = ?`},
+	{"roles", `SELECT r.name AS role, ur.granted_at
+               FROM user_roles ur JOIN roles r ON r.id = ur.role_id WHERE ur.user_id = ?`},
+	{"linked_accounts", `SELECT provider, subject, email, username, created_at, last_login_at
+                         FROM user_identities WHERE user_id = ?`},
+	{"skills", `SELECT s.name, s.category, us.proficiency, us.years, us.created_at
+                FROM user_skills us JOIN skills s ON s.id = us.skill_id WHERE us.user_id = ? ORDER BY s.name`},
+	{"availability", `SELECT status, hourly_rate, rate_currency, timezone, updated_at FROM user_availability WHERE user_id = ?`},
+	{"contact_requests", `SELECT cr.id, s.username AS sender, r.username AS recipient, cr.message, cr.status,
+                                 cr.response_note, cr.created_at, cr.responded_at
+                          FROM contact_requests cr
+                          JOIN users s ON s.id = cr.sender_id
+                          JOIN users r ON r.id = cr.recipient_id
+                          WHERE ? IN (cr.sender_id, cr.recipient_id) ORDER BY cr.id`},
+	{"messages", `SELECT m.id, m.conversation_id, s.username AS sender, m.body, m.created_at
+                  FROM messages m
+                  JOIN conversation_participants p ON p.conversation_id = m.conversation_id
+                  JOIN users s ON s.id = m.sender_id
+                  WHERE p.user_id = ? ORDER BY m.id`},
+	{"blocked_users", `SELECT u.username, b.created_at
+                       FROM user_blocks b JOIN users u ON u.id = b.blocked_id WHERE b.blocker_id = ? ORDER BY b.created_at`},
+	{"prompts", `SELECT id, title, content, tags, created_at FROM prompts WHERE user_id = ? ORDER BY id`},
+	{"projects", `SELECT id, title, description, github_url, website_url, image_url1, image_url2, image_url3, created_at
+                  FROM projects WHERE user_id = ? ORDER BY id`},
+	{"forum_posts", `SELECT id, title, content, url, score, created_at FROM forum_posts WHERE user_id = ? ORDER BY id`},
+	{"forum_comments", `SELECT id, post_id, content, created_at FROM forum_comments WHERE user_id = ? ORDER BY id`},
+	{"forum_votes", `SELECT post_id, created_at FROM forum_votes WHERE user_id = ? ORDER BY id`},
+	{"budget_categories", `SELECT id, name, created_at FROM budget_categories WHERE user_id = ? ORDER BY id`},
+	{"budget_transactions", `SELECT t.id, t.date, t.amount, t.description, t.category_id, c.name AS category, t.created_at
+                             FROM budget_transactions t
+                             LEFT JOIN budget_categories c ON c.id = t.category_id
+                             WHERE t.user_id = ? ORDER BY t.date, t.id`},
+	{"magic_links", `SELECT id, created_at, expires_at, redirect_url, max_uses, use_count, revoked_at
+                     FROM magic_links WHERE user_id = ? ORDER BY id`},
+	{"access_tokens", `SELECT id, name, token_prefix, scopes, created_at, last_used_at, expires_at, revoked_at
+                       FROM personal_access_tokens WHERE user_id = ? ORDER BY id`},
+	{"sessions", `SELECT id, created_at, last_seen_at, expires_at, ip_address, user_agent
+                  FROM sessions WHERE user_id = ? AND impersonator_id IS NULL ORDER BY id`},
+}
+
+// exportCSVTables are also written as CSV for use in spreadsheets
+var exportCSVTables = map[string]bool{"budget_transactions": true}
+
+// CountUserExportRows returns roughly how much data an export of the user
+// would contain, to decide whether to build it in the background
+func CountUserExportRows(db *sql.DB, userID int) (int, error) {
+	total := 0
+	for _, table := range exportTables {
+		var count int
+		query := `SELECT COUNT(*) FROM (` + table.query + `)`
+		if err := db.QueryRow(query, userID).Scan(&count); err != nil {
+			return 0, fmt.Errorf("%s: %w", table.name, err)
+		}
+		total += count
+	}
+
+	return total, nil
+}
+
+// BuildUserExport writes a ZIP archive with one JSON file per table of the
+// user's data
+func BuildUserExport(db *sql.DB, userID int) ([]byte, error) {
+	var buf bytes.Buffer
+	archive := zip.NewWriter(&buf)
+	now := time.Now()
+
+	create := func(name string) (io.Writer, error) {
+		return archive.CreateHeader(&zip.FileHeader{Name: name, Method: zip.Deflate, Modified: now})
+	}
+
+	for _, table := range exportTables {
+		columns, rows, err := queryExportRows(db, table.query, userID)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", table.name, err)
+		}
+
+		var data interface{} = rows
+		if table.name == "account" && len(rows) == 1 {
+			data = rows[0]
+		}
+
+		f, err := create(table.name + ".json")
+		if err != nil {
+			return nil, err
+		}
+		encoder := json.NewEncoder(f)
+		encoder.SetIndent("", "  ")
+		if err := encoder.Encode(data); err != nil {
+			return nil, err
+		}
+
+		if exportCSVTables[table.name] {
+			f, err := create(table.name + ".csv")
+			if err != nil {
+				return nil, err
+			}
+			if err := writeExportCSV(f, columns, rows); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	if err := archive.Close(); err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
+// queryExportRows runs an export query and returns its rows as column maps
+func queryExportRows(db *sql.DB, query string, userID int) ([]string, []map[string]interface{}, error) {
+	rows, err := db.Query(query, userID)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer rows.Close()
+
+	columns, err := rows.Columns()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	result := []map[string]interface{}{}
+	for rows.Next() {
+		values := make([]interface{}, len(columns))
+		pointers := make([]interface{}, len(columns))
+		for i := range values {
+			pointers[i] = &values[i]
+		}
+		if err := rows.Scan(pointers...); err != nil {
+			return nil, nil, err
+		}
+
+		row := make(map[string]interface{}, len(columns))
+		for i, column := range columns {
+			// TEXT columns come back as []byte, which JSON would base64 encode
+			if b, ok := values[i].([]byte); ok {
+				values[i] = string(b)
+			}
+			row[column] = values[i]
+		}
+		result = append(result, row)
+	}
+
+	return columns, result, rows.Err()
+}
+
+func writeExportCSV(w io.Writer, columns []string, rows []map[string]interface{}) error {
+	out := csv.NewWriter(w)
+	if err := out.Write(columns); err != nil {
+		return err
+	}
+
+	for _, row := range rows {
+		record := make([]string, len(columns))
+		for i, column := range columns {
+			switch v := row[column].(type) {
+			case nil:
+				record[i] = ""
+			case time.Time:
+				record[i] = v.UTC().Format(time.RFC3339)
+			default:
+				record[i] = CSVCell(fmt.Sprint(v))
+			}
+		}
+		if err := out.Write(record); err != nil {
+			return err
+		}
+	}
+
+	out.Flush()
+	return out.Error()
+}
+
+// CreateDataExport queues a background export for the user. If one is
+// already queued or running it is returned instead.
+func CreateDataExport(db *sql.DB, userID int) (*DataExport, error) {
+	query := `SELECT id, user_id, status, COALESCE(size, 0), COALESCE(error, ''), created_at, completed_at, expires_at
+              FROM data_exports
+              WHERE user_id = ? AND status IN (?, ?)
+              ORDER BY id DESC LIMIT 1`
+	export, err := scanDataExport(db.QueryRow(query, userID, DataExportPending, DataExportRunning))
+	if err == nil {
+		return export, nil
+	}
+	if err != sql.ErrNoRows {
+		return nil, err
+	}
+
+	now := time.Now().UTC()
+	export = &DataExport{
+		UserID:    userID,
+		Status:    DataExportPending,
+		CreatedAt: now,
+		ExpiresAt: now.Add(DataExportTTL),
+	}
+
+	result, err := db.Exec(`INSERT INTO data_exports (user_id, status, created_at, expires_at) VALUES (?, ?, ?, ?)`,
+		userID, export.Status, now, export.ExpiresAt)
+	if err != nil {
+		return nil, err
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return nil, err
+	}
+	export.ID = int(id)
+
+	return export, nil
+}
+
+// GetDataExport returns one of the user's unexpired exports
+func GetDataExport(db *sql.DB, id, userID int) (*DataExport, error) {
+	query := `SELECT id, user_id, status, COALESCE(size, 0), COALESCE(error, ''), created_at, completed_at, expires_at
+              FROM data_exports
+              WHERE id = ? AND user_id = ? AND expires_at > ?`
+	return scanDataExport(db.QueryRow(query, id, userID, time.Now().UTC()))
+}
+
+// GetDataExportArchive returns the ZIP of a finished export
+func GetDataExportArchive(db *sql.DB, id, userID int) ([]byte, error) {
+	query := `SELECT archive FROM data_exports
+              WHERE id = ? AND user_id = ? AND status = ? AND expires_at > ?`
+
+	var archive []byte
+	err := db.QueryRow(query, id, userID, DataExportReady, time.Now().UTC()).Scan(&archive)
+	return archive, err
+}
+
+// RunDataExport builds a queued export. Only one caller wins the claim on
+// the job, so it is safe to call from several workers.
+func RunDataExport(db *sql.DB, id int) error {
+	result, err := db.Exec(`UPDATE data_exports SET status = ?, started_at = ? WHERE id = ? AND status = ?`,
+		DataExportRunning, time.Now().UTC(), id, DataExportPending)
+	if err != nil {
+		return err
+	}
+	if claimed, err := result.RowsAffected(); err != nil || claimed == 0 {
+		return err
+	}
+
+	var userID int
+	if err := db.QueryRow(`SELECT user_id FROM data_exports WHERE id = ?`, id).Scan(&userID); err != nil {
+		return err
+	}
+
+	archive, buildErr := BuildUserExport(db, userID)
+	now := time.Now().UTC()
+	if buildErr != nil {
+		_, err := db.Exec(`UPDATE data_exports SET status = ?, error = ?, completed_at = ? WHERE id = ?`,
+			DataExportFailed, "The export could not be generated, please try again", now, id)
+		if err != nil {
+			return err
+		}
+		return buildErr
+	}
+
+	query := `UPDATE data_exports SET status = ?, archive = ?, size = ?, completed_at = ?, expires_at = ? WHERE id = ?`
+	_, err = db.Exec(query, DataExportReady, archive, len(archive), now, now.Add(DataExportTTL), id)
+	return err
+}
+
+// ProcessDataExports runs every queued export, retries exports left running
+// by a previous process, and deletes expired ones
+func ProcessDataExports(db *sql.DB) error {
+	now := time.Now().UTC()
+
+	if _, err := db.Exec(`DELETE FROM data_exports WHERE expires_at <= ?`, now); err != nil {
+		return err
+	}
+
+	_, err := db.Exec(`UPDATE data_exports SET status = ? WHERE status = ? AND started_at <= ?`,
+		DataExportPending, DataExportRunning, now.Add(-dataExportStaleAfter))
+	if err != nil {
+		return err
+	}
+
+	ids, err := queryInts(db, `SELECT id FROM data_exports WHERE status = ? ORDER BY id`, DataExportPending)
+	if err != nil {
+		return err
+	}
+
+	for _, id := range ids {
+		if err := RunDataExport(db, id); err != nil {
+			log.Printf("Data export %d failed: %v", id, err)
+		}
+	}
+
+	return nil
+}
+
+// StartDataExportWorker processes queued exports in the background every
+// interval. Newly queued exports can also be run straight away with
+// RunDataExport.
+func StartDataExportWorker(db *sql.DB, interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for range ticker.C {
+			if err := ProcessDataExports(db); err != nil {
+				log.Printf("Data export worker failed: %v", err)
+			}
+		}
+	}()
+}
+
+func scanDataExport(row rowScanner) (*DataExport, error) {
+	var export DataExport
+	var completedAt sql.NullTime
+
+	err := row.Scan(&export.ID, &export.UserID, &export.Status, &export.Size, &export.Error,
+		&export.CreatedAt, &completedAt, &export.ExpiresAt)
+	if err != nil {
+		return nil, err
+	}
+
+	if completedAt.Valid {
+		export.CompletedAt = &completedAt.Time
+	}
+
+	return &export, nil
+}
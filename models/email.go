@@ -0,0 +1,178 @@
+package models
+
+import (
+	"database/sql"
+	"errors"
+	"strings"
+	"time"
+)
+
+// EmailVerificationTTL is how long a verification link stays valid
+const EmailVerificationTTL = 24 * time.Hour
+
+// ErrEmailTaken is returned when another account already uses the address
+var ErrEmailTaken = errors.New("email address is already in use")
+
+// NormalizeEmail trims and lowercases an address so lookups are case-insensitive
+func NormalizeEmail(email string) string {
+	return strings.ToLower(strings.TrimSpace(email))
+}
+
+// GetUserIDByVerifiedEmail finds the user owning a verified email address.
+// Unverified addresses and deleted users return sql.ErrNoRows.
+func GetUserIDByVerifiedEmail(db *sql.DB, email string) (int, error) {
+	query := `SELECT id FROM users WHERE email = ? AND email_verified_at IS NOT NULL AND deleted_at IS NULL`
+
+	var userID int
+	err := db.QueryRow(query, NormalizeEmail(email)).Scan(&userID)
+	if err != nil {
+		return 0, err
+	}
+
+	return userID, nil
+}
+
+// SetUserEmail sets (or changes) a user's address and marks it unverified.
+// Outstanding verification tokens for the old address stop working.
+func SetUserEmail(db *sql.DB, userID int, email string) error {
+	email = NormalizeEmail(email)
+
+	taken, err := EmailInUse(db, email, userID)
+	if err != nil {
+		return err
+	}
+	if taken {
+		return ErrEmailTaken
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+
+	if err := releaseUnverifiedEmail(tx, email, userID); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	query := `UPDATE users SET email = ?, email_verified_at = NULL WHERE id = ?`
+	if _, err := tx.Exec(query, email, userID); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// releaseUnverifiedEmail takes the address away from any other account that
+// set it without verifying it, so an unconfirmed claim can't lock the real
+// owner out. Their verification links stop working with it.
+func releaseUnverifiedEmail(tx *sql.Tx, email string, exceptUserID int) error {
+	_, err := tx.Exec(`UPDATE users SET email = NULL WHERE email = ? AND id != ? AND email_verified_at IS NULL`,
+		NormalizeEmail(email), exceptUserID)
+	return err
+}
+
+// EmailInUse reports whether an account other than exceptUserID has verified
+// the address. Unverified addresses don't count; they are released when
+// someone else claims them.
+func EmailInUse(db *sql.DB, email string, exceptUserID int) (bool, error) {
+	var count int
+	query := `SELECT COUNT(*) FROM users WHERE email = ? AND id != ? AND email_verified_at IS NOT NULL`
+	err := db.QueryRow(query, NormalizeEmail(email), exceptUserID).Scan(&count)
+	if err != nil {
+		return false, err
+	}
+
+	return count > 0, nil
+}
+
+// CreateEmailVerificationToken issues a token confirming email for the user.
+// Any earlier unused tokens for the user are discarded.
+func CreateEmailVerificationToken(db *sql.DB, userID int, email string) (string, error) {
+	token, err := newSecretToken()
+	if err != nil {
+		return "", err
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return "", err
+	}
+
+	_, err = tx.Exec(`DELETE FROM email_verification_tokens WHERE user_id = ? AND used_at IS NULL`, userID)
+	if err != nil {
+		tx.Rollback()
+		return "", err
+	}
+
+	now := time.Now().UTC()
+	query := `INSERT INTO email_verification_tokens (user_id, email, token_hash, created_at, expires_at)
+              VALUES (?, ?, ?, ?, ?)`
+	_, err = tx.Exec(query, userID, NormalizeEmail(email), hashToken(token), now, now.Add(EmailVerificationTTL))
+	if err != nil {
+		tx.Rollback()
+		return "", err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return "", err
+	}
+
+	return token, nil
+}
+
+// VerifyEmailToken consumes a verification token and marks the address it was
+// issued for as verified. Unknown, used or expired tokens, and tokens for an
+// address the user has since changed away from, return sql.ErrNoRows.
+func VerifyEmailToken(db *sql.DB, token string) (int, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return 0, err
+	}
+
+	var id, userID int
+	var email string
+	var expiresAt time.Time
+	query := `SELECT id, user_id, email, expires_at FROM email_verification_tokens
+              WHERE token_hash = ? AND used_at IS NULL`
+	err = tx.QueryRow(query, hashToken(token)).Scan(&id, &userID, &email, &expiresAt)
+	if err != nil {
+		tx.Rollback()
+		return 0, err
+	}
+
+	if time.Now().After(expiresAt) {
+		tx.Rollback()
+		return 0, sql.ErrNoRows
+	}
+
+	now := time.Now().UTC()
+	result, err := tx.Exec(`UPDATE users SET email_verified_at = ? WHERE id = ? AND email = ?`, now, userID, email)
+	if err != nil {
+		tx.Rollback()
+		return 0, err
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		tx.Rollback()
+		return 0, err
+	}
+	if affected == 0 {
+		tx.Rollback()
+		return 0, sql.ErrNoRows
+	}
+
+	_, err = tx.Exec(`UPDATE email_verification_tokens SET used_at = ? WHERE id = ?`, now, id)
+	if err != nil {
+		tx.Rollback()
+		return 0, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, err
+	}
+
+	return userID, nil
+}
@@ -48,9 +48,9 @@ func GetForumPosts(db *sql.DB, sortBy string, page, limit int) ([]ForumPost, err
 	
 	query := `
 		SELECT fp.id, fp.user_id, fp.title, fp.content, fp.url, fp.score, fp.created_at,
-			u.id, u.username, u.fullname, u.is_admin, u.created_at
+			u.id, u.username, u.fullname, ` + isAdminColumn("u") + `, u.created_at
 		FROM forum_posts fp
-		JOIN users u ON fp.user_id = u.id
+		JOIN users u ON fp.user_id = u.id AND u.deleted_at IS NULL
 		ORDER BY ` + orderBy + `
 		LIMIT ? OFFSET ?
 	`
@@ -94,9 +94,9 @@ func GetForumPostByID(db *sql.DB, postID int, currentUserID int) (*ForumPost, er
 	// Get post with user info
 	postQuery := `
 		SELECT fp.id, fp.user_id, fp.title, fp.content, fp.url, fp.score, fp.created_at,
-			u.id, u.username, u.fullname, u.is_admin, u.created_at
+			u.id, u.username, u.fullname, ` + isAdminColumn("u") + `, u.created_at
 		FROM forum_posts fp
-		JOIN users u ON fp.user_id = u.id
+		JOIN users u ON fp.user_id = u.id AND u.deleted_at IS NULL
 		WHERE fp.id = ?
 	`
 	
@@ -141,9 +141,9 @@ func GetForumPostByID(db *sql.DB, postID int, currentUserID int) (*ForumPost, er
 	// Get comments with user info
 	commentsQuery := `
 		SELECT c.id, c.post_id, c.user_id, c.content, c.created_at,
-			u.id, u.username, u.fullname, u.is_admin, u.created_at
+			u.id, u.username, u.fullname, ` + isAdminColumn("u") + `, u.created_at
 		FROM forum_comments c
-		JOIN users u ON c.user_id = u.id
+		JOIN users u ON c.user_id = u.id AND u.deleted_at IS NULL
 		WHERE c.post_id = ?
 		ORDER BY c.created_at ASC
 	`
@@ -270,4 +270,72 @@ func VoteForumPost(db *sql.DB, postID, userID int) error {
 	
 	// Commit transaction
 	return tx.Commit()
-}
\ No newline at end of file
+}
+// GetForumCommentByID returns a single comment without its author
+func GetForumCommentByID(db *sql.DB, commentID int) (*ForumComment, error) {
+	query := `SELECT id, post_id, user_id, content, created_at FROM forum_comments WHERE id = ?`
+
+	var comment ForumComment
+	err := db.QueryRow(query, commentID).Scan(&comment.ID, &comment.PostID, &comment.UserID, &comment.Content, &comment.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+
+	return &comment, nil
+}
+
+// DeleteForumPost removes a post together with its comments and votes.
+// It returns sql.ErrNoRows if the post does not exist.
+func DeleteForumPost(db *sql.DB, postID int) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+
+	for _, query := range []string{
+		"DELETE FROM forum_comments WHERE post_id = ?",
+		"DELETE FROM forum_votes WHERE post_id = ?",
+	} {
+		if _, err := tx.Exec(query, postID); err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+
+	result, err := tx.Exec("DELETE FROM forum_posts WHERE id = ?", postID)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	if affected == 0 {
+		tx.Rollback()
+		return sql.ErrNoRows
+	}
+
+	return tx.Commit()
+}
+
+// DeleteForumComment removes a single comment. It returns sql.ErrNoRows if
+// the comment does not exist.
+func DeleteForumComment(db *sql.DB, commentID int) error {
+	result, err := db.Exec("DELETE FROM forum_comments WHERE id = ?", commentID)
+	if err != nil {
+		return err
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return sql.ErrNoRows
+	}
+
+	return nil
+}
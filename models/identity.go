@@ -0,0 +1,318 @@
+package models
+
+import (
+	"database/sql"
+	"errors"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// OAuthStateTTL is how long a user has to finish logging in at the provider
+const OAuthStateTTL = 10 * time.Minute
+
+// ErrIdentityLinked is returned when a provider account already belongs to
+// another user
+var ErrIdentityLinked = errors.New("identity is linked to another account")
+
+// UserIdentity is an external provider account linked to a user
+type UserIdentity struct {
+	ID          int        `json:"id"`
+	UserID      int        `json:"user_id"`
+	Provider    string     `json:"provider"`
+	Subject     string     `json:"-"`
+	Email       string     `json:"email"`
+	Username    string     `json:"username"`
+	CreatedAt   time.Time  `json:"created_at"`
+	LastLoginAt *time.Time `json:"last_login_at"`
+}
+
+// OAuthState is an authorization request waiting for the provider callback.
+// LinkUserID is set when an existing user is linking a new provider.
+type OAuthState struct {
+	Provider     string
+	Nonce        string
+	CodeVerifier string
+	RedirectURL  string
+	LinkUserID   int
+}
+
+// CreateOAuthState records a pending authorization request and returns the
+// state value to send to the provider
+func CreateOAuthState(db *sql.DB, s *OAuthState) (string, error) {
+	state, err := newSecretToken()
+	if err != nil {
+		return "", err
+	}
+
+	now := time.Now().UTC()
+	if _, err := db.Exec(`DELETE FROM oauth_states WHERE expires_at <= ?`, now); err != nil {
+		return "", err
+	}
+
+	var linkUserID sql.NullInt64
+	if s.LinkUserID != 0 {
+		linkUserID = sql.NullInt64{Int64: int64(s.LinkUserID), Valid: true}
+	}
+
+	query := `INSERT INTO oauth_states (state_hash, provider, nonce, code_verifier, redirect_url, link_user_id, created_at, expires_at)
+              VALUES (?, ?, ?, ?, ?, ?, ?, ?)`
+	_, err = db.Exec(query, hashToken(state), s.Provider, s.Nonce, s.CodeVerifier, s.RedirectURL, linkUserID, now, now.Add(OAuthStateTTL))
+	if err != nil {
+		return "", err
+	}
+
+	return state, nil
+}
+
+// ConsumeOAuthState removes and returns a pending authorization request so
+// each state can be used once. Unknown and expired states return sql.ErrNoRows.
+func ConsumeOAuthState(db *sql.DB, state string) (*OAuthState, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return nil, err
+	}
+
+	var s OAuthState
+	var id int
+	var redirectURL sql.NullString
+	var linkUserID sql.NullInt64
+	var expiresAt time.Time
+	query := `SELECT id, provider, nonce, code_verifier, redirect_url, link_user_id, expires_at
+              FROM oauth_states WHERE state_hash = ?`
+	err = tx.QueryRow(query, hashToken(state)).Scan(&id, &s.Provider, &s.Nonce, &s.CodeVerifier, &redirectURL, &linkUserID, &expiresAt)
+	if err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+
+	if _, err := tx.Exec(`DELETE FROM oauth_states WHERE id = ?`, id); err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	if time.Now().After(expiresAt) {
+		return nil, sql.ErrNoRows
+	}
+
+	s.RedirectURL = redirectURL.String
+	s.LinkUserID = int(linkUserID.Int64)
+	return &s, nil
+}
+
+const identityColumns = `id, user_id, provider, subject, email, username, created_at, last_login_at`
+
+// GetUserIdentity finds the link for a provider account
+func GetUserIdentity(db *sql.DB, provider, subject string) (*UserIdentity, error) {
+	query := `SELECT ` + identityColumns + ` FROM user_identities WHERE provider = ? AND subject = ?`
+	return scanUserIdentity(db.QueryRow(query, provider, subject))
+}
+
+// GetUserIdentities lists the provider accounts linked to a user
+func GetUserIdentities(db *sql.DB, userID int) ([]UserIdentity, error) {
+	query := `SELECT ` + identityColumns + ` FROM user_identities WHERE user_id = ? ORDER BY created_at`
+
+	rows, err := db.Query(query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	identities := []UserIdentity{}
+	for rows.Next() {
+		identity, err := scanUserIdentity(rows)
+		if err != nil {
+			return nil, err
+		}
+		identities = append(identities, *identity)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return identities, nil
+}
+
+// LinkUserIdentity links a provider account to a user. Linking an account
+// the user already has refreshes its details; an account linked to someone
+// else returns ErrIdentityLinked.
+func LinkUserIdentity(db *sql.DB, userID int, provider, subject, email, username string) error {
+	existing, err := GetUserIdentity(db, provider, subject)
+	if err == nil {
+		if existing.UserID != userID {
+			return ErrIdentityLinked
+		}
+		_, err = db.Exec(`UPDATE user_identities SET email = ?, username = ? WHERE id = ?`, email, username, existing.ID)
+		return err
+	}
+	if err != sql.ErrNoRows {
+		return err
+	}
+
+	query := `INSERT INTO user_identities (user_id, provider, subject, email, username, created_at) VALUES (?, ?, ?, ?, ?, ?)`
+	_, err = db.Exec(query, userID, provider, subject, email, username, time.Now().UTC())
+	return err
+}
+
+// TouchUserIdentity records a login through a linked provider account
+func TouchUserIdentity(db *sql.DB, id int) error {
+	_, err := db.Exec(`UPDATE user_identities SET last_login_at = ? WHERE id = ?`, time.Now().UTC(), id)
+	return err
+}
+
+// DeleteUserIdentity unlinks one of the user's provider accounts
+func DeleteUserIdentity(db *sql.DB, id, userID int) error {
+	result, err := db.Exec(`DELETE FROM user_identities WHERE id = ? AND user_id = ?`, id, userID)
+	if err != nil {
+		return err
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return sql.ErrNoRows
+	}
+
+	return nil
+}
+
+// NewOAuthUser describes an account being provisioned on first provider login
+type NewOAuthUser struct {
+	Username      string
+	Fullname      string
+	Email         string
+	EmailVerified bool
+	GithubURL     string
+	PhotoURL      string
+
+	Provider         string
+	Subject          string
+	ProviderUsername string
+}
+
+// CreateOAuthUser provisions a user together with their provider identity.
+// The account gets a random password; the user can set a real one through
+// the password reset flow.
+func CreateOAuthUser(db *sql.DB, u *NewOAuthUser) (int, error) {
+	secret, err := newSecretToken()
+	if err != nil {
+		return 0, err
+	}
+	hash, err := HashPassword(secret)
+	if err != nil {
+		return 0, err
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return 0, err
+	}
+
+	var email sql.NullString
+	var emailVerifiedAt sql.NullTime
+	now := time.Now().UTC()
+	if u.Email != "" {
+		email = sql.NullString{String: NormalizeEmail(u.Email), Valid: true}
+		if u.EmailVerified {
+			emailVerifiedAt = sql.NullTime{Time: now, Valid: true}
+		}
+	}
+
+	if email.Valid {
+		if err := releaseUnverifiedEmail(tx, email.String, 0); err != nil {
+			tx.Rollback()
+			return 0, err
+		}
+	}
+
+	query := `INSERT INTO users (username, password, fullname, bio, linked_in_url, github_url, photo_url, email, email_verified_at)
+              VALUES (?, ?, ?, '', '', ?, ?, ?, ?)`
+	result, err := tx.Exec(query, u.Username, hash, u.Fullname, u.GithubURL, u.PhotoURL, email, emailVerifiedAt)
+	if err != nil {
+		tx.Rollback()
+		return 0, err
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		tx.Rollback()
+		return 0, err
+	}
+
+	if err := assignDefaultRole(tx, id); err != nil {
+		tx.Rollback()
+		return 0, err
+	}
+
+	query = `INSERT INTO user_identities (user_id, provider, subject, email, username, created_at, last_login_at)
+             VALUES (?, ?, ?, ?, ?, ?, ?)`
+	_, err = tx.Exec(query, id, u.Provider, u.Subject, u.Email, u.ProviderUsername, now, now)
+	if err != nil {
+		tx.Rollback()
+		return 0, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, err
+	}
+
+	return int(id), nil
+}
+
+var usernameDisallowed = regexp.MustCompile(`[^a-z0-9_-]+`)
+
+// AvailableUsername turns a provider username into a free local one, adding
+// a number if the name is taken
+func AvailableUsername(db *sql.DB, base string) (string, error) {
+	base = strings.Trim(usernameDisallowed.ReplaceAllString(strings.ToLower(base), ""), "-_")
+	if len(base) < 2 {
+		base = "user"
+	}
+	// Leave room for a number within the username length limit
+	if len(base) > 35 {
+		base = base[:35]
+	}
+
+	for i := 1; ; i++ {
+		candidate := base
+		if i > 1 {
+			candidate = base + strconv.Itoa(i)
+		}
+
+		var count int
+		if err := db.QueryRow(`SELECT COUNT(*) FROM users WHERE username = ?`, candidate).Scan(&count); err != nil {
+			return "", err
+		}
+		if count == 0 {
+			return candidate, nil
+		}
+	}
+}
+
+func scanUserIdentity(row rowScanner) (*UserIdentity, error) {
+	var identity UserIdentity
+	var email, username sql.NullString
+	var lastLoginAt sql.NullTime
+
+	err := row.Scan(&identity.ID, &identity.UserID, &identity.Provider, &identity.Subject,
+		&email, &username, &identity.CreatedAt, &lastLoginAt)
+	if err != nil {
+		return nil, err
+	}
+
+	identity.Email = email.String
+	identity.Username = username.String
+	if lastLoginAt.Valid {
+		identity.LastLoginAt = &lastLoginAt.Time
+	}
+
+	return &identity, nil
+}
@@ -0,0 +1,117 @@
+package models
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+)
+
+const (
+	// LoginChallengeTTL is how long a user has to enter their second factor
+	LoginChallengeTTL = 5 * time.Minute
+
+	// A challenge accepts at most maxLoginChallengeAttempts codes
+	maxLoginChallengeAttempts = 5
+
+	// maxOpenLoginChallenges caps how many unexpired challenges a user can
+	// have, so knowing the password doesn't buy unlimited code guesses
+	maxOpenLoginChallenges = 3
+)
+
+// ErrTooManyLoginChallenges is returned when a user already has
+// maxOpenLoginChallenges open
+var ErrTooManyLoginChallenges = errors.New("too many open login challenges")
+
+// LoginChallenge is a login that passed the first factor and is waiting for a
+// two-factor code before a session is issued
+type LoginChallenge struct {
+	ID          int
+	UserID      int
+	RedirectURL string
+	Attempts    int
+	ExpiresAt   time.Time
+}
+
+// CreateLoginChallenge starts a second-factor step for the user. The returned
+// token identifies the challenge to the client and is stored only as a hash.
+// Returns ErrTooManyLoginChallenges if the user has too many open already.
+func CreateLoginChallenge(db *sql.DB, userID int, redirectURL string) (string, error) {
+	token, err := newSecretToken()
+	if err != nil {
+		return "", err
+	}
+
+	now := time.Now().UTC()
+
+	// Abandoned challenges are cleared out here rather than by a sweeper
+	_, err = db.Exec(`DELETE FROM login_challenges WHERE expires_at <= ?`, now)
+	if err != nil {
+		return "", err
+	}
+
+	// Exhausted challenges keep counting until they expire
+	var open int
+	err = db.QueryRow(`SELECT COUNT(*) FROM login_challenges WHERE user_id = ?`, userID).Scan(&open)
+	if err != nil {
+		return "", err
+	}
+	if open >= maxOpenLoginChallenges {
+		return "", ErrTooManyLoginChallenges
+	}
+
+	query := `INSERT INTO login_challenges (user_id, token_hash, redirect_url, created_at, expires_at)
+              VALUES (?, ?, ?, ?, ?)`
+	_, err = db.Exec(query, userID, hashToken(token), redirectURL, now, now.Add(LoginChallengeTTL))
+	if err != nil {
+		return "", err
+	}
+
+	return token, nil
+}
+
+// GetLoginChallenge looks up a pending challenge. Unknown, expired and
+// exhausted challenges return sql.ErrNoRows.
+func GetLoginChallenge(db *sql.DB, token string) (*LoginChallenge, error) {
+	query := `SELECT id, user_id, redirect_url, attempts, expires_at FROM login_challenges WHERE token_hash = ?`
+
+	var ch LoginChallenge
+	var redirectURL sql.NullString
+	err := db.QueryRow(query, hashToken(token)).Scan(&ch.ID, &ch.UserID, &redirectURL, &ch.Attempts, &ch.ExpiresAt)
+	if err != nil {
+		return nil, err
+	}
+	ch.RedirectURL = redirectURL.String
+
+	if time.Now().After(ch.ExpiresAt) || ch.Attempts >= maxLoginChallengeAttempts {
+		return nil, sql.ErrNoRows
+	}
+
+	return &ch, nil
+}
+
+// ClaimLoginChallengeAttempt uses up one of the challenge's attempts before a
+// code is checked, so parallel requests cannot get more than
+// maxLoginChallengeAttempts guesses. Returns sql.ErrNoRows once they are gone.
+func ClaimLoginChallengeAttempt(db *sql.DB, id int) error {
+	query := `UPDATE login_challenges SET attempts = attempts + 1 WHERE id = ? AND attempts < ?`
+	result, err := db.Exec(query, id, maxLoginChallengeAttempts)
+	if err != nil {
+		return err
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return sql.ErrNoRows
+	}
+
+	return nil
+}
+
+// DeleteLoginChallenge removes a challenge once it has been completed
+func DeleteLoginChallenge(db *sql.DB, id int) error {
+	_, err := db.Exec(`DELETE FROM login_challenges WHERE id = ?`, id)
+	return err
+}
@@ -0,0 +1,183 @@
+package models
+
+import (
+	"database/sql"
+	"strings"
+	"time"
+)
+
+// loginFailureWindow is how long failures are remembered. A key with no
+// failures for this long starts counting from zero again.
+const loginFailureWindow = 24 * time.Hour
+
+// ThrottlePolicy describes how failed logins for one kind of key are slowed
+// down. After FreeAttempts failures each further failure blocks the key for
+// BaseDelay, doubling every time up to MaxDelay. LockoutAfter failures lock
+// the key for LockoutDuration.
+type ThrottlePolicy struct {
+	FreeAttempts    int
+	BaseDelay       time.Duration
+	MaxDelay        time.Duration
+	LockoutAfter    int
+	LockoutDuration time.Duration
+}
+
+var (
+	// UsernameThrottle protects a single account from password guessing
+	UsernameThrottle = ThrottlePolicy{
+		FreeAttempts:    3,
+		BaseDelay:       time.Second,
+		MaxDelay:        5 * time.Minute,
+		LockoutAfter:    10,
+		LockoutDuration: 30 * time.Minute,
+	}
+
+	// IPThrottle slows down one address guessing across many accounts. It is
+	// more generous since many users can share an address.
+	IPThrottle = ThrottlePolicy{
+		FreeAttempts:    20,
+		BaseDelay:       time.Second,
+		MaxDelay:        15 * time.Minute,
+		LockoutAfter:    100,
+		LockoutDuration: time.Hour,
+	}
+)
+
+// LoginThrottle is the failure state of a username or IP address
+type LoginThrottle struct {
+	Key           string     `json:"key"`
+	Failures      int        `json:"failures"`
+	LastFailureAt time.Time  `json:"last_failure_at"`
+	BlockedUntil  *time.Time `json:"blocked_until"`
+	Locked        bool       `json:"locked"`
+}
+
+// UsernameThrottleKey is the throttle key for login attempts on a username
+func UsernameThrottleKey(username string) string {
+	return "user:" + strings.ToLower(strings.TrimSpace(username))
+}
+
+// IPThrottleKey is the throttle key for login attempts from an address
+func IPThrottleKey(ip string) string {
+	return "ip:" + ip
+}
+
+// LoginBlockedFor returns how long the key must wait before trying again, or
+// zero if it may try now
+func LoginBlockedFor(db *sql.DB, key string) (time.Duration, error) {
+	var blockedUntil sql.NullTime
+	err := db.QueryRow(`SELECT blocked_until FROM login_throttles WHERE key = ?`, key).Scan(&blockedUntil)
+	if err == sql.ErrNoRows {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	if !blockedUntil.Valid {
+		return 0, nil
+	}
+	if wait := time.Until(blockedUntil.Time); wait > 0 {
+		return wait, nil
+	}
+	return 0, nil
+}
+
+// RecordLoginFailure counts a failed attempt for key and applies the policy's
+// backoff or lockout
+func RecordLoginFailure(db *sql.DB, key string, policy ThrottlePolicy) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+
+	now := time.Now().UTC()
+
+	var failures int
+	var lastFailureAt time.Time
+	err = tx.QueryRow(`SELECT failures, last_failure_at FROM login_throttles WHERE key = ?`, key).Scan(&failures, &lastFailureAt)
+	if err != nil && err != sql.ErrNoRows {
+		tx.Rollback()
+		return err
+	}
+	if err == sql.ErrNoRows || now.Sub(lastFailureAt) > loginFailureWindow {
+		failures = 0
+	}
+	failures++
+
+	var blockedUntil sql.NullTime
+	locked := false
+	switch {
+	case failures >= policy.LockoutAfter:
+		blockedUntil = sql.NullTime{Time: now.Add(policy.LockoutDuration), Valid: true}
+		locked = true
+	case failures > policy.FreeAttempts:
+		delay := policy.MaxDelay
+		if shift := failures - policy.FreeAttempts - 1; shift < 32 {
+			if d := policy.BaseDelay << shift; d < delay {
+				delay = d
+			}
+		}
+		blockedUntil = sql.NullTime{Time: now.Add(delay), Valid: true}
+	}
+
+	query := `INSERT INTO login_throttles (key, failures, last_failure_at, blocked_until, locked)
+              VALUES (?, ?, ?, ?, ?)
+              ON CONFLICT(key) DO UPDATE SET failures = excluded.failures, last_failure_at = excluded.last_failure_at,
+                  blocked_until = excluded.blocked_until, locked = excluded.locked`
+	if _, err := tx.Exec(query, key, failures, now, blockedUntil, locked); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// ClearLoginThrottle forgets the failures for a key, after a successful login
+// or when an administrator unlocks it. It reports whether anything was cleared.
+func ClearLoginThrottle(db *sql.DB, key string) (bool, error) {
+	result, err := db.Exec(`DELETE FROM login_throttles WHERE key = ?`, key)
+	if err != nil {
+		return false, err
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+
+	return affected > 0, nil
+}
+
+// GetBlockedLoginThrottles lists keys that are currently backed off or locked
+func GetBlockedLoginThrottles(db *sql.DB) ([]LoginThrottle, error) {
+	query := `SELECT key, failures, last_failure_at, blocked_until, locked
+              FROM login_throttles
+              WHERE blocked_until > ?
+              ORDER BY blocked_until DESC`
+
+	rows, err := db.Query(query, time.Now().UTC())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	throttles := []LoginThrottle{}
+	for rows.Next() {
+		var t LoginThrottle
+		var blockedUntil sql.NullTime
+		if err := rows.Scan(&t.Key, &t.Failures, &t.LastFailureAt, &blockedUntil, &t.Locked); err != nil {
+			return nil, err
+		}
+		if blockedUntil.Valid {
+			t.BlockedUntil = &blockedUntil.Time
+		}
+		throttles = append(throttles, t)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return throttles, nil
+}
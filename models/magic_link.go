@@ -6,55 +6,90 @@ import (
 	"time"
 )
 
+// DefaultMagicLinkTTL is used when a link is created without a custom lifetime
+const DefaultMagicLinkTTL = 7 * 24 * time.Hour
+
 type MagicLink struct {
+	ID          int                   `json:"id"`
+	UserID      int                   `json:"user_id"`
+	Token       string                `json:"token"`
+	CreatedAt   time.Time             `json:"created_at"`
+	ExpiresAt   time.Time             `json:"expires_at"`
+	RedirectURL string                `json:"redirect_url"`
+	MaxUses     *int                  `json:"max_uses"` // nil means unlimited
+	UseCount    int                   `json:"use_count"`
+	RevokedAt   *time.Time            `json:"revoked_at"`
+	Redemptions []MagicLinkRedemption `json:"redemptions,omitempty"`
+}
+
+// MagicLinkRedemption records a single login through a magic link
+type MagicLinkRedemption struct {
 	ID          int       `json:"id"`
-	UserID      int       `json:"user_id"`
-	Token       string    `json:"token"`
-	CreatedAt   time.Time `json:"created_at"`
-	ExpiresAt   time.Time `json:"expires_at"`
-	RedirectURL string    `json:"redirect_url"`
+	MagicLinkID int       `json:"magic_link_id"`
+	RedeemedAt  time.Time `json:"redeemed_at"`
+	IPAddress   string    `json:"ip_address"`
+	UserAgent   string    `json:"user_agent"`
+}
+
+// usable reports whether the link can still be redeemed
+func (l *MagicLink) usable() bool {
+	if l.RevokedAt != nil || time.Now().After(l.ExpiresAt) {
+		return false
+	}
+	return l.MaxUses == nil || l.UseCount < *l.MaxUses
 }
 
-// CreateMagicLink creates a new magic link for the given user
-func CreateMagicLink(db *sql.DB, userID int, redirectURL string) (*MagicLink, error) {
+// CreateMagicLink creates a new magic link for the given user. A ttl of zero
+// uses DefaultMagicLinkTTL and a maxUses of zero allows unlimited logins.
+func CreateMagicLink(db *sql.DB, userID int, redirectURL string, ttl time.Duration, maxUses int) (*MagicLink, error) {
 	token := uuid.New().String()
-	
-	// Add 7 days to current time for expiration
-	expiresAt := time.Now().AddDate(0, 0, 7)
-	
+
+	if ttl <= 0 {
+		ttl = DefaultMagicLinkTTL
+	}
+	createdAt := time.Now().UTC()
+	expiresAt := createdAt.Add(ttl)
+
 	// If redirectURL is empty, use the default '/'
 	if redirectURL == "" {
 		redirectURL = "/"
 	}
-	
-	query := `INSERT INTO magic_links (user_id, token, expires_at, redirect_url) VALUES (?, ?, ?, ?)`
-	result, err := db.Exec(query, userID, token, expiresAt, redirectURL)
+
+	var limit *int
+	if maxUses > 0 {
+		limit = &maxUses
+	}
+
+	query := `INSERT INTO magic_links (user_id, token, created_at, expires_at, redirect_url, max_uses, use_count) VALUES (?, ?, ?, ?, ?, ?, 0)`
+	result, err := db.Exec(query, userID, token, createdAt, expiresAt, redirectURL, limit)
 	if err != nil {
 		return nil, err
 	}
-	
+
 	id, err := result.LastInsertId()
 	if err != nil {
 		return nil, err
 	}
-	
+
 	return &MagicLink{
 		ID:          int(id),
 		UserID:      userID,
 		Token:       token,
-		CreatedAt:   time.Now(),
+		CreatedAt:   createdAt,
 		ExpiresAt:   expiresAt,
 		RedirectURL: redirectURL,
+		MaxUses:     limit,
 	}, nil
 }
 
-// GetUserMagicLinks retrieves all magic links for a given user
+// GetUserMagicLinks retrieves all magic links for a given user, including
+// the redemption history of each link
 func GetUserMagicLinks(db *sql.DB, userID int) ([]MagicLink, error) {
-	query := `SELECT id, user_id, token, created_at, expires_at, redirect_url
-	          FROM magic_links 
-	          WHERE user_id = ? 
+	query := `SELECT id, user_id, token, created_at, expires_at, redirect_url, max_uses, use_count, revoked_at
+	          FROM magic_links
+	          WHERE user_id = ?
 	          ORDER BY created_at DESC`
-	
+
 	rows, err := db.Query(query, userID)
 	if err != nil {
 		return []MagicLink{}, err
@@ -63,23 +98,17 @@ func GetUserMagicLinks(db *sql.DB, userID int) ([]MagicLink, error) {
 
 	// Initialize with empty slice instead of nil
 	links := []MagicLink{}
-	
+	index := map[int]int{}
+
 	for rows.Next() {
-		var link MagicLink
-		var redirectURL sql.NullString
-		
-		err := rows.Scan(&link.ID, &link.UserID, &link.Token, &link.CreatedAt, &link.ExpiresAt, &redirectURL)
+		link, err := scanMagicLink(rows)
 		if err != nil {
 			return []MagicLink{}, err
 		}
-		
-		if redirectURL.Valid {
-			link.RedirectURL = redirectURL.String
-		} else {
-			link.RedirectURL = "/"
-		}
-		
-		links = append(links, link)
+
+		link.Redemptions = []MagicLinkRedemption{}
+		index[link.ID] = len(links)
+		links = append(links, *link)
 	}
 
 	// Check for rows.Err() to make sure there wasn't an error during iteration
@@ -87,43 +116,159 @@ func GetUserMagicLinks(db *sql.DB, userID int) ([]MagicLink, error) {
 		return []MagicLink{}, err
 	}
 
+	redemptionQuery := `SELECT r.id, r.magic_link_id, r.redeemed_at, r.ip_address, r.user_agent
+	                    FROM magic_link_redemptions r
+	                    JOIN magic_links ml ON r.magic_link_id = ml.id
+	                    WHERE ml.user_id = ?
+	                    ORDER BY r.redeemed_at DESC`
+
+	redemptionRows, err := db.Query(redemptionQuery, userID)
+	if err != nil {
+		return []MagicLink{}, err
+	}
+	defer redemptionRows.Close()
+
+	for redemptionRows.Next() {
+		var r MagicLinkRedemption
+		var ipAddress, userAgent sql.NullString
+
+		err := redemptionRows.Scan(&r.ID, &r.MagicLinkID, &r.RedeemedAt, &ipAddress, &userAgent)
+		if err != nil {
+			return []MagicLink{}, err
+		}
+
+		r.IPAddress = ipAddress.String
+		r.UserAgent = userAgent.String
+
+		if i, ok := index[r.MagicLinkID]; ok {
+			links[i].Redemptions = append(links[i].Redemptions, r)
+		}
+	}
+
+	if err = redemptionRows.Err(); err != nil {
+		return []MagicLink{}, err
+	}
+
 	return links, nil
 }
 
-// GetMagicLinkByToken retrieves a magic link by its token
+// GetMagicLinkByToken retrieves a magic link by its token. Expired, revoked
+// and used-up links return sql.ErrNoRows.
 func GetMagicLinkByToken(db *sql.DB, token string) (*MagicLink, error) {
-	query := `SELECT id, user_id, token, created_at, expires_at, redirect_url
-	          FROM magic_links 
+	query := `SELECT id, user_id, token, created_at, expires_at, redirect_url, max_uses, use_count, revoked_at
+	          FROM magic_links
 	          WHERE token = ?`
-	
+
+	link, err := scanMagicLink(db.QueryRow(query, token))
+	if err != nil {
+		return nil, err
+	}
+
+	if !link.usable() {
+		return nil, sql.ErrNoRows
+	}
+
+	return link, nil
+}
+
+// RedeemMagicLink consumes one use of a magic link and records who redeemed
+// it. Expired, revoked and used-up links return sql.ErrNoRows.
+func RedeemMagicLink(db *sql.DB, token, ipAddress, userAgent string) (*MagicLink, error) {
+	link, err := GetMagicLinkByToken(db, token)
+	if err != nil {
+		return nil, err
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return nil, err
+	}
+
+	// The use limit is re-checked in the UPDATE so concurrent redemptions
+	// cannot exceed it
+	result, err := tx.Exec(`UPDATE magic_links SET use_count = use_count + 1
+	                        WHERE id = ? AND revoked_at IS NULL AND (max_uses IS NULL OR use_count < max_uses)`, link.ID)
+	if err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+	if affected == 0 {
+		tx.Rollback()
+		return nil, sql.ErrNoRows
+	}
+
+	_, err = tx.Exec(`INSERT INTO magic_link_redemptions (magic_link_id, redeemed_at, ip_address, user_agent) VALUES (?, ?, ?, ?)`,
+		link.ID, time.Now().UTC(), ipAddress, userAgent)
+	if err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	link.UseCount++
+	return link, nil
+}
+
+// RevokeUserMagicLinks invalidates every outstanding magic link for a user.
+// Called when the user's password changes or their sessions are revoked.
+func RevokeUserMagicLinks(db *sql.DB, userID int) error {
+	query := `UPDATE magic_links SET revoked_at = ? WHERE user_id = ? AND revoked_at IS NULL`
+	_, err := db.Exec(query, time.Now().UTC(), userID)
+	return err
+}
+
+// DeleteMagicLink deletes a magic link by its ID
+func DeleteMagicLink(db *sql.DB, id int, userID int) error {
+	query := `DELETE FROM magic_links WHERE id = ? AND user_id = ?`
+	result, err := db.Exec(query, id, userID)
+	if err != nil {
+		return err
+	}
+
+	// Foreign keys are not enforced, so clean up the redemption history here
+	if affected, err := result.RowsAffected(); err == nil && affected > 0 {
+		_, err = db.Exec(`DELETE FROM magic_link_redemptions WHERE magic_link_id = ?`, id)
+		return err
+	}
+
+	return nil
+}
+
+func scanMagicLink(row rowScanner) (*MagicLink, error) {
 	var link MagicLink
 	var redirectURL sql.NullString
-	
-	err := db.QueryRow(query, token).Scan(
-		&link.ID, &link.UserID, &link.Token, &link.CreatedAt, &link.ExpiresAt, &redirectURL,
-	)
+	var maxUses, useCount sql.NullInt64
+	var revokedAt sql.NullTime
+
+	err := row.Scan(&link.ID, &link.UserID, &link.Token, &link.CreatedAt, &link.ExpiresAt, &redirectURL,
+		&maxUses, &useCount, &revokedAt)
 	if err != nil {
 		return nil, err
 	}
-	
+
 	// Set the RedirectURL with a default if it's null
 	if redirectURL.Valid {
 		link.RedirectURL = redirectURL.String
 	} else {
 		link.RedirectURL = "/"
 	}
-	
-	// Check if link is expired
-	if time.Now().After(link.ExpiresAt) {
-		return nil, sql.ErrNoRows
+	if maxUses.Valid {
+		n := int(maxUses.Int64)
+		link.MaxUses = &n
+	}
+	link.UseCount = int(useCount.Int64)
+	if revokedAt.Valid {
+		link.RevokedAt = &revokedAt.Time
 	}
-	
+
 	return &link, nil
 }
-
-// DeleteMagicLink deletes a magic link by its ID
-func DeleteMagicLink(db *sql.DB, id int, userID int) error {
-	query := `DELETE FROM magic_links WHERE id = ? AND user_id = ?`
-	_, err := db.Exec(query, id, userID)
-	return err
-}
\ No newline at end of file
@@ -0,0 +1,293 @@
+package models
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+// MaxMessageLength is the longest direct message body accepted
+const MaxMessageLength = 5000
+
+// Message is one direct message in a conversation
+type Message struct {
+	ID             int       `json:"id"`
+	ConversationID int       `json:"conversation_id"`
+	SenderID       int       `json:"sender_id"`
+	Body           string    `json:"body"`
+	CreatedAt      time.Time `json:"created_at"`
+}
+
+// ConversationUser is the other participant of a conversation
+type ConversationUser struct {
+	ID       int    `json:"id"`
+	Username string `json:"username"`
+	Fullname string `json:"fullname"`
+	PhotoURL string `json:"photo_url"`
+}
+
+// Conversation is a one-to-one thread as seen by one of its participants
+type Conversation struct {
+	ID            int              `json:"id"`
+	With          ConversationUser `json:"with"`
+	LastMessage   *Message         `json:"last_message"`
+	LastMessageAt time.Time        `json:"last_message_at"`
+	Unread        int              `json:"unread"`
+	// Blocked is set when the viewer has blocked the other participant
+	Blocked bool `json:"blocked"`
+}
+
+// UnreadMessages summarizes what a user hasn't read yet
+type UnreadMessages struct {
+	Messages      int `json:"messages"`
+	Conversations int `json:"conversations"`
+}
+
+// pairKey identifies the conversation between two users regardless of who
+// started it
+func pairKey(a, b int) string {
+	if a > b {
+		a, b = b, a
+	}
+	return fmt.Sprintf("%d:%d", a, b)
+}
+
+// GetOrCreateConversation returns the ID of the conversation between two
+// users, starting one if they haven't talked before
+func GetOrCreateConversation(db *sql.DB, userID, otherID int) (int, error) {
+	key := pairKey(userID, otherID)
+
+	tx, err := db.Begin()
+	if err != nil {
+		return 0, err
+	}
+
+	var id int64
+	err = tx.QueryRow(`SELECT id FROM conversations WHERE pair_key = ?`, key).Scan(&id)
+	if err == nil {
+		return int(id), tx.Commit()
+	}
+	if err != sql.ErrNoRows {
+		tx.Rollback()
+		return 0, err
+	}
+
+	now := time.Now().UTC()
+	result, err := tx.Exec(`INSERT INTO conversations (pair_key, created_at, last_message_at) VALUES (?, ?, ?)`, key, now, now)
+	if err != nil {
+		tx.Rollback()
+		return 0, err
+	}
+
+	id, err = result.LastInsertId()
+	if err != nil {
+		tx.Rollback()
+		return 0, err
+	}
+
+	for _, participant := range []int{userID, otherID} {
+		_, err := tx.Exec(`INSERT INTO conversation_participants (conversation_id, user_id) VALUES (?, ?)`, id, participant)
+		if err != nil {
+			tx.Rollback()
+			return 0, err
+		}
+	}
+
+	return int(id), tx.Commit()
+}
+
+const conversationSelect = `
+	SELECT c.id, c.last_message_at, o.id, o.username, o.fullname, o.photo_url,
+	       (SELECT COUNT(*) FROM messages m
+	        WHERE m.conversation_id = c.id AND m.sender_id != me.user_id AND m.id > me.last_read_message_id),
+	       EXISTS (SELECT 1 FROM user_blocks WHERE blocker_id = me.user_id AND blocked_id = o.id),
+	       lm.id, lm.sender_id, lm.body, lm.created_at
+	FROM conversation_participants me
+	JOIN conversations c ON c.id = me.conversation_id
+	JOIN conversation_participants op ON op.conversation_id = c.id AND op.user_id != me.user_id
+	JOIN users o ON o.id = op.user_id
+	LEFT JOIN messages lm ON lm.id = (SELECT MAX(id) FROM messages WHERE conversation_id = c.id)
+	WHERE me.user_id = ? AND o.deleted_at IS NULL`
+
+func scanConversation(row rowScanner) (*Conversation, error) {
+	var c Conversation
+	var fullname, photo sql.NullString
+	var lastID, lastSender sql.NullInt64
+	var lastBody sql.NullString
+	var lastCreatedAt sql.NullTime
+
+	err := row.Scan(&c.ID, &c.LastMessageAt, &c.With.ID, &c.With.Username, &fullname, &photo,
+		&c.Unread, &c.Blocked, &lastID, &lastSender, &lastBody, &lastCreatedAt)
+	if err != nil {
+		return nil, err
+	}
+
+	c.With.Fullname = fullname.String
+	c.With.PhotoURL = photo.String
+	if lastID.Valid {
+		c.LastMessage = &Message{
+			ID:             int(lastID.Int64),
+			ConversationID: c.ID,
+			SenderID:       int(lastSender.Int64),
+			Body:           lastBody.String,
+			CreatedAt:      lastCreatedAt.Time,
+		}
+	}
+
+	return &c, nil
+}
+
+// GetConversation returns a conversation as seen by userID, or sql.ErrNoRows
+// if they aren't part of it
+func GetConversation(db *sql.DB, id, userID int) (*Conversation, error) {
+	return scanConversation(db.QueryRow(conversationSelect+` AND c.id = ?`, userID, id))
+}
+
+// GetConversations returns one page of a user's conversations, most recently
+// active first
+func GetConversations(db *sql.DB, userID, page, pageSize int) ([]Conversation, error) {
+	rows, err := db.Query(conversationSelect+`
+	                      ORDER BY c.last_message_at DESC, c.id DESC
+	                      LIMIT ? OFFSET ?`, userID, pageSize, (page-1)*pageSize)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	conversations := []Conversation{}
+	for rows.Next() {
+		c, err := scanConversation(rows)
+		if err != nil {
+			return nil, err
+		}
+		conversations = append(conversations, *c)
+	}
+
+	return conversations, rows.Err()
+}
+
+// CountConversations counts the conversations GetConversations pages through
+func CountConversations(db *sql.DB, userID int) (int, error) {
+	var count int
+	err := db.QueryRow(`SELECT COUNT(*) FROM conversation_participants me
+                        JOIN conversation_participants op ON op.conversation_id = me.conversation_id AND op.user_id != me.user_id
+                        JOIN users o ON o.id = op.user_id
+                        WHERE me.user_id = ? AND o.deleted_at IS NULL`, userID).Scan(&count)
+	return count, err
+}
+
+// CreateMessage adds a message to a conversation. The sender has read
+// everything up to their own message.
+func CreateMessage(db *sql.DB, conversationID, senderID int, body string) (*Message, error) {
+	message := &Message{ConversationID: conversationID, SenderID: senderID, Body: body, CreatedAt: time.Now().UTC()}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return nil, err
+	}
+
+	result, err := tx.Exec(`INSERT INTO messages (conversation_id, sender_id, body, created_at) VALUES (?, ?, ?, ?)`,
+		conversationID, senderID, body, message.CreatedAt)
+	if err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+	message.ID = int(id)
+
+	if _, err := tx.Exec(`UPDATE conversations SET last_message_at = ? WHERE id = ?`, message.CreatedAt, conversationID); err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+
+	_, err = tx.Exec(`UPDATE conversation_participants SET last_read_message_id = ? WHERE conversation_id = ? AND user_id = ?`,
+		message.ID, conversationID, senderID)
+	if err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+
+	return message, tx.Commit()
+}
+
+// GetMessages returns up to limit messages of a conversation, oldest first.
+// With beforeID set only messages older than it are returned, for paging
+// back through history.
+func GetMessages(db *sql.DB, conversationID, beforeID, limit int) ([]Message, error) {
+	query := `SELECT id, conversation_id, sender_id, body, created_at FROM messages WHERE conversation_id = ?`
+	args := []interface{}{conversationID}
+	if beforeID > 0 {
+		query += ` AND id < ?`
+		args = append(args, beforeID)
+	}
+	query += ` ORDER BY id DESC LIMIT ?`
+	args = append(args, limit)
+
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	messages := []Message{}
+	for rows.Next() {
+		var m Message
+		if err := rows.Scan(&m.ID, &m.ConversationID, &m.SenderID, &m.Body, &m.CreatedAt); err != nil {
+			return nil, err
+		}
+		messages = append(messages, m)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	// Newest were fetched first; return them in reading order
+	for i, j := 0, len(messages)-1; i < j; i, j = i+1, j-1 {
+		messages[i], messages[j] = messages[j], messages[i]
+	}
+
+	return messages, nil
+}
+
+// MarkConversationRead moves a participant's read position forward to
+// upToID, or to the latest message if upToID is 0. It never moves backwards.
+// Returns the new read position.
+func MarkConversationRead(db *sql.DB, conversationID, userID, upToID int) (int, error) {
+	var latest int
+	err := db.QueryRow(`SELECT COALESCE(MAX(id), 0) FROM messages WHERE conversation_id = ?`, conversationID).Scan(&latest)
+	if err != nil {
+		return 0, err
+	}
+	if upToID <= 0 || upToID > latest {
+		upToID = latest
+	}
+
+	_, err = db.Exec(`UPDATE conversation_participants SET last_read_message_id = MAX(last_read_message_id, ?)
+                      WHERE conversation_id = ? AND user_id = ?`, upToID, conversationID, userID)
+	if err != nil {
+		return 0, err
+	}
+
+	var lastRead int
+	err = db.QueryRow(`SELECT last_read_message_id FROM conversation_participants WHERE conversation_id = ? AND user_id = ?`,
+		conversationID, userID).Scan(&lastRead)
+	return lastRead, err
+}
+
+// CountUnreadMessages counts the messages a user hasn't read, and in how many
+// conversations
+func CountUnreadMessages(db *sql.DB, userID int) (UnreadMessages, error) {
+	var unread UnreadMessages
+	err := db.QueryRow(`SELECT COUNT(*), COUNT(DISTINCT m.conversation_id)
+                        FROM conversation_participants me
+                        JOIN messages m ON m.conversation_id = me.conversation_id
+                        JOIN users s ON s.id = m.sender_id
+                        WHERE me.user_id = ? AND m.sender_id != me.user_id AND m.id > me.last_read_message_id
+                          AND s.deleted_at IS NULL`, userID).Scan(&unread.Messages, &unread.Conversations)
+	return unread, err
+}
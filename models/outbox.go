@@ -0,0 +1,112 @@
+package models
+
+import (
+	"database/sql"
+	"time"
+)
+
+// Outbox statuses
+const (
+	OutboxPending = "pending"
+	OutboxSent    = "sent"
+	OutboxFailed  = "failed"
+)
+
+type OutboxEmail struct {
+	ID            int        `json:"id"`
+	ToAddress     string     `json:"to_address"`
+	Subject       string     `json:"subject"`
+	TextBody      string     `json:"text_body"`
+	HTMLBody      string     `json:"html_body"`
+	Status        string     `json:"status"`
+	Attempts      int        `json:"attempts"`
+	LastError     string     `json:"last_error"`
+	NextAttemptAt time.Time  `json:"next_attempt_at"`
+	CreatedAt     time.Time  `json:"created_at"`
+	SentAt        *time.Time `json:"sent_at"`
+}
+
+// QueueEmail adds a rendered email to the outbox for immediate delivery
+func QueueEmail(db *sql.DB, to, subject, textBody, htmlBody string) (int, error) {
+	now := time.Now().UTC()
+
+	query := `INSERT INTO email_outbox (to_address, subject, text_body, html_body, status, next_attempt_at, created_at)
+              VALUES (?, ?, ?, ?, ?, ?, ?)`
+
+	result, err := db.Exec(query, to, subject, textBody, htmlBody, OutboxPending, now, now)
+	if err != nil {
+		return 0, err
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return 0, err
+	}
+
+	return int(id), nil
+}
+
+// GetDueOutboxEmails returns pending emails whose next attempt is due, oldest first
+func GetDueOutboxEmails(db *sql.DB, limit int) ([]OutboxEmail, error) {
+	query := `SELECT id, to_address, subject, text_body, html_body, status, attempts, last_error,
+                  next_attempt_at, created_at, sent_at
+              FROM email_outbox
+              WHERE status = ? AND next_attempt_at <= ?
+              ORDER BY next_attempt_at ASC
+              LIMIT ?`
+
+	rows, err := db.Query(query, OutboxPending, time.Now().UTC(), limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	emails := []OutboxEmail{}
+	for rows.Next() {
+		var e OutboxEmail
+		var htmlBody, lastError sql.NullString
+		var sentAt sql.NullTime
+
+		err := rows.Scan(&e.ID, &e.ToAddress, &e.Subject, &e.TextBody, &htmlBody, &e.Status, &e.Attempts,
+			&lastError, &e.NextAttemptAt, &e.CreatedAt, &sentAt)
+		if err != nil {
+			return nil, err
+		}
+
+		e.HTMLBody = htmlBody.String
+		e.LastError = lastError.String
+		if sentAt.Valid {
+			e.SentAt = &sentAt.Time
+		}
+
+		emails = append(emails, e)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return emails, nil
+}
+
+// MarkOutboxEmailSent records a successful delivery
+func MarkOutboxEmailSent(db *sql.DB, id int) error {
+	query := `UPDATE email_outbox SET status = ?, attempts = attempts + 1, last_error = NULL, sent_at = ?
+              WHERE id = ?`
+	_, err := db.Exec(query, OutboxSent, time.Now().UTC(), id)
+	return err
+}
+
+// MarkOutboxEmailFailed records a failed attempt. If nextAttemptAt is nil the
+// email has run out of retries and is marked failed for good.
+func MarkOutboxEmailFailed(db *sql.DB, id int, sendErr error, nextAttemptAt *time.Time) error {
+	status := OutboxPending
+	if nextAttemptAt == nil {
+		status = OutboxFailed
+	}
+
+	query := `UPDATE email_outbox SET status = ?, attempts = attempts + 1, last_error = ?, next_attempt_at = COALESCE(?, next_attempt_at)
+              WHERE id = ?`
+	_, err := db.Exec(query, status, sendErr.Error(), nextAttemptAt, id)
+	return err
+}
@@ -0,0 +1,79 @@
+package models
+
+import (
+	"crypto/subtle"
+	"database/sql"
+	"strings"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// Stored password hashes are prefixed with a scheme version so the format can
+// change later without guessing. Anything without a known prefix is treated as
+// a legacy plaintext password left over from before hashing was introduced.
+const (
+	passwordHashPrefix = "v1$"
+	PasswordHashCost   = 12
+)
+
+// HashPassword returns the versioned bcrypt hash for a plaintext password
+func HashPassword(password string) (string, error) {
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), PasswordHashCost)
+	if err != nil {
+		return "", err
+	}
+
+	return passwordHashPrefix + string(hash), nil
+}
+
+// VerifyPassword checks a plaintext password against a stored value. The second
+// return value reports whether the stored value should be replaced with a fresh
+// hash (legacy plaintext or a bcrypt cost lower than PasswordHashCost).
+func VerifyPassword(stored, password string) (bool, bool) {
+	if IsLegacyPassword(stored) {
+		// Legacy plaintext row
+		match := subtle.ConstantTimeCompare([]byte(stored), []byte(password)) == 1
+		return match, match
+	}
+
+	hash := []byte(strings.TrimPrefix(stored, passwordHashPrefix))
+	if err := bcrypt.CompareHashAndPassword(hash, []byte(password)); err != nil {
+		return false, false
+	}
+
+	cost, err := bcrypt.Cost(hash)
+	if err != nil {
+		return true, true
+	}
+
+	return true, cost < PasswordHashCost
+}
+
+// SetUserPassword hashes and stores a new password for the given user
+func SetUserPassword(db *sql.DB, id int, password string) error {
+	hash, err := HashPassword(password)
+	if err != nil {
+		return err
+	}
+
+	query := `UPDATE users SET password = ? WHERE id = ?`
+	_, err = db.Exec(query, hash, id)
+	return err
+}
+
+// IsLegacyPassword reports whether a stored password is a plaintext row from
+// before hashing was introduced
+func IsLegacyPassword(stored string) bool {
+	return !strings.HasPrefix(stored, passwordHashPrefix)
+}
+
+// LockUserPassword replaces a user's password with a random one nobody knows,
+// so the account can only be used again after a password reset
+func LockUserPassword(db *sql.DB, id int) error {
+	secret, err := newSecretToken()
+	if err != nil {
+		return err
+	}
+
+	return SetUserPassword(db, id, secret)
+}
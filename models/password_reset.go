@@ -0,0 +1,77 @@
+package models
+
+import (
+	"database/sql"
+	"time"
+)
+
+// PasswordResetTTL is how long a password reset link stays valid
+const PasswordResetTTL = time.Hour
+
+// CreatePasswordResetToken issues a reset token for the user. Earlier unused
+// tokens are discarded so only the most recent email works.
+func CreatePasswordResetToken(db *sql.DB, userID int) (string, error) {
+	token, err := newSecretToken()
+	if err != nil {
+		return "", err
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return "", err
+	}
+
+	_, err = tx.Exec(`DELETE FROM password_reset_tokens WHERE user_id = ? AND used_at IS NULL`, userID)
+	if err != nil {
+		tx.Rollback()
+		return "", err
+	}
+
+	now := time.Now().UTC()
+	query := `INSERT INTO password_reset_tokens (user_id, token_hash, created_at, expires_at) VALUES (?, ?, ?, ?)`
+	_, err = tx.Exec(query, userID, hashToken(token), now, now.Add(PasswordResetTTL))
+	if err != nil {
+		tx.Rollback()
+		return "", err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return "", err
+	}
+
+	return token, nil
+}
+
+// ConsumePasswordResetToken marks a reset token used and returns its user.
+// Unknown, used and expired tokens return sql.ErrNoRows.
+func ConsumePasswordResetToken(db *sql.DB, token string) (int, error) {
+	now := time.Now().UTC()
+
+	var id, userID int
+	var expiresAt time.Time
+	query := `SELECT id, user_id, expires_at FROM password_reset_tokens WHERE token_hash = ? AND used_at IS NULL`
+	err := db.QueryRow(query, hashToken(token)).Scan(&id, &userID, &expiresAt)
+	if err != nil {
+		return 0, err
+	}
+
+	if now.After(expiresAt) {
+		return 0, sql.ErrNoRows
+	}
+
+	// The used_at check makes concurrent redemptions of the same token lose
+	result, err := db.Exec(`UPDATE password_reset_tokens SET used_at = ? WHERE id = ? AND used_at IS NULL`, now, id)
+	if err != nil {
+		return 0, err
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return 0, err
+	}
+	if affected == 0 {
+		return 0, sql.ErrNoRows
+	}
+
+	return userID, nil
+}
@@ -157,7 +157,7 @@ func GetUserPublicProjectsByUsername(db *sql.DB, username string) ([]Project, er
                   p.image_url1, p.image_url2, p.image_url3, p.created_at 
               FROM projects p
               JOIN users u ON p.user_id = u.id 
-              WHERE u.username = ? 
+              WHERE u.username = ? AND u.deleted_at IS NULL
               ORDER BY p.created_at DESC`
 
 	rows, err := db.Query(query, username)
@@ -125,7 +125,7 @@ func GetUserPublicPromptsByUsername(db *sql.DB, username string) ([]Prompt, erro
 	query := `SELECT p.id, p.user_id, p.title, p.content, p.tags, p.created_at 
               FROM prompts p
               JOIN users u ON p.user_id = u.id 
-              WHERE u.username = ? 
+              WHERE u.username = ? AND u.deleted_at IS NULL
               ORDER BY p.created_at DESC`
 
 	rows, err := db.Query(query, username)
@@ -0,0 +1,206 @@
+package models
+
+import (
+	"database/sql"
+	"errors"
+	"log"
+	"time"
+)
+
+// Points awarded for each kind of activity. Comments are capped per window so
+// a burst of short replies can't outrank real contributions.
+const (
+	ReputationPointsPerVote         = 5
+	ReputationPointsPerComment      = 1
+	ReputationPointsPerPrompt       = 3
+	ReputationPointsPerProject      = 10
+	ReputationPointsPerProfileField = 2
+	ReputationCommentCap            = 50
+)
+
+// Ranking windows
+const (
+	ReputationWeek  = "week"
+	ReputationMonth = "month"
+	ReputationYear  = "year"
+	ReputationAll   = "all"
+)
+
+// reputationWindows maps each window to how far back it counts activity.
+// Zero means all time.
+var reputationWindows = map[string]time.Duration{
+	ReputationWeek:  7 * 24 * time.Hour,
+	ReputationMonth: 30 * 24 * time.Hour,
+	ReputationYear:  365 * 24 * time.Hour,
+	ReputationAll:   0,
+}
+
+var ErrUnknownReputationWindow = errors.New("unknown reputation window")
+
+// ValidReputationWindow reports whether window is a supported ranking window
+func ValidReputationWindow(window string) bool {
+	_, ok := reputationWindows[window]
+	return ok
+}
+
+// ReputationComponent is one part of a user's score
+type ReputationComponent struct {
+	Count  int `json:"count"`
+	Points int `json:"points"`
+}
+
+// ReputationBreakdown shows where a user's score comes from
+type ReputationBreakdown struct {
+	ForumVotes ReputationComponent `json:"forum_votes"`
+	Comments   ReputationComponent `json:"comments"`
+	Prompts    ReputationComponent `json:"prompts"`
+	Projects   ReputationComponent `json:"projects"`
+	Profile    ReputationComponent `json:"profile"`
+}
+
+// Reputation is a user's materialized score for one window
+type Reputation struct {
+	Score      int                 `json:"score"`
+	Window     string              `json:"window"`
+	Breakdown  ReputationBreakdown `json:"breakdown"`
+	ComputedAt time.Time           `json:"computed_at"`
+}
+
+// RankedUser is a user together with their reputation
+type RankedUser struct {
+	User
+	Reputation Reputation `json:"reputation"`
+}
+
+// reputationInsert counts each user's activity since the window start.
+// Votes a user cast on their own posts don't count. Profile completeness
+// doesn't depend on the window.
+const reputationInsert = `
+	INSERT INTO user_reputation (user_id, period, post_votes, comments, prompts, projects, profile_fields, computed_at)
+	SELECT u.id, ?,
+	       (SELECT COUNT(*) FROM forum_votes v JOIN forum_posts p ON p.id = v.post_id
+	        WHERE p.user_id = u.id AND v.user_id != u.id AND v.created_at >= ?),
+	       (SELECT COUNT(*) FROM forum_comments WHERE user_id = u.id AND created_at >= ?),
+	       (SELECT COUNT(*) FROM prompts WHERE user_id = u.id AND created_at >= ?),
+	       (SELECT COUNT(*) FROM projects WHERE user_id = u.id AND created_at >= ?),
+	       (COALESCE(u.fullname, '') != '') + (COALESCE(u.bio, '') != '') + (COALESCE(u.photo_url, '') != '') +
+	       (COALESCE(u.github_url, '') != '') + (COALESCE(u.linked_in_url, '') != ''),
+	       ?
+	FROM users u
+	WHERE u.deleted_at IS NULL AND u.username != ?`
+
+const reputationScore = `
+	UPDATE user_reputation
+	SET score = post_votes * ? + MIN(comments, ?) * ? + prompts * ? + projects * ? + profile_fields * ?
+	WHERE period = ?`
+
+// RecomputeReputation rebuilds every window of the reputation table in a
+// single transaction, so readers never see a half-built ranking
+func RecomputeReputation(db *sql.DB) error {
+	now := time.Now().UTC()
+
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+
+	if _, err := tx.Exec(`DELETE FROM user_reputation`); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	for window, span := range reputationWindows {
+		since := "0000-00-00 00:00:00"
+		if span > 0 {
+			since = now.Add(-span).Format("2006-01-02 15:04:05")
+		}
+
+		_, err := tx.Exec(reputationInsert, window, since, since, since, since, now, DeletedUserPlaceholder)
+		if err != nil {
+			tx.Rollback()
+			return err
+		}
+
+		_, err = tx.Exec(reputationScore, ReputationPointsPerVote, ReputationCommentCap, ReputationPointsPerComment,
+			ReputationPointsPerPrompt, ReputationPointsPerProject, ReputationPointsPerProfileField, window)
+		if err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// GetTopUsers returns the highest scoring users for a window, as of the last
+// recompute. Ties go to the longest standing member.
+func GetTopUsers(db *sql.DB, limit int, window string) ([]RankedUser, error) {
+	if !ValidReputationWindow(window) {
+		return nil, ErrUnknownReputationWindow
+	}
+
+	query := `SELECT u.id, u.username, u.fullname, u.bio, u.linked_in_url, u.github_url, u.photo_url, u.created_at, ` + isAdminColumn("u") + `,
+                     r.score, r.post_votes, r.comments, r.prompts, r.projects, r.profile_fields, r.computed_at
+              FROM user_reputation r
+              JOIN users u ON u.id = r.user_id
+              WHERE r.period = ? AND u.deleted_at IS NULL
+              ORDER BY r.score DESC, u.id
+              LIMIT ?`
+
+	rows, err := db.Query(query, window, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	users := []RankedUser{}
+	for rows.Next() {
+		var u RankedUser
+		var bio, linkedIn, github, fullname, photo sql.NullString
+		var votes, comments, prompts, projects, profile int
+
+		err := rows.Scan(&u.ID, &u.Username, &fullname, &bio, &linkedIn, &github, &photo, &u.CreatedAt, &u.IsAdmin,
+			&u.Reputation.Score, &votes, &comments, &prompts, &projects, &profile, &u.Reputation.ComputedAt)
+		if err != nil {
+			return nil, err
+		}
+
+		u.Fullname = fullname.String
+		u.Bio = bio.String
+		u.LinkedInURL = linkedIn.String
+		u.GithubURL = github.String
+		u.PhotoURL = photo.String
+
+		u.Reputation.Window = window
+		u.Reputation.Breakdown = ReputationBreakdown{
+			ForumVotes: ReputationComponent{votes, votes * ReputationPointsPerVote},
+			Comments:   ReputationComponent{comments, min(comments, ReputationCommentCap) * ReputationPointsPerComment},
+			Prompts:    ReputationComponent{prompts, prompts * ReputationPointsPerPrompt},
+			Projects:   ReputationComponent{projects, projects * ReputationPointsPerProject},
+			Profile:    ReputationComponent{profile, profile * ReputationPointsPerProfileField},
+		}
+
+		users = append(users, u)
+	}
+
+	return users, rows.Err()
+}
+
+// StartReputationUpdater recomputes reputation right away and then in the
+// background every interval
+func StartReputationUpdater(db *sql.DB, interval time.Duration) {
+	if err := RecomputeReputation(db); err != nil {
+		log.Printf("Reputation update failed: %v", err)
+	}
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for range ticker.C {
+			if err := RecomputeReputation(db); err != nil {
+				log.Printf("Reputation update failed: %v", err)
+			}
+		}
+	}()
+}
@@ -0,0 +1,238 @@
+package models
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+)
+
+// Built-in roles
+const (
+	RoleAdmin     = "admin"
+	RoleModerator = "moderator"
+	RoleMember    = "member"
+)
+
+// Permissions checked by RequirePermission
+const (
+	PermAdminAccess    = "admin.access"
+	PermUsersView      = "users.view"
+	PermUsersEdit      = "users.edit"
+	PermUsersDelete    = "users.delete"
+	PermRolesManage    = "roles.manage"
+	PermSettingsManage = "settings.manage"
+	PermForumModerate  = "forum.moderate"
+	PermAuditView      = "audit.view"
+	PermImpersonate    = "users.impersonate"
+	PermSkillsManage   = "skills.manage"
+)
+
+var (
+	// ErrUnknownRole is returned for role names that do not exist
+	ErrUnknownRole = errors.New("unknown role")
+
+	// ErrLastAdmin is returned when revoking the admin role from the only admin
+	ErrLastAdmin = errors.New("cannot remove the last administrator")
+)
+
+// Role is a named set of permissions
+type Role struct {
+	ID          int      `json:"id"`
+	Name        string   `json:"name"`
+	Description string   `json:"description"`
+	Permissions []string `json:"permissions"`
+}
+
+// execer is satisfied by both *sql.DB and *sql.Tx
+type execer interface {
+	Exec(query string, args ...interface{}) (sql.Result, error)
+}
+
+// isAdminColumn selects whether the user aliased as alias holds the admin
+// role, for queries that fill in User.IsAdmin
+func isAdminColumn(alias string) string {
+	return `EXISTS (SELECT 1 FROM user_roles ur JOIN roles r ON r.id = ur.role_id
+                    WHERE ur.user_id = ` + alias + `.id AND r.name = '` + RoleAdmin + `')`
+}
+
+// assignDefaultRole gives a newly created user the member role
+func assignDefaultRole(db execer, userID int64) error {
+	query := `INSERT INTO user_roles (user_id, role_id, granted_at) SELECT ?, id, ? FROM roles WHERE name = ?`
+	_, err := db.Exec(query, userID, time.Now().UTC(), RoleMember)
+	return err
+}
+
+// GetRoles lists every role with its permissions
+func GetRoles(db *sql.DB) ([]Role, error) {
+	query := `SELECT r.id, r.name, COALESCE(r.description, ''), COALESCE(p.name, '')
+              FROM roles r
+              LEFT JOIN role_permissions rp ON rp.role_id = r.id
+              LEFT JOIN permissions p ON p.id = rp.permission_id
+              ORDER BY r.id, p.name`
+
+	rows, err := db.Query(query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	roles := []Role{}
+	for rows.Next() {
+		var role Role
+		var permission string
+		if err := rows.Scan(&role.ID, &role.Name, &role.Description, &permission); err != nil {
+			return nil, err
+		}
+
+		if len(roles) == 0 || roles[len(roles)-1].ID != role.ID {
+			role.Permissions = []string{}
+			roles = append(roles, role)
+		}
+		if permission != "" {
+			last := &roles[len(roles)-1]
+			last.Permissions = append(last.Permissions, permission)
+		}
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return roles, nil
+}
+
+// GetUserRoles returns the names of the roles a user holds
+func GetUserRoles(db *sql.DB, userID int) ([]string, error) {
+	query := `SELECT r.name FROM user_roles ur JOIN roles r ON r.id = ur.role_id
+              WHERE ur.user_id = ? ORDER BY r.id`
+	return queryStrings(db, query, userID)
+}
+
+// GetUserPermissions returns every permission granted by the user's roles
+func GetUserPermissions(db *sql.DB, userID int) ([]string, error) {
+	query := `SELECT DISTINCT p.name
+              FROM user_roles ur
+              JOIN role_permissions rp ON rp.role_id = ur.role_id
+              JOIN permissions p ON p.id = rp.permission_id
+              WHERE ur.user_id = ?
+              ORDER BY p.name`
+	return queryStrings(db, query, userID)
+}
+
+// UserHasPermission reports whether any of the user's roles grants permission
+func UserHasPermission(db *sql.DB, userID int, permission string) (bool, error) {
+	query := `SELECT EXISTS (
+                  SELECT 1 FROM user_roles ur
+                  JOIN role_permissions rp ON rp.role_id = ur.role_id
+                  JOIN permissions p ON p.id = rp.permission_id
+                  WHERE ur.user_id = ? AND p.name = ?)`
+
+	var has bool
+	err := db.QueryRow(query, userID, permission).Scan(&has)
+	return has, err
+}
+
+// GrantRole gives a user a role. Granting a role the user already holds is
+// not an error.
+func GrantRole(db *sql.DB, userID int, role string, grantedBy int) error {
+	var roleID int
+	err := db.QueryRow(`SELECT id FROM roles WHERE name = ?`, role).Scan(&roleID)
+	if err == sql.ErrNoRows {
+		return ErrUnknownRole
+	}
+	if err != nil {
+		return err
+	}
+
+	query := `INSERT OR IGNORE INTO user_roles (user_id, role_id, granted_at, granted_by) VALUES (?, ?, ?, ?)`
+	_, err = db.Exec(query, userID, roleID, time.Now().UTC(), grantedBy)
+	return err
+}
+
+// otherAdminsQuery counts the active administrators other than a user
+const otherAdminsQuery = `SELECT COUNT(*) FROM user_roles ur
+                          JOIN roles r ON r.id = ur.role_id
+                          JOIN users u ON u.id = ur.user_id AND u.deleted_at IS NULL
+                          WHERE r.name = ? AND ur.user_id != ?`
+
+// IsLastAdmin reports whether the user is an administrator and no other
+// active user is
+func IsLastAdmin(db *sql.DB, userID int) (bool, error) {
+	isAdmin, err := UserHasRole(db, userID, RoleAdmin)
+	if err != nil || !isAdmin {
+		return false, err
+	}
+
+	var admins int
+	err = db.QueryRow(otherAdminsQuery, RoleAdmin, userID).Scan(&admins)
+	return admins == 0, err
+}
+
+// UserHasRole reports whether the user holds a role
+func UserHasRole(db *sql.DB, userID int, role string) (bool, error) {
+	query := `SELECT EXISTS (SELECT 1 FROM user_roles ur JOIN roles r ON r.id = ur.role_id
+                             WHERE ur.user_id = ? AND r.name = ?)`
+
+	var has bool
+	err := db.QueryRow(query, userID, role).Scan(&has)
+	return has, err
+}
+
+// RevokeRole takes a role away from a user. It returns sql.ErrNoRows if the
+// user did not hold it, and refuses to remove the last administrator.
+func RevokeRole(db *sql.DB, userID int, role string) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+
+	if role == RoleAdmin {
+		var admins int
+		if err := tx.QueryRow(otherAdminsQuery, RoleAdmin, userID).Scan(&admins); err != nil {
+			tx.Rollback()
+			return err
+		}
+		if admins == 0 {
+			tx.Rollback()
+			return ErrLastAdmin
+		}
+	}
+
+	query := `DELETE FROM user_roles WHERE user_id = ? AND role_id = (SELECT id FROM roles WHERE name = ?)`
+	result, err := tx.Exec(query, userID, role)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	if affected == 0 {
+		tx.Rollback()
+		return sql.ErrNoRows
+	}
+
+	return tx.Commit()
+}
+
+func queryStrings(db *sql.DB, query string, args ...interface{}) ([]string, error) {
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	values := []string{}
+	for rows.Next() {
+		var v string
+		if err := rows.Scan(&v); err != nil {
+			return nil, err
+		}
+		values = append(values, v)
+	}
+
+	return values, rows.Err()
+}
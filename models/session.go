@@ -2,37 +2,106 @@ package models
 
 import (
 	"database/sql"
+	"log"
+	"time"
+
 	"github.com/google/uuid"
 )
 
+const (
+	// SessionIdleTTL is how long a session survives without being used.
+	// Every use slides the expiry forward by this amount.
+	SessionIdleTTL = 30 * 24 * time.Hour
+
+	// SessionMaxAge caps the lifetime of a session regardless of activity
+	SessionMaxAge = 90 * 24 * time.Hour
+
+	// ImpersonationTTL is how long an administrator may view the site as
+	// another user before having to start again. It does not slide.
+	ImpersonationTTL = 30 * time.Minute
+
+	// sessionTouchInterval limits how often last_seen_at is written so that
+	// busy clients do not turn every request into a database write
+	sessionTouchInterval = 5 * time.Minute
+)
+
 type Session struct {
-	ID     int    `json:"id"`
-	UserID int    `json:"user_id"`
-	Token  string `json:"token"`
+	ID         int       `json:"id"`
+	UserID     int       `json:"user_id"`
+	Token      string    `json:"-"`
+	CSRFToken  string    `json:"-"`
+	CreatedAt  time.Time `json:"created_at"`
+	LastSeenAt time.Time `json:"last_seen_at"`
+	ExpiresAt  time.Time `json:"expires_at"`
+	IPAddress  string    `json:"ip_address"`
+	UserAgent  string    `json:"user_agent"`
+	Current    bool      `json:"current"`
+
+	// Set when an administrator is viewing the site as this session's user
+	ImpersonatorID        *int `json:"-"`
+	ImpersonatorSessionID *int `json:"-"`
 }
 
-func CreateSession(db *sql.DB, userID int) (string, error) {
-	token := uuid.New().String()
-	
-	query := `INSERT INTO sessions (user_id, token) VALUES (?, ?)`
-	_, err := db.Exec(query, userID, token)
+// CreateSession starts a session for the user along with its CSRF token
+func CreateSession(db *sql.DB, userID int, ipAddress, userAgent string) (*Session, error) {
+	return createSession(db, userID, nil, ipAddress, userAgent)
+}
+
+// CreateImpersonationSession starts a session for userID on behalf of the
+// administrator who owns adminSession. It expires after ImpersonationTTL.
+func CreateImpersonationSession(db *sql.DB, userID int, adminSession *Session, ipAddress, userAgent string) (*Session, error) {
+	return createSession(db, userID, adminSession, ipAddress, userAgent)
+}
+
+func createSession(db *sql.DB, userID int, adminSession *Session, ipAddress, userAgent string) (*Session, error) {
+	csrfToken, err := newSecretToken()
 	if err != nil {
-		return "", err
+		return nil, err
 	}
-	
-	return token, nil
+
+	now := time.Now().UTC()
+	session := &Session{
+		UserID:     userID,
+		Token:      uuid.New().String(),
+		CSRFToken:  csrfToken,
+		CreatedAt:  now,
+		LastSeenAt: now,
+		ExpiresAt:  now.Add(SessionIdleTTL),
+		IPAddress:  ipAddress,
+		UserAgent:  userAgent,
+	}
+
+	if adminSession != nil {
+		session.ImpersonatorID = &adminSession.UserID
+		session.ImpersonatorSessionID = &adminSession.ID
+		session.ExpiresAt = now.Add(ImpersonationTTL)
+	}
+
+	query := `INSERT INTO sessions (user_id, token, csrf_token, created_at, last_seen_at, expires_at, ip_address, user_agent,
+                                    impersonator_id, impersonator_session_id)
+              VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`
+	result, err := db.Exec(query, userID, session.Token, csrfToken, now, now, session.ExpiresAt, ipAddress, userAgent,
+		session.ImpersonatorID, session.ImpersonatorSessionID)
+	if err != nil {
+		return nil, err
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return nil, err
+	}
+	session.ID = int(id)
+
+	return session, nil
 }
 
 func GetUserIDByToken(db *sql.DB, token string) (int, error) {
-	query := `SELECT user_id FROM sessions WHERE token = ?`
-	
-	var userID int
-	err := db.QueryRow(query, token).Scan(&userID)
+	session, err := GetSessionByToken(db, token)
 	if err != nil {
 		return 0, err
 	}
-	
-	return userID, nil
+
+	return session.UserID, nil
 }
 
 func DeleteSession(db *sql.DB, token string) error {
@@ -41,14 +110,234 @@ func DeleteSession(db *sql.DB, token string) error {
 	return err
 }
 
+// GetSessionByToken returns the session for a token, or sql.ErrNoRows if the
+// token is unknown or the session has expired
 func GetSessionByToken(db *sql.DB, token string) (*Session, error) {
-	query := `SELECT id, user_id, token FROM sessions WHERE token = ?`
-	
+	query := `SELECT id, user_id, token, csrf_token, created_at, last_seen_at, expires_at, ip_address, user_agent,
+                     impersonator_id, impersonator_session_id
+              FROM sessions
+              WHERE token = ?`
+
+	session, err := scanSession(db.QueryRow(query, token))
+	if err != nil {
+		return nil, err
+	}
+
+	if time.Now().After(session.ExpiresAt) {
+		return nil, sql.ErrNoRows
+	}
+
+	return session, nil
+}
+
+// GetSessionByID returns an unexpired session by its ID
+func GetSessionByID(db *sql.DB, id int) (*Session, error) {
+	query := `SELECT id, user_id, token, csrf_token, created_at, last_seen_at, expires_at, ip_address, user_agent,
+                     impersonator_id, impersonator_session_id
+              FROM sessions
+              WHERE id = ?`
+
+	session, err := scanSession(db.QueryRow(query, id))
+	if err != nil {
+		return nil, err
+	}
+
+	if time.Now().After(session.ExpiresAt) {
+		return nil, sql.ErrNoRows
+	}
+
+	return session, nil
+}
+
+// TouchSession records activity on a session and slides its expiry forward,
+// never past SessionMaxAge from when it was created. Impersonation sessions
+// keep their fixed expiry.
+func TouchSession(db *sql.DB, session *Session, ipAddress, userAgent string) error {
+	now := time.Now().UTC()
+	if now.Sub(session.LastSeenAt) < sessionTouchInterval {
+		return nil
+	}
+
+	expiresAt := now.Add(SessionIdleTTL)
+	if maxExpiry := session.CreatedAt.Add(SessionMaxAge); expiresAt.After(maxExpiry) {
+		expiresAt = maxExpiry
+	}
+	if session.ImpersonatorID != nil {
+		expiresAt = session.ExpiresAt
+	}
+
+	query := `UPDATE sessions
+              SET last_seen_at = ?, expires_at = ?, ip_address = ?, user_agent = ?
+              WHERE id = ?`
+	_, err := db.Exec(query, now, expiresAt, ipAddress, userAgent, session.ID)
+	if err != nil {
+		return err
+	}
+
+	session.LastSeenAt = now
+	session.ExpiresAt = expiresAt
+	session.IPAddress = ipAddress
+	session.UserAgent = userAgent
+	return nil
+}
+
+// EnsureSessionCSRFToken gives a session created before CSRF tokens existed
+// a token of its own
+func EnsureSessionCSRFToken(db *sql.DB, session *Session) error {
+	if session.CSRFToken != "" {
+		return nil
+	}
+
+	token, err := newSecretToken()
+	if err != nil {
+		return err
+	}
+
+	_, err = db.Exec(`UPDATE sessions SET csrf_token = ? WHERE id = ?`, token, session.ID)
+	if err != nil {
+		return err
+	}
+
+	session.CSRFToken = token
+	return nil
+}
+
+// GetUserSessions returns all active sessions for a user, most recently used
+// first. Impersonation sessions are not the user's devices and are left out.
+func GetUserSessions(db *sql.DB, userID int) ([]Session, error) {
+	query := `SELECT id, user_id, token, csrf_token, created_at, last_seen_at, expires_at, ip_address, user_agent,
+                     impersonator_id, impersonator_session_id
+              FROM sessions
+              WHERE user_id = ? AND expires_at > ? AND impersonator_id IS NULL
+              ORDER BY last_seen_at DESC`
+
+	rows, err := db.Query(query, userID, time.Now().UTC())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	sessions := []Session{}
+	for rows.Next() {
+		session, err := scanSession(rows)
+		if err != nil {
+			return nil, err
+		}
+		sessions = append(sessions, *session)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return sessions, nil
+}
+
+// DeleteUserSession revokes a single session belonging to the given user
+func DeleteUserSession(db *sql.DB, id, userID int) error {
+	query := `DELETE FROM sessions WHERE id = ? AND user_id = ?`
+	result, err := db.Exec(query, id, userID)
+	if err != nil {
+		return err
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return sql.ErrNoRows
+	}
+
+	return nil
+}
+
+// DeleteUserSessions revokes every session for a user ("log out everywhere")
+func DeleteUserSessions(db *sql.DB, userID int) error {
+	query := `DELETE FROM sessions WHERE user_id = ?`
+	_, err := db.Exec(query, userID)
+	return err
+}
+
+// DeleteOtherUserSessions revokes every session for a user except keepID,
+// used after a password change to sign out other devices
+func DeleteOtherUserSessions(db *sql.DB, userID, keepID int) error {
+	query := `DELETE FROM sessions WHERE user_id = ? AND id != ?`
+	_, err := db.Exec(query, userID, keepID)
+	return err
+}
+
+// DeleteExpiredSessions purges sessions whose expiry has passed
+func DeleteExpiredSessions(db *sql.DB) (int64, error) {
+	query := `DELETE FROM sessions WHERE expires_at IS NULL OR expires_at <= ?`
+	result, err := db.Exec(query, time.Now().UTC())
+	if err != nil {
+		return 0, err
+	}
+
+	return result.RowsAffected()
+}
+
+// StartSessionSweeper purges expired sessions in the background every interval
+func StartSessionSweeper(db *sql.DB, interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for range ticker.C {
+			purged, err := DeleteExpiredSessions(db)
+			if err != nil {
+				log.Printf("Session sweeper failed: %v", err)
+				continue
+			}
+			if purged > 0 {
+				log.Printf("Session sweeper purged %d expired sessions", purged)
+			}
+		}
+	}()
+}
+
+// rowScanner is satisfied by both *sql.Row and *sql.Rows
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanSession(row rowScanner) (*Session, error) {
 	var session Session
-	err := db.QueryRow(query, token).Scan(&session.ID, &session.UserID, &session.Token)
+	var lastSeenAt, expiresAt sql.NullTime
+	var csrfToken, ipAddress, userAgent sql.NullString
+	var impersonatorID, impersonatorSessionID sql.NullInt64
+
+	err := row.Scan(&session.ID, &session.UserID, &session.Token, &csrfToken, &session.CreatedAt,
+		&lastSeenAt, &expiresAt, &ipAddress, &userAgent, &impersonatorID, &impersonatorSessionID)
 	if err != nil {
 		return nil, err
 	}
-	
+
+	if impersonatorID.Valid {
+		id := int(impersonatorID.Int64)
+		session.ImpersonatorID = &id
+	}
+	if impersonatorSessionID.Valid {
+		id := int(impersonatorSessionID.Int64)
+		session.ImpersonatorSessionID = &id
+	}
+
+	session.CSRFToken = csrfToken.String
+	if lastSeenAt.Valid {
+		session.LastSeenAt = lastSeenAt.Time
+	} else {
+		session.LastSeenAt = session.CreatedAt
+	}
+	if expiresAt.Valid {
+		session.ExpiresAt = expiresAt.Time
+	}
+	if ipAddress.Valid {
+		session.IPAddress = ipAddress.String
+	}
+	if userAgent.Valid {
+		session.UserAgent = userAgent.String
+	}
+
 	return &session, nil
-}
\ No newline at end of file
+}
@@ -0,0 +1,38 @@
+package models
+
+import (
+	"database/sql"
+	"time"
+)
+
+// SettingRequireAdminTwoFactor makes two-factor authentication mandatory for
+// administrators when set to "true"
+const SettingRequireAdminTwoFactor = "require_admin_2fa"
+
+// GetSetting returns a site setting, or "" if it has never been set
+func GetSetting(db *sql.DB, key string) (string, error) {
+	var value string
+	err := db.QueryRow(`SELECT value FROM app_settings WHERE key = ?`, key).Scan(&value)
+	if err == sql.ErrNoRows {
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+
+	return value, nil
+}
+
+// GetBoolSetting reports whether a setting is "true"
+func GetBoolSetting(db *sql.DB, key string) (bool, error) {
+	value, err := GetSetting(db, key)
+	return value == "true", err
+}
+
+// SetSetting creates or replaces a site setting
+func SetSetting(db *sql.DB, key, value string) error {
+	query := `INSERT INTO app_settings (key, value, updated_at) VALUES (?, ?, ?)
+              ON CONFLICT(key) DO UPDATE SET value = excluded.value, updated_at = excluded.updated_at`
+	_, err := db.Exec(query, key, value, time.Now().UTC())
+	return err
+}
@@ -0,0 +1,517 @@
+package models
+
+import (
+	"database/sql"
+	"errors"
+	"strings"
+)
+
+const (
+	// MaxSkillNameLength is the longest skill name or alias
+	MaxSkillNameLength = 40
+
+	// MaxUserSkills is how many skills a user may list on their profile
+	MaxUserSkills = 30
+
+	// MaxSkillYears is the most years of experience accepted for a skill
+	MaxSkillYears = 50
+)
+
+// SkillCategories are the groups skills are filed under
+var SkillCategories = []string{"language", "framework", "ai", "tool", "other"}
+
+// SkillProficiencies are the proficiency levels, lowest first
+var SkillProficiencies = []string{"beginner", "intermediate", "advanced", "expert"}
+
+var (
+	ErrSkillExists   = errors.New("skill name or alias already exists")
+	ErrSkillSelf     = errors.New("cannot merge a skill into itself")
+	ErrTooManySkills = errors.New("too many skills")
+)
+
+// Skill is an entry in the skills taxonomy
+type Skill struct {
+	ID        int      `json:"id"`
+	Name      string   `json:"name"`
+	Category  string   `json:"category"`
+	Aliases   []string `json:"aliases"`
+	UserCount int      `json:"user_count"`
+	Approved  bool     `json:"approved"` // false for suggestions from users awaiting an admin
+}
+
+// UserSkill is a skill on a user's profile
+type UserSkill struct {
+	SkillID     int    `json:"skill_id"`
+	Name        string `json:"name"`
+	Category    string `json:"category"`
+	Proficiency string `json:"proficiency"`
+	Years       int    `json:"years"`
+}
+
+// UserSkillInput is a skill a user lists by name (or alias)
+type UserSkillInput struct {
+	Name        string `json:"name"`
+	Proficiency string `json:"proficiency"`
+	Years       int    `json:"years"`
+}
+
+// ValidSkillCategory reports whether category is one of SkillCategories
+func ValidSkillCategory(category string) bool {
+	return indexOf(SkillCategories, category) >= 0
+}
+
+// ValidSkillProficiency reports whether proficiency is one of SkillProficiencies
+func ValidSkillProficiency(proficiency string) bool {
+	return indexOf(SkillProficiencies, proficiency) >= 0
+}
+
+func indexOf(values []string, value string) int {
+	for i, v := range values {
+		if v == value {
+			return i
+		}
+	}
+	return -1
+}
+
+// NormalizeSkillName trims a skill name or alias and collapses inner
+// whitespace. Returns "" if the name is empty or too long.
+func NormalizeSkillName(name string) string {
+	name = strings.Join(strings.Fields(name), " ")
+	if len(name) > MaxSkillNameLength {
+		return ""
+	}
+	return name
+}
+
+// skillUserCount counts the active users that list a skill
+const skillUserCount = `(SELECT COUNT(*) FROM user_skills us JOIN users u ON u.id = us.user_id
+                         WHERE us.skill_id = s.id AND u.deleted_at IS NULL)`
+
+func querySkills(db *sql.DB, where string, args ...interface{}) ([]Skill, error) {
+	query := `SELECT s.id, s.name, s.category, s.approved, ` + skillUserCount + ` AS user_count
+              FROM skills s ` + where
+
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	skills := []Skill{}
+	for rows.Next() {
+		var s Skill
+		s.Aliases = []string{}
+		if err := rows.Scan(&s.ID, &s.Name, &s.Category, &s.Approved, &s.UserCount); err != nil {
+			return nil, err
+		}
+		skills = append(skills, s)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	if err := loadSkillAliases(db, skills); err != nil {
+		return nil, err
+	}
+
+	return skills, nil
+}
+
+// loadSkillAliases fills in the aliases of every skill with a single query
+func loadSkillAliases(db *sql.DB, skills []Skill) error {
+	if len(skills) == 0 {
+		return nil
+	}
+
+	index := make(map[int]int, len(skills))
+	args := make([]interface{}, len(skills))
+	for i, s := range skills {
+		index[s.ID] = i
+		args[i] = s.ID
+	}
+
+	query := `SELECT skill_id, alias FROM skill_aliases
+              WHERE skill_id IN (?` + strings.Repeat(", ?", len(skills)-1) + `)
+              ORDER BY alias`
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var skillID int
+		var alias string
+		if err := rows.Scan(&skillID, &alias); err != nil {
+			return err
+		}
+		skill := &skills[index[skillID]]
+		skill.Aliases = append(skill.Aliases, alias)
+	}
+
+	return rows.Err()
+}
+
+// GetSkills returns a page of the approved taxonomy, or of one category of
+// it, by name
+func GetSkills(db *sql.DB, category string, page, pageSize int) ([]Skill, error) {
+	offset := (page - 1) * pageSize
+	if category != "" {
+		return querySkills(db, `WHERE s.approved = 1 AND s.category = ? ORDER BY s.name LIMIT ? OFFSET ?`,
+			category, pageSize, offset)
+	}
+	return querySkills(db, `WHERE s.approved = 1 ORDER BY s.name LIMIT ? OFFSET ?`, pageSize, offset)
+}
+
+// GetSkillCount returns how many approved skills there are, optionally in
+// one category
+func GetSkillCount(db *sql.DB, category string) (int, error) {
+	var count int
+	err := db.QueryRow(`SELECT COUNT(*) FROM skills WHERE approved = 1 AND (? = '' OR category = ?)`,
+		category, category).Scan(&count)
+	return count, err
+}
+
+// GetSkillSuggestions returns a page of the names users listed that are
+// waiting for an admin, most listed first
+func GetSkillSuggestions(db *sql.DB, page, pageSize int) ([]Skill, error) {
+	return querySkills(db, `WHERE s.approved = 0 ORDER BY user_count DESC, s.name LIMIT ? OFFSET ?`,
+		pageSize, (page-1)*pageSize)
+}
+
+// GetSkillSuggestionCount returns how many suggestions are waiting
+func GetSkillSuggestionCount(db *sql.DB) (int, error) {
+	var count int
+	err := db.QueryRow(`SELECT COUNT(*) FROM skills WHERE approved = 0`).Scan(&count)
+	return count, err
+}
+
+// SuggestSkills returns approved skills whose name or an alias starts with
+// prefix, most popular first
+func SuggestSkills(db *sql.DB, prefix string, limit int) ([]Skill, error) {
+	pattern := escapeLike(prefix) + "%"
+	return querySkills(db, `WHERE s.approved = 1
+                              AND (s.name LIKE ? ESCAPE '\'
+                                   OR s.id IN (SELECT skill_id FROM skill_aliases WHERE alias LIKE ? ESCAPE '\'))
+                            ORDER BY user_count DESC, s.name
+                            LIMIT ?`, pattern, pattern, limit)
+}
+
+// GetSkillByID returns a single skill
+func GetSkillByID(db *sql.DB, id int) (*Skill, error) {
+	skills, err := querySkills(db, `WHERE s.id = ?`, id)
+	if err != nil {
+		return nil, err
+	}
+	if len(skills) == 0 {
+		return nil, sql.ErrNoRows
+	}
+	return &skills[0], nil
+}
+
+// escapeLike escapes the LIKE wildcards in s, using \ as the escape character
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(s)
+}
+
+// queryRower is satisfied by both *sql.DB and *sql.Tx
+type queryRower interface {
+	QueryRow(query string, args ...interface{}) *sql.Row
+}
+
+// resolveSkillID finds the skill a name or alias refers to, case-insensitively
+func resolveSkillID(db queryRower, name string) (int, error) {
+	var id int
+	err := db.QueryRow(`SELECT id FROM skills WHERE name = ?
+                        UNION ALL
+                        SELECT skill_id FROM skill_aliases WHERE alias = ?
+                        LIMIT 1`, name, name).Scan(&id)
+	return id, err
+}
+
+// skillNameTaken reports whether name is already used by a skill other than
+// exceptID, as its name or as an alias
+func skillNameTaken(db queryRower, name string, exceptID int) (bool, error) {
+	id, err := resolveSkillID(db, name)
+	if err == sql.ErrNoRows {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return id != exceptID, nil
+}
+
+// CreateSkill adds a skill to the taxonomy
+func CreateSkill(db *sql.DB, name, category string) (int, error) {
+	taken, err := skillNameTaken(db, name, 0)
+	if err != nil {
+		return 0, err
+	}
+	if taken {
+		return 0, ErrSkillExists
+	}
+
+	result, err := db.Exec(`INSERT INTO skills (name, category) VALUES (?, ?)`, name, category)
+	if err != nil {
+		return 0, err
+	}
+
+	id, err := result.LastInsertId()
+	return int(id), err
+}
+
+// ApproveSkill adds a user suggestion to the taxonomy under category.
+// Returns sql.ErrNoRows if the skill is not a suggestion.
+func ApproveSkill(db *sql.DB, id int, category string) error {
+	result, err := db.Exec(`UPDATE skills SET approved = 1, category = ? WHERE id = ? AND approved = 0`, category, id)
+	if err != nil {
+		return err
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// UpdateSkill renames or recategorizes a skill
+func UpdateSkill(db *sql.DB, id int, name, category string) error {
+	taken, err := skillNameTaken(db, name, id)
+	if err != nil {
+		return err
+	}
+	if taken {
+		return ErrSkillExists
+	}
+
+	_, err = db.Exec(`UPDATE skills SET name = ?, category = ? WHERE id = ?`, name, category, id)
+	return err
+}
+
+// DeleteSkill removes a skill from the taxonomy and from every profile
+func DeleteSkill(db *sql.DB, id int) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+
+	for _, query := range []string{
+		`DELETE FROM user_skills WHERE skill_id = ?`,
+		`DELETE FROM skill_aliases WHERE skill_id = ?`,
+		`DELETE FROM skills WHERE id = ?`,
+	} {
+		if _, err := tx.Exec(query, id); err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// MergeSkill folds a synonym into another skill. Users who listed both keep
+// the higher proficiency and years; everyone else moves over. The merged
+// skill's name and aliases become aliases of the skill it was merged into.
+func MergeSkill(db *sql.DB, fromID, intoID int) error {
+	if fromID == intoID {
+		return ErrSkillSelf
+	}
+
+	var fromName string
+	if err := db.QueryRow(`SELECT name FROM skills WHERE id = ?`, fromID).Scan(&fromName); err != nil {
+		return err
+	}
+	var exists int
+	if err := db.QueryRow(`SELECT 1 FROM skills WHERE id = ?`, intoID).Scan(&exists); err != nil {
+		return err
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+
+	// Users who listed both skills
+	rows, err := tx.Query(`SELECT f.user_id, f.proficiency, f.years, i.proficiency, i.years
+                           FROM user_skills f
+                           JOIN user_skills i ON i.user_id = f.user_id AND i.skill_id = ?
+                           WHERE f.skill_id = ?`, intoID, fromID)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	var both []UserSkill
+	var userIDs []int
+	for rows.Next() {
+		var userID int
+		var from, into UserSkill
+		if err := rows.Scan(&userID, &from.Proficiency, &from.Years, &into.Proficiency, &into.Years); err != nil {
+			rows.Close()
+			tx.Rollback()
+			return err
+		}
+		if indexOf(SkillProficiencies, from.Proficiency) > indexOf(SkillProficiencies, into.Proficiency) {
+			into.Proficiency = from.Proficiency
+		}
+		into.Years = max(into.Years, from.Years)
+		both = append(both, into)
+		userIDs = append(userIDs, userID)
+	}
+	rows.Close()
+
+	for i, skill := range both {
+		_, err := tx.Exec(`UPDATE user_skills SET proficiency = ?, years = ? WHERE user_id = ? AND skill_id = ?`,
+			skill.Proficiency, skill.Years, userIDs[i], intoID)
+		if err != nil {
+			tx.Rollback()
+			return err
+		}
+		if _, err := tx.Exec(`DELETE FROM user_skills WHERE user_id = ? AND skill_id = ?`, userIDs[i], fromID); err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+
+	for _, query := range []string{
+		`UPDATE user_skills SET skill_id = ? WHERE skill_id = ?`,
+		`UPDATE skill_aliases SET skill_id = ? WHERE skill_id = ?`,
+	} {
+		if _, err := tx.Exec(query, intoID, fromID); err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+
+	if _, err := tx.Exec(`DELETE FROM skills WHERE id = ?`, fromID); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	// Adding the alias also reindexes everyone with the merged skill
+	if _, err := tx.Exec(`INSERT INTO skill_aliases (alias, skill_id) VALUES (?, ?)`, fromName, intoID); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// AddSkillAlias makes alias resolve to a skill
+func AddSkillAlias(db *sql.DB, skillID int, alias string) error {
+	taken, err := skillNameTaken(db, alias, 0)
+	if err != nil {
+		return err
+	}
+	if taken {
+		return ErrSkillExists
+	}
+
+	_, err = db.Exec(`INSERT INTO skill_aliases (alias, skill_id) VALUES (?, ?)`, alias, skillID)
+	return err
+}
+
+// RemoveSkillAlias deletes an alias of a skill. Returns sql.ErrNoRows if the
+// skill has no such alias.
+func RemoveSkillAlias(db *sql.DB, skillID int, alias string) error {
+	result, err := db.Exec(`DELETE FROM skill_aliases WHERE skill_id = ? AND alias = ?`, skillID, alias)
+	if err != nil {
+		return err
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// GetUserSkills returns the skills on a user's profile, strongest first
+func GetUserSkills(db *sql.DB, userID int) ([]UserSkill, error) {
+	rows, err := db.Query(`SELECT s.id, s.name, s.category, us.proficiency, us.years
+                           FROM user_skills us
+                           JOIN skills s ON s.id = us.skill_id
+                           WHERE us.user_id = ?
+                           ORDER BY us.years DESC, s.name`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	skills := []UserSkill{}
+	for rows.Next() {
+		var s UserSkill
+		if err := rows.Scan(&s.SkillID, &s.Name, &s.Category, &s.Proficiency, &s.Years); err != nil {
+			return nil, err
+		}
+		skills = append(skills, s)
+	}
+
+	return skills, rows.Err()
+}
+
+// SetUserSkills replaces the skills on a user's profile. Names are resolved
+// through aliases; names the taxonomy doesn't know yet become unapproved
+// suggestions under "other" for admins to curate, and suggestions nobody
+// lists any more are dropped. Listing the same skill twice keeps the last.
+func SetUserSkills(db *sql.DB, userID int, inputs []UserSkillInput) error {
+	if len(inputs) > MaxUserSkills {
+		return ErrTooManySkills
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+
+	if _, err := tx.Exec(`DELETE FROM user_skills WHERE user_id = ?`, userID); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	for _, input := range inputs {
+		skillID, err := resolveSkillID(tx, input.Name)
+		if err == sql.ErrNoRows {
+			var result sql.Result
+			result, err = tx.Exec(`INSERT INTO skills (name, category, approved) VALUES (?, 'other', 0)`, input.Name)
+			if err == nil {
+				var id int64
+				id, err = result.LastInsertId()
+				skillID = int(id)
+			}
+		}
+		if err != nil {
+			tx.Rollback()
+			return err
+		}
+
+		_, err = tx.Exec(`INSERT OR REPLACE INTO user_skills (user_id, skill_id, proficiency, years) VALUES (?, ?, ?, ?)`,
+			userID, skillID, input.Proficiency, input.Years)
+		if err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+
+	for _, query := range []string{
+		`DELETE FROM skill_aliases WHERE skill_id IN
+         (SELECT id FROM skills WHERE approved = 0 AND id NOT IN (SELECT skill_id FROM user_skills))`,
+		`DELETE FROM skills WHERE approved = 0 AND id NOT IN (SELECT skill_id FROM user_skills)`,
+	} {
+		if _, err := tx.Exec(query); err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
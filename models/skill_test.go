@@ -0,0 +1,101 @@
+package models
+
+import (
+	"testing"
+
+	"vibecoders/internal/testdb"
+)
+
+func TestUnknownSkillsStayOutOfTheTaxonomy(t *testing.T) {
+	db := testdb.New(t)
+	userID := createTestUser(t, db, "alice")
+
+	err := SetUserSkills(db, userID, []UserSkillInput{
+		{Name: "golang", Proficiency: "expert"},
+		{Name: "Zig", Proficiency: "beginner"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The profile keeps both, resolving the alias
+	skills, err := GetUserSkills(db, userID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(skills) != 2 {
+		t.Fatalf("profile has %d skills, want 2", len(skills))
+	}
+
+	suggested, err := SuggestSkills(db, "Zi", 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(suggested) != 0 {
+		t.Errorf("autocomplete offers %v, want nothing before approval", suggested)
+	}
+
+	pending, err := GetSkillSuggestions(db, 1, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pending) != 1 || pending[0].Name != "Zig" || pending[0].Approved {
+		t.Fatalf("suggestions = %+v, want just Zig", pending)
+	}
+
+	total, err := GetSkillCount(db, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	taxonomy, err := GetSkills(db, "", 1, 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(taxonomy) != total {
+		t.Errorf("GetSkills returned %d skills, GetSkillCount says %d", len(taxonomy), total)
+	}
+	for _, s := range taxonomy {
+		if s.Name == "Zig" {
+			t.Error("the taxonomy lists an unapproved suggestion")
+		}
+		if s.Name == "Go" && (len(s.Aliases) != 1 || s.Aliases[0] != "golang") {
+			t.Errorf("Go has aliases %v, want [golang]", s.Aliases)
+		}
+	}
+
+	// Once nobody lists a suggestion it is dropped
+	if err := SetUserSkills(db, userID, []UserSkillInput{{Name: "Go", Proficiency: "expert"}}); err != nil {
+		t.Fatal(err)
+	}
+	if n := count(t, db, `SELECT COUNT(*) FROM skills WHERE name = 'Zig'`); n != 0 {
+		t.Error("the unused suggestion was kept")
+	}
+}
+
+func TestApproveSkill(t *testing.T) {
+	db := testdb.New(t)
+	userID := createTestUser(t, db, "alice")
+
+	if err := SetUserSkills(db, userID, []UserSkillInput{{Name: "Zig", Proficiency: "beginner"}}); err != nil {
+		t.Fatal(err)
+	}
+	skills, err := GetUserSkills(db, userID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := ApproveSkill(db, skills[0].SkillID, "language"); err != nil {
+		t.Fatal(err)
+	}
+	if err := ApproveSkill(db, skills[0].SkillID, "language"); err == nil {
+		t.Error("approving twice succeeded")
+	}
+
+	suggested, err := SuggestSkills(db, "Zi", 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(suggested) != 1 || suggested[0].Category != "language" {
+		t.Errorf("autocomplete = %+v, want Zig as a language", suggested)
+	}
+}
@@ -0,0 +1,23 @@
+package models
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+)
+
+// newSecretToken returns 32 random bytes as hex, for tokens that are handed to
+// the user once and stored only as a hash
+func newSecretToken() (string, error) {
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(secret), nil
+}
+
+// hashToken returns the SHA-256 hex digest under which a secret token is stored
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,346 @@
+package models
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/subtle"
+	"database/sql"
+	"encoding/base32"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// TOTP parameters follow the RFC 6238 defaults that authenticator apps expect
+const (
+	totpPeriod = 30
+	totpDigits = 6
+
+	// totpSkew accepts codes from one step either side of now to allow for
+	// clock drift between the server and the user's device
+	totpSkew = 1
+
+	// RecoveryCodeCount is how many recovery codes are issued at a time
+	RecoveryCodeCount = 10
+)
+
+var (
+	// ErrTwoFactorEnabled is returned when enrolling an account that already has 2FA
+	ErrTwoFactorEnabled = errors.New("two-factor authentication is already enabled")
+
+	// ErrTwoFactorNotEnabled is returned for 2FA operations on accounts without it
+	ErrTwoFactorNotEnabled = errors.New("two-factor authentication is not enabled")
+
+	// ErrInvalidTwoFactorCode is returned when a TOTP or recovery code does not match
+	ErrInvalidTwoFactorCode = errors.New("invalid two-factor code")
+)
+
+var totpEncoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// TwoFactorStatus describes a user's 2FA enrollment
+type TwoFactorStatus struct {
+	Enabled                bool       `json:"enabled"`
+	EnabledAt              *time.Time `json:"enabled_at"`
+	RecoveryCodesRemaining int        `json:"recovery_codes_remaining"`
+}
+
+// totpCode computes the code for a secret at a time step
+func totpCode(key []byte, step int64) string {
+	var msg [8]byte
+	binary.BigEndian.PutUint64(msg[:], uint64(step))
+
+	mac := hmac.New(sha1.New, key)
+	mac.Write(msg[:])
+	sum := mac.Sum(nil)
+
+	// Dynamic truncation, RFC 4226 section 5.3
+	offset := sum[len(sum)-1] & 0x0f
+	value := binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7fffffff
+
+	return fmt.Sprintf("%0*d", totpDigits, value%1000000)
+}
+
+// matchTOTP returns the time step a code is valid for, checking the steps
+// around now. ok is false if the code matches none of them.
+func matchTOTP(secret, code string, now time.Time) (step int64, ok bool) {
+	key, err := totpEncoding.DecodeString(secret)
+	if err != nil || len(code) != totpDigits {
+		return 0, false
+	}
+
+	current := now.Unix() / totpPeriod
+	for s := current - totpSkew; s <= current+totpSkew; s++ {
+		if subtle.ConstantTimeCompare([]byte(totpCode(key, s)), []byte(code)) == 1 {
+			return s, true
+		}
+	}
+	return 0, false
+}
+
+// TOTPURI builds the otpauth:// URI that authenticator apps scan as a QR code
+func TOTPURI(issuer, account, secret string) string {
+	params := url.Values{}
+	params.Set("secret", secret)
+	params.Set("issuer", issuer)
+	params.Set("algorithm", "SHA1")
+	params.Set("digits", fmt.Sprint(totpDigits))
+	params.Set("period", fmt.Sprint(totpPeriod))
+
+	label := url.PathEscape(issuer + ":" + account)
+	return "otpauth://totp/" + label + "?" + params.Encode()
+}
+
+// normalizeTwoFactorCode strips the spaces and dashes people type into codes
+func normalizeTwoFactorCode(code string) string {
+	code = strings.ToLower(strings.TrimSpace(code))
+	code = strings.ReplaceAll(code, " ", "")
+	return strings.ReplaceAll(code, "-", "")
+}
+
+// IsTwoFactorEnabled reports whether the user has completed TOTP enrollment
+func IsTwoFactorEnabled(db *sql.DB, userID int) (bool, error) {
+	var enabledAt sql.NullTime
+	err := db.QueryRow(`SELECT totp_enabled_at FROM users WHERE id = ?`, userID).Scan(&enabledAt)
+	if err != nil {
+		return false, err
+	}
+
+	return enabledAt.Valid, nil
+}
+
+// GetTwoFactorStatus returns the user's 2FA state and remaining recovery codes
+func GetTwoFactorStatus(db *sql.DB, userID int) (*TwoFactorStatus, error) {
+	var enabledAt sql.NullTime
+	err := db.QueryRow(`SELECT totp_enabled_at FROM users WHERE id = ?`, userID).Scan(&enabledAt)
+	if err != nil {
+		return nil, err
+	}
+
+	status := &TwoFactorStatus{Enabled: enabledAt.Valid}
+	if enabledAt.Valid {
+		status.EnabledAt = &enabledAt.Time
+	}
+
+	query := `SELECT COUNT(*) FROM recovery_codes WHERE user_id = ? AND used_at IS NULL`
+	if err := db.QueryRow(query, userID).Scan(&status.RecoveryCodesRemaining); err != nil {
+		return nil, err
+	}
+
+	return status, nil
+}
+
+// BeginTOTPEnrollment generates a new secret for the user. 2FA is not turned
+// on until ConfirmTOTPEnrollment succeeds with a code from that secret.
+func BeginTOTPEnrollment(db *sql.DB, userID int) (string, error) {
+	enabled, err := IsTwoFactorEnabled(db, userID)
+	if err != nil {
+		return "", err
+	}
+	if enabled {
+		return "", ErrTwoFactorEnabled
+	}
+
+	key := make([]byte, 20)
+	if _, err := rand.Read(key); err != nil {
+		return "", err
+	}
+	secret := totpEncoding.EncodeToString(key)
+
+	_, err = db.Exec(`UPDATE users SET totp_secret = ?, totp_last_step = NULL WHERE id = ?`, secret, userID)
+	if err != nil {
+		return "", err
+	}
+
+	return secret, nil
+}
+
+// ConfirmTOTPEnrollment turns on 2FA once the user proves their authenticator
+// produces valid codes, and returns a fresh set of recovery codes
+func ConfirmTOTPEnrollment(db *sql.DB, userID int, code string) ([]string, error) {
+	var secret sql.NullString
+	var enabledAt sql.NullTime
+	query := `SELECT totp_secret, totp_enabled_at FROM users WHERE id = ?`
+	if err := db.QueryRow(query, userID).Scan(&secret, &enabledAt); err != nil {
+		return nil, err
+	}
+
+	if enabledAt.Valid {
+		return nil, ErrTwoFactorEnabled
+	}
+	if !secret.Valid {
+		return nil, ErrTwoFactorNotEnabled
+	}
+
+	step, ok := matchTOTP(secret.String, normalizeTwoFactorCode(code), time.Now())
+	if !ok {
+		return nil, ErrInvalidTwoFactorCode
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = tx.Exec(`UPDATE users SET totp_enabled_at = ?, totp_last_step = ? WHERE id = ?`, time.Now().UTC(), step, userID)
+	if err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+
+	codes, err := replaceRecoveryCodes(tx, userID)
+	if err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	return codes, nil
+}
+
+// VerifyTwoFactorCode checks a TOTP code or an unused recovery code for a user
+// with 2FA enabled. TOTP codes are accepted once per time step and recovery
+// codes are consumed.
+func VerifyTwoFactorCode(db *sql.DB, userID int, code string) error {
+	var secret sql.NullString
+	var enabledAt sql.NullTime
+	var lastStep sql.NullInt64
+	query := `SELECT totp_secret, totp_enabled_at, totp_last_step FROM users WHERE id = ?`
+	if err := db.QueryRow(query, userID).Scan(&secret, &enabledAt, &lastStep); err != nil {
+		return err
+	}
+
+	if !enabledAt.Valid || !secret.Valid {
+		return ErrTwoFactorNotEnabled
+	}
+
+	code = normalizeTwoFactorCode(code)
+	if len(code) != totpDigits {
+		return consumeRecoveryCode(db, userID, code)
+	}
+
+	step, ok := matchTOTP(secret.String, code, time.Now())
+	if !ok || (lastStep.Valid && step <= lastStep.Int64) {
+		return ErrInvalidTwoFactorCode
+	}
+
+	// Conditional update so two concurrent logins cannot both use one code
+	result, err := db.Exec(`UPDATE users SET totp_last_step = ?
+                            WHERE id = ? AND (totp_last_step IS NULL OR totp_last_step < ?)`, step, userID, step)
+	if err != nil {
+		return err
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return ErrInvalidTwoFactorCode
+	}
+
+	return nil
+}
+
+// DisableTwoFactor turns off 2FA and discards the secret and recovery codes
+func DisableTwoFactor(db *sql.DB, userID int) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+
+	query := `UPDATE users SET totp_secret = NULL, totp_enabled_at = NULL, totp_last_step = NULL WHERE id = ?`
+	if _, err := tx.Exec(query, userID); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	if _, err := tx.Exec(`DELETE FROM recovery_codes WHERE user_id = ?`, userID); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// RegenerateRecoveryCodes replaces all of the user's recovery codes
+func RegenerateRecoveryCodes(db *sql.DB, userID int) ([]string, error) {
+	enabled, err := IsTwoFactorEnabled(db, userID)
+	if err != nil {
+		return nil, err
+	}
+	if !enabled {
+		return nil, ErrTwoFactorNotEnabled
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return nil, err
+	}
+
+	codes, err := replaceRecoveryCodes(tx, userID)
+	if err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	return codes, nil
+}
+
+// replaceRecoveryCodes deletes the user's recovery codes and issues new ones,
+// returned formatted like "a1b2c-3d4e5"
+func replaceRecoveryCodes(tx *sql.Tx, userID int) ([]string, error) {
+	if _, err := tx.Exec(`DELETE FROM recovery_codes WHERE user_id = ?`, userID); err != nil {
+		return nil, err
+	}
+
+	now := time.Now().UTC()
+	codes := make([]string, 0, RecoveryCodeCount)
+	for i := 0; i < RecoveryCodeCount; i++ {
+		raw := make([]byte, 5)
+		if _, err := rand.Read(raw); err != nil {
+			return nil, err
+		}
+		code := hex.EncodeToString(raw)
+
+		query := `INSERT INTO recovery_codes (user_id, code_hash, created_at) VALUES (?, ?, ?)`
+		if _, err := tx.Exec(query, userID, hashToken(code), now); err != nil {
+			return nil, err
+		}
+
+		codes = append(codes, code[:5]+"-"+code[5:])
+	}
+
+	return codes, nil
+}
+
+// consumeRecoveryCode marks a matching unused recovery code as used
+func consumeRecoveryCode(db *sql.DB, userID int, code string) error {
+	query := `UPDATE recovery_codes SET used_at = ?
+              WHERE user_id = ? AND code_hash = ? AND used_at IS NULL`
+	result, err := db.Exec(query, time.Now().UTC(), userID, hashToken(code))
+	if err != nil {
+		return err
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return ErrInvalidTwoFactorCode
+	}
+
+	return nil
+}
@@ -2,6 +2,7 @@ package models
 
 import (
 	"database/sql"
+	"regexp"
 	"time"
 )
 
@@ -16,59 +17,26 @@ type User struct {
 	Password    string    `json:"-"` // Don't include password in JSON responses
 	CreatedAt   time.Time `json:"created_at"`
 	IsAdmin     bool      `json:"is_admin"`
-}
-
-func GetTopUsers(db *sql.DB, limit int) ([]User, error) {
-	query := `SELECT id, username, fullname, bio, linked_in_url, github_url, photo_url, created_at, is_admin 
-              FROM users 
-              ORDER BY id 
-              LIMIT ?`
-	
-	rows, err := db.Query(query, limit)
-	if err != nil {
-		return nil, err
-	}
-	defer rows.Close()
-
-	var users []User
-	for rows.Next() {
-		var u User
-		var bio, linkedIn, github, fullname sql.NullString
-		
-		err := rows.Scan(&u.ID, &u.Username, &fullname, &bio, &linkedIn, &github, &u.PhotoURL, &u.CreatedAt, &u.IsAdmin)
-		if err != nil {
-			return nil, err
-		}
-		
-		if bio.Valid {
-			u.Bio = bio.String
-		}
-		if linkedIn.Valid {
-			u.LinkedInURL = linkedIn.String
-		}
-		if github.Valid {
-			u.GithubURL = github.String
-		}
-		if fullname.Valid {
-			u.Fullname = fullname.String
-		}
-		
-		users = append(users, u)
-	}
-
-	return users, nil
+	// Email is private: only returned to the user themselves and admins
+	Email         string `json:"email,omitempty"`
+	EmailVerified bool   `json:"email_verified,omitempty"`
+	// DeletedAt is only set on users awaiting purge, as listed for admins
+	DeletedAt *time.Time `json:"deleted_at,omitempty"`
 }
 
 func GetUserByUsername(db *sql.DB, username string) (*User, error) {
-	query := `SELECT id, username, fullname, bio, linked_in_url, github_url, photo_url, password, created_at, is_admin 
+	query := `SELECT id, username, fullname, bio, linked_in_url, github_url, photo_url, password, created_at, ` + isAdminColumn("users") + `,
+                  email, email_verified_at
               FROM users 
-              WHERE username = ?`
+              WHERE username = ? AND deleted_at IS NULL`
 	
 	var u User
-	var bio, linkedIn, github, fullname sql.NullString
+	var bio, linkedIn, github, fullname, email sql.NullString
+	var emailVerifiedAt sql.NullTime
 	
 	err := db.QueryRow(query, username).Scan(
 		&u.ID, &u.Username, &fullname, &bio, &linkedIn, &github, &u.PhotoURL, &u.Password, &u.CreatedAt, &u.IsAdmin,
+		&email, &emailVerifiedAt,
 	)
 	if err != nil {
 		return nil, err
@@ -86,20 +54,25 @@ func GetUserByUsername(db *sql.DB, username string) (*User, error) {
 	if fullname.Valid {
 		u.Fullname = fullname.String
 	}
+	u.Email = email.String
+	u.EmailVerified = email.Valid && emailVerifiedAt.Valid
 	
 	return &u, nil
 }
 
 func GetUserByID(db *sql.DB, id int) (*User, error) {
-	query := `SELECT id, username, fullname, bio, linked_in_url, github_url, photo_url, created_at, is_admin 
+	query := `SELECT id, username, fullname, bio, linked_in_url, github_url, photo_url, created_at, ` + isAdminColumn("users") + `,
+                  email, email_verified_at
               FROM users 
-              WHERE id = ?`
+              WHERE id = ? AND deleted_at IS NULL`
 	
 	var u User
-	var bio, linkedIn, github, fullname sql.NullString
+	var bio, linkedIn, github, fullname, email sql.NullString
+	var emailVerifiedAt sql.NullTime
 	
 	err := db.QueryRow(query, id).Scan(
 		&u.ID, &u.Username, &fullname, &bio, &linkedIn, &github, &u.PhotoURL, &u.CreatedAt, &u.IsAdmin,
+		&email, &emailVerifiedAt,
 	)
 	if err != nil {
 		return nil, err
@@ -117,16 +90,33 @@ func GetUserByID(db *sql.DB, id int) (*User, error) {
 	if fullname.Valid {
 		u.Fullname = fullname.String
 	}
+	u.Email = email.String
+	u.EmailVerified = email.Valid && emailVerifiedAt.Valid
 	
 	return &u, nil
 }
 
+// CreateUser inserts a new user, storing a hash of the given plaintext password
 func CreateUser(db *sql.DB, username, password, fullname, bio, linkedIn, github, photoURL string) error {
+	hash, err := HashPassword(password)
+	if err != nil {
+		return err
+	}
+
 	query := `INSERT INTO users (username, password, fullname, bio, linked_in_url, github_url, photo_url) 
               VALUES (?, ?, ?, ?, ?, ?, ?)`
 	
-	_, err := db.Exec(query, username, password, fullname, bio, linkedIn, github, photoURL)
-	return err
+	result, err := db.Exec(query, username, hash, fullname, bio, linkedIn, github, photoURL)
+	if err != nil {
+		return err
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return err
+	}
+
+	return assignDefaultRole(db, id)
 }
 
 func UpdateUser(db *sql.DB, id int, fullname, bio, linkedIn, github, photoURL string) error {
@@ -142,8 +132,10 @@ func UpdateUser(db *sql.DB, id int, fullname, bio, linkedIn, github, photoURL st
 func GetAllUsers(db *sql.DB, page, pageSize int) ([]User, error) {
 	offset := (page - 1) * pageSize
 	
-	query := `SELECT id, username, fullname, bio, linked_in_url, github_url, photo_url, created_at, is_admin 
+	query := `SELECT id, username, fullname, bio, linked_in_url, github_url, photo_url, created_at, ` + isAdminColumn("users") + `,
+                  email, email_verified_at
               FROM users 
+              WHERE deleted_at IS NULL
               ORDER BY created_at DESC 
               LIMIT ? OFFSET ?`
 	
@@ -156,9 +148,11 @@ func GetAllUsers(db *sql.DB, page, pageSize int) ([]User, error) {
 	var users []User
 	for rows.Next() {
 		var u User
-		var bio, linkedIn, github, fullname sql.NullString
+		var bio, linkedIn, github, fullname, email sql.NullString
+		var emailVerifiedAt sql.NullTime
 		
-		err := rows.Scan(&u.ID, &u.Username, &fullname, &bio, &linkedIn, &github, &u.PhotoURL, &u.CreatedAt, &u.IsAdmin)
+		err := rows.Scan(&u.ID, &u.Username, &fullname, &bio, &linkedIn, &github, &u.PhotoURL, &u.CreatedAt, &u.IsAdmin,
+			&email, &emailVerifiedAt)
 		if err != nil {
 			return nil, err
 		}
@@ -175,6 +169,8 @@ func GetAllUsers(db *sql.DB, page, pageSize int) ([]User, error) {
 		if fullname.Valid {
 			u.Fullname = fullname.String
 		}
+		u.Email = email.String
+		u.EmailVerified = email.Valid && emailVerifiedAt.Valid
 		
 		users = append(users, u)
 	}
@@ -182,9 +178,9 @@ func GetAllUsers(db *sql.DB, page, pageSize int) ([]User, error) {
 	return users, nil
 }
 
-// GetTotalUserCount returns the total number of users in the database
+// GetTotalUserCount returns the total number of users that are not deleted
 func GetTotalUserCount(db *sql.DB) (int, error) {
-	query := `SELECT COUNT(*) FROM users`
+	query := `SELECT COUNT(*) FROM users WHERE deleted_at IS NULL`
 	
 	var count int
 	err := db.QueryRow(query).Scan(&count)
@@ -195,27 +191,34 @@ func GetTotalUserCount(db *sql.DB) (int, error) {
 	return count, nil
 }
 
-// UpdateUserAdmin allows an admin to update all fields of a user, including admin status
-func UpdateUserAdmin(db *sql.DB, id int, username, fullname, bio, linkedIn, github, photoURL string, isAdmin bool) error {
+// UpdateUserAdmin allows an admin to update all profile fields of a user.
+// Admin status is a role; see GrantRole and RevokeRole.
+func UpdateUserAdmin(db *sql.DB, id int, username, fullname, bio, linkedIn, github, photoURL string) error {
 	query := `UPDATE users 
-              SET username = ?, fullname = ?, bio = ?, linked_in_url = ?, github_url = ?, photo_url = ?, is_admin = ?
+              SET username = ?, fullname = ?, bio = ?, linked_in_url = ?, github_url = ?, photo_url = ?
               WHERE id = ?`
 	
-	_, err := db.Exec(query, username, fullname, bio, linkedIn, github, photoURL, isAdmin, id)
+	_, err := db.Exec(query, username, fullname, bio, linkedIn, github, photoURL, id)
 	return err
 }
 
-// DeleteUser deletes a user from the database
-func DeleteUser(db *sql.DB, id int) error {
-	// First delete any sessions for this user
-	sessionQuery := `DELETE FROM sessions WHERE user_id = ?`
-	_, err := db.Exec(sessionQuery, id)
+var usernamePattern = regexp.MustCompile(`^[A-Za-z0-9_-]{2,39}$`)
+
+// ValidUsername reports whether a username is 2 to 39 letters, digits,
+// hyphens or underscores. Usernames end up in URLs and email subjects.
+func ValidUsername(username string) bool {
+	return usernamePattern.MatchString(username)
+}
+
+// UsernameInUse reports whether an account other than exceptUserID has the
+// username. Deleted accounts keep their username until they are purged.
+func UsernameInUse(db *sql.DB, username string, exceptUserID int) (bool, error) {
+	var count int
+	query := `SELECT COUNT(*) FROM users WHERE username = ? AND id != ?`
+	err := db.QueryRow(query, username, exceptUserID).Scan(&count)
 	if err != nil {
-		return err
+		return false, err
 	}
-	
-	// Then delete the user
-	userQuery := `DELETE FROM users WHERE id = ?`
-	_, err = db.Exec(userQuery, id)
-	return err
-}
\ No newline at end of file
+
+	return count > 0, nil
+}
@@ -0,0 +1,75 @@
+package models
+
+import (
+	"database/sql"
+	"time"
+)
+
+// BlockedUser is an entry on a user's block list
+type BlockedUser struct {
+	ID        int       `json:"id"`
+	Username  string    `json:"username"`
+	Fullname  string    `json:"fullname"`
+	PhotoURL  string    `json:"photo_url"`
+	BlockedAt time.Time `json:"blocked_at"`
+}
+
+// BlockUser stops blockedID from messaging or contacting blockerID. Blocking
+// someone twice is a no-op.
+func BlockUser(db *sql.DB, blockerID, blockedID int) error {
+	_, err := db.Exec(`INSERT OR IGNORE INTO user_blocks (blocker_id, blocked_id, created_at) VALUES (?, ?, ?)`,
+		blockerID, blockedID, time.Now().UTC())
+	return err
+}
+
+// UnblockUser lifts a block. Returns sql.ErrNoRows if there was none.
+func UnblockUser(db *sql.DB, blockerID, blockedID int) error {
+	result, err := db.Exec(`DELETE FROM user_blocks WHERE blocker_id = ? AND blocked_id = ?`, blockerID, blockedID)
+	if err != nil {
+		return err
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// IsBlockedBetween reports whether either user has blocked the other
+func IsBlockedBetween(db *sql.DB, a, b int) (bool, error) {
+	var blocked bool
+	err := db.QueryRow(`SELECT EXISTS (SELECT 1 FROM user_blocks
+                        WHERE (blocker_id = ? AND blocked_id = ?) OR (blocker_id = ? AND blocked_id = ?))`,
+		a, b, b, a).Scan(&blocked)
+	return blocked, err
+}
+
+// GetBlockedUsers returns everyone a user has blocked, most recent first
+func GetBlockedUsers(db *sql.DB, userID int) ([]BlockedUser, error) {
+	rows, err := db.Query(`SELECT u.id, u.username, u.fullname, u.photo_url, b.created_at
+                           FROM user_blocks b JOIN users u ON u.id = b.blocked_id
+                           WHERE b.blocker_id = ? AND u.deleted_at IS NULL
+                           ORDER BY b.created_at DESC`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	users := []BlockedUser{}
+	for rows.Next() {
+		var u BlockedUser
+		var fullname, photo sql.NullString
+		if err := rows.Scan(&u.ID, &u.Username, &fullname, &photo, &u.BlockedAt); err != nil {
+			return nil, err
+		}
+		u.Fullname = fullname.String
+		u.PhotoURL = photo.String
+		users = append(users, u)
+	}
+
+	return users, rows.Err()
+}
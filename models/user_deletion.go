@@ -0,0 +1,313 @@
+package models
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"time"
+)
+
+const (
+	// UserDeletionGracePeriod is how long a deleted user can be restored
+	// before the purge job removes the account and everything it owns
+	UserDeletionGracePeriod = 30 * 24 * time.Hour
+
+	// DeletedUserPlaceholder owns forum content that was anonymized when its
+	// author deleted their account
+	DeletedUserPlaceholder = "[deleted]"
+)
+
+// SoftDeleteUser marks a user deleted, signs them out everywhere and revokes
+// their magic links. With anonymizeForum their forum posts and comments are
+// handed to the deleted user placeholder when the account is purged instead
+// of being removed. It returns when the account will be purged, or
+// sql.ErrNoRows if the user does not exist or is already deleted.
+func SoftDeleteUser(db *sql.DB, id int, anonymizeForum bool) (time.Time, error) {
+	now := time.Now().UTC()
+
+	tx, err := db.Begin()
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	query := `UPDATE users SET deleted_at = ?, anonymize_forum_on_purge = ? WHERE id = ? AND deleted_at IS NULL`
+	result, err := tx.Exec(query, now, anonymizeForum, id)
+	if err != nil {
+		tx.Rollback()
+		return time.Time{}, err
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		tx.Rollback()
+		return time.Time{}, err
+	}
+	if affected == 0 {
+		tx.Rollback()
+		return time.Time{}, sql.ErrNoRows
+	}
+
+	if _, err := tx.Exec(`DELETE FROM sessions WHERE user_id = ?`, id); err != nil {
+		tx.Rollback()
+		return time.Time{}, err
+	}
+
+	query = `UPDATE magic_links SET revoked_at = ? WHERE user_id = ? AND revoked_at IS NULL`
+	if _, err := tx.Exec(query, now, id); err != nil {
+		tx.Rollback()
+		return time.Time{}, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return time.Time{}, err
+	}
+
+	return now.Add(UserDeletionGracePeriod), nil
+}
+
+// anonymizeForumContent hands a user's forum posts and comments to the
+// deleted user placeholder so threads stay intact after the account is gone.
+// Their votes stay with them and are removed with the rest of the account.
+func anonymizeForumContent(tx *sql.Tx, userID int) error {
+	var placeholderID int
+	err := tx.QueryRow(`SELECT id FROM users WHERE username = ?`, DeletedUserPlaceholder).Scan(&placeholderID)
+	if err != nil {
+		return err
+	}
+
+	for _, query := range []string{
+		`UPDATE forum_posts SET user_id = ? WHERE user_id = ?`,
+		`UPDATE forum_comments SET user_id = ? WHERE user_id = ?`,
+	} {
+		if _, err := tx.Exec(query, placeholderID, userID); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// RestoreUser undoes a soft delete that is still within the grace period.
+// It returns sql.ErrNoRows if there is no such deleted user.
+func RestoreUser(db *sql.DB, id int) error {
+	cutoff := time.Now().UTC().Add(-UserDeletionGracePeriod)
+
+	query := `UPDATE users SET deleted_at = NULL, anonymize_forum_on_purge = 0
+              WHERE id = ? AND deleted_at IS NOT NULL AND deleted_at > ?`
+	result, err := db.Exec(query, id, cutoff)
+	if err != nil {
+		return err
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return sql.ErrNoRows
+	}
+
+	return nil
+}
+
+// GetDeletedUsers returns a page of users awaiting purge, most recently
+// deleted first
+func GetDeletedUsers(db *sql.DB, page, pageSize int) ([]User, error) {
+	query := `SELECT id, username, COALESCE(fullname, ''), COALESCE(email, ''), created_at, deleted_at
+              FROM users
+              WHERE deleted_at IS NOT NULL
+              ORDER BY deleted_at DESC
+              LIMIT ? OFFSET ?`
+
+	rows, err := db.Query(query, pageSize, (page-1)*pageSize)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	users := []User{}
+	for rows.Next() {
+		var u User
+		var deletedAt time.Time
+		if err := rows.Scan(&u.ID, &u.Username, &u.Fullname, &u.Email, &u.CreatedAt, &deletedAt); err != nil {
+			return nil, err
+		}
+		u.DeletedAt = &deletedAt
+		users = append(users, u)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return users, nil
+}
+
+// GetDeletedUserCount returns how many users are awaiting purge
+func GetDeletedUserCount(db *sql.DB) (int, error) {
+	var count int
+	err := db.QueryRow(`SELECT COUNT(*) FROM users WHERE deleted_at IS NOT NULL`).Scan(&count)
+	return count, err
+}
+
+// GetDeletedUserByID returns a soft-deleted user, or sql.ErrNoRows
+func GetDeletedUserByID(db *sql.DB, id int) (*User, error) {
+	query := `SELECT id, username, COALESCE(fullname, ''), COALESCE(email, ''), created_at, deleted_at
+              FROM users
+              WHERE id = ? AND deleted_at IS NOT NULL`
+
+	var u User
+	var deletedAt time.Time
+	err := db.QueryRow(query, id).Scan(&u.ID, &u.Username, &u.Fullname, &u.Email, &u.CreatedAt, &deletedAt)
+	if err != nil {
+		return nil, err
+	}
+	u.DeletedAt = &deletedAt
+
+	return &u, nil
+}
+
+// userContentDeletes removes everything a user owns, in dependency order.
+// Every statement takes the user ID as its only argument. Forum scores are
+// corrected for the user's votes before the votes go away.
+var userContentDeletes = []string{
+	`UPDATE forum_posts SET score = score - 1
+     WHERE id IN (SELECT post_id FROM forum_votes WHERE user_id = ?)`,
+	`DELETE FROM forum_votes WHERE post_id IN (SELECT id FROM forum_posts WHERE user_id = ?)`,
+	`DELETE FROM forum_comments WHERE post_id IN (SELECT id FROM forum_posts WHERE user_id = ?)`,
+	`DELETE FROM forum_votes WHERE user_id = ?`,
+	`DELETE FROM forum_comments WHERE user_id = ?`,
+	`DELETE FROM forum_posts WHERE user_id = ?`,
+	`DELETE FROM prompts WHERE user_id = ?`,
+	`DELETE FROM projects WHERE user_id = ?`,
+	`DELETE FROM budget_transactions WHERE user_id = ?`,
+	`DELETE FROM budget_categories WHERE user_id = ?`,
+	`DELETE FROM magic_link_redemptions WHERE magic_link_id IN (SELECT id FROM magic_links WHERE user_id = ?)`,
+	`DELETE FROM magic_links WHERE user_id = ?`,
+	`DELETE FROM personal_access_tokens WHERE user_id = ?`,
+	`DELETE FROM sessions WHERE user_id = ?`,
+	`DELETE FROM password_reset_tokens WHERE user_id = ?`,
+	`DELETE FROM email_verification_tokens WHERE user_id = ?`,
+	`DELETE FROM recovery_codes WHERE user_id = ?`,
+	`DELETE FROM login_challenges WHERE user_id = ?`,
+	`DELETE FROM user_identities WHERE user_id = ?`,
+	`DELETE FROM oauth_states WHERE link_user_id = ?`,
+	`DELETE FROM user_roles WHERE user_id = ?`,
+	`DELETE FROM data_exports WHERE user_id = ?`,
+	`DELETE FROM user_reputation WHERE user_id = ?`,
+	`DELETE FROM user_skills WHERE user_id = ?`,
+	`DELETE FROM user_availability WHERE user_id = ?`,
+	`DELETE FROM contact_requests WHERE ? IN (sender_id, recipient_id)`,
+	`DELETE FROM messages WHERE conversation_id IN (SELECT conversation_id FROM conversation_participants WHERE user_id = ?)`,
+	`DELETE FROM conversations WHERE id IN (SELECT conversation_id FROM conversation_participants WHERE user_id = ?)`,
+	`DELETE FROM conversation_participants WHERE conversation_id IN
+     (SELECT conversation_id FROM conversation_participants WHERE user_id = ?)`,
+	`DELETE FROM user_blocks WHERE ? IN (blocker_id, blocked_id)`,
+}
+
+// PurgeUser permanently removes a user and all of their content in a single
+// transaction, first anonymizing their forum content if they asked for it at
+// deletion. The audit log keeps its entries about them.
+func PurgeUser(db *sql.DB, id int) error {
+	var username string
+	var anonymizeForum bool
+	query := `SELECT username, anonymize_forum_on_purge FROM users WHERE id = ?`
+	if err := db.QueryRow(query, id).Scan(&username, &anonymizeForum); err != nil {
+		return err
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+
+	if anonymizeForum {
+		if err := anonymizeForumContent(tx, id); err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+
+	for _, query := range userContentDeletes {
+		if _, err := tx.Exec(query, id); err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+
+	if _, err := tx.Exec(`DELETE FROM login_throttles WHERE key = ?`, UsernameThrottleKey(username)); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	if _, err := tx.Exec(`DELETE FROM users WHERE id = ?`, id); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// PurgeDeletedUsers purges every user whose grace period has passed and
+// returns how many were removed. A failure on one user does not stop the rest.
+func PurgeDeletedUsers(db *sql.DB) (int, error) {
+	cutoff := time.Now().UTC().Add(-UserDeletionGracePeriod)
+
+	ids, err := queryInts(db, `SELECT id FROM users WHERE deleted_at IS NOT NULL AND deleted_at <= ?`, cutoff)
+	if err != nil {
+		return 0, err
+	}
+
+	purged := 0
+	for _, id := range ids {
+		if err := PurgeUser(db, id); err != nil {
+			log.Printf("User purge: could not purge user %d: %v", id, err)
+			continue
+		}
+		purged++
+	}
+
+	if purged < len(ids) {
+		return purged, fmt.Errorf("%d of %d users could not be purged", len(ids)-purged, len(ids))
+	}
+
+	return purged, nil
+}
+
+// StartUserPurger purges users past their grace period in the background
+// every interval
+func StartUserPurger(db *sql.DB, interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for range ticker.C {
+			purged, err := PurgeDeletedUsers(db)
+			if err != nil {
+				log.Printf("User purge: %v", err)
+			}
+			if purged > 0 {
+				log.Printf("User purge removed %d deleted accounts", purged)
+			}
+		}
+	}()
+}
+
+func queryInts(db *sql.DB, query string, args ...interface{}) ([]int, error) {
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	values := []int{}
+	for rows.Next() {
+		var v int
+		if err := rows.Scan(&v); err != nil {
+			return nil, err
+		}
+		values = append(values, v)
+	}
+
+	return values, rows.Err()
+}
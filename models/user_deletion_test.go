@@ -0,0 +1,170 @@
+package models
+
+import (
+	"database/sql"
+	"testing"
+
+	"vibecoders/internal/testdb"
+)
+
+// createTestUser registers a user and returns their ID
+func createTestUser(t *testing.T, db *sql.DB, username string) int {
+	t.Helper()
+
+	if err := CreateUser(db, username, "password123", "", "", "", "", ""); err != nil {
+		t.Fatal(err)
+	}
+	user, err := GetUserByUsername(db, username)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return user.ID
+}
+
+// count runs a COUNT(*) query
+func count(t *testing.T, db *sql.DB, query string, args ...interface{}) int {
+	t.Helper()
+
+	var n int
+	if err := db.QueryRow(query, args...).Scan(&n); err != nil {
+		t.Fatal(err)
+	}
+	return n
+}
+
+// forumFixture gives alice a post, comments and votes on her own and bob's
+// posts, and bob a vote and a comment on alice's post
+type forumFixture struct {
+	alice, bob                      int
+	alicePost, bobPost              int
+	aliceComment, aliceCommentOnBob int
+	bobCommentOnAlice               int
+}
+
+func newForumFixture(t *testing.T, db *sql.DB) forumFixture {
+	t.Helper()
+
+	var f forumFixture
+	f.alice = createTestUser(t, db, "alice")
+	f.bob = createTestUser(t, db, "bob")
+
+	must := func(id int, err error) int {
+		t.Helper()
+		if err != nil {
+			t.Fatal(err)
+		}
+		return id
+	}
+	f.alicePost = must(CreateForumPost(db, f.alice, "Alice's post", "content", ""))
+	f.bobPost = must(CreateForumPost(db, f.bob, "Bob's post", "content", ""))
+	f.aliceComment = must(CreateForumComment(db, f.alicePost, f.alice, "own comment"))
+	f.aliceCommentOnBob = must(CreateForumComment(db, f.bobPost, f.alice, "comment on bob"))
+	f.bobCommentOnAlice = must(CreateForumComment(db, f.alicePost, f.bob, "comment on alice"))
+
+	for _, vote := range [][2]int{{f.alicePost, f.alice}, {f.bobPost, f.alice}, {f.alicePost, f.bob}} {
+		if err := VoteForumPost(db, vote[0], vote[1]); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := CreatePrompt(db, f.alice, "Prompt", "content", nil); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := CreateSession(db, f.alice, "127.0.0.1", "test"); err != nil {
+		t.Fatal(err)
+	}
+
+	return f
+}
+
+func TestPurgeUserAnonymizesForumContent(t *testing.T) {
+	db := testdb.New(t)
+	f := newForumFixture(t, db)
+
+	if _, err := SoftDeleteUser(db, f.alice, true); err != nil {
+		t.Fatal(err)
+	}
+
+	// Nothing is handed over until the purge
+	if n := count(t, db, `SELECT COUNT(*) FROM forum_posts WHERE user_id = ?`, f.alice); n != 1 {
+		t.Fatalf("alice owns %d posts before the purge, want 1", n)
+	}
+
+	if err := PurgeUser(db, f.alice); err != nil {
+		t.Fatal(err)
+	}
+
+	var placeholder int
+	if err := db.QueryRow(`SELECT id FROM users WHERE username = ?`, DeletedUserPlaceholder).Scan(&placeholder); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, c := range []struct {
+		table string
+		id    int
+	}{
+		{"forum_posts", f.alicePost},
+		{"forum_comments", f.aliceComment},
+		{"forum_comments", f.aliceCommentOnBob},
+	} {
+		var owner int
+		if err := db.QueryRow(`SELECT user_id FROM `+c.table+` WHERE id = ?`, c.id).Scan(&owner); err != nil {
+			t.Fatalf("%s %d: %v", c.table, c.id, err)
+		}
+		if owner != placeholder {
+			t.Errorf("%s %d belongs to user %d, want the placeholder %d", c.table, c.id, owner, placeholder)
+		}
+	}
+
+	// Bob's comment on the anonymized post stays his
+	if n := count(t, db, `SELECT COUNT(*) FROM forum_comments WHERE id = ? AND user_id = ?`, f.bobCommentOnAlice, f.bob); n != 1 {
+		t.Error("bob's comment on the anonymized post is gone")
+	}
+
+	// Alice's votes are removed and the scores corrected; bob's vote stays
+	for post, want := range map[int]int{f.alicePost: 1, f.bobPost: 0} {
+		var score int
+		if err := db.QueryRow(`SELECT score FROM forum_posts WHERE id = ?`, post).Scan(&score); err != nil {
+			t.Fatal(err)
+		}
+		if score != want {
+			t.Errorf("post %d has score %d, want %d", post, score, want)
+		}
+	}
+
+	for _, table := range []string{"forum_votes", "prompts", "sessions", "user_roles"} {
+		if n := count(t, db, `SELECT COUNT(*) FROM `+table+` WHERE user_id = ?`, f.alice); n != 0 {
+			t.Errorf("%d %s rows left for alice", n, table)
+		}
+	}
+	if n := count(t, db, `SELECT COUNT(*) FROM users WHERE id = ?`, f.alice); n != 0 {
+		t.Error("alice's user row is still there")
+	}
+}
+
+func TestRestoreUserCancelsForumAnonymization(t *testing.T) {
+	db := testdb.New(t)
+	f := newForumFixture(t, db)
+
+	if _, err := SoftDeleteUser(db, f.alice, true); err != nil {
+		t.Fatal(err)
+	}
+	if err := RestoreUser(db, f.alice); err != nil {
+		t.Fatal(err)
+	}
+
+	// Deleted again without anonymization, so the purge removes the content
+	if _, err := SoftDeleteUser(db, f.alice, false); err != nil {
+		t.Fatal(err)
+	}
+	if err := PurgeUser(db, f.alice); err != nil {
+		t.Fatal(err)
+	}
+
+	if n := count(t, db, `SELECT COUNT(*) FROM forum_posts WHERE id = ?`, f.alicePost); n != 0 {
+		t.Error("alice's post survived the purge")
+	}
+	if n := count(t, db, `SELECT COUNT(*) FROM forum_comments WHERE id IN (?, ?, ?)`,
+		f.aliceComment, f.aliceCommentOnBob, f.bobCommentOnAlice); n != 0 {
+		t.Errorf("%d comments by or on alice's post survived the purge", n)
+	}
+}
@@ -0,0 +1,145 @@
+package models
+
+import (
+	"database/sql"
+	"strings"
+	"unicode"
+)
+
+// UserSearch describes a directory search. Query is free text; every word
+// must match, as a prefix, in some indexed field.
+type UserSearch struct {
+	Query        string
+	HasGithub    bool
+	HasProjects  bool
+	Skills       []string // Skill names or aliases the user must list, all of them
+	Availability string   // Only users with this availability status
+}
+
+// SearchResult is a user matched by a directory search
+type SearchResult struct {
+	User
+	Reputation   int    `json:"reputation"`
+	Availability string `json:"availability,omitempty"`
+}
+
+// userSearchWeights are the bm25 weights of the users_fts columns, in order:
+// username, fullname, bio, skills, prompts, projects
+const userSearchWeights = "10.0, 8.0, 3.0, 6.0, 1.0, 2.0"
+
+// ftsMatchQuery turns free text into an FTS5 query. Words are reduced to
+// letters and digits and quoted, so user input can never be parsed as FTS5
+// syntax. Returns "" when nothing searchable is left.
+func ftsMatchQuery(text string) string {
+	var terms []string
+	for _, word := range strings.Fields(text) {
+		word = strings.Map(func(r rune) rune {
+			if unicode.IsLetter(r) || unicode.IsDigit(r) {
+				return unicode.ToLower(r)
+			}
+			return -1
+		}, word)
+		if word != "" {
+			terms = append(terms, `"`+word+`"*`)
+		}
+	}
+
+	return strings.Join(terms, " ")
+}
+
+// userSearchFrom returns the FROM and WHERE clauses shared by SearchUsers and
+// CountSearchUsers, and their arguments
+func userSearchFrom(search UserSearch) (string, []interface{}) {
+	from := ` FROM users u`
+	where := []string{"u.deleted_at IS NULL", "u.username != ?"}
+	args := []interface{}{DeletedUserPlaceholder}
+
+	if match := ftsMatchQuery(search.Query); match != "" {
+		from = ` FROM users_fts JOIN users u ON u.id = users_fts.rowid`
+		where = append(where, "users_fts MATCH ?")
+		args = append(args, match)
+	}
+	if search.HasGithub {
+		where = append(where, "COALESCE(u.github_url, '') != ''")
+	}
+	if search.HasProjects {
+		where = append(where, "EXISTS (SELECT 1 FROM projects WHERE user_id = u.id)")
+	}
+	if search.Availability != "" {
+		where = append(where, "EXISTS (SELECT 1 FROM user_availability WHERE user_id = u.id AND status = ?)")
+		args = append(args, search.Availability)
+	}
+	for _, skill := range search.Skills {
+		where = append(where, `EXISTS (SELECT 1 FROM user_skills us JOIN skills s ON s.id = us.skill_id
+                                       WHERE us.user_id = u.id
+                                         AND (s.name = ? OR s.id IN (SELECT skill_id FROM skill_aliases WHERE alias = ?)))`)
+		args = append(args, skill, skill)
+	}
+
+	return from + ` WHERE ` + strings.Join(where, " AND "), args
+}
+
+// SearchUsers returns one page of the developer directory. With a text query
+// results are ordered by relevance, otherwise (and on ties) by all-time
+// reputation.
+func SearchUsers(db *sql.DB, search UserSearch, page, pageSize int) ([]SearchResult, error) {
+	from, args := userSearchFrom(search)
+
+	orderBy := "reputation DESC, u.id"
+	if ftsMatchQuery(search.Query) != "" {
+		orderBy = "bm25(users_fts, " + userSearchWeights + "), " + orderBy
+	}
+
+	query := `SELECT u.id, u.username, u.fullname, u.bio, u.linked_in_url, u.github_url, u.photo_url, u.created_at, ` + isAdminColumn("u") + `,
+                     COALESCE((SELECT score FROM user_reputation WHERE user_id = u.id AND period = ?), 0) AS reputation,
+                     COALESCE((SELECT status FROM user_availability WHERE user_id = u.id), '')` +
+		from + `
+              ORDER BY ` + orderBy + `
+              LIMIT ? OFFSET ?`
+
+	args = append([]interface{}{ReputationAll}, args...)
+	args = append(args, pageSize, (page-1)*pageSize)
+
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	results := []SearchResult{}
+	for rows.Next() {
+		var r SearchResult
+		var bio, linkedIn, github, fullname, photo sql.NullString
+
+		err := rows.Scan(&r.ID, &r.Username, &fullname, &bio, &linkedIn, &github, &photo, &r.CreatedAt, &r.IsAdmin, &r.Reputation, &r.Availability)
+		if err != nil {
+			return nil, err
+		}
+
+		r.Fullname = fullname.String
+		r.Bio = bio.String
+		r.LinkedInURL = linkedIn.String
+		r.GithubURL = github.String
+		r.PhotoURL = photo.String
+
+		results = append(results, r)
+	}
+
+	return results, rows.Err()
+}
+
+// CountSearchUsers returns how many users match a directory search
+func CountSearchUsers(db *sql.DB, search UserSearch) (int, error) {
+	from, args := userSearchFrom(search)
+
+	var count int
+	err := db.QueryRow(`SELECT COUNT(*)`+from, args...).Scan(&count)
+	return count, err
+}
+
+// CheckUserSearch fails if the SQLite driver was built without FTS5, which
+// the search index and its triggers need
+func CheckUserSearch(db *sql.DB) error {
+	_, err := db.Exec(`SELECT rowid FROM users_fts WHERE users_fts MATCH '"check"' LIMIT 1`)
+	return err
+}
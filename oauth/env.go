@@ -0,0 +1,88 @@
+package oauth
+
+import (
+	"fmt"
+	"os"
+	"strings"
+)
+
+// presets hold the well-known endpoints of popular plain OAuth 2.0 providers
+// so only the client credentials need configuring
+var presets = map[string]preset{
+	"github": {
+		authURL:     "https://github.com/login/oauth/authorize",
+		tokenURL:    "https://github.com/login/oauth/access_token",
+		userInfoURL: "https://api.github.com/user",
+		emailsURL:   "https://api.github.com/user/emails",
+		scopes:      []string{"read:user", "user:email"},
+	},
+}
+
+type preset struct {
+	authURL, tokenURL, userInfoURL, emailsURL string
+	scopes                                    []string
+}
+
+// ProvidersFromEnv builds the providers listed in OAUTH_PROVIDERS, e.g.
+// "github,google". Each provider NAME is configured with:
+//
+//	OAUTH_NAME_CLIENT_ID, OAUTH_NAME_CLIENT_SECRET
+//	OAUTH_NAME_ISSUER    - OpenID Connect issuer; endpoints are discovered
+//	OAUTH_NAME_AUTH_URL, OAUTH_NAME_TOKEN_URL, OAUTH_NAME_USERINFO_URL
+//	OAUTH_NAME_SCOPES    - space or comma separated
+//
+// "github" needs only the client credentials.
+func ProvidersFromEnv() (Providers, error) {
+	providers := Providers{}
+
+	for _, name := range strings.Split(os.Getenv("OAUTH_PROVIDERS"), ",") {
+		name = strings.ToLower(strings.TrimSpace(name))
+		if name == "" {
+			continue
+		}
+
+		env := func(key string) string {
+			return strings.TrimSpace(os.Getenv("OAUTH_" + strings.ToUpper(name) + "_" + key))
+		}
+
+		preset := presets[name]
+		p := &Provider{
+			Name:         name,
+			ClientID:     env("CLIENT_ID"),
+			ClientSecret: env("CLIENT_SECRET"),
+			Issuer:       env("ISSUER"),
+			AuthURL:      firstNonEmpty(env("AUTH_URL"), preset.authURL),
+			TokenURL:     firstNonEmpty(env("TOKEN_URL"), preset.tokenURL),
+			UserInfoURL:  firstNonEmpty(env("USERINFO_URL"), preset.userInfoURL),
+			EmailsURL:    preset.emailsURL,
+			Scopes:       preset.scopes,
+		}
+
+		if scopes := env("SCOPES"); scopes != "" {
+			p.Scopes = strings.Fields(strings.ReplaceAll(scopes, ",", " "))
+		}
+		if p.OIDC() && len(p.Scopes) == 0 {
+			p.Scopes = []string{"openid", "email", "profile"}
+		}
+
+		if p.ClientID == "" {
+			return nil, fmt.Errorf("oauth: OAUTH_%s_CLIENT_ID is required", strings.ToUpper(name))
+		}
+		if !p.OIDC() && (p.AuthURL == "" || p.TokenURL == "" || p.UserInfoURL == "") {
+			return nil, fmt.Errorf("oauth: %s needs either an issuer or auth, token and userinfo URLs", name)
+		}
+
+		providers[name] = p
+	}
+
+	return providers, nil
+}
+
+func firstNonEmpty(values ...string) string {
+	for _, v := range values {
+		if v != "" {
+			return v
+		}
+	}
+	return ""
+}
@@ -0,0 +1,191 @@
+package oauth
+
+import (
+	"context"
+	"crypto"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// clockSkew tolerates small differences between our clock and the provider's
+const clockSkew = time.Minute
+
+// keySet caches a provider's JSON Web Key Set, refetching it when a token is
+// signed with a key it has not seen
+type keySet struct {
+	url    string
+	client *http.Client
+
+	mu      sync.Mutex
+	keys    map[string]*rsa.PublicKey
+	fetched time.Time
+}
+
+func (s *keySet) key(ctx context.Context, kid string) (*rsa.PublicKey, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if key, ok := s.keys[kid]; ok {
+		return key, nil
+	}
+
+	// Rate limit refetches so garbage kids cannot hammer the provider
+	if time.Since(s.fetched) < time.Minute && s.keys != nil {
+		return nil, fmt.Errorf("oauth: unknown signing key %q", kid)
+	}
+
+	if err := s.fetch(ctx); err != nil {
+		return nil, err
+	}
+
+	key, ok := s.keys[kid]
+	if !ok {
+		return nil, fmt.Errorf("oauth: unknown signing key %q", kid)
+	}
+	return key, nil
+}
+
+func (s *keySet) fetch(ctx context.Context) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, s.url, nil)
+	if err != nil {
+		return err
+	}
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("oauth: fetching keys returned %s", resp.Status)
+	}
+
+	var doc struct {
+		Keys []struct {
+			Kty string `json:"kty"`
+			Kid string `json:"kid"`
+			Use string `json:"use"`
+			N   string `json:"n"`
+			E   string `json:"e"`
+		} `json:"keys"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&doc); err != nil {
+		return err
+	}
+
+	keys := map[string]*rsa.PublicKey{}
+	for _, k := range doc.Keys {
+		if k.Kty != "RSA" || (k.Use != "" && k.Use != "sig") {
+			continue
+		}
+
+		n, err := base64.RawURLEncoding.DecodeString(k.N)
+		if err != nil {
+			continue
+		}
+		e, err := base64.RawURLEncoding.DecodeString(k.E)
+		if err != nil {
+			continue
+		}
+
+		keys[k.Kid] = &rsa.PublicKey{
+			N: new(big.Int).SetBytes(n),
+			E: int(new(big.Int).SetBytes(e).Int64()),
+		}
+	}
+
+	s.keys = keys
+	s.fetched = time.Now()
+	return nil
+}
+
+// verifyIDToken checks an RS256 ID token and returns its claims
+func (p *Provider) verifyIDToken(ctx context.Context, raw, nonce string) (map[string]interface{}, error) {
+	parts := strings.Split(raw, ".")
+	if len(parts) != 3 {
+		return nil, errors.New("oauth: malformed ID token")
+	}
+
+	var header struct {
+		Alg string `json:"alg"`
+		Kid string `json:"kid"`
+	}
+	if err := decodeSegment(parts[0], &header); err != nil {
+		return nil, err
+	}
+	if header.Alg != "RS256" {
+		return nil, fmt.Errorf("oauth: unsupported ID token algorithm %q", header.Alg)
+	}
+
+	key, err := p.keys.key(ctx, header.Kid)
+	if err != nil {
+		return nil, err
+	}
+
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, errors.New("oauth: malformed ID token signature")
+	}
+	digest := sha256.Sum256([]byte(parts[0] + "." + parts[1]))
+	if err := rsa.VerifyPKCS1v15(key, crypto.SHA256, digest[:], signature); err != nil {
+		return nil, errors.New("oauth: invalid ID token signature")
+	}
+
+	var claims map[string]interface{}
+	if err := decodeSegment(parts[1], &claims); err != nil {
+		return nil, err
+	}
+
+	if claimString(claims, "iss") != p.Issuer {
+		return nil, errors.New("oauth: ID token issuer mismatch")
+	}
+	if !audienceContains(claims["aud"], p.ClientID) {
+		return nil, errors.New("oauth: ID token audience mismatch")
+	}
+
+	exp, ok := claims["exp"].(float64)
+	if !ok || time.Now().Add(-clockSkew).After(time.Unix(int64(exp), 0)) {
+		return nil, errors.New("oauth: ID token has expired")
+	}
+	if nonce == "" || claimString(claims, "nonce") != nonce {
+		return nil, errors.New("oauth: ID token nonce mismatch")
+	}
+
+	return claims, nil
+}
+
+func decodeSegment(seg string, v interface{}) error {
+	data, err := base64.RawURLEncoding.DecodeString(seg)
+	if err != nil {
+		return errors.New("oauth: malformed ID token")
+	}
+	if err := json.Unmarshal(data, v); err != nil {
+		return errors.New("oauth: malformed ID token")
+	}
+	return nil
+}
+
+// audienceContains handles "aud" as either a string or a list of strings
+func audienceContains(aud interface{}, clientID string) bool {
+	switch v := aud.(type) {
+	case string:
+		return v == clientID
+	case []interface{}:
+		for _, a := range v {
+			if s, ok := a.(string); ok && s == clientID {
+				return true
+			}
+		}
+	}
+	return false
+}
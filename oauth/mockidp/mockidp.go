@@ -0,0 +1,271 @@
+// Package mockidp is a minimal OpenID Connect provider for local development
+// and tests. It signs ID tokens with a throwaway RSA key and logs in whoever
+// asks: /authorize?login=alice skips the form and issues a code for alice.
+package mockidp
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"html/template"
+	"math/big"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+const keyID = "mock-key"
+
+// Server is an in-memory identity provider
+type Server struct {
+	Issuer string
+
+	key *rsa.PrivateKey
+
+	mu     sync.Mutex
+	codes  map[string]*grant
+	tokens map[string]string // access token -> login
+}
+
+// grant is an issued authorization code waiting to be exchanged
+type grant struct {
+	login         string
+	clientID      string
+	redirectURI   string
+	nonce         string
+	codeChallenge string
+	expiresAt     time.Time
+}
+
+// New creates a provider that identifies itself as issuer, which must be the
+// URL it is served at
+func New(issuer string) (*Server, error) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Server{
+		Issuer: strings.TrimSuffix(issuer, "/"),
+		key:    key,
+		codes:  map[string]*grant{},
+		tokens: map[string]string{},
+	}, nil
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch r.URL.Path {
+	case "/.well-known/openid-configuration":
+		s.discovery(w)
+	case "/authorize":
+		s.authorize(w, r)
+	case "/token":
+		s.token(w, r)
+	case "/userinfo":
+		s.userinfo(w, r)
+	case "/jwks":
+		s.jwks(w)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func (s *Server) discovery(w http.ResponseWriter) {
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"issuer":                                s.Issuer,
+		"authorization_endpoint":                s.Issuer + "/authorize",
+		"token_endpoint":                        s.Issuer + "/token",
+		"userinfo_endpoint":                     s.Issuer + "/userinfo",
+		"jwks_uri":                              s.Issuer + "/jwks",
+		"response_types_supported":              []string{"code"},
+		"subject_types_supported":               []string{"public"},
+		"id_token_signing_alg_values_supported": []string{"RS256"},
+		"code_challenge_methods_supported":      []string{"S256"},
+	})
+}
+
+var loginForm = template.Must(template.New("login").Parse(`<!DOCTYPE html>
+<html><body style="font-family:sans-serif;max-width:24rem;margin:4rem auto">
+<h1>Mock identity provider</h1>
+<form method="get" action="/authorize">
+{{ range $k, $v := .Params }}{{ range $v }}<input type="hidden" name="{{ $k }}" value="{{ . }}">{{ end }}{{ end }}
+<label>Log in as <input name="login" autofocus required></label>
+<button type="submit">Continue</button>
+</form>
+</body></html>`))
+
+func (s *Server) authorize(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+
+	redirectURI := q.Get("redirect_uri")
+	if q.Get("response_type") != "code" || q.Get("client_id") == "" || redirectURI == "" {
+		http.Error(w, "invalid authorization request", http.StatusBadRequest)
+		return
+	}
+	if q.Get("code_challenge") == "" || q.Get("code_challenge_method") != "S256" {
+		http.Error(w, "PKCE with S256 is required", http.StatusBadRequest)
+		return
+	}
+
+	login := strings.TrimSpace(q.Get("login"))
+	if login == "" {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		loginForm.Execute(w, map[string]interface{}{"Params": q})
+		return
+	}
+
+	code := randomString()
+	s.mu.Lock()
+	s.codes[code] = &grant{
+		login:         login,
+		clientID:      q.Get("client_id"),
+		redirectURI:   redirectURI,
+		nonce:         q.Get("nonce"),
+		codeChallenge: q.Get("code_challenge"),
+		expiresAt:     time.Now().Add(time.Minute),
+	}
+	s.mu.Unlock()
+
+	target, err := url.Parse(redirectURI)
+	if err != nil {
+		http.Error(w, "invalid redirect_uri", http.StatusBadRequest)
+		return
+	}
+	params := target.Query()
+	params.Set("code", code)
+	params.Set("state", q.Get("state"))
+	target.RawQuery = params.Encode()
+
+	http.Redirect(w, r, target.String(), http.StatusFound)
+}
+
+func (s *Server) token(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if err := r.ParseForm(); err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid_request"})
+		return
+	}
+
+	s.mu.Lock()
+	g, ok := s.codes[r.PostForm.Get("code")]
+	delete(s.codes, r.PostForm.Get("code"))
+	s.mu.Unlock()
+
+	challenge := sha256.Sum256([]byte(r.PostForm.Get("code_verifier")))
+	switch {
+	case r.PostForm.Get("grant_type") != "authorization_code",
+		!ok, time.Now().After(g.expiresAt),
+		g.clientID != r.PostForm.Get("client_id"),
+		g.redirectURI != r.PostForm.Get("redirect_uri"),
+		base64.RawURLEncoding.EncodeToString(challenge[:]) != g.codeChallenge:
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid_grant"})
+		return
+	}
+
+	accessToken := randomString()
+	s.mu.Lock()
+	s.tokens[accessToken] = g.login
+	s.mu.Unlock()
+
+	now := time.Now()
+	claims := s.claims(g.login)
+	claims["iss"] = s.Issuer
+	claims["aud"] = g.clientID
+	claims["iat"] = now.Unix()
+	claims["exp"] = now.Add(time.Hour).Unix()
+	claims["nonce"] = g.nonce
+
+	idToken, err := s.sign(claims)
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "server_error"})
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"access_token": accessToken,
+		"token_type":   "Bearer",
+		"expires_in":   3600,
+		"id_token":     idToken,
+	})
+}
+
+func (s *Server) userinfo(w http.ResponseWriter, r *http.Request) {
+	token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+
+	s.mu.Lock()
+	login, ok := s.tokens[token]
+	s.mu.Unlock()
+
+	if !ok {
+		writeJSON(w, http.StatusUnauthorized, map[string]string{"error": "invalid_token"})
+		return
+	}
+
+	writeJSON(w, http.StatusOK, s.claims(login))
+}
+
+func (s *Server) jwks(w http.ResponseWriter) {
+	pub := s.key.PublicKey
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"keys": []map[string]string{{
+			"kty": "RSA",
+			"kid": keyID,
+			"use": "sig",
+			"alg": "RS256",
+			"n":   base64.RawURLEncoding.EncodeToString(pub.N.Bytes()),
+			"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(pub.E)).Bytes()),
+		}},
+	})
+}
+
+// claims describes the fake account for a login name
+func (s *Server) claims(login string) map[string]interface{} {
+	return map[string]interface{}{
+		"sub":                "mock|" + login,
+		"preferred_username": login,
+		"name":               login,
+		"email":              login + "@example.com",
+		"email_verified":     true,
+		"profile":            s.Issuer + "/users/" + url.PathEscape(login),
+	}
+}
+
+func (s *Server) sign(claims map[string]interface{}) (string, error) {
+	header, err := json.Marshal(map[string]string{"alg": "RS256", "typ": "JWT", "kid": keyID})
+	if err != nil {
+		return "", err
+	}
+	payload, err := json.Marshal(claims)
+	if err != nil {
+		return "", err
+	}
+
+	signingInput := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(payload)
+	digest := sha256.Sum256([]byte(signingInput))
+	signature, err := rsa.SignPKCS1v15(rand.Reader, s.key, crypto.SHA256, digest[:])
+	if err != nil {
+		return "", err
+	}
+
+	return signingInput + "." + base64.RawURLEncoding.EncodeToString(signature), nil
+}
+
+func randomString() string {
+	b := make([]byte, 24)
+	rand.Read(b)
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
@@ -0,0 +1,340 @@
+// Package oauth implements login through external OAuth 2.0 and OpenID
+// Connect identity providers using the authorization code flow with PKCE.
+package oauth
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Identity is the account a provider vouches for after a successful login
+type Identity struct {
+	Subject       string
+	Email         string
+	EmailVerified bool
+	Username      string
+	Name          string
+	AvatarURL     string
+	ProfileURL    string
+}
+
+// Provider is a configured identity provider. Providers with an Issuer are
+// treated as OpenID Connect: their endpoints are discovered and an ID token
+// is required. Without one the provider is plain OAuth 2.0 and the identity
+// comes from UserInfoURL alone.
+type Provider struct {
+	Name         string
+	ClientID     string
+	ClientSecret string
+	Scopes       []string
+
+	Issuer      string
+	AuthURL     string
+	TokenURL    string
+	UserInfoURL string
+	JWKSURL     string
+
+	// EmailsURL lists the account's addresses with their verified state, for
+	// providers like GitHub whose user endpoint omits private emails
+	EmailsURL string
+
+	HTTPClient *http.Client
+
+	mu         sync.Mutex
+	discovered bool
+	keys       *keySet
+}
+
+// Providers maps provider names, as used in URLs, to their configuration
+type Providers map[string]*Provider
+
+// Names returns the configured provider names
+func (p Providers) Names() []string {
+	names := make([]string, 0, len(p))
+	for name := range p {
+		names = append(names, name)
+	}
+	return names
+}
+
+// TokenResponse is the token endpoint's answer to a code exchange
+type TokenResponse struct {
+	AccessToken string `json:"access_token"`
+	TokenType   string `json:"token_type"`
+	IDToken     string `json:"id_token"`
+	Error       string `json:"error"`
+	ErrorDesc   string `json:"error_description"`
+}
+
+// OIDC reports whether the provider is an OpenID Connect provider
+func (p *Provider) OIDC() bool {
+	return p.Issuer != ""
+}
+
+func (p *Provider) client() *http.Client {
+	if p.HTTPClient != nil {
+		return p.HTTPClient
+	}
+	return http.DefaultClient
+}
+
+// discover fills in endpoints from the issuer's discovery document. Endpoints
+// that were configured explicitly are kept.
+func (p *Provider) discover(ctx context.Context) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.discovered || !p.OIDC() {
+		return nil
+	}
+
+	var doc struct {
+		Issuer                string `json:"issuer"`
+		AuthorizationEndpoint string `json:"authorization_endpoint"`
+		TokenEndpoint         string `json:"token_endpoint"`
+		UserinfoEndpoint      string `json:"userinfo_endpoint"`
+		JWKSURI               string `json:"jwks_uri"`
+	}
+	wellKnown := strings.TrimSuffix(p.Issuer, "/") + "/.well-known/openid-configuration"
+	if err := p.getJSON(ctx, wellKnown, "", &doc); err != nil {
+		return fmt.Errorf("oauth: discovery for %s failed: %w", p.Name, err)
+	}
+
+	if doc.Issuer != p.Issuer {
+		return fmt.Errorf("oauth: %s discovery returned issuer %q", p.Name, doc.Issuer)
+	}
+
+	if p.AuthURL == "" {
+		p.AuthURL = doc.AuthorizationEndpoint
+	}
+	if p.TokenURL == "" {
+		p.TokenURL = doc.TokenEndpoint
+	}
+	if p.UserInfoURL == "" {
+		p.UserInfoURL = doc.UserinfoEndpoint
+	}
+	if p.JWKSURL == "" {
+		p.JWKSURL = doc.JWKSURI
+	}
+	p.keys = &keySet{url: p.JWKSURL, client: p.client()}
+	p.discovered = true
+
+	return nil
+}
+
+// AuthCodeURL returns the provider URL the browser is sent to. state and
+// nonce are echoed back and checked on the callback; codeChallenge is the
+// PKCE challenge for the verifier kept on the server.
+func (p *Provider) AuthCodeURL(ctx context.Context, redirectURI, state, nonce, codeChallenge string) (string, error) {
+	if err := p.discover(ctx); err != nil {
+		return "", err
+	}
+
+	params := url.Values{}
+	params.Set("response_type", "code")
+	params.Set("client_id", p.ClientID)
+	params.Set("redirect_uri", redirectURI)
+	params.Set("scope", strings.Join(p.Scopes, " "))
+	params.Set("state", state)
+	params.Set("code_challenge", codeChallenge)
+	params.Set("code_challenge_method", "S256")
+	if p.OIDC() {
+		params.Set("nonce", nonce)
+	}
+
+	sep := "?"
+	if strings.Contains(p.AuthURL, "?") {
+		sep = "&"
+	}
+	return p.AuthURL + sep + params.Encode(), nil
+}
+
+// Exchange trades an authorization code for tokens
+func (p *Provider) Exchange(ctx context.Context, redirectURI, code, codeVerifier string) (*TokenResponse, error) {
+	if err := p.discover(ctx); err != nil {
+		return nil, err
+	}
+
+	form := url.Values{}
+	form.Set("grant_type", "authorization_code")
+	form.Set("code", code)
+	form.Set("redirect_uri", redirectURI)
+	form.Set("client_id", p.ClientID)
+	form.Set("code_verifier", codeVerifier)
+	if p.ClientSecret != "" {
+		form.Set("client_secret", p.ClientSecret)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, p.TokenURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := p.client().Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	var token TokenResponse
+	if err := json.NewDecoder(io.LimitReader(resp.Body, 1<<20)).Decode(&token); err != nil {
+		return nil, fmt.Errorf("oauth: invalid token response from %s: %w", p.Name, err)
+	}
+	if token.Error != "" {
+		return nil, fmt.Errorf("oauth: %s token error: %s %s", p.Name, token.Error, token.ErrorDesc)
+	}
+	if resp.StatusCode != http.StatusOK || token.AccessToken == "" {
+		return nil, fmt.Errorf("oauth: %s token endpoint returned %s", p.Name, resp.Status)
+	}
+
+	return &token, nil
+}
+
+// Identity resolves the logged-in account from a token response. For OIDC
+// providers the ID token's signature, issuer, audience, expiry and nonce are
+// verified before anything else is trusted.
+func (p *Provider) Identity(ctx context.Context, token *TokenResponse, nonce string) (*Identity, error) {
+	if err := p.discover(ctx); err != nil {
+		return nil, err
+	}
+
+	claims := map[string]interface{}{}
+	if p.OIDC() {
+		if token.IDToken == "" {
+			return nil, fmt.Errorf("oauth: %s did not return an ID token", p.Name)
+		}
+
+		idClaims, err := p.verifyIDToken(ctx, token.IDToken, nonce)
+		if err != nil {
+			return nil, err
+		}
+		claims = idClaims
+	}
+
+	if p.UserInfoURL != "" {
+		var info map[string]interface{}
+		if err := p.getJSON(ctx, p.UserInfoURL, token.AccessToken, &info); err != nil {
+			return nil, fmt.Errorf("oauth: %s userinfo failed: %w", p.Name, err)
+		}
+
+		// The userinfo subject must be the one the ID token was issued for
+		if sub, ok := claims["sub"]; ok && claimString(info, "sub") != "" && claimString(info, "sub") != sub {
+			return nil, fmt.Errorf("oauth: %s userinfo subject does not match ID token", p.Name)
+		}
+		for k, v := range info {
+			if _, exists := claims[k]; !exists {
+				claims[k] = v
+			}
+		}
+	}
+
+	identity := &Identity{
+		Subject:       firstClaim(claims, "sub", "id"),
+		Email:         claimString(claims, "email"),
+		EmailVerified: claimBool(claims, "email_verified"),
+		Username:      firstClaim(claims, "preferred_username", "login", "nickname"),
+		Name:          claimString(claims, "name"),
+		AvatarURL:     firstClaim(claims, "picture", "avatar_url"),
+		ProfileURL:    firstClaim(claims, "profile", "html_url"),
+	}
+	if identity.Subject == "" {
+		return nil, fmt.Errorf("oauth: %s did not identify the account", p.Name)
+	}
+
+	if p.EmailsURL != "" && !identity.EmailVerified {
+		p.primaryEmail(ctx, token.AccessToken, identity)
+	}
+
+	return identity, nil
+}
+
+// primaryEmail fills in the verified primary address from EmailsURL. Failures
+// are ignored since the email is optional.
+func (p *Provider) primaryEmail(ctx context.Context, accessToken string, identity *Identity) {
+	var emails []struct {
+		Email    string `json:"email"`
+		Primary  bool   `json:"primary"`
+		Verified bool   `json:"verified"`
+	}
+	if err := p.getJSON(ctx, p.EmailsURL, accessToken, &emails); err != nil {
+		return
+	}
+
+	for _, e := range emails {
+		if e.Primary && e.Verified {
+			identity.Email = e.Email
+			identity.EmailVerified = true
+			return
+		}
+	}
+}
+
+// getJSON fetches url, authenticating with a bearer token when one is given
+func (p *Provider) getJSON(ctx context.Context, url, bearer string, v interface{}) error {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+	if bearer != "" {
+		req.Header.Set("Authorization", "Bearer "+bearer)
+	}
+
+	resp, err := p.client().Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return errors.New(resp.Status)
+	}
+
+	return json.NewDecoder(io.LimitReader(resp.Body, 1<<20)).Decode(v)
+}
+
+func claimString(claims map[string]interface{}, key string) string {
+	switch v := claims[key].(type) {
+	case string:
+		return v
+	case float64:
+		// JSON numbers, e.g. GitHub's numeric user id
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	}
+	return ""
+}
+
+func claimBool(claims map[string]interface{}, key string) bool {
+	switch v := claims[key].(type) {
+	case bool:
+		return v
+	case string:
+		return v == "true"
+	}
+	return false
+}
+
+// firstClaim returns the first non-empty claim among keys, for claims that
+// providers name differently
+func firstClaim(claims map[string]interface{}, keys ...string) string {
+	for _, key := range keys {
+		if v := claimString(claims, key); v != "" {
+			return v
+		}
+	}
+	return ""
+}
@@ -0,0 +1,28 @@
+package oauth
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+)
+
+// RandomString returns n random bytes encoded as unpadded base64url, used for
+// state, nonce and PKCE verifier values
+func RandomString(n int) (string, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// NewCodeVerifier returns a PKCE code verifier (RFC 7636 section 4.1)
+func NewCodeVerifier() (string, error) {
+	return RandomString(32)
+}
+
+// CodeChallenge derives the S256 code challenge for a verifier
+func CodeChallenge(verifier string) string {
+	sum := sha256.Sum256([]byte(verifier))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
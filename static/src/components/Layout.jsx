@@ -1,10 +1,25 @@
-import React from 'react';
+import React, { useState, useEffect } from 'react';
 import { Link, Outlet, useNavigate } from 'react-router-dom';
 import { useAuth } from '../contexts/AuthContext';
 
 const Layout = () => {
   const { user, logout, loading } = useAuth();
   const navigate = useNavigate();
+  const [unread, setUnread] = useState(0);
+
+  // Keep the unread badge current while signed in
+  useEffect(() => {
+    if (!user || user.impersonation) {
+      return;
+    }
+    setUnread(user.unread_messages);
+    const events = new EventSource('/api/messages/stream');
+    const update = (e) => setUnread(JSON.parse(e.data).unread.messages);
+    events.addEventListener('ready', update);
+    events.addEventListener('message', update);
+    events.addEventListener('read', update);
+    return () => events.close();
+  }, [user?.id]);
 
   const handleLogout = async () => {
     const result = await logout();
@@ -13,8 +28,24 @@ const Layout = () => {
     }
   };
 
+  const handleStopImpersonation = async () => {
+    await fetch('/api/impersonation/stop', { method: 'POST' });
+    // Switches back to the administrator's own session
+    window.location.href = '/admin';
+  };
+
   return (
     <div className="min-h-screen flex flex-col">
+      {user?.impersonation && (
+        <div className="bg-yellow-400 text-gray-900 py-2 px-4 text-sm text-center">
+          Viewing as <span className="font-semibold">{user.username}</span> (signed in as{' '}
+          {user.impersonation.impersonator_username}) until{' '}
+          {new Date(user.impersonation.expires_at).toLocaleTimeString()}.{' '}
+          <button onClick={handleStopImpersonation} className="underline font-semibold">
+            Stop viewing
+          </button>
+        </div>
+      )}
       <header className="bg-gray-800 py-4 px-4 sm:px-6">
         <div className="max-w-6xl mx-auto flex justify-between items-center">
           <Link to="/" className="text-2xl font-bold text-purple-500">andrewarrow.dev</Link>
@@ -25,6 +56,12 @@ const Layout = () => {
             {!loading && (
               user ? (
                 <>
+                  <Link to="/messages" className="text-gray-300 hover:text-white px-3 py-2 rounded-md">
+                    Messages
+                    {unread > 0 && (
+                      <span className="ml-1 bg-purple-600 text-white text-xs rounded-full px-2 py-0.5">{unread}</span>
+                    )}
+                  </Link>
                   <Link to="/profile" className="text-gray-300 hover:text-white px-3 py-2 rounded-md">Profile</Link>
                   {user.is_admin && (
                     <Link to="/admin" className="text-yellow-400 hover:text-yellow-300 px-3 py-2 rounded-md">Admin</Link>
@@ -46,6 +46,11 @@ export const AuthProvider = ({ children }) => {
         throw new Error(data.error || 'Login failed');
       }
 
+      // Accounts with 2FA need a code before a session is issued
+      if (data.two_factor_required) {
+        return { success: false, twoFactorRequired: true, challenge: data.challenge };
+      }
+
       // Fetch the complete user data
       const userResponse = await fetch('/api/user');
       if (userResponse.ok) {
@@ -104,6 +109,28 @@ export const AuthProvider = ({ children }) => {
     }
   };
 
+  const deleteAccount = async (confirmation) => {
+    try {
+      const response = await fetch('/api/user', {
+        method: 'DELETE',
+        headers: {
+          'Content-Type': 'application/json',
+        },
+        body: JSON.stringify(confirmation),
+      });
+
+      const data = await response.json();
+      if (!response.ok) {
+        throw new Error(data.error || 'Failed to delete account');
+      }
+
+      setUser(null);
+      return { success: true, purgeAt: data.purge_at };
+    } catch (error) {
+      return { success: false, error: error.message };
+    }
+  };
+
   const updateProfile = async (userData) => {
     setError(null);
     try {
@@ -375,6 +402,10 @@ export const AuthProvider = ({ children }) => {
         throw new Error(data.error || 'Failed to login with magic link');
       }
       
+      if (data.two_factor_required) {
+        return { success: false, twoFactorRequired: true, challenge: data.challenge };
+      }
+
       // Store the redirect URL from the response
       const redirectURL = data.redirect_url || '/';
       
@@ -395,6 +426,38 @@ export const AuthProvider = ({ children }) => {
     }
   };
 
+  // Completes a login that returned a two-factor challenge
+  const verifyTwoFactor = async (challenge, code) => {
+    setError(null);
+    try {
+      const response = await fetch('/api/login/2fa', {
+        method: 'POST',
+        headers: {
+          'Content-Type': 'application/json',
+        },
+        body: JSON.stringify({ challenge, code }),
+      });
+
+      const data = await response.json();
+
+      if (!response.ok) {
+        throw new Error(data.error || 'Verification failed');
+      }
+
+      const userResponse = await fetch('/api/user');
+      if (userResponse.ok) {
+        const userData = await userResponse.json();
+        setUser(userData);
+        return { success: true, redirectURL: data.redirect_url || '/' };
+      } else {
+        throw new Error('Failed to get user data after login');
+      }
+    } catch (error) {
+      setError(error.message);
+      return { success: false, error: error.message };
+    }
+  };
+
   const value = {
     user,
     loading,
@@ -402,6 +465,7 @@ export const AuthProvider = ({ children }) => {
     login,
     register,
     logout,
+    deleteAccount,
     updateProfile,
     getUserPrompts,
     createPrompt,
@@ -415,6 +479,7 @@ export const AuthProvider = ({ children }) => {
     getUserMagicLinks,
     deleteMagicLink,
     loginWithMagicLink,
+    verifyTwoFactor,
   };
 
   return <AuthContext.Provider value={value}>{children}</AuthContext.Provider>;
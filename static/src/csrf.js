@@ -0,0 +1,26 @@
+// The API rejects cookie-authenticated writes that do not echo the session's
+// CSRF token. Wrap fetch once so every same-origin request sends it.
+const CSRF_COOKIE = 'csrf_token';
+const CSRF_HEADER = 'X-CSRF-Token';
+const SAFE_METHODS = ['GET', 'HEAD', 'OPTIONS'];
+
+const readCookie = (name) => {
+  const match = document.cookie.split('; ').find((row) => row.startsWith(`${name}=`));
+  return match ? decodeURIComponent(match.slice(name.length + 1)) : '';
+};
+
+const originalFetch = window.fetch.bind(window);
+
+window.fetch = (input, init = {}) => {
+  const url = new URL(typeof input === 'string' ? input : input.url, window.location.href);
+  const method = (init.method || (typeof input === 'string' ? 'GET' : input.method) || 'GET').toUpperCase();
+  const token = readCookie(CSRF_COOKIE);
+
+  if (url.origin === window.location.origin && !SAFE_METHODS.includes(method) && token) {
+    const headers = new Headers(init.headers || (typeof input === 'string' ? undefined : input.headers));
+    headers.set(CSRF_HEADER, token);
+    return originalFetch(input, { ...init, headers });
+  }
+
+  return originalFetch(input, init);
+};
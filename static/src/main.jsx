@@ -3,6 +3,7 @@ import ReactDOM from 'react-dom/client';
 
 import { BrowserRouter, Routes, Route, Navigate } from 'react-router-dom';
 import './index.css';
+import './csrf';
 
 import { AuthProvider } from './contexts/AuthContext';
 import { ForumProvider } from './contexts/ForumContext';
@@ -10,6 +11,7 @@ import Layout from './components/Layout';
 import Home from './pages/Home';
 import Login from './pages/Login';
 import Register from './pages/Register';
+import ResetPassword from './pages/ResetPassword';
 import Profile from './pages/Profile';
 import UserProfile from './pages/UserProfile';
 import Forum from './pages/Forum';
@@ -20,6 +22,7 @@ import Admin from './pages/Admin';
 import AdminEditUser from './pages/AdminEditUser';
 import MagicLink from './pages/MagicLink';
 import MagicLinksPage from './pages/MagicLinksPage';
+import Messages from './pages/Messages';
 import TestPage from './pages/TestPage';
 import ProtectedRoute from './components/ProtectedRoute';
 import AdminRoute from './components/AdminRoute';
@@ -34,6 +37,7 @@ ReactDOM.createRoot(document.getElementById('root')).render(
               <Route index element={<Home />} />
               <Route path="login" element={<Login />} />
               <Route path="register" element={<Register />} />
+              <Route path="reset-password" element={<ResetPassword />} />
               <Route 
                 path="profile" 
                 element={
@@ -43,6 +47,14 @@ ReactDOM.createRoot(document.getElementById('root')).render(
                 } 
               />
               <Route path="users/:username" element={<UserProfile />} />
+              <Route 
+                path="messages" 
+                element={
+                  <ProtectedRoute>
+                    <Messages />
+                  </ProtectedRoute>
+                } 
+              />
               <Route path="magic/:token" element={<MagicLink />} />
               <Route 
                 path="magic-links" 
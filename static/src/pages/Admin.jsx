@@ -45,7 +45,7 @@ const Admin = () => {
   };
 
   const handleDeleteUser = async (userId) => {
-    if (!window.confirm('Are you sure you want to delete this user?')) {
+    if (!window.confirm('Delete this user? They can be restored for 30 days, after which their account and content are removed for good.')) {
       return;
     }
 
@@ -65,6 +65,24 @@ const Admin = () => {
     }
   };
 
+  const handleImpersonate = async (userId) => {
+    try {
+      const response = await fetch(`/api/admin/users/${userId}/impersonate`, {
+        method: 'POST',
+      });
+
+      const data = await response.json();
+      if (!response.ok) {
+        throw new Error(data.error || 'Failed to view as user');
+      }
+
+      // The session cookie now belongs to the user, so reload everything
+      window.location.href = '/profile';
+    } catch (err) {
+      setError(err.message);
+    }
+  };
+
   if (loading && users.length === 0) {
     return (
       <div className="w-full flex justify-center items-center h-64">
@@ -126,6 +144,14 @@ const Admin = () => {
                     >
                       Edit
                     </Link>
+                    {!user.is_admin && (
+                      <button
+                        onClick={() => handleImpersonate(user.id)}
+                        className="text-gray-600 hover:text-gray-900 mr-4"
+                      >
+                        View as
+                      </button>
+                    )}
                     <button
                       onClick={() => handleDeleteUser(user.id)}
                       className="text-red-600 hover:text-red-900"
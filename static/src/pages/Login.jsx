@@ -1,15 +1,29 @@
-import React, { useState } from 'react';
-import { useNavigate, Link } from 'react-router-dom';
+import React, { useEffect, useState } from 'react';
+import { useNavigate, useLocation, useSearchParams, Link } from 'react-router-dom';
 import { useAuth } from '../contexts/AuthContext';
 
 const Login = () => {
+  const [searchParams] = useSearchParams();
   const [username, setUsername] = useState('');
   const [password, setPassword] = useState('');
-  const [error, setError] = useState('');
+  const [error, setError] = useState(searchParams.get('oauth_error') || '');
+  const [providers, setProviders] = useState([]);
   const [loading, setLoading] = useState(false);
   
-  const { login } = useAuth();
+  const { login, verifyTwoFactor } = useAuth();
   const navigate = useNavigate();
+  const location = useLocation();
+
+  // Set once the password (or a magic link) is accepted for a 2FA account
+  const [challenge, setChallenge] = useState(location.state?.challenge || searchParams.get('challenge') || '');
+  const [code, setCode] = useState('');
+
+  useEffect(() => {
+    fetch('/api/oauth/providers')
+      .then((response) => (response.ok ? response.json() : []))
+      .then(setProviders)
+      .catch(() => setProviders([]));
+  }, []);
 
   const handleSubmit = async (e) => {
     e.preventDefault();
@@ -27,6 +41,8 @@ const Login = () => {
       
       if (result.success) {
         navigate('/profile');
+      } else if (result.twoFactorRequired) {
+        setChallenge(result.challenge);
       } else {
         setError(result.error || 'Failed to login');
       }
@@ -37,6 +53,82 @@ const Login = () => {
     }
   };
 
+  const handleTwoFactorSubmit = async (e) => {
+    e.preventDefault();
+
+    if (!code) {
+      setError('Please enter your authentication code');
+      return;
+    }
+
+    setError('');
+    setLoading(true);
+
+    try {
+      const result = await verifyTwoFactor(challenge, code);
+
+      if (result.success) {
+        navigate(result.redirectURL === '/' ? '/profile' : result.redirectURL);
+      } else {
+        setError(result.error || 'Failed to verify code');
+      }
+    } catch (err) {
+      setError('An unexpected error occurred');
+    } finally {
+      setLoading(false);
+    }
+  };
+
+  if (challenge) {
+    return (
+      <div className="max-w-md mx-auto">
+        <h1 className="text-3xl font-bold text-center text-purple-500 mb-6">Two-Factor Authentication</h1>
+
+        {error && (
+          <div className="bg-red-500 text-white p-3 rounded-md mb-4">
+            {error}
+          </div>
+        )}
+
+        <form onSubmit={handleTwoFactorSubmit} className="bg-gray-800 shadow-md rounded-lg p-6">
+          <div className="mb-6">
+            <label htmlFor="code" className="block text-gray-300 mb-2">
+              Authentication code
+            </label>
+            <input
+              type="text"
+              id="code"
+              value={code}
+              onChange={(e) => setCode(e.target.value)}
+              className="input"
+              placeholder="6-digit code or a recovery code"
+              autoComplete="one-time-code"
+              autoFocus
+            />
+          </div>
+
+          <div className="flex justify-between items-center">
+            <button
+              type="submit"
+              className="btn btn-primary"
+              disabled={loading}
+            >
+              {loading ? 'Verifying...' : 'Verify'}
+            </button>
+
+            <button
+              type="button"
+              onClick={() => { setChallenge(''); setCode(''); setError(''); }}
+              className="text-purple-400 hover:text-purple-300"
+            >
+              Start over
+            </button>
+          </div>
+        </form>
+      </div>
+    );
+  }
+
   return (
     <div className="max-w-md mx-auto">
       <h1 className="text-3xl font-bold text-center text-purple-500 mb-6">Login</h1>
@@ -90,6 +182,26 @@ const Login = () => {
           </Link>
         </div>
       </form>
+
+      {providers.length > 0 && (
+        <div className="bg-gray-800 shadow-md rounded-lg p-6 mt-4 space-y-2">
+          {providers.map((provider) => (
+            <a
+              key={provider}
+              href={`/api/oauth/${provider}/login?redirect_url=/profile`}
+              className="btn btn-secondary w-full block text-center capitalize"
+            >
+              Continue with {provider}
+            </a>
+          ))}
+        </div>
+      )}
+
+      <p className="text-center mt-4">
+        <Link to="/reset-password" className="text-purple-400 hover:text-purple-300">
+          Forgot your password?
+        </Link>
+      </p>
     </div>
   );
 };
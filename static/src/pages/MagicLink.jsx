@@ -26,6 +26,9 @@ const MagicLink = () => {
           // Immediately redirect to the specified URL
           navigate(result.redirectURL || '/profile', { replace: true });
           return; // Skip setting success state since we're navigating away
+        } else if (result.twoFactorRequired) {
+          navigate('/login', { replace: true, state: { challenge: result.challenge } });
+          return;
         } else {
           setStatus('error');
           setError(result.error);
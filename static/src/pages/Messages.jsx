@@ -0,0 +1,213 @@
+import React, { useState, useEffect, useRef } from 'react';
+import { Link, useSearchParams } from 'react-router-dom';
+import { useAuth } from '../contexts/AuthContext';
+
+const Messages = () => {
+  const { user } = useAuth();
+  const [searchParams, setSearchParams] = useSearchParams();
+  const [conversations, setConversations] = useState([]);
+  const [messages, setMessages] = useState([]);
+  const [hasMore, setHasMore] = useState(false);
+  const [body, setBody] = useState('');
+  const [error, setError] = useState('');
+  const [loading, setLoading] = useState(true);
+  const selectedRef = useRef(null);
+
+  const selectedId = Number(searchParams.get('c')) || null;
+  const recipient = searchParams.get('to');
+  const selected = conversations.find(c => c.id === selectedId);
+  selectedRef.current = selectedId;
+
+  const fetchConversations = async () => {
+    try {
+      const response = await fetch('/api/conversations?pageSize=100');
+      const data = await response.json();
+      if (!response.ok) {
+        throw new Error(data.error || 'Failed to load conversations');
+      }
+      setConversations(data.conversations);
+      return data.conversations;
+    } catch (err) {
+      setError(err.message);
+      return [];
+    } finally {
+      setLoading(false);
+    }
+  };
+
+  const markRead = async (id) => {
+    await fetch(`/api/conversations/${id}/read`, { method: 'POST' });
+    setConversations(prev => prev.map(c => (c.id === id ? { ...c, unread: 0 } : c)));
+  };
+
+  const fetchMessages = async (id, before) => {
+    const query = before ? `?before=${before}` : '';
+    const response = await fetch(`/api/conversations/${id}/messages${query}`);
+    const data = await response.json();
+    if (!response.ok) {
+      setError(data.error || 'Failed to load messages');
+      return;
+    }
+    setMessages(prev => (before ? [...data.messages, ...prev] : data.messages));
+    setHasMore(data.has_more);
+  };
+
+  useEffect(() => {
+    fetchConversations().then(list => {
+      // Continue an existing conversation when arriving from a profile
+      const existing = recipient && list.find(c => c.with.username === recipient);
+      if (existing) {
+        setSearchParams({ c: existing.id });
+      }
+    });
+  }, []);
+
+  useEffect(() => {
+    setMessages([]);
+    if (selectedId) {
+      fetchMessages(selectedId);
+      markRead(selectedId);
+    }
+  }, [selectedId]);
+
+  // New messages and read receipts arrive over Server-Sent Events
+  useEffect(() => {
+    const events = new EventSource('/api/messages/stream');
+    events.addEventListener('message', (e) => {
+      const data = JSON.parse(e.data);
+      if (data.conversation_id === selectedRef.current) {
+        setMessages(prev => (prev.some(m => m.id === data.message.id) ? prev : [...prev, data.message]));
+        if (data.message.sender_id !== user.id) {
+          markRead(data.conversation_id);
+        }
+      }
+      fetchConversations();
+    });
+    return () => events.close();
+  }, []);
+
+  const handleSend = async (e) => {
+    e.preventDefault();
+    setError('');
+
+    try {
+      const response = await fetch(selectedId ? `/api/conversations/${selectedId}/messages` : '/api/conversations', {
+        method: 'POST',
+        headers: {
+          'Content-Type': 'application/json',
+        },
+        body: JSON.stringify(selectedId ? { body } : { username: recipient, body }),
+      });
+      const data = await response.json();
+      if (!response.ok) {
+        throw new Error(data.error || 'Failed to send message');
+      }
+
+      setBody('');
+      if (selectedId) {
+        setMessages(prev => (prev.some(m => m.id === data.id) ? prev : [...prev, data]));
+      } else {
+        await fetchConversations();
+        setSearchParams({ c: data.conversation.id });
+      }
+    } catch (err) {
+      setError(err.message);
+    }
+  };
+
+  const handleBlock = async () => {
+    const method = selected.blocked ? 'DELETE' : 'POST';
+    if (method === 'POST' && !window.confirm(`Block ${selected.with.username}? Neither of you will be able to message the other.`)) {
+      return;
+    }
+    const response = await fetch(`/api/users/${selected.with.username}/block`, { method });
+    if (response.ok) {
+      fetchConversations();
+    }
+  };
+
+  if (loading) {
+    return <div className="text-center py-10">Loading...</div>;
+  }
+
+  return (
+    <div className="grid grid-cols-1 md:grid-cols-3 gap-6">
+      <div className="bg-gray-800 rounded-lg shadow-lg p-4">
+        <h1 className="text-xl font-bold text-purple-500 mb-4">Messages</h1>
+        {conversations.length === 0 && <p className="text-gray-400">No conversations yet.</p>}
+        <ul className="space-y-2">
+          {conversations.map(c => (
+            <li key={c.id}>
+              <button
+                onClick={() => setSearchParams({ c: c.id })}
+                className={`w-full text-left p-2 rounded-md ${c.id === selectedId ? 'bg-gray-700' : 'hover:bg-gray-700'}`}
+              >
+                <div className="flex justify-between">
+                  <span className="font-semibold">{c.with.username}</span>
+                  {c.unread > 0 && (
+                    <span className="bg-purple-600 text-white text-xs rounded-full px-2 py-0.5">{c.unread}</span>
+                  )}
+                </div>
+                {c.last_message && <p className="text-gray-400 text-sm truncate">{c.last_message.body}</p>}
+              </button>
+            </li>
+          ))}
+        </ul>
+      </div>
+
+      <div className="md:col-span-2 bg-gray-800 rounded-lg shadow-lg p-4 flex flex-col">
+        {selected || recipient ? (
+          <>
+            <div className="flex justify-between items-center mb-4">
+              <Link
+                to={`/users/${selected ? selected.with.username : recipient}`}
+                className="text-lg font-bold text-purple-400 hover:text-purple-300"
+              >
+                {selected ? selected.with.username : recipient}
+              </Link>
+              {selected && (
+                <button onClick={handleBlock} className="text-sm text-gray-400 hover:text-red-400">
+                  {selected.blocked ? 'Unblock' : 'Block'}
+                </button>
+              )}
+            </div>
+
+            <div className="flex-grow space-y-3 mb-4 overflow-y-auto max-h-[60vh]">
+              {hasMore && (
+                <button onClick={() => fetchMessages(selectedId, messages[0].id)} className="text-sm text-purple-400">
+                  Load older messages
+                </button>
+              )}
+              {messages.map(m => (
+                <div key={m.id} className={`flex ${m.sender_id === user.id ? 'justify-end' : 'justify-start'}`}>
+                  <div className={`rounded-lg px-3 py-2 max-w-md ${m.sender_id === user.id ? 'bg-purple-700' : 'bg-gray-700'}`}>
+                    <p className="whitespace-pre-wrap">{m.body}</p>
+                    <p className="text-xs text-gray-300 mt-1">{new Date(m.created_at).toLocaleString()}</p>
+                  </div>
+                </div>
+              ))}
+            </div>
+
+            {error && <p className="text-red-400 mb-2">{error}</p>}
+            <form onSubmit={handleSend} className="flex space-x-2">
+              <textarea
+                className="form-input flex-grow"
+                rows="2"
+                value={body}
+                onChange={(e) => setBody(e.target.value)}
+                placeholder="Write a message"
+              />
+              <button type="submit" className="btn btn-primary" disabled={!body.trim()}>
+                Send
+              </button>
+            </form>
+          </>
+        ) : (
+          <p className="text-gray-400">Select a conversation.</p>
+        )}
+      </div>
+    </div>
+  );
+};
+
+export default Messages;
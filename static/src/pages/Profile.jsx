@@ -1,9 +1,10 @@
 import React, { useState, useEffect } from 'react';
+import { Link } from 'react-router-dom';
 import { useAuth } from '../contexts/AuthContext';
 
 const Profile = () => {
   const { 
-    user, updateProfile, 
+    user, updateProfile, deleteAccount,
     getUserPrompts, createPrompt, updatePrompt, deletePrompt,
     getUserProjects, createProject, updateProject, deleteProject,
     createMagicLink, getUserMagicLinks, deleteMagicLink
@@ -17,6 +18,18 @@ const Profile = () => {
   const [magicLinksLoading, setMagicLinksLoading] = useState(false);
   const [newMagicLinkRedirectURL, setNewMagicLinkRedirectURL] = useState('/');
   
+  // Contact requests state
+  const [contactRequests, setContactRequests] = useState([]);
+  const [contactRequestsLoading, setContactRequestsLoading] = useState(false);
+
+  // Account deletion state
+  const [deleteFormData, setDeleteFormData] = useState({
+    password: '',
+    code: '',
+    anonymize_forum: false,
+  });
+  const [deleteLoading, setDeleteLoading] = useState(false);
+
   // Profile form state
   const [profileFormData, setProfileFormData] = useState({
     bio: user?.bio || '',
@@ -63,6 +76,8 @@ const Profile = () => {
       fetchProjects();
     } else if (activeTab === 'magic-links') {
       fetchMagicLinks();
+    } else if (activeTab === 'contact') {
+      fetchContactRequests();
     }
   }, [activeTab]);
   
@@ -86,6 +101,39 @@ const Profile = () => {
     }
   };
   
+  const fetchContactRequests = async () => {
+    setContactRequestsLoading(true);
+    try {
+      const response = await fetch('/api/contact-requests/inbox');
+      const data = await response.json();
+      if (!response.ok) {
+        throw new Error(data.error || 'Failed to fetch contact requests');
+      }
+      setContactRequests(data.requests);
+    } catch (err) {
+      setError(err.message);
+    } finally {
+      setContactRequestsLoading(false);
+    }
+  };
+
+  const handleContactResponse = async (requestId, action) => {
+    setSuccess('');
+    setError('');
+    try {
+      const response = await fetch(`/api/contact-requests/${requestId}/${action}`, {
+        method: 'POST',
+      });
+      const data = await response.json();
+      if (!response.ok) {
+        throw new Error(data.error || 'Failed to answer contact request');
+      }
+      setContactRequests(contactRequests.map(r => (r.id === requestId ? data : r)));
+    } catch (err) {
+      setError(err.message);
+    }
+  };
+
   const handleCreateMagicLink = async () => {
     setSuccess('');
     setError('');
@@ -195,6 +243,32 @@ const Profile = () => {
     }
   };
 
+  const handleDeleteAccount = async (e) => {
+    e.preventDefault();
+
+    if (!window.confirm('Delete your account? You can ask an admin to restore it within 30 days.')) {
+      return;
+    }
+
+    setSuccess('');
+    setError('');
+    setDeleteLoading(true);
+
+    try {
+      const result = await deleteAccount(deleteFormData);
+
+      if (result.success) {
+        window.location.href = '/';
+      } else {
+        setError(result.error || 'Failed to delete account');
+      }
+    } catch (err) {
+      setError('An unexpected error occurred');
+    } finally {
+      setDeleteLoading(false);
+    }
+  };
+
   // Prompt form handlers
   const handlePromptChange = (e) => {
     const { name, value } = e.target;
@@ -507,6 +581,16 @@ const Profile = () => {
           >
             Magic Links
           </button>
+          <button
+            className={`py-4 px-6 text-center border-b-2 font-medium text-sm ${
+              activeTab === 'contact'
+                ? 'border-purple-500 text-purple-500'
+                : 'border-transparent text-gray-400 hover:text-gray-300 hover:border-gray-400'
+            }`}
+            onClick={() => setActiveTab('contact')}
+          >
+            Contact Requests
+          </button>
         </nav>
       </div>
       
@@ -597,6 +681,65 @@ const Profile = () => {
               {loading ? 'Updating...' : 'Update Profile'}
             </button>
           </form>
+
+          <div className="mt-10 border-t border-red-900 pt-6">
+            <h2 className="text-xl font-bold text-red-500 mb-2">Delete Account</h2>
+            <p className="text-gray-400 mb-4">
+              Your account is hidden immediately and permanently removed after 30 days.
+              You will be signed out everywhere.
+            </p>
+            <form onSubmit={handleDeleteAccount}>
+              <div className="mb-4">
+                <label className="block text-gray-300 mb-2" htmlFor="delete_password">
+                  Password
+                </label>
+                <input
+                  type="password"
+                  id="delete_password"
+                  className="form-input"
+                  value={deleteFormData.password}
+                  onChange={(e) => setDeleteFormData({ ...deleteFormData, password: e.target.value })}
+                />
+                <p className="text-gray-400 text-sm mt-1">
+                  Signed up with a provider and never set a password?{' '}
+                  <Link to="/reset-password" className="text-purple-400 hover:text-purple-300">
+                    Set one through a password reset
+                  </Link>{' '}
+                  first.
+                </p>
+              </div>
+              {user?.two_factor_enabled && (
+                <div className="mb-4">
+                  <label className="block text-gray-300 mb-2" htmlFor="delete_code">
+                    Or two-factor code
+                  </label>
+                  <input
+                    type="text"
+                    id="delete_code"
+                    className="form-input"
+                    value={deleteFormData.code}
+                    onChange={(e) => setDeleteFormData({ ...deleteFormData, code: e.target.value })}
+                  />
+                </div>
+              )}
+              <label className="flex items-center text-gray-300 mb-4">
+                <input
+                  type="checkbox"
+                  className="mr-2"
+                  checked={deleteFormData.anonymize_forum}
+                  onChange={(e) => setDeleteFormData({ ...deleteFormData, anonymize_forum: e.target.checked })}
+                />
+                Keep my forum posts and comments, shown as [deleted]
+              </label>
+              <button
+                type="submit"
+                className="btn bg-red-600 hover:bg-red-700 text-white"
+                disabled={deleteLoading}
+              >
+                {deleteLoading ? 'Deleting...' : 'Delete Account'}
+              </button>
+            </form>
+          </div>
         </div>
       )}
       
@@ -1129,6 +1272,48 @@ const Profile = () => {
           </div>
         </div>
       )}
+
+      {activeTab === 'contact' && (
+        <div className="bg-gray-800 rounded-lg shadow-lg p-6">
+          <h2 className="text-2xl font-bold text-purple-500 mb-6">Contact Requests</h2>
+
+          {contactRequestsLoading ? (
+            <p className="text-gray-400">Loading...</p>
+          ) : contactRequests.length === 0 ? (
+            <p className="text-gray-400">Nobody has reached out yet.</p>
+          ) : (
+            <div className="space-y-4">
+              {contactRequests.map(request => (
+                <div key={request.id} className="bg-gray-700 p-4 rounded-lg">
+                  <div className="flex justify-between mb-2">
+                    <a href={`/users/${request.sender.username}`} className="text-purple-400 hover:text-purple-300 font-medium">
+                      {request.sender.username}
+                    </a>
+                    <span className="text-gray-400 text-sm">{new Date(request.created_at).toLocaleDateString()}</span>
+                  </div>
+                  <p className="text-gray-300 whitespace-pre-line mb-4">{request.message}</p>
+
+                  {request.status === 'pending' ? (
+                    <div className="flex gap-2">
+                      <button className="btn btn-primary" onClick={() => handleContactResponse(request.id, 'accept')}>
+                        Accept
+                      </button>
+                      <button className="btn bg-gray-600 hover:bg-gray-500 text-white" onClick={() => handleContactResponse(request.id, 'decline')}>
+                        Decline
+                      </button>
+                    </div>
+                  ) : (
+                    <p className="text-gray-400 text-sm">
+                      {request.status === 'accepted' ? 'Accepted' : 'Declined'}
+                      {request.contact?.email && ` · ${request.contact.email}`}
+                    </p>
+                  )}
+                </div>
+              ))}
+            </div>
+          )}
+        </div>
+      )}
     </div>
   );
 };
@@ -0,0 +1,130 @@
+import React, { useState } from 'react';
+import { useNavigate, useSearchParams, Link } from 'react-router-dom';
+
+// Without a token this page requests a reset email; with the token from that
+// email it sets the new password
+const ResetPassword = () => {
+  const [searchParams] = useSearchParams();
+  const token = searchParams.get('token');
+
+  const [email, setEmail] = useState('');
+  const [password, setPassword] = useState('');
+  const [confirmPassword, setConfirmPassword] = useState('');
+  const [error, setError] = useState('');
+  const [message, setMessage] = useState('');
+  const [loading, setLoading] = useState(false);
+
+  const navigate = useNavigate();
+
+  const handleSubmit = async (e) => {
+    e.preventDefault();
+    setError('');
+    setMessage('');
+    setLoading(true);
+
+    try {
+      const response = await fetch(token ? '/api/password/reset' : '/api/password/forgot', {
+        method: 'POST',
+        headers: { 'Content-Type': 'application/json' },
+        body: JSON.stringify(token
+          ? { token, new_password: password, confirm_password: confirmPassword }
+          : { email }),
+      });
+      const data = await response.json();
+
+      if (!response.ok) {
+        setError(data.error || 'Something went wrong');
+      } else if (token) {
+        navigate('/login');
+      } else {
+        setMessage(data.message);
+      }
+    } catch (err) {
+      setError('An unexpected error occurred');
+    } finally {
+      setLoading(false);
+    }
+  };
+
+  return (
+    <div className="max-w-md mx-auto">
+      <h1 className="text-3xl font-bold text-center text-purple-500 mb-6">Reset Password</h1>
+
+      {error && (
+        <div className="bg-red-500 text-white p-3 rounded-md mb-4">
+          {error}
+        </div>
+      )}
+
+      {message && (
+        <div className="bg-green-600 text-white p-3 rounded-md mb-4">
+          {message}
+        </div>
+      )}
+
+      <form onSubmit={handleSubmit} className="bg-gray-800 shadow-md rounded-lg p-6">
+        {token ? (
+          <>
+            <div className="mb-4">
+              <label htmlFor="password" className="block text-gray-300 mb-2">
+                New password
+              </label>
+              <input
+                type="password"
+                id="password"
+                value={password}
+                onChange={(e) => setPassword(e.target.value)}
+                className="input"
+                placeholder="At least 8 characters"
+              />
+            </div>
+
+            <div className="mb-6">
+              <label htmlFor="confirmPassword" className="block text-gray-300 mb-2">
+                Confirm new password
+              </label>
+              <input
+                type="password"
+                id="confirmPassword"
+                value={confirmPassword}
+                onChange={(e) => setConfirmPassword(e.target.value)}
+                className="input"
+                placeholder="Repeat your new password"
+              />
+            </div>
+          </>
+        ) : (
+          <div className="mb-6">
+            <label htmlFor="email" className="block text-gray-300 mb-2">
+              Email
+            </label>
+            <input
+              type="email"
+              id="email"
+              value={email}
+              onChange={(e) => setEmail(e.target.value)}
+              className="input"
+              placeholder="Enter your verified email address"
+            />
+          </div>
+        )}
+
+        <div className="flex justify-between items-center">
+          <button
+            type="submit"
+            className="btn btn-primary"
+            disabled={loading}
+          >
+            {loading ? 'Please wait...' : token ? 'Set password' : 'Send reset link'}
+          </button>
+
+          <Link to="/login" className="text-purple-400 hover:text-purple-300">
+            Back to login
+          </Link>
+        </div>
+      </form>
+    </div>
+  );
+};
+
+export default ResetPassword;
@@ -1,13 +1,52 @@
 import React, { useState, useEffect } from 'react';
-import { useParams } from 'react-router-dom';
+import { Link, useParams } from 'react-router-dom';
+import { useAuth } from '../contexts/AuthContext';
+
+const availabilityLabels = {
+  open_to_work: 'Open to work',
+  freelance: 'Available for freelance',
+  not_looking: 'Not looking',
+};
 
 const UserProfile = () => {
   const { username } = useParams();
+  const { user: currentUser } = useAuth();
   const [user, setUser] = useState(null);
   const [prompts, setPrompts] = useState([]);
   const [projects, setProjects] = useState([]);
   const [loading, setLoading] = useState(true);
   const [error, setError] = useState('');
+  const [contactMessage, setContactMessage] = useState('');
+  const [contactStatus, setContactStatus] = useState(null);
+  const [contactSending, setContactSending] = useState(false);
+
+  const handleContactSubmit = async (e) => {
+    e.preventDefault();
+    setContactSending(true);
+    setContactStatus(null);
+
+    try {
+      const response = await fetch(`/api/users/${username}/contact`, {
+        method: 'POST',
+        headers: {
+          'Content-Type': 'application/json',
+        },
+        body: JSON.stringify({ message: contactMessage }),
+      });
+      const data = await response.json();
+
+      if (!response.ok) {
+        throw new Error(data.error || 'Failed to send message');
+      }
+
+      setContactMessage('');
+      setContactStatus({ success: true, message: 'Message sent. You will see their contact details if they accept.' });
+    } catch (err) {
+      setContactStatus({ success: false, message: err.message });
+    } finally {
+      setContactSending(false);
+    }
+  };
 
   useEffect(() => {
     const fetchData = async () => {
@@ -121,6 +160,28 @@ const UserProfile = () => {
           <h1 className="text-3xl font-bold text-purple-500 mb-2">{user.username}</h1>
           {user.fullname && <p className="text-xl text-gray-200 mb-2">{user.fullname}</p>}
           {user.bio && <p className="text-gray-300 mb-4">{user.bio}</p>}
+
+          {user.availability && (
+            <p className="text-green-400 mb-4">
+              {availabilityLabels[user.availability.status]}
+              {user.availability.hourly_rate != null && ` · ${user.availability.hourly_rate} ${user.availability.rate_currency}/hr`}
+              {user.availability.timezone && ` · ${user.availability.timezone}`}
+            </p>
+          )}
+
+          {user.skills?.length > 0 && (
+            <div className="flex flex-wrap gap-2 mb-4">
+              {user.skills.map(skill => (
+                <span
+                  key={skill.skill_id}
+                  className="bg-gray-700 text-gray-200 text-sm px-3 py-1 rounded-full"
+                  title={`${skill.proficiency}${skill.years ? `, ${skill.years} yr${skill.years === 1 ? '' : 's'}` : ''}`}
+                >
+                  {skill.name}
+                </span>
+              ))}
+            </div>
+          )}
           
           <div className="flex flex-wrap gap-4">
             {user.github_url && (
@@ -148,6 +209,33 @@ const UserProfile = () => {
         </div>
       </div>
 
+      {currentUser && currentUser.username !== user.username && !currentUser.impersonation && (
+        <div className="mb-8">
+          <Link to={`/messages?to=${encodeURIComponent(user.username)}`} className="btn btn-primary">
+            Message {user.username}
+          </Link>
+        </div>
+      )}
+
+      {currentUser && currentUser.username !== user.username && user.availability?.status !== 'not_looking' && (
+        <form onSubmit={handleContactSubmit} className="bg-gray-800 rounded-lg shadow-lg p-6 mb-8">
+          <h2 className="text-xl font-bold text-purple-500 mb-4">Get in touch</h2>
+          <textarea
+            className="form-input w-full mb-4"
+            rows="4"
+            placeholder={`What would you like to talk to ${user.username} about?`}
+            value={contactMessage}
+            onChange={(e) => setContactMessage(e.target.value)}
+          />
+          {contactStatus && (
+            <p className={`mb-4 ${contactStatus.success ? 'text-green-400' : 'text-red-400'}`}>{contactStatus.message}</p>
+          )}
+          <button type="submit" className="btn btn-primary" disabled={contactSending}>
+            {contactSending ? 'Sending...' : 'Send'}
+          </button>
+        </form>
+      )}
+
       
       {/* Projects Section */}
       {projects.length > 0 && (